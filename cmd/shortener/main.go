@@ -4,13 +4,19 @@ import (
 	"context"
 	"fmt"
 	"github.com/go-chi/chi/v5"
+	"github.com/sub3er0/urlShorteningService/internal/admin"
 	"github.com/sub3er0/urlShorteningService/internal/config"
 	"github.com/sub3er0/urlShorteningService/internal/cookie"
 	"github.com/sub3er0/urlShorteningService/internal/gzip"
+	"github.com/sub3er0/urlShorteningService/internal/health"
 	"github.com/sub3er0/urlShorteningService/internal/logger"
+	"github.com/sub3er0/urlShorteningService/internal/metadata"
+	"github.com/sub3er0/urlShorteningService/internal/outbox"
 	"github.com/sub3er0/urlShorteningService/internal/repository"
 	"github.com/sub3er0/urlShorteningService/internal/shortener"
 	"github.com/sub3er0/urlShorteningService/internal/storage"
+	"github.com/sub3er0/urlShorteningService/internal/subnet"
+	"github.com/sub3er0/urlShorteningService/internal/webhook"
 	"go.uber.org/zap"
 	"golang.org/x/crypto/acme/autocert"
 	"log"
@@ -42,47 +48,243 @@ func main() {
 		log.Fatalf("Error while initializing configuration: %v", err)
 	}
 
+	if cfg.Migrate != "" {
+		if err := runMigrations(cfg); err != nil {
+			log.Fatalf("Error while migrating database schema: %v", err)
+		}
+
+		return
+	}
+
 	var dataUrlsStorage storage.URLStorageInterface
 	var dataUsersStorage storage.UserStorageInterface
+	var dataAdminStorage storage.AdminStorageInterface
+	var dataWebhookStorage storage.WebhookStorageInterface
+	var dataHealthStorage storage.HealthStorageInterface
+	var storageCompactor storage.CompactorInterface
+	var outboxRelays []*outbox.Relay
 
-	if cfg.DatabaseDsn != "" {
-		defaultStorage := &storage.DefaultStorage{}
-		defaultStorage.Init(cfg.DatabaseDsn)
-		defer defaultStorage.Close()
+	if dsns := databaseDsns(cfg); len(dsns) > 0 {
+		var pools []storage.DBConnectionInterface
+
+		for _, dsn := range dsns {
+			pool, err := storage.NewPool(context.Background(), dsn, poolConfig(cfg))
+
+			if err != nil {
+				log.Fatalf("Error while initializing db connection: %v", err)
+			}
+
+			defer pool.Close()
+
+			defaultStorage := &storage.DefaultStorage{}
+			defaultStorage.SetConnection(pool)
+
+			if err := defaultStorage.Migrate(context.Background()); err != nil {
+				log.Fatalf("Error while migrating database schema: %v", err)
+			}
+
+			pools = append(pools, pool)
+		}
+
+		pool := pools[0]
+
+		if len(cfg.DatabaseShards) > 0 {
+			shardedStorage := storage.NewShardedStorage(pools)
+
+			if err := shardedStorage.CheckLayout(context.Background()); err != nil {
+				log.Fatalf("Error while checking database shards: %v", err)
+			}
+
+			dataUrlsStorage = shardedStorage
+			dataUsersStorage = shardedStorage
+			dataAdminStorage = shardedStorage
+
+			if cfg.HealthCheck {
+				dataHealthStorage = shardedStorage
+			}
+		} else {
+			urlStorage := &storage.URLStorage{}
+			urlStorage.SetConnection(pool)
+			dataUrlsStorage = urlStorage
+
+			usersStorage := &storage.UsersStorage{}
+			usersStorage.SetConnection(pool)
+			dataUsersStorage = usersStorage
+
+			adminStorage := &storage.AdminStorage{}
+			adminStorage.SetConnection(pool)
+			dataAdminStorage = adminStorage
+
+			if cfg.HealthCheck {
+				healthStorage := &storage.HealthStorage{}
+				healthStorage.SetConnection(pool)
+				dataHealthStorage = healthStorage
+			}
+		}
+
+		webhookStorage := &storage.WebhookStorage{}
+		webhookStorage.SetConnection(pool)
+		dataWebhookStorage = webhookStorage
+
+		if len(cfg.OutboxSinks) > 0 {
+			var sinks []outbox.Sink
+
+			for _, spec := range cfg.OutboxSinks {
+				sink, err := outbox.NewSink(spec)
+
+				if err != nil {
+					log.Fatalf("Error configuring outbox: %v", err)
+				}
+
+				sinks = append(sinks, sink)
+			}
+
+			// События ссылок записываются в outbox базы данных, хранящей ссылку, поэтому события
+			// каждого шарда публикуются отдельно.
+			for _, pool := range pools {
+				outboxStorage := &storage.OutboxStorage{}
+				outboxStorage.SetConnection(pool)
+				outboxRelays = append(outboxRelays, &outbox.Relay{
+					Repository: &repository.OutboxRepository{Storage: outboxStorage, Timeout: cfg.StorageTimeout},
+					Sinks:      sinks,
+				})
+			}
+		}
+	} else if cfg.BoltStoragePath != "" {
+		boltStorage := &storage.BoltStorage{BoltStoragePath: cfg.BoltStoragePath}
 
-		dataUrlsStorage = &storage.URLStorage{}
-		dataUrlsStorage.Init(cfg.DatabaseDsn)
-		defer dataUrlsStorage.Close()
+		if err := boltStorage.Init(""); err != nil {
+			log.Fatalf("Error while opening bolt storage: %v", err)
+		}
 
-		dataUsersStorage = &storage.UsersStorage{}
-		dataUsersStorage.Init(cfg.DatabaseDsn)
-		defer dataUsersStorage.Close()
+		defer boltStorage.Close()
+		dataUrlsStorage = boltStorage
+		dataUsersStorage = boltStorage
+		dataAdminStorage = boltStorage
+		dataWebhookStorage = boltStorage
+		dataHealthStorage = boltStorage
 	} else if cfg.FileStoragePath != "" {
-		dataUrlsStorage = &storage.FileStorage{FileStoragePath: cfg.FileStoragePath}
-		dataUsersStorage = &storage.FileStorage{FileStoragePath: cfg.FileStoragePath}
+		fileStorage := &storage.FileStorage{
+			FileStoragePath: cfg.FileStoragePath,
+			CompactRatio:    cfg.FileStorageCompactRatio,
+			CompactMinSize:  cfg.FileStorageCompactMinSize,
+			SyncPolicy:      cfg.FileStorageSync,
+		}
+
+		if err := fileStorage.Init(""); err != nil {
+			log.Fatalf("Error while loading file storage: %v", err)
+		}
+
+		defer fileStorage.Close()
+		dataUrlsStorage = fileStorage
+		dataUsersStorage = fileStorage
+		dataAdminStorage = fileStorage
+		dataWebhookStorage = fileStorage
+		dataHealthStorage = fileStorage
+		storageCompactor = fileStorage
 	} else {
-		dataUrlsStorage = &storage.InMemoryStorage{Urls: make(map[string]string)}
-		dataUsersStorage = &storage.InMemoryStorage{Urls: make(map[string]string)}
+		inMemoryStorage := &storage.InMemoryStorage{}
+		dataUrlsStorage = inMemoryStorage
+		dataUsersStorage = inMemoryStorage
+		dataAdminStorage = inMemoryStorage
+		dataWebhookStorage = inMemoryStorage
+		dataHealthStorage = inMemoryStorage
 	}
 
 	cookieManager := cookie.CookieManager{
 		Storage: dataUsersStorage,
 	}
 
-	var urlRepository = &repository.URLRepository{Storage: dataUrlsStorage}
-	var userRepository = &repository.UserRepository{Storage: dataUsersStorage}
+	var urlRepository repository.URLRepositoryInterface = &repository.URLRepository{
+		Storage: dataUrlsStorage,
+		Timeout: cfg.StorageTimeout,
+	}
+	var userRepository = &repository.UserRepository{Storage: dataUsersStorage, Timeout: cfg.StorageTimeout}
+	var adminRepository = &repository.AdminRepository{Storage: dataAdminStorage, Timeout: cfg.StorageTimeout}
+	var webhookRepository = &repository.WebhookRepository{Storage: dataWebhookStorage, Timeout: cfg.StorageTimeout}
+
+	if cfg.URLCacheSize > 0 {
+		urlCache := repository.NewCachedURLRepository(
+			urlRepository, cfg.URLCacheSize, cfg.URLCacheTTL, cfg.URLCacheNegativeTTL)
+		urlRepository = urlCache
+		userRepository.URLCache = urlCache
+		adminRepository.URLCache = urlCache
+	}
+
+	webhookDispatcher := &webhook.Dispatcher{Repository: webhookRepository, Client: webhook.NewClient()}
+	dispatcherCtx, stopDispatcher := context.WithCancel(context.Background())
+	defer stopDispatcher()
+	go webhookDispatcher.Run(dispatcherCtx)
+
+	for _, outboxRelay := range outboxRelays {
+		go outboxRelay.Run(dispatcherCtx)
+	}
+
+	if cfg.HealthCheck {
+		healthChecker := &health.Checker{
+			Repository: &repository.HealthRepository{Storage: dataHealthStorage, Timeout: cfg.StorageTimeout},
+			DeadAfter:  cfg.HealthCheckDeadAfter,
+		}
+		go healthChecker.Run(dispatcherCtx)
+	}
+
+	domains, err := shortener.ParseDomains(cfg.Domains)
+
+	if err != nil {
+		log.Fatalf("Error parsing short domains: %v", err)
+	}
+
+	var comingSoonPage []byte
+
+	if cfg.ComingSoonPage != "" {
+		comingSoonPage, err = os.ReadFile(cfg.ComingSoonPage)
+
+		if err != nil {
+			log.Fatalf("Error reading coming soon page: %v", err)
+		}
+	}
 
 	shortenerInstance = &shortener.URLShortener{
 		UserRepository: userRepository,
 		URLRepository:  urlRepository,
 		ServerAddress:  cfg.ServerAddress,
 		BaseURL:        cfg.BaseURL,
+		Domains:        domains,
+		ComingSoonPage: comingSoonPage,
 		CookieManager:  &cookieManager,
-		RemoveChan:     make(chan string),
+		Webhooks:       webhookDispatcher,
+		Metadata:       &metadata.Collector{Fetcher: &metadata.Fetcher{}, Repository: urlRepository},
+		RemoveChan:     make(chan shortener.RemoveRequest),
 	}
 
 	go shortenerInstance.Worker()
 
+	trustedSubnetChecker, err := subnet.NewTrustedSubnetChecker(cfg.TrustedSubnet)
+
+	if err != nil {
+		log.Fatalf("Error parsing trusted subnet: %v", err)
+	}
+
+	adminHandler := &admin.Handler{
+		Repository:    adminRepository,
+		Token:         cfg.AdminToken,
+		Compactor:     storageCompactor,
+		TrustedSubnet: trustedSubnetChecker,
+	}
+
+	userWebhookHandler := &webhook.Handler{
+		Repository: webhookRepository,
+		Owner:      cookieManager.GetRequestUserID,
+	}
+
+	// Вебхуки администратора не принадлежат пользователю и получают события всех ссылок.
+	// Изменения вебхуков администратора записываются в журнал действий администратора.
+	adminWebhookHandler := &webhook.Handler{
+		Repository: webhookRepository,
+		Owner:      func(*http.Request) string { return "" },
+		Audit:      adminHandler.Audit,
+	}
+
 	zapLogger, err := zap.NewDevelopment()
 
 	if err != nil {
@@ -102,9 +304,33 @@ func main() {
 
 		r.With(cookieManager.AuthMiddleware).Get("/api/user/urls", shortenerInstance.GetUserUrls)
 		r.With(cookieManager.AuthMiddleware).Delete("/api/user/urls", shortenerInstance.DeleteUserUrls)
+		r.With(cookieManager.AuthMiddleware).Put("/api/user/urls/{id}/devices", shortenerInstance.UpdateUserURLDevices)
+		r.With(cookieManager.AuthMiddleware).Put(
+			"/api/user/urls/{id}/activation", shortenerInstance.UpdateUserURLActivation)
+
+		r.With(cookieManager.AuthMiddleware).Route("/api/user/webhooks", func(r chi.Router) {
+			r.Get("/", userWebhookHandler.ListWebhooks)
+			r.Post("/", userWebhookHandler.CreateWebhook)
+			r.Delete("/{id}", userWebhookHandler.DeleteWebhook)
+			r.Get("/{id}/deliveries", userWebhookHandler.GetDeliveries)
+		})
 	})
 
 	r.Get("/ping", shortenerInstance.PingHandler)
+	r.With(trustedSubnetChecker.Middleware).Get("/api/internal/stats", shortenerInstance.StatsHandler)
+
+	r.With(adminHandler.Middleware).Route("/api/admin", func(r chi.Router) {
+		r.Get("/urls", adminHandler.ListUrls)
+		r.Post("/urls/{id}/disable", adminHandler.DisableURL)
+		r.Post("/urls/{id}/owner", adminHandler.ReassignURL)
+		r.Post("/users/{id}/ban", adminHandler.BanUser)
+		r.Get("/audit", adminHandler.GetAuditRecords)
+		r.Post("/storage/compact", adminHandler.CompactStorage)
+		r.Get("/webhooks", adminWebhookHandler.ListWebhooks)
+		r.Post("/webhooks", adminWebhookHandler.CreateWebhook)
+		r.Delete("/webhooks/{id}", adminWebhookHandler.DeleteWebhook)
+		r.Get("/webhooks/{id}/deliveries", adminWebhookHandler.GetDeliveries)
+	})
 
 	server := &http.Server{}
 
@@ -156,3 +382,80 @@ func main() {
 
 	fmt.Println("Server Shutdown gracefully")
 }
+
+// poolConfig возвращает параметры пула соединений с базой данных из конфигурации.
+func poolConfig(cfg *config.ConfigData) storage.PoolConfig {
+	return storage.PoolConfig{
+		MaxConns:            cfg.DatabaseMaxConns,
+		MinConns:            cfg.DatabaseMinConns,
+		MaxConnIdleTime:     cfg.DatabaseMaxConnIdleTime,
+		MaxConnLifetime:     cfg.DatabaseMaxConnLifetime,
+		StatementCacheMode:  cfg.DatabaseStatementCacheMode,
+		ConnectRetries:      cfg.DatabaseConnectRetries,
+		ConnectRetryBackoff: cfg.DatabaseConnectRetryBackoff,
+	}
+}
+
+// databaseDsns возвращает строки подключения к базам данных из конфигурации: шарды или единственную базу данных.
+func databaseDsns(cfg *config.ConfigData) []string {
+	if len(cfg.DatabaseShards) > 0 {
+		return cfg.DatabaseShards
+	}
+
+	if cfg.DatabaseDsn != "" {
+		return []string{cfg.DatabaseDsn}
+	}
+
+	return nil
+}
+
+// runMigrations выполняет команду миграции схемы из конфигурации на каждой базе данных: up, down или down:N.
+// Команда проверяется до подключения к базам данных.
+func runMigrations(cfg *config.ConfigData) error {
+	direction, steps, err := config.ParseMigrateCommand(cfg.Migrate)
+
+	if err != nil {
+		return err
+	}
+
+	for _, dsn := range databaseDsns(cfg) {
+		if err = migrateDatabase(dsn, cfg, direction, steps); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// migrateDatabase выполняет миграцию схемы базы данных по строке подключения dsn в направлении direction.
+// При откате отменяется steps последних миграций.
+func migrateDatabase(dsn string, cfg *config.ConfigData, direction string, steps int) error {
+	pool, err := storage.NewPool(context.Background(), dsn, poolConfig(cfg))
+
+	if err != nil {
+		return err
+	}
+
+	defer pool.Close()
+
+	defaultStorage := &storage.DefaultStorage{}
+	defaultStorage.SetConnection(pool)
+
+	if direction == config.MigrateUp {
+		applied, err := defaultStorage.MigrateUp(context.Background())
+
+		if err == nil {
+			fmt.Printf("Applied migrations: %v\n", applied)
+		}
+
+		return err
+	}
+
+	reverted, err := defaultStorage.MigrateDown(context.Background(), steps)
+
+	if err == nil {
+		fmt.Printf("Reverted migrations: %v\n", reverted)
+	}
+
+	return err
+}
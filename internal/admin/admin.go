@@ -0,0 +1,277 @@
+package admin
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sub3er0/urlShorteningService/internal/repository"
+	"github.com/sub3er0/urlShorteningService/internal/storage"
+	"github.com/sub3er0/urlShorteningService/internal/subnet"
+)
+
+// Действия администратора, сохраняемые в журнале.
+const (
+	ActionSearch   = "search"
+	ActionDisable  = "disable_url"
+	ActionReassign = "reassign_url"
+	ActionBan      = "ban_user"
+	ActionCompact  = "compact_storage"
+)
+
+const (
+	defaultLimit = 100
+	maxLimit     = 1000
+)
+
+// Handler обрабатывает запросы административного API модерации.
+// Доступ к API защищён токеном администратора, не связанным с пользовательскими куками.
+type Handler struct {
+	// Repository предоставляет доступ к операциям модерации в хранилище.
+	Repository repository.AdminRepositoryInterface
+
+	// Token содержит токен администратора. Если токен пуст, API недоступно.
+	Token string
+
+	// Compactor сжимает хранилище. Не задан, если хранилище не нуждается в сжатии.
+	Compactor storage.CompactorInterface
+
+	// TrustedSubnet определяет адрес администратора для журнала: заголовок X-Real-IP учитывается
+	// только от прокси из доверенной подсети. Если не задан, в журнал записывается адрес соединения.
+	TrustedSubnet *subnet.TrustedSubnetChecker
+}
+
+// DisableRequestBody представляет тело запроса на блокировку ссылки.
+type DisableRequestBody struct {
+	Reason string `json:"reason"` // Причина блокировки, возвращаемая при переходе по ссылке.
+}
+
+// ReassignRequestBody представляет тело запроса на смену владельца ссылки.
+type ReassignRequestBody struct {
+	UserID string `json:"user_id"` // Идентификатор нового владельца ссылки.
+}
+
+// Middleware проверяет токен администратора в заголовке Authorization.
+// Если токен отсутствует или неверен, возвращает статус 401 Unauthorized.
+func (h *Handler) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+
+		if h.Token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(h.Token)) != 1 {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// ListUrls возвращает ссылки всех пользователей.
+// Поддерживает параметры запроса q, user_id, limit и offset.
+func (h *Handler) ListUrls(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := storage.URLSearchFilter{
+		Query:  query.Get("q"),
+		UserID: query.Get("user_id"),
+		Limit:  defaultLimit,
+	}
+
+	var err error
+
+	if limit := query.Get("limit"); limit != "" {
+		filter.Limit, err = strconv.Atoi(limit)
+
+		if err != nil || filter.Limit <= 0 || filter.Limit > maxLimit {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+	}
+
+	if offset := query.Get("offset"); offset != "" {
+		filter.Offset, err = strconv.Atoi(offset)
+
+		if err != nil || filter.Offset < 0 {
+			http.Error(w, "Invalid offset", http.StatusBadRequest)
+			return
+		}
+	}
+
+	rows, err := h.Repository.SearchUrls(r.Context(), filter)
+
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	h.Audit(r, ActionSearch, filter.UserID, query.Encode())
+
+	if rows == nil {
+		rows = []storage.DataStorageRow{}
+	}
+
+	writeJSON(w, http.StatusOK, rows)
+}
+
+// DisableURL блокирует ссылку. Переход по заблокированной ссылке возвращает 410 Gone с причиной.
+func (h *Handler) DisableURL(w http.ResponseWriter, r *http.Request) {
+	shortURL := r.PathValue("id")
+
+	var requestBody DisableRequestBody
+
+	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil || requestBody.Reason == "" {
+		http.Error(w, "Reason is required", http.StatusBadRequest)
+		return
+	}
+
+	found, err := h.Repository.DisableURL(r.Context(), shortURL, requestBody.Reason)
+
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	if !found {
+		http.Error(w, "NotFound", http.StatusNotFound)
+		return
+	}
+
+	h.Audit(r, ActionDisable, shortURL, requestBody.Reason)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ReassignURL передает ссылку другому пользователю.
+func (h *Handler) ReassignURL(w http.ResponseWriter, r *http.Request) {
+	shortURL := r.PathValue("id")
+
+	var requestBody ReassignRequestBody
+
+	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil || requestBody.UserID == "" {
+		http.Error(w, "User ID is required", http.StatusBadRequest)
+		return
+	}
+
+	found, err := h.Repository.ReassignURL(r.Context(), shortURL, requestBody.UserID)
+
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	if !found {
+		http.Error(w, "NotFound", http.StatusNotFound)
+		return
+	}
+
+	h.Audit(r, ActionReassign, shortURL, requestBody.UserID)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// BanUser блокирует пользователя. Куки заблокированного пользователя перестают приниматься.
+func (h *Handler) BanUser(w http.ResponseWriter, r *http.Request) {
+	userID := r.PathValue("id")
+
+	if err := h.Repository.BanUser(r.Context(), userID); err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	h.Audit(r, ActionBan, userID, "")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetAuditRecords возвращает последние записи журнала действий администратора.
+func (h *Handler) GetAuditRecords(w http.ResponseWriter, r *http.Request) {
+	limit := defaultLimit
+
+	if value := r.URL.Query().Get("limit"); value != "" {
+		var err error
+		limit, err = strconv.Atoi(value)
+
+		if err != nil || limit <= 0 || limit > maxLimit {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+	}
+
+	records, err := h.Repository.GetAuditRecords(r.Context(), limit)
+
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	if records == nil {
+		records = []storage.AuditRecord{}
+	}
+
+	writeJSON(w, http.StatusOK, records)
+}
+
+// CompactStorage сжимает хранилище и возвращает размер файла до и после сжатия.
+// Если хранилище не поддерживает сжатие, возвращает статус 501 Not Implemented.
+func (h *Handler) CompactStorage(w http.ResponseWriter, r *http.Request) {
+	if h.Compactor == nil {
+		http.Error(w, "Storage does not support compaction", http.StatusNotImplemented)
+		return
+	}
+
+	result, err := h.Compactor.Compact(r.Context())
+
+	if err != nil {
+		log.Printf("Error while compacting storage: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	h.Audit(r, ActionCompact, "", fmt.Sprintf("%d -> %d bytes", result.SizeBefore, result.SizeAfter))
+	writeJSON(w, http.StatusOK, result)
+}
+
+// Audit сохраняет запись о действии администратора.
+// Ошибка сохранения записывается в лог и не прерывает обработку запроса.
+// Запись сохраняется и при отключении клиента, так как действие к этому моменту уже выполнено.
+func (h *Handler) Audit(r *http.Request, action string, target string, details string) {
+	actor := r.RemoteAddr
+
+	if h.TrustedSubnet != nil {
+		if ip := h.TrustedSubnet.ClientIP(r); ip != nil {
+			actor = ip.String()
+		}
+	}
+
+	record := storage.AuditRecord{
+		Action:    action,
+		Target:    target,
+		Details:   details,
+		Actor:     actor,
+		CreatedAt: time.Now().UTC(),
+	}
+
+	if err := h.Repository.SaveAuditRecord(context.WithoutCancel(r.Context()), record); err != nil {
+		log.Printf("Error while saving audit record: %v", err)
+	}
+}
+
+// writeJSON сериализует данные и записывает их в ответ с указанным статусом.
+func writeJSON(w http.ResponseWriter, status int, data interface{}) {
+	jsonData, err := json.Marshal(data)
+
+	if err != nil {
+		log.Printf("Serialization fail: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	if _, err = w.Write(jsonData); err != nil {
+		log.Printf("Write data error: %v", err)
+	}
+}
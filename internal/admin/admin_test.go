@@ -0,0 +1,327 @@
+package admin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/sub3er0/urlShorteningService/internal/storage"
+	"github.com/sub3er0/urlShorteningService/internal/subnet"
+)
+
+// MockAdminRepository - мок для AdminRepositoryInterface.
+type MockAdminRepository struct {
+	mock.Mock
+}
+
+// SearchUrls - реализует метод интерфейса AdminRepositoryInterface.
+func (m *MockAdminRepository) SearchUrls(
+	ctx context.Context, filter storage.URLSearchFilter) ([]storage.DataStorageRow, error) {
+	args := m.Called(ctx, filter)
+	return args.Get(0).([]storage.DataStorageRow), args.Error(1)
+}
+
+// DisableURL - реализует метод интерфейса AdminRepositoryInterface.
+func (m *MockAdminRepository) DisableURL(ctx context.Context, shortURL string, reason string) (bool, error) {
+	args := m.Called(ctx, shortURL, reason)
+	return args.Bool(0), args.Error(1)
+}
+
+// ReassignURL - реализует метод интерфейса AdminRepositoryInterface.
+func (m *MockAdminRepository) ReassignURL(ctx context.Context, shortURL string, userID string) (bool, error) {
+	args := m.Called(ctx, shortURL, userID)
+	return args.Bool(0), args.Error(1)
+}
+
+// BanUser - реализует метод интерфейса AdminRepositoryInterface.
+func (m *MockAdminRepository) BanUser(ctx context.Context, userID string) error {
+	args := m.Called(ctx, userID)
+	return args.Error(0)
+}
+
+// SaveAuditRecord - реализует метод интерфейса AdminRepositoryInterface.
+func (m *MockAdminRepository) SaveAuditRecord(ctx context.Context, record storage.AuditRecord) error {
+	args := m.Called(ctx, record)
+	return args.Error(0)
+}
+
+// GetAuditRecords - реализует метод интерфейса AdminRepositoryInterface.
+func (m *MockAdminRepository) GetAuditRecords(ctx context.Context, limit int) ([]storage.AuditRecord, error) {
+	args := m.Called(ctx, limit)
+	return args.Get(0).([]storage.AuditRecord), args.Error(1)
+}
+
+// MockCompactor - мок для CompactorInterface.
+type MockCompactor struct {
+	mock.Mock
+}
+
+// Compact - реализует метод интерфейса CompactorInterface.
+func (m *MockCompactor) Compact(ctx context.Context) (storage.CompactionResult, error) {
+	args := m.Called(ctx)
+	return args.Get(0).(storage.CompactionResult), args.Error(1)
+}
+
+func auditRecordWith(action string, target string) interface{} {
+	return mock.MatchedBy(func(record storage.AuditRecord) bool {
+		return record.Action == action && record.Target == target
+	})
+}
+
+func TestMiddleware(t *testing.T) {
+	handler := &Handler{Token: "secret"}
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	tests := []struct {
+		name       string
+		token      string
+		header     string
+		wantStatus int
+	}{
+		{name: "valid token", token: "secret", header: "Bearer secret", wantStatus: http.StatusOK},
+		{name: "invalid token", token: "secret", header: "Bearer wrong", wantStatus: http.StatusUnauthorized},
+		{name: "missing token", token: "secret", header: "", wantStatus: http.StatusUnauthorized},
+		{name: "api disabled", token: "", header: "Bearer ", wantStatus: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler.Token = tt.token
+			req := httptest.NewRequest("GET", "/api/admin/urls", nil)
+			req.Header.Set("Authorization", tt.header)
+			w := httptest.NewRecorder()
+
+			handler.Middleware(next).ServeHTTP(w, req)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+		})
+	}
+}
+
+func TestListUrls_Success(t *testing.T) {
+	mockRepo := new(MockAdminRepository)
+	handler := &Handler{Repository: mockRepo}
+
+	expectedFilter := storage.URLSearchFilter{Query: "example", UserID: "user1", Limit: 10, Offset: 5}
+	expectedRows := []storage.DataStorageRow{{ShortURL: "abc", URL: "http://example.com", UserID: "user1"}}
+	mockRepo.On("SearchUrls", mock.Anything, expectedFilter).Return(expectedRows, nil)
+	mockRepo.On("SaveAuditRecord", mock.Anything, auditRecordWith(ActionSearch, "user1")).Return(nil)
+
+	req := httptest.NewRequest("GET", "/api/admin/urls?q=example&user_id=user1&limit=10&offset=5", nil)
+	w := httptest.NewRecorder()
+
+	handler.ListUrls(w, req)
+
+	res := w.Result()
+	defer res.Body.Close()
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+
+	var rows []storage.DataStorageRow
+	assert.NoError(t, json.NewDecoder(res.Body).Decode(&rows))
+	assert.Equal(t, expectedRows, rows)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestListUrls_InvalidLimit(t *testing.T) {
+	handler := &Handler{Repository: new(MockAdminRepository)}
+
+	req := httptest.NewRequest("GET", "/api/admin/urls?limit=abc", nil)
+	w := httptest.NewRecorder()
+
+	handler.ListUrls(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestDisableURL_Success(t *testing.T) {
+	mockRepo := new(MockAdminRepository)
+	handler := &Handler{Repository: mockRepo}
+
+	mockRepo.On("DisableURL", mock.Anything, "abc", "phishing").Return(true, nil)
+	mockRepo.On("SaveAuditRecord", mock.Anything, auditRecordWith(ActionDisable, "abc")).Return(nil)
+
+	req := httptest.NewRequest("POST", "/api/admin/urls/abc/disable", bytes.NewBufferString(`{"reason":"phishing"}`))
+	req.SetPathValue("id", "abc")
+	w := httptest.NewRecorder()
+
+	handler.DisableURL(w, req)
+
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestDisableURL_NotFound(t *testing.T) {
+	mockRepo := new(MockAdminRepository)
+	handler := &Handler{Repository: mockRepo}
+
+	mockRepo.On("DisableURL", mock.Anything, "abc", "phishing").Return(false, nil)
+
+	req := httptest.NewRequest("POST", "/api/admin/urls/abc/disable", bytes.NewBufferString(`{"reason":"phishing"}`))
+	req.SetPathValue("id", "abc")
+	w := httptest.NewRecorder()
+
+	handler.DisableURL(w, req)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	mockRepo.AssertNotCalled(t, "SaveAuditRecord", mock.Anything)
+}
+
+func TestDisableURL_MissingReason(t *testing.T) {
+	handler := &Handler{Repository: new(MockAdminRepository)}
+
+	req := httptest.NewRequest("POST", "/api/admin/urls/abc/disable", bytes.NewBufferString(`{}`))
+	req.SetPathValue("id", "abc")
+	w := httptest.NewRecorder()
+
+	handler.DisableURL(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestReassignURL_Success(t *testing.T) {
+	mockRepo := new(MockAdminRepository)
+	handler := &Handler{Repository: mockRepo}
+
+	mockRepo.On("ReassignURL", mock.Anything, "abc", "user2").Return(true, nil)
+	mockRepo.On("SaveAuditRecord", mock.Anything, auditRecordWith(ActionReassign, "abc")).Return(nil)
+
+	req := httptest.NewRequest("POST", "/api/admin/urls/abc/owner", bytes.NewBufferString(`{"user_id":"user2"}`))
+	req.SetPathValue("id", "abc")
+	w := httptest.NewRecorder()
+
+	handler.ReassignURL(w, req)
+
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestBanUser_Success(t *testing.T) {
+	mockRepo := new(MockAdminRepository)
+	handler := &Handler{Repository: mockRepo}
+
+	mockRepo.On("BanUser", mock.Anything, "user1").Return(nil)
+	mockRepo.On("SaveAuditRecord", mock.Anything, auditRecordWith(ActionBan, "user1")).Return(errors.New("audit error"))
+
+	req := httptest.NewRequest("POST", "/api/admin/users/user1/ban", nil)
+	req.SetPathValue("id", "user1")
+	w := httptest.NewRecorder()
+
+	handler.BanUser(w, req)
+
+	// Ошибка записи в журнал не отменяет выполненное действие
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestAudit_Actor(t *testing.T) {
+	trustedSubnet, err := subnet.NewTrustedSubnetChecker("10.0.0.0/8")
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		realIP     string
+		expected   string
+	}{
+		{name: "Forged header from untrusted client", remoteAddr: "203.0.113.5:4000", realIP: "10.0.0.1",
+			expected: "203.0.113.5"},
+		{name: "Header from trusted proxy", remoteAddr: "10.0.0.2:4000", realIP: "198.51.100.7",
+			expected: "198.51.100.7"},
+		{name: "No header", remoteAddr: "10.0.0.2:4000", expected: "10.0.0.2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo := new(MockAdminRepository)
+			handler := &Handler{Repository: mockRepo, TrustedSubnet: trustedSubnet}
+
+			mockRepo.On("SaveAuditRecord", mock.Anything, mock.MatchedBy(func(record storage.AuditRecord) bool {
+				return record.Actor == tt.expected
+			})).Return(nil)
+
+			req := httptest.NewRequest("POST", "/api/admin/users/user1/ban", nil)
+			req.RemoteAddr = tt.remoteAddr
+
+			if tt.realIP != "" {
+				req.Header.Set("X-Real-IP", tt.realIP)
+			}
+
+			handler.Audit(req, ActionBan, "user1", "")
+
+			mockRepo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestBanUser_StorageError(t *testing.T) {
+	mockRepo := new(MockAdminRepository)
+	handler := &Handler{Repository: mockRepo}
+
+	mockRepo.On("BanUser", mock.Anything, "user1").Return(errors.New("db error"))
+
+	req := httptest.NewRequest("POST", "/api/admin/users/user1/ban", nil)
+	req.SetPathValue("id", "user1")
+	w := httptest.NewRecorder()
+
+	handler.BanUser(w, req)
+
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+}
+
+func TestGetAuditRecords_Success(t *testing.T) {
+	mockRepo := new(MockAdminRepository)
+	handler := &Handler{Repository: mockRepo}
+
+	expectedRecords := []storage.AuditRecord{{ID: 1, Action: ActionBan, Target: "user1"}}
+	mockRepo.On("GetAuditRecords", mock.Anything, 20).Return(expectedRecords, nil)
+
+	req := httptest.NewRequest("GET", "/api/admin/audit?limit=20", nil)
+	w := httptest.NewRecorder()
+
+	handler.GetAuditRecords(w, req)
+
+	res := w.Result()
+	defer res.Body.Close()
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+
+	var records []storage.AuditRecord
+	assert.NoError(t, json.NewDecoder(res.Body).Decode(&records))
+	assert.Equal(t, expectedRecords, records)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestCompactStorage_Success(t *testing.T) {
+	mockRepo := new(MockAdminRepository)
+	mockCompactor := new(MockCompactor)
+	handler := &Handler{Repository: mockRepo, Compactor: mockCompactor}
+
+	mockCompactor.On("Compact", mock.Anything).Return(storage.CompactionResult{SizeBefore: 200, SizeAfter: 50}, nil)
+	mockRepo.On("SaveAuditRecord", mock.Anything, auditRecordWith(ActionCompact, "")).Return(nil)
+
+	w := httptest.NewRecorder()
+	handler.CompactStorage(w, httptest.NewRequest("POST", "/api/admin/storage/compact", nil))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var result storage.CompactionResult
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+	assert.Equal(t, int64(50), result.SizeAfter)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestCompactStorage_NotSupported(t *testing.T) {
+	handler := &Handler{Repository: new(MockAdminRepository)}
+
+	w := httptest.NewRecorder()
+	handler.CompactStorage(w, httptest.NewRequest("POST", "/api/admin/storage/compact", nil))
+
+	assert.Equal(t, http.StatusNotImplemented, w.Code)
+}
@@ -2,10 +2,15 @@ package config
 
 import (
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
 	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
 )
 
 // ConfigData представляет конфигурацию приложения.
@@ -20,13 +25,180 @@ type ConfigData struct {
 	// FileStoragePath задает путь к файлу, где могут храниться данные.
 	FileStoragePath string `json:"file_storage_path"`
 
+	// FileStorageCompactRatio задает долю устаревших записей файла хранилища, при которой он сжимается.
+	// Нулевое значение соответствует значению по умолчанию, отрицательное отключает автоматическое сжатие.
+	FileStorageCompactRatio float64 `json:"file_storage_compact_ratio"`
+
+	// FileStorageCompactMinSize задает минимальный размер файла хранилища в байтах для автоматического сжатия.
+	FileStorageCompactMinSize int64 `json:"file_storage_compact_min_size"`
+
+	// FileStorageSync задает политику сброса записей файла хранилища на диск: always, interval или never.
+	FileStorageSync string `json:"file_storage_sync"`
+
+	// BoltStoragePath задает путь к файлу встроенного хранилища bbolt.
+	// Используется вместо файла FileStoragePath, если база данных не задана.
+	BoltStoragePath string `json:"bolt_storage_path"`
+
 	// DatabaseDsn представляет строку подключения к базе данных.
 	DatabaseDsn string `json:"database_dsn"`
 
+	// DatabaseShards задает строки подключения к шардам базы данных. Если они заданы, ссылки и пользователи
+	// распределяются по шардам, а DatabaseDsn не используется. Первый шард также хранит вебхуки
+	// и журнал действий администратора. Новые шарды добавляются только в конец списка.
+	DatabaseShards []string `json:"database_shards"`
+
+	// StorageTimeout ограничивает время каждой операции хранилища. Нулевое значение не ограничивает его.
+	StorageTimeout time.Duration `json:"storage_timeout"`
+
+	// DatabaseMaxConns задает максимальное количество соединений пула базы данных.
+	// Нулевое значение оставляет значение из строки подключения или значение по умолчанию.
+	DatabaseMaxConns int32 `json:"database_max_conns"`
+
+	// DatabaseMinConns задает количество соединений пула, поддерживаемых открытыми.
+	DatabaseMinConns int32 `json:"database_min_conns"`
+
+	// DatabaseMaxConnIdleTime задает время, после которого простаивающее соединение пула закрывается.
+	DatabaseMaxConnIdleTime time.Duration `json:"database_max_conn_idle_time"`
+
+	// DatabaseMaxConnLifetime задает время, после которого соединение пула пересоздается.
+	DatabaseMaxConnLifetime time.Duration `json:"database_max_conn_lifetime"`
+
+	// DatabaseStatementCacheMode задает режим кеша подготовленных выражений: prepare, describe или none.
+	// Режим describe или none нужен при работе через PgBouncer в режиме транзакций.
+	DatabaseStatementCacheMode string `json:"database_statement_cache_mode"`
+
+	// DatabaseConnectRetries задает количество повторных попыток подключения к базе данных при старте.
+	DatabaseConnectRetries int `json:"database_connect_retries"`
+
+	// DatabaseConnectRetryBackoff задает паузу перед первой повторной попыткой подключения,
+	// удваиваемую с каждой следующей попыткой.
+	DatabaseConnectRetryBackoff time.Duration `json:"database_connect_retry_backoff"`
+
+	// URLCacheSize задает количество коротких URL в кеше переходов. Нулевое значение отключает кеш.
+	URLCacheSize int `json:"url_cache_size"`
+
+	// URLCacheTTL задает время жизни ссылки в кеше переходов. Нулевое значение соответствует значению по умолчанию.
+	URLCacheTTL time.Duration `json:"url_cache_ttl"`
+
+	// URLCacheNegativeTTL задает время, в течение которого кеш помнит об отсутствии ссылки.
+	// Нулевое значение соответствует значению по умолчанию.
+	URLCacheNegativeTTL time.Duration `json:"url_cache_negative_ttl"`
+
+	// Migrate задает команду миграции схемы базы данных, после выполнения которой сервис завершает работу:
+	// up применяет все миграции, down откатывает последнюю, down:N — N последних.
+	Migrate string `json:"-"`
+
 	// EnableHTTPS включает https
 	EnableHTTPS bool `json:"enable_https"`
+
+	// TrustedSubnet задает доверенную подсеть в нотации CIDR для доступа к внутренним эндпоинтам.
+	// Заголовок X-Real-IP учитывается только от прокси из этой подсети, который должен перезаписывать его.
+	TrustedSubnet string `json:"trusted_subnet"`
+
+	// AdminToken задает токен доступа к административному API. Пустое значение отключает API.
+	AdminToken string `json:"admin_token"`
+
+	// Domains задает базовые адреса дополнительных коротких доменов.
+	Domains []string `json:"domains"`
+
+	// ComingSoonPage задает путь к HTML-странице, отдаваемой по ссылкам до времени их активации.
+	ComingSoonPage string `json:"coming_soon_page"`
+
+	// OutboxSinks задает получателей событий outbox: "log", "file:<путь>" или адрес http(s).
+	// Используется только при хранении данных в базе данных.
+	OutboxSinks []string `json:"outbox_sinks"`
+
+	// HealthCheck включает периодическую проверку доступности адресов перехода ссылок.
+	HealthCheck bool `json:"health_check"`
+
+	// HealthCheckDeadAfter задает количество неудачных проверок подряд,
+	// после которого ссылка помечается недоступной. Нулевое значение отключает пометку.
+	HealthCheckDeadAfter int `json:"health_check_dead_after"`
+}
+
+// errInvalidDuration возвращается, если длительность в файле конфигурации задана некорректно.
+var errInvalidDuration = errors.New("must be a non-negative duration")
+
+// UnmarshalJSON читает конфигурацию из JSON. Длительности задаются строками в формате time.ParseDuration,
+// например "30s" или "1h30m", как и в переменных окружения.
+func (cfg *ConfigData) UnmarshalJSON(data []byte) error {
+	type plainConfig ConfigData
+
+	durations := struct {
+		*plainConfig
+		StorageTimeout              *string `json:"storage_timeout"`
+		DatabaseMaxConnIdleTime     *string `json:"database_max_conn_idle_time"`
+		DatabaseMaxConnLifetime     *string `json:"database_max_conn_lifetime"`
+		DatabaseConnectRetryBackoff *string `json:"database_connect_retry_backoff"`
+		URLCacheTTL                 *string `json:"url_cache_ttl"`
+		URLCacheNegativeTTL         *string `json:"url_cache_negative_ttl"`
+	}{plainConfig: (*plainConfig)(cfg)}
+
+	if err := json.Unmarshal(data, &durations); err != nil {
+		return err
+	}
+
+	fields := []struct {
+		name  string
+		value *string
+		field *time.Duration
+	}{
+		{"storage_timeout", durations.StorageTimeout, &cfg.StorageTimeout},
+		{"database_max_conn_idle_time", durations.DatabaseMaxConnIdleTime, &cfg.DatabaseMaxConnIdleTime},
+		{"database_max_conn_lifetime", durations.DatabaseMaxConnLifetime, &cfg.DatabaseMaxConnLifetime},
+		{"database_connect_retry_backoff", durations.DatabaseConnectRetryBackoff, &cfg.DatabaseConnectRetryBackoff},
+		{"url_cache_ttl", durations.URLCacheTTL, &cfg.URLCacheTTL},
+		{"url_cache_negative_ttl", durations.URLCacheNegativeTTL, &cfg.URLCacheNegativeTTL},
+	}
+
+	for _, field := range fields {
+		if field.value == nil {
+			continue
+		}
+
+		value, err := time.ParseDuration(*field.value)
+
+		if err != nil || value < 0 {
+			return fmt.Errorf("%s %w", field.name, errInvalidDuration)
+		}
+
+		*field.field = value
+	}
+
+	return nil
 }
 
+// Направления миграции схемы базы данных.
+const (
+	MigrateUp   = "up"
+	MigrateDown = "down"
+)
+
+// migrateSteps описывает допустимое количество откатываемых миграций в команде down:N.
+var migrateSteps = regexp.MustCompile(`^[1-9][0-9]*$`)
+
+// ParseMigrateCommand разбирает команду миграции схемы базы данных: up, down или down:N.
+// Возвращает направление и количество откатываемых миграций: ноль для up, одну для down и N для down:N.
+func ParseMigrateCommand(command string) (string, int, error) {
+	direction, value, found := strings.Cut(command, ":")
+
+	switch {
+	case direction == MigrateUp && !found:
+		return MigrateUp, 0, nil
+	case direction == MigrateDown && !found:
+		return MigrateDown, 1, nil
+	case direction == MigrateDown && migrateSteps.MatchString(value):
+		if steps, err := strconv.Atoi(value); err == nil {
+			return MigrateDown, steps, nil
+		}
+	}
+
+	return "", 0, fmt.Errorf("migrate must be up, down or down:N, got %q", command)
+}
+
+// statementCacheModes описывает допустимые режимы кеша подготовленных выражений.
+var statementCacheModes = regexp.MustCompile(`^(prepare|describe|none)$`)
+
 // isParsed отслеживает, выполнена ли обработка аргументов командной строки.
 var isParsed bool
 
@@ -53,7 +225,14 @@ func (cs *Configuration) InitConfig() (*ConfigData, error) {
 	}
 	defer file.Close()
 
-	if err := json.NewDecoder(file).Decode(cfg); err != nil {
+	err = json.NewDecoder(file).Decode(cfg)
+
+	// Некорректная длительность не заменяется значением по умолчанию, как и в переменных окружения.
+	if errors.Is(err, errInvalidDuration) {
+		return nil, err
+	}
+
+	if err != nil {
 		log.Printf("Warning: Error decoding config file: %v. Using default configuration.\n", err)
 	}
 
@@ -65,7 +244,9 @@ func (cs *Configuration) InitConfig() (*ConfigData, error) {
 			&cfg.DatabaseDsn,
 			"d", "",
 			"Строка подключения к базе данных")
+		flag.StringVar(&cfg.Migrate, "migrate", "", "Выполнить миграцию схемы базы данных и завершить работу: up, down или down:N")
 		flag.BoolVar(&cfg.EnableHTTPS, "s", false, "Enable HTTPS")
+		flag.StringVar(&cfg.TrustedSubnet, "t", cfg.TrustedSubnet, "Доверенная подсеть в нотации CIDR")
 
 		flag.Parse()
 		isParsed = true
@@ -83,14 +264,202 @@ func (cs *Configuration) InitConfig() (*ConfigData, error) {
 		cfg.FileStoragePath = FileStoragePath
 	}
 
+	if BoltStoragePath := os.Getenv("BOLT_STORAGE_PATH"); BoltStoragePath != "" {
+		cfg.BoltStoragePath = BoltStoragePath
+	}
+
+	if FileStorageSync := os.Getenv("FILE_STORAGE_SYNC"); FileStorageSync != "" {
+		cfg.FileStorageSync = FileStorageSync
+	}
+
+	if CompactRatio := os.Getenv("FILE_STORAGE_COMPACT_RATIO"); CompactRatio != "" {
+		value, err := strconv.ParseFloat(CompactRatio, 64)
+
+		if err != nil || value > 1 {
+			return nil, fmt.Errorf("FILE_STORAGE_COMPACT_RATIO must be a number not greater than 1")
+		}
+
+		cfg.FileStorageCompactRatio = value
+	}
+
+	if CompactMinSize := os.Getenv("FILE_STORAGE_COMPACT_MIN_SIZE"); CompactMinSize != "" {
+		value, err := strconv.ParseInt(CompactMinSize, 10, 64)
+
+		if err != nil || value < 0 {
+			return nil, fmt.Errorf("FILE_STORAGE_COMPACT_MIN_SIZE must be a non-negative integer")
+		}
+
+		cfg.FileStorageCompactMinSize = value
+	}
+
 	if DatabaseDsn := os.Getenv("DATABASE_DSN"); DatabaseDsn != "" {
 		cfg.DatabaseDsn = DatabaseDsn
 	}
 
+	if DatabaseShards := os.Getenv("DATABASE_SHARDS"); DatabaseShards != "" {
+		cfg.DatabaseShards = strings.Split(DatabaseShards, ",")
+	}
+
+	if StorageTimeout := os.Getenv("STORAGE_TIMEOUT"); StorageTimeout != "" {
+		value, err := time.ParseDuration(StorageTimeout)
+
+		if err != nil || value < 0 {
+			return nil, fmt.Errorf("STORAGE_TIMEOUT must be a non-negative duration")
+		}
+
+		cfg.StorageTimeout = value
+	}
+
+	if MaxConns := os.Getenv("DATABASE_MAX_CONNS"); MaxConns != "" {
+		value, err := strconv.ParseInt(MaxConns, 10, 32)
+
+		if err != nil || value < 0 {
+			return nil, fmt.Errorf("DATABASE_MAX_CONNS must be a non-negative integer")
+		}
+
+		cfg.DatabaseMaxConns = int32(value)
+	}
+
+	if MinConns := os.Getenv("DATABASE_MIN_CONNS"); MinConns != "" {
+		value, err := strconv.ParseInt(MinConns, 10, 32)
+
+		if err != nil || value < 0 {
+			return nil, fmt.Errorf("DATABASE_MIN_CONNS must be a non-negative integer")
+		}
+
+		cfg.DatabaseMinConns = int32(value)
+	}
+
+	if MaxConnIdleTime := os.Getenv("DATABASE_MAX_CONN_IDLE_TIME"); MaxConnIdleTime != "" {
+		value, err := time.ParseDuration(MaxConnIdleTime)
+
+		if err != nil || value < 0 {
+			return nil, fmt.Errorf("DATABASE_MAX_CONN_IDLE_TIME must be a non-negative duration")
+		}
+
+		cfg.DatabaseMaxConnIdleTime = value
+	}
+
+	if MaxConnLifetime := os.Getenv("DATABASE_MAX_CONN_LIFETIME"); MaxConnLifetime != "" {
+		value, err := time.ParseDuration(MaxConnLifetime)
+
+		if err != nil || value < 0 {
+			return nil, fmt.Errorf("DATABASE_MAX_CONN_LIFETIME must be a non-negative duration")
+		}
+
+		cfg.DatabaseMaxConnLifetime = value
+	}
+
+	if StatementCacheMode := os.Getenv("DATABASE_STATEMENT_CACHE_MODE"); StatementCacheMode != "" {
+		cfg.DatabaseStatementCacheMode = StatementCacheMode
+	}
+
+	if ConnectRetries := os.Getenv("DATABASE_CONNECT_RETRIES"); ConnectRetries != "" {
+		value, err := strconv.Atoi(ConnectRetries)
+
+		if err != nil || value < 0 {
+			return nil, fmt.Errorf("DATABASE_CONNECT_RETRIES must be a non-negative integer")
+		}
+
+		cfg.DatabaseConnectRetries = value
+	}
+
+	if ConnectRetryBackoff := os.Getenv("DATABASE_CONNECT_RETRY_BACKOFF"); ConnectRetryBackoff != "" {
+		value, err := time.ParseDuration(ConnectRetryBackoff)
+
+		if err != nil || value < 0 {
+			return nil, fmt.Errorf("DATABASE_CONNECT_RETRY_BACKOFF must be a non-negative duration")
+		}
+
+		cfg.DatabaseConnectRetryBackoff = value
+	}
+
+	if CacheSize := os.Getenv("URL_CACHE_SIZE"); CacheSize != "" {
+		value, err := strconv.Atoi(CacheSize)
+
+		if err != nil || value < 0 {
+			return nil, fmt.Errorf("URL_CACHE_SIZE must be a non-negative integer")
+		}
+
+		cfg.URLCacheSize = value
+	}
+
+	if CacheTTL := os.Getenv("URL_CACHE_TTL"); CacheTTL != "" {
+		value, err := time.ParseDuration(CacheTTL)
+
+		if err != nil || value < 0 {
+			return nil, fmt.Errorf("URL_CACHE_TTL must be a non-negative duration")
+		}
+
+		cfg.URLCacheTTL = value
+	}
+
+	if CacheNegativeTTL := os.Getenv("URL_CACHE_NEGATIVE_TTL"); CacheNegativeTTL != "" {
+		value, err := time.ParseDuration(CacheNegativeTTL)
+
+		if err != nil || value < 0 {
+			return nil, fmt.Errorf("URL_CACHE_NEGATIVE_TTL must be a non-negative duration")
+		}
+
+		cfg.URLCacheNegativeTTL = value
+	}
+
 	if os.Getenv("ENABLE_HTTPS") == "true" {
 		cfg.EnableHTTPS = true
 	}
 
+	if TrustedSubnet := os.Getenv("TRUSTED_SUBNET"); TrustedSubnet != "" {
+		cfg.TrustedSubnet = TrustedSubnet
+	}
+
+	if AdminToken := os.Getenv("ADMIN_TOKEN"); AdminToken != "" {
+		cfg.AdminToken = AdminToken
+	}
+
+	if Domains := os.Getenv("SHORT_DOMAINS"); Domains != "" {
+		cfg.Domains = strings.Split(Domains, ",")
+	}
+
+	if ComingSoonPage := os.Getenv("COMING_SOON_PAGE"); ComingSoonPage != "" {
+		cfg.ComingSoonPage = ComingSoonPage
+	}
+
+	if OutboxSinks := os.Getenv("OUTBOX_SINKS"); OutboxSinks != "" {
+		cfg.OutboxSinks = strings.Split(OutboxSinks, ",")
+	}
+
+	if os.Getenv("HEALTH_CHECK") == "true" {
+		cfg.HealthCheck = true
+	}
+
+	if DeadAfter := os.Getenv("HEALTH_CHECK_DEAD_AFTER"); DeadAfter != "" {
+		value, err := strconv.Atoi(DeadAfter)
+
+		if err != nil || value < 0 {
+			return nil, fmt.Errorf("HEALTH_CHECK_DEAD_AFTER must be a non-negative integer")
+		}
+
+		cfg.HealthCheckDeadAfter = value
+	}
+
+	if cfg.DatabaseStatementCacheMode != "" && !statementCacheModes.MatchString(cfg.DatabaseStatementCacheMode) {
+		return nil, fmt.Errorf("DATABASE_STATEMENT_CACHE_MODE must be prepare, describe or none")
+	}
+
+	if cfg.DatabaseMaxConns > 0 && cfg.DatabaseMinConns > cfg.DatabaseMaxConns {
+		return nil, fmt.Errorf("DATABASE_MIN_CONNS must not exceed DATABASE_MAX_CONNS")
+	}
+
+	if cfg.Migrate != "" {
+		if _, _, err := ParseMigrateCommand(cfg.Migrate); err != nil {
+			return nil, err
+		}
+	}
+
+	if cfg.Migrate != "" && cfg.DatabaseDsn == "" && len(cfg.DatabaseShards) == 0 {
+		return nil, fmt.Errorf("migrate requires a database connection string")
+	}
+
 	if cfg.ServerAddress == "" {
 		return nil, fmt.Errorf("ServerAddress is required")
 	}
@@ -2,7 +2,9 @@ package config
 
 import (
 	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -77,3 +79,319 @@ func TestInitConfig_MissingBaseURL(t *testing.T) {
 	assert.Nil(t, cfg)
 	assert.EqualError(t, err, "BaseURL is required")
 }
+
+func TestInitConfig_TrustedSubnetEnvVar(t *testing.T) {
+	os.Setenv("SERVER_ADDRESS", "env.localhost:8080")
+	os.Setenv("BASE_URL", "http://env.localhost:8080/")
+	os.Setenv("TRUSTED_SUBNET", "192.168.0.0/24")
+
+	defer os.Unsetenv("SERVER_ADDRESS")
+	defer os.Unsetenv("BASE_URL")
+	defer os.Unsetenv("TRUSTED_SUBNET")
+
+	// Act
+	config := Configuration{}
+	cfg, err := config.InitConfig()
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, "192.168.0.0/24", cfg.TrustedSubnet)
+}
+
+func TestInitConfig_DomainsEnvVar(t *testing.T) {
+	os.Setenv("SERVER_ADDRESS", "env.localhost:8080")
+	os.Setenv("BASE_URL", "http://env.localhost:8080/")
+	os.Setenv("SHORT_DOMAINS", "https://go.example.com,https://s.example.org/")
+
+	defer os.Unsetenv("SERVER_ADDRESS")
+	defer os.Unsetenv("BASE_URL")
+	defer os.Unsetenv("SHORT_DOMAINS")
+
+	// Act
+	config := Configuration{}
+	cfg, err := config.InitConfig()
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"https://go.example.com", "https://s.example.org/"}, cfg.Domains)
+}
+
+func TestInitConfig_OutboxSinksEnvVar(t *testing.T) {
+	os.Setenv("SERVER_ADDRESS", "env.localhost:8080")
+	os.Setenv("BASE_URL", "http://env.localhost:8080/")
+	os.Setenv("OUTBOX_SINKS", "log,file:/var/log/outbox.jsonl")
+
+	defer os.Unsetenv("SERVER_ADDRESS")
+	defer os.Unsetenv("BASE_URL")
+	defer os.Unsetenv("OUTBOX_SINKS")
+
+	// Act
+	config := Configuration{}
+	cfg, err := config.InitConfig()
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"log", "file:/var/log/outbox.jsonl"}, cfg.OutboxSinks)
+}
+
+func TestInitConfig_HealthCheckEnvVars(t *testing.T) {
+	os.Setenv("SERVER_ADDRESS", "env.localhost:8080")
+	os.Setenv("BASE_URL", "http://env.localhost:8080/")
+	os.Setenv("HEALTH_CHECK", "true")
+	os.Setenv("HEALTH_CHECK_DEAD_AFTER", "5")
+
+	defer os.Unsetenv("SERVER_ADDRESS")
+	defer os.Unsetenv("BASE_URL")
+	defer os.Unsetenv("HEALTH_CHECK")
+	defer os.Unsetenv("HEALTH_CHECK_DEAD_AFTER")
+
+	// Act
+	config := Configuration{}
+	cfg, err := config.InitConfig()
+
+	// Assert
+	assert.NoError(t, err)
+	assert.True(t, cfg.HealthCheck)
+	assert.Equal(t, 5, cfg.HealthCheckDeadAfter)
+
+	os.Setenv("HEALTH_CHECK_DEAD_AFTER", "never")
+	_, err = config.InitConfig()
+	assert.Error(t, err)
+}
+
+func TestInitConfig_FileStorageEnvVars(t *testing.T) {
+	// Arrange
+	os.Setenv("SERVER_ADDRESS", "env.localhost:8080")
+	os.Setenv("BASE_URL", "http://env.localhost:8080/")
+	os.Setenv("FILE_STORAGE_COMPACT_RATIO", "0.3")
+	os.Setenv("FILE_STORAGE_COMPACT_MIN_SIZE", "4096")
+	os.Setenv("FILE_STORAGE_SYNC", "always")
+
+	defer os.Unsetenv("SERVER_ADDRESS")
+	defer os.Unsetenv("BASE_URL")
+	defer os.Unsetenv("FILE_STORAGE_COMPACT_RATIO")
+	defer os.Unsetenv("FILE_STORAGE_COMPACT_MIN_SIZE")
+	defer os.Unsetenv("FILE_STORAGE_SYNC")
+
+	// Act
+	config := Configuration{}
+	cfg, err := config.InitConfig()
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, 0.3, cfg.FileStorageCompactRatio)
+	assert.Equal(t, int64(4096), cfg.FileStorageCompactMinSize)
+	assert.Equal(t, "always", cfg.FileStorageSync)
+
+	os.Setenv("FILE_STORAGE_COMPACT_RATIO", "2")
+	_, err = config.InitConfig()
+	assert.Error(t, err)
+}
+
+func TestInitConfig_StorageTimeoutEnvVar(t *testing.T) {
+	os.Setenv("SERVER_ADDRESS", "env.localhost:8080")
+	os.Setenv("BASE_URL", "http://env.localhost:8080/")
+	os.Setenv("STORAGE_TIMEOUT", "3s")
+
+	defer os.Unsetenv("SERVER_ADDRESS")
+	defer os.Unsetenv("BASE_URL")
+	defer os.Unsetenv("STORAGE_TIMEOUT")
+
+	// Act
+	config := Configuration{}
+	cfg, err := config.InitConfig()
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, 3*time.Second, cfg.StorageTimeout)
+
+	os.Setenv("STORAGE_TIMEOUT", "-1s")
+	_, err = config.InitConfig()
+	assert.Error(t, err)
+}
+
+func TestInitConfig_DatabasePoolEnvVars(t *testing.T) {
+	os.Setenv("SERVER_ADDRESS", "env.localhost:8080")
+	os.Setenv("BASE_URL", "http://env.localhost:8080/")
+	os.Setenv("DATABASE_MAX_CONNS", "20")
+	os.Setenv("DATABASE_MIN_CONNS", "2")
+	os.Setenv("DATABASE_MAX_CONN_IDLE_TIME", "1m")
+	os.Setenv("DATABASE_MAX_CONN_LIFETIME", "1h")
+	os.Setenv("DATABASE_STATEMENT_CACHE_MODE", "describe")
+	os.Setenv("DATABASE_CONNECT_RETRIES", "5")
+	os.Setenv("DATABASE_CONNECT_RETRY_BACKOFF", "500ms")
+
+	defer os.Unsetenv("SERVER_ADDRESS")
+	defer os.Unsetenv("BASE_URL")
+	defer os.Unsetenv("DATABASE_MAX_CONNS")
+	defer os.Unsetenv("DATABASE_MIN_CONNS")
+	defer os.Unsetenv("DATABASE_MAX_CONN_IDLE_TIME")
+	defer os.Unsetenv("DATABASE_MAX_CONN_LIFETIME")
+	defer os.Unsetenv("DATABASE_STATEMENT_CACHE_MODE")
+	defer os.Unsetenv("DATABASE_CONNECT_RETRIES")
+	defer os.Unsetenv("DATABASE_CONNECT_RETRY_BACKOFF")
+
+	// Act
+	config := Configuration{}
+	cfg, err := config.InitConfig()
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, int32(20), cfg.DatabaseMaxConns)
+	assert.Equal(t, int32(2), cfg.DatabaseMinConns)
+	assert.Equal(t, time.Minute, cfg.DatabaseMaxConnIdleTime)
+	assert.Equal(t, time.Hour, cfg.DatabaseMaxConnLifetime)
+	assert.Equal(t, "describe", cfg.DatabaseStatementCacheMode)
+	assert.Equal(t, 5, cfg.DatabaseConnectRetries)
+	assert.Equal(t, 500*time.Millisecond, cfg.DatabaseConnectRetryBackoff)
+
+	os.Setenv("DATABASE_STATEMENT_CACHE_MODE", "always")
+	_, err = config.InitConfig()
+	assert.Error(t, err)
+
+	os.Setenv("DATABASE_STATEMENT_CACHE_MODE", "none")
+	os.Setenv("DATABASE_MIN_CONNS", "30")
+	_, err = config.InitConfig()
+	assert.Error(t, err)
+}
+
+func TestInitConfig_URLCacheEnvVars(t *testing.T) {
+	os.Setenv("SERVER_ADDRESS", "env.localhost:8080")
+	os.Setenv("BASE_URL", "http://env.localhost:8080/")
+	os.Setenv("URL_CACHE_SIZE", "10000")
+	os.Setenv("URL_CACHE_TTL", "2m")
+	os.Setenv("URL_CACHE_NEGATIVE_TTL", "10s")
+
+	defer os.Unsetenv("SERVER_ADDRESS")
+	defer os.Unsetenv("BASE_URL")
+	defer os.Unsetenv("URL_CACHE_SIZE")
+	defer os.Unsetenv("URL_CACHE_TTL")
+	defer os.Unsetenv("URL_CACHE_NEGATIVE_TTL")
+
+	// Act
+	config := Configuration{}
+	cfg, err := config.InitConfig()
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, 10000, cfg.URLCacheSize)
+	assert.Equal(t, 2*time.Minute, cfg.URLCacheTTL)
+	assert.Equal(t, 10*time.Second, cfg.URLCacheNegativeTTL)
+
+	os.Setenv("URL_CACHE_SIZE", "-1")
+	_, err = config.InitConfig()
+	assert.Error(t, err)
+}
+
+func TestInitConfig_BoltStoragePathEnvVar(t *testing.T) {
+	os.Setenv("SERVER_ADDRESS", "env.localhost:8080")
+	os.Setenv("BASE_URL", "http://env.localhost:8080/")
+	os.Setenv("BOLT_STORAGE_PATH", "/env/path/to/shortener.db")
+
+	defer os.Unsetenv("SERVER_ADDRESS")
+	defer os.Unsetenv("BASE_URL")
+	defer os.Unsetenv("BOLT_STORAGE_PATH")
+
+	// Act
+	config := Configuration{}
+	cfg, err := config.InitConfig()
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, "/env/path/to/shortener.db", cfg.BoltStoragePath)
+}
+
+func TestInitConfig_DatabaseShardsEnvVar(t *testing.T) {
+	os.Setenv("SERVER_ADDRESS", "env.localhost:8080")
+	os.Setenv("BASE_URL", "http://env.localhost:8080/")
+	os.Setenv("DATABASE_SHARDS", "postgres://localhost:5432/shard0,postgres://localhost:5433/shard1")
+
+	defer os.Unsetenv("SERVER_ADDRESS")
+	defer os.Unsetenv("BASE_URL")
+	defer os.Unsetenv("DATABASE_SHARDS")
+
+	// Act
+	config := Configuration{}
+	cfg, err := config.InitConfig()
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"postgres://localhost:5432/shard0", "postgres://localhost:5433/shard1"}, cfg.DatabaseShards)
+}
+
+func TestInitConfig_DurationsFromFile(t *testing.T) {
+	configFile := filepath.Join(t.TempDir(), "config.json")
+	assert.NoError(t, os.WriteFile(configFile, []byte(`{
+		"server_address": "file.localhost:8080",
+		"base_url": "http://file.localhost:8080/",
+		"database_max_conns": 20,
+		"storage_timeout": "3s",
+		"database_max_conn_idle_time": "1m",
+		"database_max_conn_lifetime": "1h30m",
+		"database_connect_retry_backoff": "500ms",
+		"url_cache_ttl": "2m",
+		"url_cache_negative_ttl": "10s"
+	}`), 0644))
+
+	os.Setenv("CONFIG", configFile)
+	defer os.Unsetenv("CONFIG")
+
+	// Act
+	config := Configuration{}
+	cfg, err := config.InitConfig()
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, "file.localhost:8080", cfg.ServerAddress)
+	assert.Equal(t, int32(20), cfg.DatabaseMaxConns)
+	assert.Equal(t, 3*time.Second, cfg.StorageTimeout)
+	assert.Equal(t, time.Minute, cfg.DatabaseMaxConnIdleTime)
+	assert.Equal(t, 90*time.Minute, cfg.DatabaseMaxConnLifetime)
+	assert.Equal(t, 500*time.Millisecond, cfg.DatabaseConnectRetryBackoff)
+	assert.Equal(t, 2*time.Minute, cfg.URLCacheTTL)
+	assert.Equal(t, 10*time.Second, cfg.URLCacheNegativeTTL)
+
+	invalidConfigs := []string{
+		`{"database_max_conn_lifetime": "-1s"}`, `{"storage_timeout": "soon"}`, `{"url_cache_ttl": "-1s"}`,
+	}
+
+	for _, invalid := range invalidConfigs {
+		assert.NoError(t, os.WriteFile(configFile, []byte(invalid), 0644))
+		_, err = config.InitConfig()
+		assert.Error(t, err, "Invalid duration %s should be rejected", invalid)
+	}
+}
+
+func TestParseMigrateCommand(t *testing.T) {
+	tests := []struct {
+		command   string
+		direction string
+		steps     int
+		wantErr   bool
+	}{
+		{command: "up", direction: MigrateUp},
+		{command: "down", direction: MigrateDown, steps: 1},
+		{command: "down:3", direction: MigrateDown, steps: 3},
+		{command: "down:0", wantErr: true},
+		{command: "down:-1", wantErr: true},
+		{command: "down:+2", wantErr: true},
+		{command: "down:99999999999999999999", wantErr: true},
+		{command: "up:2", wantErr: true},
+		{command: "sideways", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.command, func(t *testing.T) {
+			direction, steps, err := ParseMigrateCommand(tt.command)
+
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.direction, direction)
+			assert.Equal(t, tt.steps, steps)
+		})
+	}
+}
@@ -6,6 +6,7 @@ import (
 
 // AuthMiddleware оборачивает HTTP-обработчик для проверки аутентификации пользователя.
 // Этот мидлвар проверяет наличие куки с именем user_info и ее валидность.
+// Заблокированным администратором пользователям возвращается статус 403 Forbidden.
 func (cm *CookieManager) AuthMiddleware(h http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		cookie, err := r.Cookie(cookieName)
@@ -15,13 +16,19 @@ func (cm *CookieManager) AuthMiddleware(h http.Handler) http.Handler {
 		}
 
 		userID, _ := getUserIDFromCookie(cookie.Value)
-		isUserExist := cm.Storage.IsUserExist(userID)
+
+		if cm.Storage.IsUserBanned(r.Context(), userID) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+
+		isUserExist := cm.Storage.IsUserExist(r.Context(), userID)
 
 		if !isUserExist {
 			http.Error(w, "Unauthorized", http.StatusUnauthorized)
 			return
 		}
 
-		h.ServeHTTP(w, r)
+		h.ServeHTTP(w, withUserID(r, userID))
 	})
 }
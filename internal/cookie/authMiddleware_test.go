@@ -6,6 +6,7 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
 )
 
 func TestAuthMiddleware_MissingCookie(t *testing.T) {
@@ -67,7 +68,8 @@ func TestAuthMiddleware_UserNotExists(t *testing.T) {
 	w := httptest.NewRecorder()
 
 	// Устанавливаем ожидание для метода IsUserExist
-	mockStorage.On("IsUserExist", "userID").Return(false) // Пользователь не существует
+	mockStorage.On("IsUserBanned", mock.Anything, "userID").Return(false)
+	mockStorage.On("IsUserExist", mock.Anything, "userID").Return(false) // Пользователь не существует
 
 	// Act
 	handler := cm.AuthMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -98,7 +100,8 @@ func TestAuthMiddleware_Success(t *testing.T) {
 	w := httptest.NewRecorder()
 
 	// Устанавливаем ожидание для метода IsUserExist
-	mockStorage.On("IsUserExist", "userID").Return(true) // Пользователь существует
+	mockStorage.On("IsUserBanned", mock.Anything, "userID").Return(false)
+	mockStorage.On("IsUserExist", mock.Anything, "userID").Return(true) // Пользователь существует
 
 	// Act
 	handler := cm.AuthMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -116,3 +119,28 @@ func TestAuthMiddleware_Success(t *testing.T) {
 	// Проверка ожиданий
 	mockStorage.AssertExpectations(t)
 }
+
+func TestAuthMiddleware_BannedUser(t *testing.T) {
+	mockStorage := new(MockUserStorage)
+	cm := &CookieManager{
+		Storage: mockStorage,
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.AddCookie(&http.Cookie{Name: cookieName, Value: "userID." + signCookie("userID")})
+	w := httptest.NewRecorder()
+
+	mockStorage.On("IsUserBanned", mock.Anything, "userID").Return(true) // Пользователь заблокирован
+
+	handler := cm.AuthMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	handler.ServeHTTP(w, req)
+
+	res := w.Result()
+	defer res.Body.Close()
+
+	assert.Equal(t, http.StatusForbidden, res.StatusCode) // Ожидаем статус 403 Forbidden
+	mockStorage.AssertExpectations(t)
+}
@@ -1,6 +1,7 @@
 package cookie
 
 import (
+	"context"
 	"crypto/hmac"
 	"crypto/rand"
 	"crypto/sha256"
@@ -36,14 +37,35 @@ type CookieManagerInterface interface {
 
 	// GetActualCookieValue возвращает значение актуальной куки для текущего пользователя.
 	GetActualCookieValue() string
+
+	// GetRequestUserID возвращает идентификатор пользователя, выполняющего запрос.
+	GetRequestUserID(r *http.Request) string
 }
 
+// userIDKey является ключом идентификатора пользователя в контексте запроса.
+type userIDKey struct{}
+
 // GetActualCookieValue возвращает значение актуальной куки для текущего пользователя.
 // Возвращает строку, представляющую актуальное значение куки.
 func (cm *CookieManager) GetActualCookieValue() string {
 	return cm.ActualCookieValue
 }
 
+// GetRequestUserID возвращает идентификатор пользователя, сохранённый в контексте запроса
+// обработчиками CookieHandler и AuthMiddleware. В отличие от ActualCookieValue, значение
+// не перезаписывается параллельными запросами других пользователей.
+// Для запросов, не прошедших через эти обработчики, возвращается пустая строка.
+func (cm *CookieManager) GetRequestUserID(r *http.Request) string {
+	userID, _ := r.Context().Value(userIDKey{}).(string)
+
+	return userID
+}
+
+// withUserID возвращает копию запроса с идентификатором пользователя в контексте.
+func withUserID(r *http.Request, userID string) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), userIDKey{}, userID))
+}
+
 var (
 	secretKey  = []byte("secret_key")
 	cookieName = "user_info"
@@ -91,6 +113,7 @@ func generateUserID() string {
 }
 
 // CookieHandler оборачивает HTTP-обработчик, добавляя логику работы с куками.
+// Запросы заблокированных пользователей отклоняются со статусом 403 Forbidden.
 func (cm *CookieManager) CookieHandler(h http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		cookie, err := r.Cookie(cookieName)
@@ -101,7 +124,13 @@ func (cm *CookieManager) CookieHandler(h http.Handler) http.Handler {
 			createNewCookie = true
 		} else {
 			userID, _ = getUserIDFromCookie(cookie.Value)
-			isUserExist := cm.Storage.IsUserExist(userID)
+
+			if cm.Storage.IsUserBanned(r.Context(), userID) {
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+
+			isUserExist := cm.Storage.IsUserExist(r.Context(), userID)
 
 			if isUserExist {
 				createNewCookie = false
@@ -113,7 +142,7 @@ func (cm *CookieManager) CookieHandler(h http.Handler) http.Handler {
 		if createNewCookie {
 			userID = generateUserID()
 			newCookieValue := userID + "." + signCookie(userID)
-			cm.Storage.SaveUser(userID)
+			cm.Storage.SaveUser(r.Context(), userID)
 			http.SetCookie(w, &http.Cookie{
 				Name:     cookieName,
 				Value:    newCookieValue,
@@ -125,6 +154,6 @@ func (cm *CookieManager) CookieHandler(h http.Handler) http.Handler {
 		}
 
 		cm.ActualCookieValue = userID
-		h.ServeHTTP(w, r)
+		h.ServeHTTP(w, withUserID(r, userID))
 	})
 }
@@ -1,9 +1,11 @@
 package cookie
 
 import (
+	"context"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/sub3er0/urlShorteningService/internal/storage"
 
@@ -17,29 +19,55 @@ type MockUserStorage struct {
 }
 
 // IsUserExist - реализует метод интерфейса UserStorageInterface
-func (m *MockUserStorage) IsUserExist(uniqueID string) bool {
-	args := m.Called(uniqueID)
+func (m *MockUserStorage) IsUserExist(ctx context.Context, uniqueID string) bool {
+	args := m.Called(ctx, uniqueID)
 	return args.Bool(0)
 }
 
 // SaveUser - реализует метод интерфейса UserStorageInterface
-func (m *MockUserStorage) SaveUser(uniqueID string) error {
-	args := m.Called(uniqueID)
+func (m *MockUserStorage) SaveUser(ctx context.Context, uniqueID string) error {
+	args := m.Called(ctx, uniqueID)
 	return args.Error(0)
 }
 
 // GetUserUrls - реализует метод интерфейса UserStorageInterface
-func (m *MockUserStorage) GetUserUrls(uniqueID string) ([]storage.UserUrlsResponseBodyItem, error) {
-	args := m.Called(uniqueID)
+func (m *MockUserStorage) GetUserUrls(ctx context.Context, uniqueID string) ([]storage.UserUrlsResponseBodyItem, error) {
+	args := m.Called(ctx, uniqueID)
 	return args.Get(0).([]storage.UserUrlsResponseBodyItem), args.Error(1)
 }
 
 // DeleteUserUrls - реализует метод интерфейса UserStorageInterface
-func (m *MockUserStorage) DeleteUserUrls(uniqueID string, shortURLs []string) error {
-	args := m.Called(uniqueID, shortURLs)
+func (m *MockUserStorage) DeleteUserUrls(ctx context.Context, uniqueID string, shortURLs []string) error {
+	args := m.Called(ctx, uniqueID, shortURLs)
 	return args.Error(0)
 }
 
+// UpdateUserURLDevices - реализует метод интерфейса UserStorageInterface
+func (m *MockUserStorage) UpdateUserURLDevices(ctx context.Context,
+	uniqueID string, shortURL string, deviceURLs storage.DeviceURLs) (bool, error) {
+	args := m.Called(ctx, uniqueID, shortURL, deviceURLs)
+	return args.Bool(0), args.Error(1)
+}
+
+// UpdateUserURLActivation - реализует метод интерфейса UserStorageInterface
+func (m *MockUserStorage) UpdateUserURLActivation(ctx context.Context,
+	uniqueID string, shortURL string, activeFrom *time.Time) (bool, error) {
+	args := m.Called(ctx, uniqueID, shortURL, activeFrom)
+	return args.Bool(0), args.Error(1)
+}
+
+// GetUsersCount - реализует метод интерфейса UserStorageInterface
+func (m *MockUserStorage) GetUsersCount(ctx context.Context) int {
+	args := m.Called(ctx)
+	return args.Int(0)
+}
+
+// IsUserBanned - реализует метод интерфейса UserStorageInterface
+func (m *MockUserStorage) IsUserBanned(ctx context.Context, uniqueID string) bool {
+	args := m.Called(ctx, uniqueID)
+	return args.Bool(0)
+}
+
 // Init - реализует метод интерфейса UserStorageInterface
 func (m *MockUserStorage) Init(connectionString string) error {
 	args := m.Called(connectionString)
@@ -77,7 +105,7 @@ func TestCookieHandler_NewUserCreated(t *testing.T) {
 	recorder := httptest.NewRecorder()
 
 	// Установка ожиданий для методов хранилища
-	mockStorage.On("SaveUser", mock.Anything).Return(nil)
+	mockStorage.On("SaveUser", mock.Anything, mock.Anything).Return(nil)
 
 	// Act
 	handler := cm.CookieHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -107,7 +135,8 @@ func TestCookieHandler_ExistingUser(t *testing.T) {
 	recorder := httptest.NewRecorder()
 
 	// Установка ожиданий для методов хранилища
-	mockStorage.On("IsUserExist", "someUserID").Return(true)
+	mockStorage.On("IsUserBanned", mock.Anything, "someUserID").Return(false)
+	mockStorage.On("IsUserExist", mock.Anything, "someUserID").Return(true)
 
 	// Act
 	handler := cm.CookieHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -124,6 +153,34 @@ func TestCookieHandler_ExistingUser(t *testing.T) {
 	mockStorage.AssertExpectations(t)
 }
 
+func TestCookieHandler_RequestUserID(t *testing.T) {
+	mockStorage := new(MockUserStorage)
+	cm := &CookieManager{
+		Storage: mockStorage,
+	}
+
+	mockStorage.On("IsUserBanned", mock.Anything, mock.Anything).Return(false)
+	mockStorage.On("IsUserExist", mock.Anything, mock.Anything).Return(true)
+
+	var requestUserID string
+	handler := cm.CookieHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Запрос другого пользователя перезаписывает актуальную куку до завершения обработки.
+		other := httptest.NewRequest("GET", "/", nil)
+		other.AddCookie(&http.Cookie{Name: "user_info", Value: "otherUserID." + signCookie("otherUserID")})
+		cm.CookieHandler(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})).
+			ServeHTTP(httptest.NewRecorder(), other)
+
+		requestUserID = cm.GetRequestUserID(r)
+	}))
+
+	request := httptest.NewRequest("GET", "/", nil)
+	request.AddCookie(&http.Cookie{Name: "user_info", Value: "someUserID." + signCookie("someUserID")})
+	handler.ServeHTTP(httptest.NewRecorder(), request)
+
+	assert.Equal(t, "someUserID", requestUserID)
+	assert.Equal(t, "otherUserID", cm.GetActualCookieValue())
+}
+
 func TestCookieHandler_InvalidCookie(t *testing.T) {
 	// Arrange
 	mockStorage := new(MockUserStorage)
@@ -131,7 +188,7 @@ func TestCookieHandler_InvalidCookie(t *testing.T) {
 		Storage: mockStorage,
 	}
 
-	mockStorage.On("SaveUser", mock.Anything).Return(nil)
+	mockStorage.On("SaveUser", mock.Anything, mock.Anything).Return(nil)
 
 	request := httptest.NewRequest("GET", "/", nil) // Запрос без куки
 	recorder := httptest.NewRecorder()
@@ -150,3 +207,30 @@ func TestCookieHandler_InvalidCookie(t *testing.T) {
 	// Проверка, что метод SaveUser был вызван для нового пользователя
 	mockStorage.AssertExpectations(t)
 }
+
+func TestCookieHandler_BannedUser(t *testing.T) {
+	mockStorage := new(MockUserStorage)
+	cm := &CookieManager{
+		Storage: mockStorage,
+	}
+
+	cookieValue := "bannedUserID." + signCookie("bannedUserID")
+	request := httptest.NewRequest("GET", "/", nil)
+	request.AddCookie(&http.Cookie{Name: "user_info", Value: cookieValue})
+	recorder := httptest.NewRecorder()
+
+	mockStorage.On("IsUserBanned", mock.Anything, "bannedUserID").Return(true)
+
+	handler := cm.CookieHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	handler.ServeHTTP(recorder, request)
+
+	res := recorder.Result()
+	defer res.Body.Close()
+	assert.Equal(t, http.StatusForbidden, res.StatusCode)
+
+	// Новая кука не выдается, пользователь не сохраняется
+	mockStorage.AssertNotCalled(t, "SaveUser", mock.Anything)
+	assert.Empty(t, res.Cookies())
+}
@@ -0,0 +1,260 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/sub3er0/urlShorteningService/internal/repository"
+	"github.com/sub3er0/urlShorteningService/internal/storage"
+)
+
+const (
+	defaultInterval    = time.Hour
+	defaultTimeout     = 10 * time.Second
+	defaultConcurrency = 8
+	defaultHostDelay   = time.Second
+	maxResponseSize    = 64 << 10
+	userAgent          = "urlShorteningService-health-checker"
+)
+
+// errUnsupportedURL указывает, что адрес перехода не является адресом http или https.
+var errUnsupportedURL = errors.New("unsupported destination url")
+
+// Checker периодически проверяет доступность адресов перехода ссылок.
+// Ссылки одного хоста проверяются последовательно с паузой HostDelay,
+// разные хосты проверяются параллельно, но не более Concurrency одновременно.
+type Checker struct {
+	// Repository предоставляет доступ к ссылкам и результатам проверок.
+	Repository repository.HealthRepositoryInterface
+
+	// Client выполняет запросы проверки. Если не задан, используется клиент с таймаутом Timeout.
+	Client *http.Client
+
+	// Interval задает период между полными проверками.
+	Interval time.Duration
+
+	// Timeout задает время ожидания ответа на один запрос.
+	Timeout time.Duration
+
+	// Concurrency задает количество хостов, проверяемых одновременно.
+	Concurrency int
+
+	// HostDelay задает паузу между запросами к одному хосту.
+	HostDelay time.Duration
+
+	// DeadAfter задает количество неудачных проверок подряд, после которого ссылка помечается недоступной.
+	// Нулевое значение отключает пометку.
+	DeadAfter int
+}
+
+// Run выполняет проверки с периодом Interval до отмены контекста.
+func (c *Checker) Run(ctx context.Context) {
+	interval := c.Interval
+
+	if interval <= 0 {
+		interval = defaultInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		c.CheckAll(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// CheckAll проверяет все активные ссылки и сохраняет результаты.
+// Возвращает количество проверенных ссылок.
+func (c *Checker) CheckAll(ctx context.Context) int {
+	targets, err := c.Repository.GetHealthTargets(ctx)
+
+	if err != nil {
+		log.Printf("Error while loading health check targets: %v", err)
+		return 0
+	}
+
+	hosts := groupByHost(targets)
+	semaphore := make(chan struct{}, c.concurrency())
+	checked := make(chan int, len(hosts))
+	var wg sync.WaitGroup
+
+	for _, hostTargets := range hosts {
+		wg.Add(1)
+
+		go func(hostTargets []storage.HealthTarget) {
+			defer wg.Done()
+
+			select {
+			case semaphore <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+
+			defer func() { <-semaphore }()
+			checked <- c.checkHost(ctx, hostTargets)
+		}(hostTargets)
+	}
+
+	wg.Wait()
+	close(checked)
+
+	total := 0
+
+	for count := range checked {
+		total += count
+	}
+
+	return total
+}
+
+// checkHost последовательно проверяет ссылки одного хоста с паузой между запросами.
+// Возвращает количество проверенных ссылок.
+func (c *Checker) checkHost(ctx context.Context, targets []storage.HealthTarget) int {
+	hostDelay := c.HostDelay
+
+	if hostDelay <= 0 {
+		hostDelay = defaultHostDelay
+	}
+
+	for i, target := range targets {
+		if i > 0 {
+			select {
+			case <-ctx.Done():
+				return i
+			case <-time.After(hostDelay):
+			}
+		}
+
+		health := c.Check(ctx, target)
+
+		if err := c.Repository.SaveLinkHealth(ctx, target.ShortURL, health); err != nil {
+			log.Printf("Error while saving health check result: %v", err)
+		}
+	}
+
+	return len(targets)
+}
+
+// Check проверяет адрес перехода ссылки и возвращает результат с учётом предыдущих неудачных проверок.
+// Сначала выполняется запрос HEAD, а если сервер его не поддерживает, запрос GET.
+func (c *Checker) Check(ctx context.Context, target storage.HealthTarget) storage.LinkHealth {
+	start := time.Now()
+	status, err := c.request(ctx, http.MethodHead, target.URL)
+
+	if err == nil && (status == http.StatusMethodNotAllowed || status == http.StatusNotImplemented) {
+		start = time.Now()
+		status, err = c.request(ctx, http.MethodGet, target.URL)
+	}
+
+	health := storage.LinkHealth{
+		Status:    status,
+		LatencyMs: time.Since(start).Milliseconds(),
+		CheckedAt: time.Now().UTC(),
+	}
+
+	if err == nil && status >= http.StatusBadRequest {
+		err = fmt.Errorf("unexpected response status %d", status)
+	}
+
+	if err == nil {
+		return health
+	}
+
+	health.Error = err.Error()
+	health.Failures = 1
+
+	if target.Health != nil {
+		health.Failures += target.Health.Failures
+	}
+
+	health.Dead = c.DeadAfter > 0 && health.Failures >= c.DeadAfter
+
+	return health
+}
+
+// request выполняет запрос проверки и возвращает HTTP статус ответа.
+func (c *Checker) request(ctx context.Context, method string, targetURL string) (int, error) {
+	timeout := c.Timeout
+
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	request, err := http.NewRequestWithContext(ctx, method, targetURL, nil)
+
+	if err != nil {
+		return 0, err
+	}
+
+	request.Header.Set("User-Agent", userAgent)
+	client := c.Client
+
+	if client == nil {
+		client = &http.Client{Timeout: timeout}
+	}
+
+	response, err := client.Do(request)
+
+	if err != nil {
+		return 0, err
+	}
+
+	defer response.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(response.Body, maxResponseSize))
+
+	return response.StatusCode, nil
+}
+
+// concurrency возвращает количество хостов, проверяемых одновременно.
+func (c *Checker) concurrency() int {
+	if c.Concurrency <= 0 {
+		return defaultConcurrency
+	}
+
+	return c.Concurrency
+}
+
+// groupByHost группирует ссылки по хосту адреса перехода.
+// Ссылки с адресами, отличными от http и https, пропускаются.
+func groupByHost(targets []storage.HealthTarget) map[string][]storage.HealthTarget {
+	hosts := make(map[string][]storage.HealthTarget)
+
+	for _, target := range targets {
+		host, err := hostOf(target.URL)
+
+		if err != nil {
+			continue
+		}
+
+		hosts[host] = append(hosts[host], target)
+	}
+
+	return hosts
+}
+
+// hostOf возвращает хост адреса http или https.
+func hostOf(rawURL string) (string, error) {
+	u, err := url.Parse(rawURL)
+
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", errUnsupportedURL
+	}
+
+	return u.Hostname(), nil
+}
@@ -0,0 +1,128 @@
+package health
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/sub3er0/urlShorteningService/internal/repository"
+	"github.com/sub3er0/urlShorteningService/internal/storage"
+)
+
+func TestChecker_Check(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/ok":
+			w.WriteHeader(http.StatusOK)
+		case "/head-not-allowed":
+			if r.Method == http.MethodHead {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+
+			w.WriteHeader(http.StatusOK)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	checker := &Checker{DeadAfter: 3}
+	ctx := context.Background()
+
+	health := checker.Check(ctx, storage.HealthTarget{URL: server.URL + "/ok"})
+	assert.Equal(t, http.StatusOK, health.Status)
+	assert.Empty(t, health.Error)
+	assert.Zero(t, health.Failures)
+	assert.False(t, health.CheckedAt.IsZero())
+
+	health = checker.Check(ctx, storage.HealthTarget{URL: server.URL + "/head-not-allowed"})
+	assert.Equal(t, http.StatusOK, health.Status, "GET should be used when HEAD is not allowed")
+
+	health = checker.Check(ctx, storage.HealthTarget{
+		URL:    server.URL + "/missing",
+		Health: &storage.LinkHealth{Failures: 1},
+	})
+	assert.Equal(t, http.StatusNotFound, health.Status)
+	assert.Equal(t, 2, health.Failures)
+	assert.False(t, health.Dead)
+
+	health = checker.Check(ctx, storage.HealthTarget{
+		URL:    server.URL + "/missing",
+		Health: &storage.LinkHealth{Failures: 2},
+	})
+	assert.True(t, health.Dead, "link should be flagged dead after DeadAfter failures")
+}
+
+func TestChecker_CheckTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+	}))
+	defer server.Close()
+
+	checker := &Checker{Timeout: 20 * time.Millisecond}
+	health := checker.Check(context.Background(), storage.HealthTarget{URL: server.URL})
+
+	assert.Zero(t, health.Status)
+	assert.NotEmpty(t, health.Error)
+	assert.Equal(t, 1, health.Failures)
+	assert.False(t, health.Dead, "links should not be flagged dead when DeadAfter is not set")
+}
+
+func TestChecker_CheckAll(t *testing.T) {
+	ctx := context.Background()
+	var mu sync.Mutex
+	active, maxActive := 0, 0
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		active++
+		if active > maxActive {
+			maxActive = active
+		}
+		mu.Unlock()
+
+		time.Sleep(10 * time.Millisecond)
+
+		mu.Lock()
+		active--
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	store := &storage.InMemoryStorage{}
+	_ = store.Set("a", server.URL+"/a")
+	_ = store.Set("b", server.URL+"/b")
+	_ = store.Set("c", server.URL+"/c")
+	_ = store.Set("d", "mailto:user@example.com")
+	_, _ = store.DisableURL(ctx, "c", "spam")
+	checker := &Checker{Repository: &repository.HealthRepository{Storage: store}, HostDelay: time.Millisecond}
+
+	assert.Equal(t, 2, checker.CheckAll(context.Background()))
+	assert.Equal(t, 1, maxActive, "requests to one host should not run concurrently")
+
+	targets, err := store.GetHealthTargets(ctx)
+	require.NoError(t, err)
+	require.Len(t, targets, 3)
+	assert.Equal(t, http.StatusOK, targets[0].Health.Status)
+	assert.Equal(t, http.StatusOK, targets[1].Health.Status)
+	assert.Nil(t, targets[2].Health, "unsupported destinations should be skipped")
+}
+
+func TestGroupByHost(t *testing.T) {
+	hosts := groupByHost([]storage.HealthTarget{
+		{ShortURL: "a", URL: "https://example.com/a"},
+		{ShortURL: "b", URL: "http://example.com:8080/b"},
+		{ShortURL: "c", URL: "https://example.org"},
+		{ShortURL: "d", URL: "ftp://example.com"},
+	})
+
+	assert.Len(t, hosts, 2)
+	assert.Len(t, hosts["example.com"], 2)
+	assert.Len(t, hosts["example.org"], 1)
+}
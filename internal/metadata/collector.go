@@ -0,0 +1,75 @@
+package metadata
+
+import (
+	"context"
+	"log"
+	"sync"
+
+	"github.com/sub3er0/urlShorteningService/internal/repository"
+)
+
+const defaultConcurrency = 4
+
+// CollectorInterface определяет метод фонового получения данных страниц перехода.
+type CollectorInterface interface {
+	// Collect запускает получение и сохранение данных страницы перехода созданной ссылки.
+	Collect(shortKey string, originalURL string)
+}
+
+// Collector получает данные страниц перехода созданных ссылок в фоне и сохраняет их вместе со ссылкой.
+// Одновременно выполняется не более Concurrency запросов.
+type Collector struct {
+	// Fetcher получает данные страниц.
+	Fetcher *Fetcher
+
+	// Repository сохраняет полученные данные.
+	Repository repository.URLRepositoryInterface
+
+	// Concurrency задает количество страниц, получаемых одновременно.
+	Concurrency int
+
+	once      sync.Once
+	semaphore chan struct{}
+	wg        sync.WaitGroup
+}
+
+// Collect запускает получение данных страницы в отдельной горутине.
+// Ошибки получения записываются в лог, ссылка при этом остаётся без данных.
+// Получение продолжается после ответа клиенту, поэтому не зависит от контекста запроса.
+func (c *Collector) Collect(shortKey string, originalURL string) {
+	c.once.Do(func() {
+		concurrency := c.Concurrency
+
+		if concurrency <= 0 {
+			concurrency = defaultConcurrency
+		}
+
+		c.semaphore = make(chan struct{}, concurrency)
+	})
+
+	c.wg.Add(1)
+
+	go func() {
+		defer c.wg.Done()
+
+		c.semaphore <- struct{}{}
+		defer func() { <-c.semaphore }()
+
+		ctx := context.Background()
+		metadata, err := c.Fetcher.Fetch(ctx, originalURL)
+
+		if err != nil {
+			log.Printf("Error while fetching link metadata: %v", err)
+			return
+		}
+
+		if err = c.Repository.SaveLinkMetadata(ctx, shortKey, metadata); err != nil {
+			log.Printf("Error while saving link metadata: %v", err)
+		}
+	}()
+}
+
+// Wait ожидает завершения запущенных получений данных.
+func (c *Collector) Wait() {
+	c.wg.Wait()
+}
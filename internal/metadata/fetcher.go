@@ -0,0 +1,291 @@
+package metadata
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+	"unicode/utf8"
+
+	"github.com/sub3er0/urlShorteningService/internal/storage"
+	"golang.org/x/net/html"
+)
+
+const (
+	defaultTimeout  = 5 * time.Second
+	defaultMaxBytes = 512 << 10
+	maxRedirects    = 5
+	maxValueLength  = 1024
+	userAgent       = "urlShorteningService-metadata-fetcher"
+)
+
+// ErrPrivateAddress указывает, что адрес назначения относится к внутренней сети.
+var ErrPrivateAddress = errors.New("destination resolves to a private address")
+
+// ErrNotHTML указывает, что страница перехода не является HTML документом.
+var ErrNotHTML = errors.New("destination is not an HTML page")
+
+// blockedPrefixes перечисляет диапазоны адресов, не входящие в стандартные проверки net.IP,
+// запросы к которым запрещены.
+var blockedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+}
+
+// Fetcher получает заголовок и Open Graph данные HTML страниц.
+type Fetcher struct {
+	// Client выполняет запросы. Если не задан, используется клиент NewClient,
+	// запрещающий подключения к внутренним адресам.
+	Client *http.Client
+
+	// Timeout задает общее время получения страницы.
+	Timeout time.Duration
+
+	// MaxBytes задает максимальный размер читаемой части страницы.
+	MaxBytes int64
+}
+
+// NewClient создает HTTP клиент, который не подключается к внутренним адресам.
+// Проверяется адрес каждого фактического подключения, в том числе после перенаправлений,
+// поэтому обойти защиту подменой DNS записи после проверки нельзя.
+func NewClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{Timeout: timeout, Control: guardAddress}
+
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			DialContext:           dialer.DialContext,
+			TLSHandshakeTimeout:   timeout,
+			ResponseHeaderTimeout: timeout,
+			MaxIdleConns:          10,
+			IdleConnTimeout:       30 * time.Second,
+		},
+		CheckRedirect: func(request *http.Request, via []*http.Request) error {
+			if len(via) >= maxRedirects {
+				return fmt.Errorf("stopped after %d redirects", maxRedirects)
+			}
+
+			if request.URL.Scheme != "http" && request.URL.Scheme != "https" {
+				return fmt.Errorf("unsupported redirect scheme %q", request.URL.Scheme)
+			}
+
+			return nil
+		},
+	}
+}
+
+// Fetch загружает начало страницы и извлекает из неё заголовок и Open Graph данные.
+func (f *Fetcher) Fetch(ctx context.Context, rawURL string) (storage.LinkMetadata, error) {
+	var metadata storage.LinkMetadata
+	timeout := f.Timeout
+
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+
+	if err != nil {
+		return metadata, err
+	}
+
+	if request.URL.Scheme != "http" && request.URL.Scheme != "https" {
+		return metadata, fmt.Errorf("unsupported scheme %q", request.URL.Scheme)
+	}
+
+	request.Header.Set("Accept", "text/html,application/xhtml+xml")
+	request.Header.Set("User-Agent", userAgent)
+	client := f.Client
+
+	if client == nil {
+		client = NewClient(timeout)
+	}
+
+	response, err := client.Do(request)
+
+	if err != nil {
+		return metadata, err
+	}
+
+	defer response.Body.Close()
+
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return metadata, fmt.Errorf("unexpected response status %d", response.StatusCode)
+	}
+
+	if !isHTML(response.Header.Get("Content-Type")) {
+		return metadata, ErrNotHTML
+	}
+
+	maxBytes := f.MaxBytes
+
+	if maxBytes <= 0 {
+		maxBytes = defaultMaxBytes
+	}
+
+	metadata = parse(io.LimitReader(response.Body, maxBytes), response.Request.URL)
+	metadata.FetchedAt = time.Now().UTC()
+
+	return metadata, nil
+}
+
+// parse извлекает заголовок и Open Graph данные из заголовка HTML документа.
+// Разбор прекращается на теге body или в конце прочитанных данных.
+func parse(r io.Reader, pageURL *url.URL) storage.LinkMetadata {
+	var metadata storage.LinkMetadata
+	tokenizer := html.NewTokenizer(r)
+	inTitle := false
+
+	for {
+		switch tokenizer.Next() {
+		case html.ErrorToken:
+			return metadata
+		case html.TextToken:
+			if inTitle && metadata.Title == "" {
+				metadata.Title = clean(string(tokenizer.Text()))
+			}
+		case html.EndTagToken:
+			name, _ := tokenizer.TagName()
+
+			if string(name) == "title" {
+				inTitle = false
+			}
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttr := tokenizer.TagName()
+
+			switch string(name) {
+			case "body":
+				return metadata
+			case "title":
+				inTitle = true
+			case "meta":
+				if hasAttr {
+					applyMeta(&metadata, tokenizer, pageURL)
+				}
+			}
+		}
+	}
+}
+
+// applyMeta переносит в metadata значение тега meta с Open Graph свойством.
+func applyMeta(metadata *storage.LinkMetadata, tokenizer *html.Tokenizer, pageURL *url.URL) {
+	var property, content string
+
+	for {
+		key, value, more := tokenizer.TagAttr()
+
+		switch string(key) {
+		case "property", "name":
+			if property == "" {
+				property = strings.ToLower(string(value))
+			}
+		case "content":
+			content = clean(string(value))
+		}
+
+		if !more {
+			break
+		}
+	}
+
+	switch property {
+	case "og:title":
+		metadata.OGTitle = content
+	case "og:description":
+		metadata.OGDescription = content
+	case "og:image":
+		metadata.OGImage = absoluteURL(content, pageURL)
+	}
+}
+
+// absoluteURL приводит адрес изображения к абсолютному адресу http или https.
+// Возвращает пустую строку для адресов других схем.
+func absoluteURL(rawURL string, pageURL *url.URL) string {
+	imageURL, err := pageURL.Parse(rawURL)
+
+	if err != nil || (imageURL.Scheme != "http" && imageURL.Scheme != "https") {
+		return ""
+	}
+
+	return imageURL.String()
+}
+
+// clean убирает лишние пробелы и ограничивает длину значения.
+func clean(value string) string {
+	value = strings.Join(strings.Fields(value), " ")
+
+	if len(value) <= maxValueLength {
+		return value
+	}
+
+	value = value[:maxValueLength]
+
+	for !utf8.ValidString(value) {
+		value = value[:len(value)-1]
+	}
+
+	return value
+}
+
+// isHTML проверяет, указывает ли заголовок Content-Type на HTML документ.
+// Страницы без заголовка считаются HTML.
+func isHTML(contentType string) bool {
+	if contentType == "" {
+		return true
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+
+	return err == nil && (mediaType == "text/html" || mediaType == "application/xhtml+xml")
+}
+
+// guardAddress запрещает подключение к внутренним адресам.
+// Вызывается для каждого подключения после разрешения имени хоста.
+func guardAddress(network string, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+
+	if err != nil {
+		return err
+	}
+
+	ip, err := netip.ParseAddr(host)
+
+	if err != nil || IsPrivate(ip) {
+		return ErrPrivateAddress
+	}
+
+	return nil
+}
+
+// IsPrivate проверяет, относится ли адрес к внутренним, служебным или зарезервированным диапазонам.
+func IsPrivate(ip netip.Addr) bool {
+	ip = ip.Unmap()
+
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return true
+	}
+
+	for _, prefix := range blockedPrefixes {
+		if prefix.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
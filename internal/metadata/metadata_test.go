@@ -0,0 +1,141 @@
+package metadata
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/sub3er0/urlShorteningService/internal/repository"
+	"github.com/sub3er0/urlShorteningService/internal/storage"
+)
+
+const testPage = `<!DOCTYPE html>
+<html><head>
+	<title>
+		Example   Domain
+	</title>
+	<meta property="og:title" content="Example OG title">
+	<meta name="og:description" content="Example description">
+	<meta property="og:image" content="/images/preview.png" />
+</head>
+<body><meta property="og:title" content="ignored"></body></html>`
+
+func newTestServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/page":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			_, _ = w.Write([]byte(testPage))
+		case "/redirect":
+			http.Redirect(w, r, "/page", http.StatusFound)
+		case "/large":
+			w.Header().Set("Content-Type", "text/html")
+			_, _ = w.Write([]byte("<html><head>" + strings.Repeat("<!-- padding -->", 1000) +
+				"<title>Too far</title></head></html>"))
+		case "/image":
+			w.Header().Set("Content-Type", "image/png")
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func TestFetcher_Fetch(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+
+	fetcher := &Fetcher{Client: server.Client()}
+
+	metadata, err := fetcher.Fetch(context.Background(), server.URL+"/redirect")
+	require.NoError(t, err)
+	assert.Equal(t, "Example Domain", metadata.Title)
+	assert.Equal(t, "Example OG title", metadata.OGTitle, "meta tags from body should be ignored")
+	assert.Equal(t, "Example description", metadata.OGDescription)
+	assert.Equal(t, server.URL+"/images/preview.png", metadata.OGImage, "image should be resolved against the final URL")
+	assert.False(t, metadata.FetchedAt.IsZero())
+
+	_, err = fetcher.Fetch(context.Background(), server.URL+"/image")
+	assert.ErrorIs(t, err, ErrNotHTML)
+
+	_, err = fetcher.Fetch(context.Background(), server.URL+"/missing")
+	assert.Error(t, err)
+
+	_, err = fetcher.Fetch(context.Background(), "ftp://example.com/file")
+	assert.Error(t, err)
+}
+
+func TestFetcher_FetchSizeLimit(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+
+	fetcher := &Fetcher{Client: server.Client(), MaxBytes: 1024}
+
+	metadata, err := fetcher.Fetch(context.Background(), server.URL+"/large")
+	require.NoError(t, err)
+	assert.Empty(t, metadata.Title, "data beyond the size limit should not be read")
+}
+
+func TestFetcher_FetchBlocksPrivateAddresses(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+
+	fetcher := &Fetcher{}
+
+	_, err := fetcher.Fetch(context.Background(), server.URL+"/page")
+	assert.ErrorIs(t, err, ErrPrivateAddress)
+}
+
+func TestIsPrivate(t *testing.T) {
+	tests := []struct {
+		ip      string
+		private bool
+	}{
+		{ip: "127.0.0.1", private: true},
+		{ip: "10.1.2.3", private: true},
+		{ip: "172.16.0.1", private: true},
+		{ip: "192.168.1.1", private: true},
+		{ip: "169.254.169.254", private: true},
+		{ip: "100.64.0.1", private: true},
+		{ip: "0.0.0.0", private: true},
+		{ip: "::1", private: true},
+		{ip: "fd00::1", private: true},
+		{ip: "::ffff:127.0.0.1", private: true},
+		{ip: "93.184.216.34", private: false},
+		{ip: "2606:2800:220:1:248:1893:25c8:1946", private: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ip, func(t *testing.T) {
+			assert.Equal(t, tt.private, IsPrivate(netip.MustParseAddr(tt.ip)))
+		})
+	}
+}
+
+func TestCollector_Collect(t *testing.T) {
+	ctx := context.Background()
+	server := newTestServer()
+	defer server.Close()
+
+	store := &storage.InMemoryStorage{}
+	_ = store.Save(ctx, storage.DataStorageRow{ShortURL: "abc", URL: server.URL + "/page", UserID: "user1"})
+	_ = store.Save(ctx, storage.DataStorageRow{ShortURL: "xyz", URL: server.URL + "/missing", UserID: "user1"})
+	collector := &Collector{
+		Fetcher:    &Fetcher{Client: server.Client()},
+		Repository: &repository.URLRepository{Storage: store},
+	}
+
+	collector.Collect("abc", server.URL+"/page")
+	collector.Collect("xyz", server.URL+"/missing")
+	collector.Wait()
+
+	urls, err := store.GetUserUrls(ctx, "user1")
+	require.NoError(t, err)
+	require.Len(t, urls, 2)
+	assert.Equal(t, "Example Domain", urls[0].Metadata.Title)
+	assert.Nil(t, urls[1].Metadata, "failed fetches should not be stored")
+}
@@ -0,0 +1,407 @@
+package migrate
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/sub3er0/urlShorteningService/internal/storage"
+)
+
+// DefaultBatchSize задаёт количество ссылок, переносимых за одну запись в целевое хранилище.
+const DefaultBatchSize = 500
+
+const fileBackendPrefix = "file:"
+
+const boltBackendPrefix = "bolt:"
+
+const shardsBackendPrefix = "shards:"
+
+// Backend объединяет хранилища ссылок и пользователей одного бэкенда.
+type Backend struct {
+	URLs  storage.URLStorageInterface // Хранилище ссылок
+	Links storage.LinkExportInterface // Запись перенесённых ссылок без событий их создания
+	Users storage.UserExportInterface // Хранилище пользователей
+	Spec  string                      // Описание, по которому открыт бэкенд
+	close func()                      // Закрывает соединения бэкенда
+}
+
+// Close освобождает ресурсы бэкенда.
+func (b *Backend) Close() {
+	if b.close != nil {
+		b.close()
+	}
+}
+
+// OpenBackend открывает бэкенд по описанию: "file:<путь>", "bolt:<путь>", адрес postgres(ql)://
+// или "shards:<адрес>,<адрес>" для шардированного хранилища.
+// Для базы данных схема создаётся, если её ещё нет.
+func OpenBackend(spec string) (*Backend, error) {
+	backend, err := openBackend(strings.TrimSpace(spec))
+
+	if err != nil {
+		return nil, err
+	}
+
+	backend.Spec = strings.TrimSpace(spec)
+
+	return backend, nil
+}
+
+// openBackend открывает бэкенд по описанию без пробелов по краям.
+func openBackend(spec string) (*Backend, error) {
+	switch {
+	case strings.HasPrefix(spec, fileBackendPrefix) && len(spec) > len(fileBackendPrefix):
+		fileStorage := &storage.FileStorage{FileStoragePath: strings.TrimPrefix(spec, fileBackendPrefix)}
+
+		if err := fileStorage.Init(""); err != nil {
+			return nil, err
+		}
+
+		return &Backend{URLs: fileStorage, Links: fileStorage, Users: fileStorage, close: fileStorage.Close}, nil
+	case strings.HasPrefix(spec, boltBackendPrefix) && len(spec) > len(boltBackendPrefix):
+		boltStorage := &storage.BoltStorage{BoltStoragePath: strings.TrimPrefix(spec, boltBackendPrefix)}
+
+		if err := boltStorage.Init(""); err != nil {
+			return nil, err
+		}
+
+		return &Backend{URLs: boltStorage, Links: boltStorage, Users: boltStorage, close: boltStorage.Close}, nil
+	case strings.HasPrefix(spec, shardsBackendPrefix) && len(spec) > len(shardsBackendPrefix):
+		shardedStorage, err := openShards(spec)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if err = shardedStorage.CheckLayout(context.Background()); err != nil {
+			shardedStorage.Close()
+			return nil, err
+		}
+
+		return &Backend{
+			URLs: shardedStorage, Links: shardedStorage, Users: shardedStorage, close: shardedStorage.Close,
+		}, nil
+	case strings.HasPrefix(spec, "postgres://") || strings.HasPrefix(spec, "postgresql://"):
+		pool, err := openDatabase(spec)
+
+		if err != nil {
+			return nil, err
+		}
+
+		urlStorage := &storage.URLStorage{}
+		urlStorage.SetConnection(pool)
+
+		usersStorage := &storage.UsersStorage{}
+		usersStorage.SetConnection(pool)
+
+		return &Backend{URLs: urlStorage, Links: urlStorage, Users: usersStorage, close: pool.Close}, nil
+	}
+
+	return nil, fmt.Errorf("unsupported storage %q", spec)
+}
+
+// openDatabase подключается к базе данных и создаёт схему, если её ещё нет.
+func openDatabase(dsn string) (storage.DBConnectionInterface, error) {
+	pool, err := storage.NewPool(context.Background(), dsn, storage.PoolConfig{})
+
+	if err != nil {
+		return nil, err
+	}
+
+	defaultStorage := &storage.DefaultStorage{}
+	defaultStorage.SetConnection(pool)
+
+	if err := defaultStorage.Migrate(context.Background()); err != nil {
+		pool.Close()
+		return nil, err
+	}
+
+	return pool, nil
+}
+
+// openShards подключается к базам данных шардов из описания "shards:<адрес>,<адрес>".
+func openShards(spec string) (*storage.ShardedStorage, error) {
+	var pools []storage.DBConnectionInterface
+
+	for _, dsn := range strings.Split(strings.TrimPrefix(strings.TrimSpace(spec), shardsBackendPrefix), ",") {
+		pool, err := openDatabase(dsn)
+
+		if err != nil {
+			closeAll(pools)
+			return nil, err
+		}
+
+		pools = append(pools, pool)
+	}
+
+	return storage.NewShardedStorage(pools), nil
+}
+
+// Rebalance размещает данные шардированного хранилища "shards:<адрес>,<адрес>" для указанного списка шардов.
+// Выполняется при остановленном сервисе после добавления, удаления или перестановки шардов.
+func Rebalance(ctx context.Context, spec string) (storage.RebalanceResult, error) {
+	if !strings.HasPrefix(strings.TrimSpace(spec), shardsBackendPrefix) {
+		return storage.RebalanceResult{}, fmt.Errorf("unsupported sharded storage %q", spec)
+	}
+
+	shardedStorage, err := openShards(spec)
+
+	if err != nil {
+		return storage.RebalanceResult{}, err
+	}
+
+	defer shardedStorage.Close()
+
+	return shardedStorage.Rebalance(ctx)
+}
+
+// closeAll закрывает соединения с базами данных.
+func closeAll(conns []storage.DBConnectionInterface) {
+	for _, conn := range conns {
+		conn.Close()
+	}
+}
+
+// State описывает прогресс переноса, сохраняемый между запусками.
+type State struct {
+	Backends    string `json:"backends"`     // Хеш описаний исходного и целевого хранилищ, для которых сохранён прогресс
+	UsersDone   bool   `json:"users_done"`   // Пользователи уже перенесены
+	URLs        int    `json:"urls"`         // Количество перенесённых ссылок в порядке их создания
+	DetailsDone bool   `json:"details_done"` // Данные страниц перехода и результаты проверки уже перенесены
+}
+
+// Result описывает итог переноса.
+type Result struct {
+	Users   int `json:"users"`   // Количество перенесённых пользователей
+	URLs    int `json:"urls"`    // Количество ссылок, перенесённых в этом запуске
+	Skipped int `json:"skipped"` // Количество ссылок, перенесённых предыдущими запусками
+	Details int `json:"details"` // Количество ссылок, для которых перенесены данные страниц перехода и проверки
+}
+
+// Migrator переносит ссылки и пользователей из одного хранилища в другое.
+// Короткие ссылки, владельцы, признаки удаления, данные страниц перехода и результаты проверки сохраняются.
+// Ссылки записываются без событий создания, поэтому подписчики вебхуков не получают уведомлений
+// о перенесённых ссылках.
+type Migrator struct {
+	Source    *Backend  // Исходное хранилище
+	Target    *Backend  // Целевое хранилище
+	BatchSize int       // Количество ссылок в одной записи, по умолчанию DefaultBatchSize
+	DryRun    bool      // Только подсчитать переносимые данные, ничего не записывая
+	StatePath string    // Файл с прогрессом переноса для продолжения после сбоя; пустой путь отключает его
+	Progress  io.Writer // Получатель сообщений о ходе переноса; nil отключает их
+}
+
+// Run переносит сначала пользователей, затем ссылки пакетами, затем данные страниц перехода
+// и результаты проверки ссылок.
+// После каждого пакета прогресс сохраняется в StatePath, поэтому повторный запуск продолжает перенос
+// с места остановки. Прогресс продолжается только для той же пары хранилищ: если файл прогресса
+// сохранён для других хранилищ, перенос не начинается. После успешного переноса файл прогресса удаляется.
+// Отмена контекста прерывает перенос так же, как ошибка записи.
+func (m *Migrator) Run(ctx context.Context) (Result, error) {
+	var result Result
+
+	state, err := m.loadState()
+
+	if err != nil {
+		return result, err
+	}
+
+	users, err := m.Source.Users.LoadUsers(ctx)
+
+	if err != nil {
+		return result, fmt.Errorf("load users: %w", err)
+	}
+
+	if !state.UsersDone {
+		if !m.DryRun && len(users) > 0 {
+			if err = m.Target.Users.SaveUsers(ctx, users); err != nil {
+				return result, fmt.Errorf("save users: %w", err)
+			}
+		}
+
+		result.Users = len(users)
+		state.UsersDone = true
+
+		if err = m.saveState(state); err != nil {
+			return result, err
+		}
+
+		m.printf("users: %d migrated\n", result.Users)
+	} else {
+		m.printf("users: already migrated\n")
+	}
+
+	rows, err := m.Source.URLs.LoadData(ctx)
+
+	if err != nil {
+		return result, fmt.Errorf("load urls: %w", err)
+	}
+
+	if state.URLs > len(rows) {
+		return result, fmt.Errorf("state %s records %d urls, but source has only %d", m.StatePath, state.URLs, len(rows))
+	}
+
+	result.Skipped = state.URLs
+	batchSize := m.BatchSize
+
+	if batchSize <= 0 {
+		batchSize = DefaultBatchSize
+	}
+
+	for state.URLs < len(rows) {
+		end := state.URLs + batchSize
+
+		if end > len(rows) {
+			end = len(rows)
+		}
+
+		if !m.DryRun {
+			if err = m.Target.Links.ImportBatch(ctx, rows[state.URLs:end]); err != nil {
+				return result, fmt.Errorf("save urls %d-%d: %w", state.URLs+1, end, err)
+			}
+		}
+
+		result.URLs += end - state.URLs
+		state.URLs = end
+
+		if err = m.saveState(state); err != nil {
+			return result, err
+		}
+
+		m.printf("urls: %d/%d (%d%%)\n", state.URLs, len(rows), state.URLs*100/len(rows))
+	}
+
+	if result.Details, err = m.migrateDetails(ctx, &state, batchSize); err != nil {
+		return result, err
+	}
+
+	if m.DryRun {
+		m.printf("dry run: %d users and %d urls would be migrated\n", result.Users, result.URLs)
+		return result, nil
+	}
+
+	if m.StatePath != "" {
+		if err = os.Remove(m.StatePath); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return result, err
+		}
+	}
+
+	m.printf("done: %d users, %d urls, %d link details migrated, %d urls skipped\n",
+		result.Users, result.URLs, result.Details, result.Skipped)
+
+	return result, nil
+}
+
+// migrateDetails переносит данные страниц перехода и результаты проверки ссылок пакетами.
+// Повторная запись тех же данных безопасна, поэтому при сбое они переносятся заново целиком.
+// Возвращает количество ссылок, для которых данные перенесены в этом запуске.
+func (m *Migrator) migrateDetails(ctx context.Context, state *State, batchSize int) (int, error) {
+	if state.DetailsDone {
+		m.printf("link details: already migrated\n")
+		return 0, nil
+	}
+
+	details, err := m.Source.Links.LoadLinkDetails(ctx)
+
+	if err != nil {
+		return 0, fmt.Errorf("load link details: %w", err)
+	}
+
+	for start := 0; start < len(details) && !m.DryRun; start += batchSize {
+		end := start + batchSize
+
+		if end > len(details) {
+			end = len(details)
+		}
+
+		if err = m.Target.Links.SaveLinkDetails(ctx, details[start:end]); err != nil {
+			return 0, fmt.Errorf("save link details %d-%d: %w", start+1, end, err)
+		}
+	}
+
+	state.DetailsDone = true
+
+	if err = m.saveState(*state); err != nil {
+		return 0, err
+	}
+
+	m.printf("link details: %d migrated\n", len(details))
+
+	return len(details), nil
+}
+
+// loadState читает сохранённый прогресс. Отсутствие файла означает перенос с начала.
+// Возвращает ошибку, если прогресс сохранён для другой пары хранилищ.
+func (m *Migrator) loadState() (State, error) {
+	state := State{Backends: m.backendsHash()}
+
+	if m.StatePath == "" {
+		return state, nil
+	}
+
+	data, err := os.ReadFile(m.StatePath)
+
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	}
+
+	if err != nil {
+		return state, err
+	}
+
+	var saved State
+
+	if err = json.Unmarshal(data, &saved); err != nil {
+		return state, fmt.Errorf("read state %s: %w", m.StatePath, err)
+	}
+
+	if saved.Backends != state.Backends {
+		return state, fmt.Errorf(
+			"state %s was saved for another source and target; remove it or pass another -state", m.StatePath)
+	}
+
+	return saved, nil
+}
+
+// backendsHash возвращает хеш описаний исходного и целевого хранилищ.
+// В файле прогресса хранится хеш, чтобы не сохранять пароли из строк подключения.
+func (m *Migrator) backendsHash() string {
+	hash := sha256.Sum256([]byte(m.Source.Spec + "\n" + m.Target.Spec))
+
+	return hex.EncodeToString(hash[:])
+}
+
+// saveState атомарно сохраняет прогресс переноса. В режиме проверки прогресс не сохраняется.
+func (m *Migrator) saveState(state State) error {
+	if m.StatePath == "" || m.DryRun {
+		return nil
+	}
+
+	data, err := json.Marshal(state)
+
+	if err != nil {
+		return err
+	}
+
+	tmpPath := m.StatePath + ".tmp"
+
+	if err = os.WriteFile(tmpPath, data, 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmpPath, m.StatePath)
+}
+
+// printf выводит сообщение о ходе переноса.
+func (m *Migrator) printf(format string, args ...interface{}) {
+	if m.Progress != nil {
+		fmt.Fprintf(m.Progress, format, args...)
+	}
+}
@@ -0,0 +1,217 @@
+package migrate
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/sub3er0/urlShorteningService/internal/storage"
+)
+
+// failingURLStorage возвращает ошибку при переносе пакета с заданным номером
+// и считает записи с событиями создания ссылок.
+type failingURLStorage struct {
+	*storage.InMemoryStorage
+	failOn  int
+	batches int
+	saved   int
+}
+
+func (f *failingURLStorage) ImportBatch(ctx context.Context, dataStorageRows []storage.DataStorageRow) error {
+	f.batches++
+
+	if f.batches == f.failOn {
+		return errors.New("connection lost")
+	}
+
+	return f.InMemoryStorage.ImportBatch(ctx, dataStorageRows)
+}
+
+func (f *failingURLStorage) SaveBatch(ctx context.Context, dataStorageRows []storage.DataStorageRow) error {
+	f.saved++
+
+	return f.InMemoryStorage.SaveBatch(ctx, dataStorageRows)
+}
+
+func newSource(t *testing.T) *Backend {
+	ctx := context.Background()
+	source := &storage.InMemoryStorage{}
+	require.NoError(t, source.SaveUser(ctx, "user1"))
+	require.NoError(t, source.BanUser(ctx, "user2"))
+	require.NoError(t, source.SaveBatch(ctx, []storage.DataStorageRow{
+		{ShortURL: "a", URL: "http://a.example.com", UserID: "user1"},
+		{ShortURL: "b", URL: "http://b.example.com", UserID: "user1"},
+		{ShortURL: "c", URL: "http://c.example.com", UserID: "user2"},
+	}))
+	require.NoError(t, source.DeleteUserUrls(ctx, "user1", []string{"b"}))
+
+	return &Backend{URLs: source, Links: source, Users: source}
+}
+
+func TestMigrator_Run(t *testing.T) {
+	ctx := context.Background()
+	target, err := OpenBackend("file:" + filepath.Join(t.TempDir(), "storage.json"))
+	require.NoError(t, err)
+	defer target.Close()
+
+	statePath := filepath.Join(t.TempDir(), "state")
+	var progress bytes.Buffer
+	migrator := &Migrator{Source: newSource(t), Target: target, BatchSize: 2, StatePath: statePath, Progress: &progress}
+
+	result, err := migrator.Run(ctx)
+
+	require.NoError(t, err)
+	assert.Equal(t, Result{Users: 2, URLs: 3}, result)
+	assert.Contains(t, progress.String(), "urls: 2/3 (66%)")
+	assert.NoFileExists(t, statePath, "State should be removed after a successful migration")
+
+	rows, err := target.URLs.LoadData(ctx)
+	require.NoError(t, err)
+	require.Len(t, rows, 3)
+	assert.Equal(t, "b", rows[1].ShortURL, "Short keys should be preserved")
+	assert.Equal(t, "user1", rows[1].UserID, "Owners should be preserved")
+	assert.True(t, rows[1].DeletedFlag, "Deleted flags should be preserved")
+
+	users, err := target.Users.LoadUsers(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []storage.User{{UserID: "user1"}, {UserID: "user2", Banned: true}}, users)
+}
+
+func TestMigrator_RunLinkDetails(t *testing.T) {
+	ctx := context.Background()
+	source := newSource(t)
+	memory := source.URLs.(*storage.InMemoryStorage)
+	fetchedAt := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	require.NoError(t, memory.SaveLinkMetadata(ctx, "a", storage.LinkMetadata{Title: "A", FetchedAt: fetchedAt}))
+	require.NoError(t, memory.SaveLinkHealth(ctx, "a", storage.LinkHealth{Status: 200, CheckedAt: fetchedAt}))
+	require.NoError(t, memory.SaveLinkHealth(ctx, "c", storage.LinkHealth{Status: 404, Failures: 3, Dead: true,
+		CheckedAt: fetchedAt}))
+
+	expected, err := memory.LoadLinkDetails(ctx)
+	require.NoError(t, err)
+
+	for _, spec := range []string{"file:storage.json", "bolt:shortener.db"} {
+		t.Run(spec, func(t *testing.T) {
+			prefix, name, _ := strings.Cut(spec, ":")
+			target, err := OpenBackend(prefix + ":" + filepath.Join(t.TempDir(), name))
+			require.NoError(t, err)
+			defer target.Close()
+
+			result, err := (&Migrator{Source: source, Target: target, BatchSize: 1}).Run(ctx)
+
+			require.NoError(t, err)
+			assert.Equal(t, 2, result.Details)
+
+			migrated, err := target.Links.LoadLinkDetails(ctx)
+			require.NoError(t, err)
+			assert.Equal(t, expected, migrated, "Link metadata and health should be migrated with the links")
+		})
+	}
+}
+
+func TestMigrator_Resume(t *testing.T) {
+	ctx := context.Background()
+	memory := &storage.InMemoryStorage{}
+	failing := &failingURLStorage{InMemoryStorage: memory, failOn: 2}
+	target := &Backend{URLs: failing, Links: failing, Users: memory}
+	statePath := filepath.Join(t.TempDir(), "state")
+	migrator := &Migrator{Source: newSource(t), Target: target, BatchSize: 2, StatePath: statePath}
+
+	_, err := migrator.Run(ctx)
+
+	require.Error(t, err)
+	data, err := os.ReadFile(statePath)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"backends":"`+migrator.backendsHash()+`","users_done":true,"urls":2,"details_done":false}`,
+		string(data))
+
+	result, err := migrator.Run(ctx)
+
+	require.NoError(t, err)
+	assert.Equal(t, Result{URLs: 1, Skipped: 2}, result)
+	assert.Equal(t, 3, memory.GetURLCount(ctx))
+	assert.Zero(t, failing.saved, "Migrated links should be written without creation events")
+	assert.Equal(t, 2, memory.GetUsersCount(ctx))
+}
+
+func TestMigrator_ResumeOtherBackends(t *testing.T) {
+	ctx := context.Background()
+	memory := &storage.InMemoryStorage{}
+	failing := &failingURLStorage{InMemoryStorage: memory, failOn: 2}
+	statePath := filepath.Join(t.TempDir(), "state")
+	source := newSource(t)
+	source.Spec = "file:old.json"
+	migrator := &Migrator{
+		Source:    source,
+		Target:    &Backend{URLs: failing, Links: failing, Users: memory, Spec: "postgres://db1"},
+		BatchSize: 2,
+		StatePath: statePath,
+	}
+
+	_, err := migrator.Run(ctx)
+	require.Error(t, err)
+
+	other := &storage.InMemoryStorage{}
+	migrator.Target = &Backend{URLs: other, Links: other, Users: other, Spec: "postgres://db2"}
+
+	_, err = migrator.Run(ctx)
+
+	require.ErrorContains(t, err, "another source and target")
+	assert.Equal(t, 0, other.GetURLCount(ctx), "Progress of another target should not be applied")
+	assert.FileExists(t, statePath, "State should be kept for the original target")
+}
+
+func TestMigrator_DryRun(t *testing.T) {
+	ctx := context.Background()
+	memory := &storage.InMemoryStorage{}
+	statePath := filepath.Join(t.TempDir(), "state")
+	var progress bytes.Buffer
+	migrator := &Migrator{
+		Source: newSource(t), Target: &Backend{URLs: memory, Links: memory, Users: memory}, DryRun: true,
+		StatePath: statePath, Progress: &progress,
+	}
+
+	result, err := migrator.Run(ctx)
+
+	require.NoError(t, err)
+	assert.Equal(t, Result{Users: 2, URLs: 3}, result)
+	assert.Contains(t, progress.String(), "dry run: 2 users and 3 urls would be migrated")
+	assert.Equal(t, 0, memory.GetURLCount(ctx), "Dry run should not write urls")
+	assert.Equal(t, 0, memory.GetUsersCount(ctx), "Dry run should not write users")
+	assert.NoFileExists(t, statePath, "Dry run should not write state")
+}
+
+func TestMigrator_RunToBolt(t *testing.T) {
+	ctx := context.Background()
+	target, err := OpenBackend("bolt:" + filepath.Join(t.TempDir(), "shortener.db"))
+	require.NoError(t, err)
+	defer target.Close()
+
+	migrator := &Migrator{Source: newSource(t), Target: target, BatchSize: 2}
+
+	result, err := migrator.Run(ctx)
+
+	require.NoError(t, err)
+	assert.Equal(t, Result{Users: 2, URLs: 3}, result)
+
+	rows, err := target.URLs.LoadData(ctx)
+	require.NoError(t, err)
+	require.Len(t, rows, 3)
+	assert.True(t, rows[1].DeletedFlag, "Deleted flags should be preserved")
+
+	users, err := target.Users.LoadUsers(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []storage.User{{UserID: "user1"}, {UserID: "user2", Banned: true}}, users)
+}
+
+func TestOpenBackend_Unsupported(t *testing.T) {
+	_, err := OpenBackend("mysql://localhost")
+	assert.Error(t, err)
+}
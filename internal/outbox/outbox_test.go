@@ -0,0 +1,137 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/sub3er0/urlShorteningService/internal/storage"
+)
+
+// fakeRepository хранит события в памяти и помечает их отправленными как OutboxStorage.
+type fakeRepository struct {
+	events []storage.OutboxEvent
+}
+
+// ProcessEvents реализует метод интерфейса OutboxRepositoryInterface.
+func (f *fakeRepository) ProcessEvents(
+	ctx context.Context, limit int, publish func(events []storage.OutboxEvent) error) (int, error) {
+	if len(f.events) == 0 {
+		return 0, nil
+	}
+
+	if limit > len(f.events) {
+		limit = len(f.events)
+	}
+
+	if err := publish(f.events[:limit]); err != nil {
+		return 0, err
+	}
+
+	f.events = f.events[limit:]
+
+	return limit, nil
+}
+
+// failingSink всегда возвращает ошибку публикации.
+type failingSink struct{}
+
+// Publish реализует метод интерфейса Sink.
+func (failingSink) Publish([]storage.OutboxEvent) error {
+	return errors.New("sink unavailable")
+}
+
+func testEvents() []storage.OutboxEvent {
+	return []storage.OutboxEvent{
+		{ID: 1, EventType: storage.OutboxLinkCreated, AggregateID: "abc", Payload: json.RawMessage(`{"short_key":"abc"}`)},
+		{ID: 2, EventType: storage.OutboxLinkDeleted, AggregateID: "abc", Payload: json.RawMessage(`{"short_key":"abc"}`)},
+	}
+}
+
+func TestNewSink(t *testing.T) {
+	sink, err := NewSink("log")
+	require.NoError(t, err)
+	assert.IsType(t, &LogSink{}, sink)
+
+	sink, err = NewSink("file:/tmp/outbox.jsonl")
+	require.NoError(t, err)
+	assert.Equal(t, "/tmp/outbox.jsonl", sink.(*FileSink).Path)
+
+	sink, err = NewSink(" https://example.com/events")
+	require.NoError(t, err)
+	assert.Equal(t, "https://example.com/events", sink.(*HTTPSink).URL)
+
+	for _, spec := range []string{"", "file:", "kafka://broker", "example.com"} {
+		_, err = NewSink(spec)
+		assert.Error(t, err, spec)
+	}
+}
+
+func TestFileSink_Publish(t *testing.T) {
+	sink := &FileSink{Path: filepath.Join(t.TempDir(), "outbox.jsonl")}
+
+	require.NoError(t, sink.Publish(testEvents()))
+	require.NoError(t, sink.Publish(testEvents()[:1]))
+
+	data, err := os.ReadFile(sink.Path)
+	require.NoError(t, err)
+
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	require.Len(t, lines, 3)
+
+	var event storage.OutboxEvent
+	require.NoError(t, json.Unmarshal([]byte(lines[1]), &event))
+	assert.Equal(t, int64(2), event.ID)
+	assert.Equal(t, storage.OutboxLinkDeleted, event.EventType)
+}
+
+func TestHTTPSink_Publish(t *testing.T) {
+	var received []storage.OutboxEvent
+	status := http.StatusOK
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewDecoder(r.Body).Decode(&received)
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	sink := &HTTPSink{URL: server.URL}
+
+	require.NoError(t, sink.Publish(testEvents()))
+	assert.Len(t, received, 2)
+
+	status = http.StatusServiceUnavailable
+	assert.Error(t, sink.Publish(testEvents()), "non-2xx response should fail publishing")
+}
+
+func TestRelay_RelayOnce(t *testing.T) {
+	ctx := context.Background()
+	repo := &fakeRepository{events: testEvents()}
+	sink := &FileSink{Path: filepath.Join(t.TempDir(), "outbox.jsonl")}
+	relay := &Relay{Repository: repo, Sinks: []Sink{sink}, BatchSize: 1}
+
+	assert.Equal(t, 1, relay.RelayOnce(ctx))
+	assert.Equal(t, 1, relay.RelayOnce(ctx))
+	assert.Equal(t, 0, relay.RelayOnce(ctx))
+
+	data, err := os.ReadFile(sink.Path)
+	require.NoError(t, err)
+	assert.Equal(t, 2, strings.Count(string(data), "\n"))
+}
+
+func TestRelay_RelayOnceSinkError(t *testing.T) {
+	ctx := context.Background()
+	repo := &fakeRepository{events: testEvents()}
+	relay := &Relay{Repository: repo, Sinks: []Sink{&LogSink{}, failingSink{}}}
+
+	assert.Equal(t, 0, relay.RelayOnce(ctx))
+	assert.Len(t, repo.events, 2, "events should stay unsent when any sink fails")
+}
@@ -0,0 +1,93 @@
+package outbox
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/sub3er0/urlShorteningService/internal/repository"
+	"github.com/sub3er0/urlShorteningService/internal/storage"
+)
+
+const (
+	defaultPollInterval = time.Second
+	defaultBatchSize    = 100
+)
+
+// Relay публикует события outbox во все получатели и помечает их отправленными.
+// Событие помечается отправленным, только если его приняли все получатели,
+// поэтому доставка выполняется как минимум один раз и получатели должны
+// учитывать возможные повторы по идентификатору события.
+type Relay struct {
+	// Repository предоставляет доступ к событиям outbox.
+	Repository repository.OutboxRepositoryInterface
+
+	// Sinks задает получателей событий.
+	Sinks []Sink
+
+	// PollInterval задает период проверки outbox.
+	PollInterval time.Duration
+
+	// BatchSize задает максимальное количество событий в одном пакете.
+	BatchSize int
+}
+
+// Run публикует события до отмены контекста.
+// Пока outbox содержит неотправленные события, пакеты публикуются без ожидания.
+func (r *Relay) Run(ctx context.Context) {
+	pollInterval := r.PollInterval
+
+	if pollInterval <= 0 {
+		pollInterval = defaultPollInterval
+	}
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		for ctx.Err() == nil {
+			if r.RelayOnce(ctx) == 0 {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RelayOnce публикует один пакет событий.
+// Возвращает количество отправленных событий.
+func (r *Relay) RelayOnce(ctx context.Context) int {
+	sent, err := r.Repository.ProcessEvents(ctx, r.batchSize(), r.publish)
+
+	if err != nil {
+		log.Printf("Error while relaying outbox events: %v", err)
+		return 0
+	}
+
+	return sent
+}
+
+// publish передает пакет событий всем получателям и прерывается на первой ошибке.
+func (r *Relay) publish(events []storage.OutboxEvent) error {
+	for _, sink := range r.Sinks {
+		if err := sink.Publish(events); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// batchSize возвращает максимальное количество событий в одном пакете.
+func (r *Relay) batchSize() int {
+	if r.BatchSize <= 0 {
+		return defaultBatchSize
+	}
+
+	return r.BatchSize
+}
@@ -0,0 +1,143 @@
+package outbox
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sub3er0/urlShorteningService/internal/storage"
+)
+
+const (
+	requestTimeout  = 10 * time.Second
+	maxResponseSize = 64 << 10
+	fileSinkPrefix  = "file:"
+)
+
+// Sink определяет получателя событий outbox.
+// Publish должен вернуть ошибку, если события не были приняты, тогда они будут отправлены повторно.
+type Sink interface {
+	// Publish публикует пакет событий.
+	Publish(events []storage.OutboxEvent) error
+}
+
+// LogSink записывает события в лог приложения.
+type LogSink struct{}
+
+// Publish записывает каждое событие отдельной строкой лога.
+func (s *LogSink) Publish(events []storage.OutboxEvent) error {
+	for _, event := range events {
+		log.Printf("Outbox event %d %s %s: %s", event.ID, event.EventType, event.AggregateID, event.Payload)
+	}
+
+	return nil
+}
+
+// FileSink дописывает события в файл в формате JSON, по одному событию на строку.
+type FileSink struct {
+	// Path задает путь к файлу событий.
+	Path string
+
+	mu sync.Mutex
+}
+
+// Publish дописывает пакет событий в файл и сбрасывает его на диск.
+func (s *FileSink) Publish(events []storage.OutboxEvent) error {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+
+	for _, event := range events {
+		if err := encoder.Encode(event); err != nil {
+			return err
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	file, err := os.OpenFile(s.Path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666)
+
+	if err != nil {
+		return err
+	}
+
+	if _, err = file.Write(buf.Bytes()); err != nil {
+		file.Close()
+		return err
+	}
+
+	if err = file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+}
+
+// HTTPSink отправляет пакет событий POST-запросом с телом в виде JSON-массива.
+type HTTPSink struct {
+	// URL задает адрес, принимающий события.
+	URL string
+
+	// Client отправляет запросы. Если не задан, используется клиент с таймаутом по умолчанию.
+	Client *http.Client
+}
+
+// Publish отправляет события и возвращает ошибку, если ответ не имеет статуса 2xx.
+func (s *HTTPSink) Publish(events []storage.OutboxEvent) error {
+	body, err := json.Marshal(events)
+
+	if err != nil {
+		return err
+	}
+
+	client := s.Client
+
+	if client == nil {
+		client = &http.Client{Timeout: requestTimeout}
+	}
+
+	response, err := client.Post(s.URL, "application/json", bytes.NewReader(body))
+
+	if err != nil {
+		return err
+	}
+
+	defer response.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(response.Body, maxResponseSize))
+
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return fmt.Errorf("unexpected response status %d", response.StatusCode)
+	}
+
+	return nil
+}
+
+// NewSink создает получателя по описанию из конфигурации:
+// "log", "file:<путь>" или абсолютный адрес http(s).
+func NewSink(spec string) (Sink, error) {
+	spec = strings.TrimSpace(spec)
+
+	switch {
+	case spec == "log":
+		return &LogSink{}, nil
+	case strings.HasPrefix(spec, fileSinkPrefix) && len(spec) > len(fileSinkPrefix):
+		return &FileSink{Path: strings.TrimPrefix(spec, fileSinkPrefix)}, nil
+	}
+
+	sinkURL, err := url.ParseRequestURI(spec)
+
+	if err != nil || (sinkURL.Scheme != "http" && sinkURL.Scheme != "https") || sinkURL.Host == "" {
+		return nil, fmt.Errorf("unsupported outbox sink %q", spec)
+	}
+
+	return &HTTPSink{URL: spec}, nil
+}
@@ -0,0 +1,91 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/sub3er0/urlShorteningService/internal/storage"
+)
+
+// AdminRepositoryInterface определяет методы для модерации ссылок и пользователей.
+type AdminRepositoryInterface interface {
+	// SearchUrls возвращает ссылки всех пользователей, подходящие под фильтр.
+	SearchUrls(ctx context.Context, filter storage.URLSearchFilter) ([]storage.DataStorageRow, error)
+
+	// DisableURL блокирует короткий URL с указанной причиной.
+	DisableURL(ctx context.Context, shortURL string, reason string) (bool, error)
+
+	// ReassignURL передает короткий URL другому пользователю.
+	ReassignURL(ctx context.Context, shortURL string, userID string) (bool, error)
+
+	// BanUser блокирует пользователя.
+	BanUser(ctx context.Context, userID string) error
+
+	// SaveAuditRecord сохраняет запись журнала действий администратора.
+	SaveAuditRecord(ctx context.Context, record storage.AuditRecord) error
+
+	// GetAuditRecords возвращает последние записи журнала действий администратора.
+	GetAuditRecords(ctx context.Context, limit int) ([]storage.AuditRecord, error)
+}
+
+// AdminRepository реализует AdminRepositoryInterface.
+type AdminRepository struct {
+	Storage storage.AdminStorageInterface
+
+	// Timeout ограничивает время каждой операции хранилища. Нулевое значение не ограничивает его.
+	Timeout time.Duration
+
+	// URLCache получает короткие URL, изменённые администратором. Может быть nil, если кеш не используется.
+	URLCache URLCacheInvalidator
+}
+
+// SearchUrls возвращает ссылки, подходящие под фильтр.
+func (ar *AdminRepository) SearchUrls(
+	ctx context.Context, filter storage.URLSearchFilter) ([]storage.DataStorageRow, error) {
+	ctx, cancel := withTimeout(ctx, ar.Timeout)
+	defer cancel()
+
+	return ar.Storage.SearchUrls(ctx, filter)
+}
+
+// DisableURL блокирует короткий URL.
+func (ar *AdminRepository) DisableURL(ctx context.Context, shortURL string, reason string) (bool, error) {
+	ctx, cancel := withTimeout(ctx, ar.Timeout)
+	defer cancel()
+	defer invalidate(ar.URLCache, shortURL)
+
+	return ar.Storage.DisableURL(ctx, shortURL, reason)
+}
+
+// ReassignURL передает короткий URL другому пользователю.
+func (ar *AdminRepository) ReassignURL(ctx context.Context, shortURL string, userID string) (bool, error) {
+	ctx, cancel := withTimeout(ctx, ar.Timeout)
+	defer cancel()
+	defer invalidate(ar.URLCache, shortURL)
+
+	return ar.Storage.ReassignURL(ctx, shortURL, userID)
+}
+
+// BanUser блокирует пользователя.
+func (ar *AdminRepository) BanUser(ctx context.Context, userID string) error {
+	ctx, cancel := withTimeout(ctx, ar.Timeout)
+	defer cancel()
+
+	return ar.Storage.BanUser(ctx, userID)
+}
+
+// SaveAuditRecord сохраняет запись журнала.
+func (ar *AdminRepository) SaveAuditRecord(ctx context.Context, record storage.AuditRecord) error {
+	ctx, cancel := withTimeout(ctx, ar.Timeout)
+	defer cancel()
+
+	return ar.Storage.SaveAuditRecord(ctx, record)
+}
+
+// GetAuditRecords возвращает последние записи журнала.
+func (ar *AdminRepository) GetAuditRecords(ctx context.Context, limit int) ([]storage.AuditRecord, error) {
+	ctx, cancel := withTimeout(ctx, ar.Timeout)
+	defer cancel()
+
+	return ar.Storage.GetAuditRecords(ctx, limit)
+}
@@ -0,0 +1,100 @@
+package repository_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/sub3er0/urlShorteningService/internal/repository"
+	"github.com/sub3er0/urlShorteningService/internal/storage"
+)
+
+// MockAdminStorage - структура, реализующая интерфейс AdminStorageInterface.
+type MockAdminStorage struct {
+	mock.Mock
+}
+
+// SearchUrls реализует метод интерфейса AdminStorageInterface.
+func (m *MockAdminStorage) SearchUrls(
+	ctx context.Context, filter storage.URLSearchFilter) ([]storage.DataStorageRow, error) {
+	args := m.Called(ctx, filter)
+	return args.Get(0).([]storage.DataStorageRow), args.Error(1)
+}
+
+// DisableURL реализует метод интерфейса AdminStorageInterface.
+func (m *MockAdminStorage) DisableURL(ctx context.Context, shortURL string, reason string) (bool, error) {
+	args := m.Called(ctx, shortURL, reason)
+	return args.Bool(0), args.Error(1)
+}
+
+// ReassignURL реализует метод интерфейса AdminStorageInterface.
+func (m *MockAdminStorage) ReassignURL(ctx context.Context, shortURL string, userID string) (bool, error) {
+	args := m.Called(ctx, shortURL, userID)
+	return args.Bool(0), args.Error(1)
+}
+
+// BanUser реализует метод интерфейса AdminStorageInterface.
+func (m *MockAdminStorage) BanUser(ctx context.Context, userID string) error {
+	args := m.Called(ctx, userID)
+	return args.Error(0)
+}
+
+// SaveAuditRecord реализует метод интерфейса AdminStorageInterface.
+func (m *MockAdminStorage) SaveAuditRecord(ctx context.Context, record storage.AuditRecord) error {
+	args := m.Called(ctx, record)
+	return args.Error(0)
+}
+
+// GetAuditRecords реализует метод интерфейса AdminStorageInterface.
+func (m *MockAdminStorage) GetAuditRecords(ctx context.Context, limit int) ([]storage.AuditRecord, error) {
+	args := m.Called(ctx, limit)
+	return args.Get(0).([]storage.AuditRecord), args.Error(1)
+}
+
+func TestAdminRepository_DisableURL(t *testing.T) {
+	ctx := context.Background()
+	mockStorage := new(MockAdminStorage)
+	repo := &repository.AdminRepository{Storage: mockStorage}
+
+	mockStorage.On("DisableURL", mock.Anything, "abc", "spam").Return(true, nil)
+
+	found, err := repo.DisableURL(ctx, "abc", "spam")
+
+	assert.NoError(t, err)
+	assert.True(t, found)
+	mockStorage.AssertExpectations(t)
+}
+
+func TestAdminRepository_ReassignURL_InvalidatesURLCache(t *testing.T) {
+	ctx := context.Background()
+	mockStorage := new(MockAdminStorage)
+	mockCache := new(MockURLCache)
+	repo := &repository.AdminRepository{Storage: mockStorage, URLCache: mockCache}
+
+	mockStorage.On("ReassignURL", mock.Anything, "abc", "user2").Return(true, nil)
+	mockCache.On("Invalidate", []string{"abc"}).Return()
+
+	found, err := repo.ReassignURL(ctx, "abc", "user2")
+
+	assert.NoError(t, err)
+	assert.True(t, found)
+	mockStorage.AssertExpectations(t)
+	mockCache.AssertExpectations(t)
+}
+
+func TestAdminRepository_SearchUrls(t *testing.T) {
+	ctx := context.Background()
+	mockStorage := new(MockAdminStorage)
+	repo := &repository.AdminRepository{Storage: mockStorage}
+
+	filter := storage.URLSearchFilter{UserID: "user1", Limit: 10}
+	expectedRows := []storage.DataStorageRow{{ShortURL: "abc", UserID: "user1"}}
+	mockStorage.On("SearchUrls", mock.Anything, filter).Return(expectedRows, nil)
+
+	rows, err := repo.SearchUrls(ctx, filter)
+
+	assert.NoError(t, err)
+	assert.Equal(t, expectedRows, rows)
+	mockStorage.AssertExpectations(t)
+}
@@ -0,0 +1,224 @@
+package repository
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sub3er0/urlShorteningService/internal/storage"
+)
+
+// Значения по умолчанию для кеша коротких URL.
+const (
+	// DefaultURLCacheTTL задает время жизни найденной ссылки в кеше.
+	DefaultURLCacheTTL = time.Minute
+
+	// DefaultURLCacheNegativeTTL задает время жизни отметки об отсутствующей ссылке в кеше.
+	DefaultURLCacheNegativeTTL = 5 * time.Second
+)
+
+// URLCacheInvalidator удаляет из кеша ссылки, изменённые в обход URLRepositoryInterface.
+type URLCacheInvalidator interface {
+	// Invalidate удаляет из кеша указанные короткие URL.
+	Invalidate(shortURLs ...string)
+}
+
+// URLCacheStatsInterface реализуют репозитории URL с кешем, сообщающие количество обращений к нему.
+type URLCacheStatsInterface interface {
+	// CacheStats возвращает количество попаданий и промахов кеша.
+	CacheStats() CacheStats
+}
+
+// invalidate удаляет короткие URL из кеша, если кеш задан.
+func invalidate(cache URLCacheInvalidator, shortURLs ...string) {
+	if cache != nil {
+		cache.Invalidate(shortURLs...)
+	}
+}
+
+// CacheStats описывает количество обращений к кешу.
+type CacheStats struct {
+	Hits   int64 `json:"hits"`   // Количество запросов, обслуженных из кеша
+	Misses int64 `json:"misses"` // Количество запросов, переданных в хранилище
+}
+
+// cacheEntry представляет ссылку в кеше. Отсутствующая ссылка хранится с признаком notFound.
+type cacheEntry struct {
+	shortURL  string
+	row       storage.GetURLRow
+	notFound  bool
+	expiresAt time.Time
+}
+
+// CachedURLRepository кеширует результаты GetURL поверх другого репозитория URL.
+// Кеш ограничен по количеству записей и вытесняет давно не запрошенные ссылки, каждая запись
+// живёт не дольше TTL. Изменения ссылок через репозиторий удаляют их из кеша, изменения через
+// другие репозитории должны вызывать Invalidate. Счётчики переходов в закешированных ссылках
+// могут отставать от хранилища на время жизни записи.
+type CachedURLRepository struct {
+	URLRepositoryInterface
+
+	size        int
+	ttl         time.Duration
+	negativeTTL time.Duration
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	order   *list.List
+
+	// generation увеличивается при каждой инвалидации, чтобы прочитанная до неё ссылка не попала в кеш.
+	generation uint64
+
+	hits   atomic.Int64
+	misses atomic.Int64
+}
+
+// NewCachedURLRepository создает кеш на size ссылок поверх репозитория repository.
+// Нулевые ttl и negativeTTL заменяются значениями по умолчанию.
+func NewCachedURLRepository(
+	repository URLRepositoryInterface, size int, ttl time.Duration, negativeTTL time.Duration) *CachedURLRepository {
+	if ttl <= 0 {
+		ttl = DefaultURLCacheTTL
+	}
+
+	if negativeTTL <= 0 {
+		negativeTTL = DefaultURLCacheNegativeTTL
+	}
+
+	return &CachedURLRepository{
+		URLRepositoryInterface: repository,
+		size:                   size,
+		ttl:                    ttl,
+		negativeTTL:            negativeTTL,
+		entries:                make(map[string]*list.Element),
+		order:                  list.New(),
+	}
+}
+
+// GetURL возвращает ссылку из кеша или читает её из репозитория и сохраняет в кеш.
+// Отсутствие ссылки тоже кешируется, другие ошибки не кешируются.
+func (cr *CachedURLRepository) GetURL(ctx context.Context, shortURL string) (storage.GetURLRow, error) {
+	entry, generation, ok := cr.get(shortURL)
+
+	if ok {
+		cr.hits.Add(1)
+
+		if entry.notFound {
+			return storage.GetURLRow{}, storage.ErrNotFound
+		}
+
+		return entry.row, nil
+	}
+
+	cr.misses.Add(1)
+	row, err := cr.URLRepositoryInterface.GetURL(ctx, shortURL)
+
+	switch {
+	case err == nil:
+		cr.put(&cacheEntry{shortURL: shortURL, row: row, expiresAt: time.Now().Add(cr.ttl)}, generation)
+	case errors.Is(err, storage.ErrNotFound):
+		entry := &cacheEntry{shortURL: shortURL, notFound: true, expiresAt: time.Now().Add(cr.negativeTTL)}
+		cr.put(entry, generation)
+	}
+
+	return row, err
+}
+
+// Save сохраняет ссылку и удаляет из кеша отметку о её отсутствии.
+func (cr *CachedURLRepository) Save(ctx context.Context, dataStorageRow storage.DataStorageRow) error {
+	defer cr.Invalidate(dataStorageRow.ShortURL)
+
+	return cr.URLRepositoryInterface.Save(ctx, dataStorageRow)
+}
+
+// InsertOrGet сохраняет ссылку или возвращает существующую и удаляет из кеша отметку об отсутствии ссылки.
+func (cr *CachedURLRepository) InsertOrGet(
+	ctx context.Context, dataStorageRow storage.DataStorageRow) (storage.DataStorageRow, bool, error) {
+	defer cr.Invalidate(dataStorageRow.ShortURL)
+
+	return cr.URLRepositoryInterface.InsertOrGet(ctx, dataStorageRow)
+}
+
+// SaveBatch сохраняет пакет ссылок и удаляет из кеша отметки об их отсутствии.
+func (cr *CachedURLRepository) SaveBatch(ctx context.Context, dataStorageRows []storage.DataStorageRow) error {
+	defer func() {
+		for _, dataStorageRow := range dataStorageRows {
+			cr.Invalidate(dataStorageRow.ShortURL)
+		}
+	}()
+
+	return cr.URLRepositoryInterface.SaveBatch(ctx, dataStorageRows)
+}
+
+// Invalidate удаляет из кеша указанные короткие URL.
+func (cr *CachedURLRepository) Invalidate(shortURLs ...string) {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+
+	cr.generation++
+
+	for _, shortURL := range shortURLs {
+		if element, ok := cr.entries[shortURL]; ok {
+			cr.remove(element)
+		}
+	}
+}
+
+// CacheStats возвращает количество попаданий и промахов кеша.
+func (cr *CachedURLRepository) CacheStats() CacheStats {
+	return CacheStats{Hits: cr.hits.Load(), Misses: cr.misses.Load()}
+}
+
+// get возвращает неустаревшую запись кеша и отмечает её как недавно запрошенную.
+// При отсутствии записи возвращает текущее поколение кеша для последующего put.
+func (cr *CachedURLRepository) get(shortURL string) (*cacheEntry, uint64, bool) {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+
+	element, ok := cr.entries[shortURL]
+
+	if !ok {
+		return nil, cr.generation, false
+	}
+
+	entry := element.Value.(*cacheEntry)
+
+	if time.Now().After(entry.expiresAt) {
+		cr.remove(element)
+		return nil, cr.generation, false
+	}
+
+	cr.order.MoveToFront(element)
+
+	return entry, cr.generation, true
+}
+
+// put сохраняет запись в кеш, вытесняя давно не запрошенные записи сверх размера кеша.
+// Запись не сохраняется, если после её чтения из репозитория кеш инвалидировался.
+func (cr *CachedURLRepository) put(entry *cacheEntry, generation uint64) {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+
+	if generation != cr.generation {
+		return
+	}
+
+	if element, ok := cr.entries[entry.shortURL]; ok {
+		cr.remove(element)
+	}
+
+	cr.entries[entry.shortURL] = cr.order.PushFront(entry)
+
+	for cr.order.Len() > cr.size {
+		cr.remove(cr.order.Back())
+	}
+}
+
+// remove удаляет запись из кеша. Вызывается под блокировкой mu.
+func (cr *CachedURLRepository) remove(element *list.Element) {
+	cr.order.Remove(element)
+	delete(cr.entries, element.Value.(*cacheEntry).shortURL)
+}
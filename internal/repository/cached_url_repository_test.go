@@ -0,0 +1,131 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/sub3er0/urlShorteningService/internal/storage"
+)
+
+func TestCachedURLRepository_GetURL(t *testing.T) {
+	ctx := context.Background()
+	mockStorage := new(MockURLStorage)
+	cache := NewCachedURLRepository(&URLRepository{Storage: mockStorage}, 10, time.Minute, time.Minute)
+
+	expectedRow := storage.GetURLRow{URL: "http://example.com"}
+	mockStorage.On("GetURL", mock.Anything, "shorturl").Return(expectedRow, nil).Once()
+
+	for i := 0; i < 3; i++ {
+		row, err := cache.GetURL(ctx, "shorturl")
+
+		assert.NoError(t, err)
+		assert.Equal(t, expectedRow, row)
+	}
+
+	assert.Equal(t, CacheStats{Hits: 2, Misses: 1}, cache.CacheStats())
+	mockStorage.AssertExpectations(t)
+}
+
+func TestCachedURLRepository_NegativeCache(t *testing.T) {
+	ctx := context.Background()
+	mockStorage := new(MockURLStorage)
+	cache := NewCachedURLRepository(&URLRepository{Storage: mockStorage}, 10, time.Minute, time.Minute)
+
+	mockStorage.On("GetURL", mock.Anything, "shorturl").Return(storage.GetURLRow{}, storage.ErrNotFound).Once()
+
+	_, err := cache.GetURL(ctx, "shorturl")
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+
+	_, err = cache.GetURL(ctx, "shorturl")
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+
+	// Сохранение ссылки удаляет отметку о её отсутствии.
+	dataStorageRow := storage.DataStorageRow{ShortURL: "shorturl", URL: "http://example.com"}
+	mockStorage.On("Save", mock.Anything, dataStorageRow).Return(nil)
+	mockStorage.On("GetURL", mock.Anything, "shorturl").Return(storage.GetURLRow{URL: "http://example.com"}, nil).Once()
+
+	assert.NoError(t, cache.Save(ctx, dataStorageRow))
+
+	row, err := cache.GetURL(ctx, "shorturl")
+	assert.NoError(t, err)
+	assert.Equal(t, "http://example.com", row.URL)
+
+	assert.Equal(t, CacheStats{Hits: 1, Misses: 2}, cache.CacheStats())
+	mockStorage.AssertExpectations(t)
+}
+
+func TestCachedURLRepository_ErrorsNotCached(t *testing.T) {
+	ctx := context.Background()
+	mockStorage := new(MockURLStorage)
+	cache := NewCachedURLRepository(&URLRepository{Storage: mockStorage}, 10, time.Minute, time.Minute)
+
+	unavailable := fmt.Errorf("%w: connection refused", storage.ErrUnavailable)
+	mockStorage.On("GetURL", mock.Anything, "shorturl").Return(storage.GetURLRow{}, unavailable).Twice()
+
+	for i := 0; i < 2; i++ {
+		_, err := cache.GetURL(ctx, "shorturl")
+		assert.ErrorIs(t, err, storage.ErrUnavailable)
+	}
+
+	mockStorage.AssertExpectations(t)
+}
+
+func TestCachedURLRepository_TTL(t *testing.T) {
+	ctx := context.Background()
+	mockStorage := new(MockURLStorage)
+	cache := NewCachedURLRepository(&URLRepository{Storage: mockStorage}, 10, time.Millisecond, time.Millisecond)
+
+	mockStorage.On("GetURL", mock.Anything, "shorturl").Return(storage.GetURLRow{URL: "http://example.com"}, nil).Twice()
+
+	_, err := cache.GetURL(ctx, "shorturl")
+	assert.NoError(t, err)
+
+	time.Sleep(5 * time.Millisecond)
+
+	_, err = cache.GetURL(ctx, "shorturl")
+	assert.NoError(t, err)
+
+	assert.Equal(t, CacheStats{Misses: 2}, cache.CacheStats())
+	mockStorage.AssertExpectations(t)
+}
+
+func TestCachedURLRepository_EvictsLeastRecentlyUsed(t *testing.T) {
+	ctx := context.Background()
+	mockStorage := new(MockURLStorage)
+	cache := NewCachedURLRepository(&URLRepository{Storage: mockStorage}, 2, time.Minute, time.Minute)
+
+	mockStorage.On("GetURL", mock.Anything, "a").Return(storage.GetURLRow{URL: "http://a.example.com"}, nil).Once()
+	mockStorage.On("GetURL", mock.Anything, "b").Return(storage.GetURLRow{URL: "http://b.example.com"}, nil).Twice()
+	mockStorage.On("GetURL", mock.Anything, "c").Return(storage.GetURLRow{URL: "http://c.example.com"}, nil).Once()
+
+	for _, shortURL := range []string{"a", "b", "a", "c", "a", "b"} {
+		_, err := cache.GetURL(ctx, shortURL)
+		assert.NoError(t, err)
+	}
+
+	assert.Equal(t, CacheStats{Hits: 2, Misses: 4}, cache.CacheStats())
+	mockStorage.AssertExpectations(t)
+}
+
+func TestCachedURLRepository_InvalidateDuringLoad(t *testing.T) {
+	ctx := context.Background()
+	mockStorage := new(MockURLStorage)
+	cache := NewCachedURLRepository(&URLRepository{Storage: mockStorage}, 10, time.Minute, time.Minute)
+
+	mockStorage.On("GetURL", mock.Anything, "shorturl").Return(storage.GetURLRow{URL: "http://example.com"}, nil).
+		Run(func(args mock.Arguments) { cache.Invalidate("shorturl") }).Once()
+	mockStorage.On("GetURL", mock.Anything, "shorturl").Return(storage.GetURLRow{IsDeleted: true}, nil).Once()
+
+	_, err := cache.GetURL(ctx, "shorturl")
+	assert.NoError(t, err)
+
+	row, err := cache.GetURL(ctx, "shorturl")
+	assert.NoError(t, err)
+	assert.True(t, row.IsDeleted)
+
+	mockStorage.AssertExpectations(t)
+}
@@ -0,0 +1,41 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/sub3er0/urlShorteningService/internal/storage"
+)
+
+// HealthRepositoryInterface определяет методы доступа к результатам проверки адресов перехода ссылок.
+type HealthRepositoryInterface interface {
+	// GetHealthTargets возвращает ссылки для проверки.
+	GetHealthTargets(ctx context.Context) ([]storage.HealthTarget, error)
+
+	// SaveLinkHealth сохраняет результат проверки адреса перехода ссылки.
+	SaveLinkHealth(ctx context.Context, shortURL string, health storage.LinkHealth) error
+}
+
+// HealthRepository реализует HealthRepositoryInterface.
+type HealthRepository struct {
+	Storage storage.HealthStorageInterface
+
+	// Timeout ограничивает время каждой операции хранилища. Нулевое значение не ограничивает его.
+	Timeout time.Duration
+}
+
+// GetHealthTargets возвращает ссылки для проверки.
+func (hr *HealthRepository) GetHealthTargets(ctx context.Context) ([]storage.HealthTarget, error) {
+	ctx, cancel := withTimeout(ctx, hr.Timeout)
+	defer cancel()
+
+	return hr.Storage.GetHealthTargets(ctx)
+}
+
+// SaveLinkHealth сохраняет результат проверки адреса перехода ссылки.
+func (hr *HealthRepository) SaveLinkHealth(ctx context.Context, shortURL string, health storage.LinkHealth) error {
+	ctx, cancel := withTimeout(ctx, hr.Timeout)
+	defer cancel()
+
+	return hr.Storage.SaveLinkHealth(ctx, shortURL, health)
+}
@@ -0,0 +1,31 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/sub3er0/urlShorteningService/internal/storage"
+)
+
+// OutboxRepositoryInterface определяет методы публикации событий outbox.
+type OutboxRepositoryInterface interface {
+	// ProcessEvents передает неотправленные события в publish и помечает их отправленными.
+	ProcessEvents(ctx context.Context, limit int, publish func(events []storage.OutboxEvent) error) (int, error)
+}
+
+// OutboxRepository реализует OutboxRepositoryInterface.
+type OutboxRepository struct {
+	Storage storage.OutboxStorageInterface
+
+	// Timeout ограничивает время каждой операции хранилища. Нулевое значение не ограничивает его.
+	Timeout time.Duration
+}
+
+// ProcessEvents передает неотправленные события в publish и помечает их отправленными.
+func (or *OutboxRepository) ProcessEvents(
+	ctx context.Context, limit int, publish func(events []storage.OutboxEvent) error) (int, error) {
+	ctx, cancel := withTimeout(ctx, or.Timeout)
+	defer cancel()
+
+	return or.Storage.ProcessEvents(ctx, limit, publish)
+}
@@ -1,32 +1,52 @@
 package repository
 
-import "github.com/sub3er0/urlShorteningService/internal/storage"
+import (
+	"context"
+	"time"
+
+	"github.com/sub3er0/urlShorteningService/internal/storage"
+)
 
 // URLRepositoryInterface определяет методы для работы с репозиторием URL.
 // Этот интерфейс предоставляет доступ к операциям получения, сохранения и манипуляции с URL в хранилище.
 type URLRepositoryInterface interface {
-	// GetURL возвращает полный URL и статус его наличия по заданному короткому URL.
-	GetURL(shortURL string) (storage.GetURLRow, bool)
+	// GetURL возвращает полный URL по заданному короткому URL.
+	// Если короткого URL нет в репозитории, возвращается storage.ErrNotFound.
+	GetURL(ctx context.Context, shortURL string) (storage.GetURLRow, error)
 
 	// GetURLCount возвращает общее количество URL в репозитории.
-	GetURLCount() int
+	GetURLCount(ctx context.Context) int
 
 	// GetShortURL возвращает короткий URL для заданного полного URL.
-	// Если в репозитории нет запись, возвращается ошибка.
-	GetShortURL(URL string) (string, error)
+	// Если в репозитории нет запись, возвращается storage.ErrNotFound.
+	GetShortURL(ctx context.Context, URL string) (string, error)
+
+	// Save сохраняет короткий URL с соответствующим полному URL, идентификатором пользователя и доменом.
+	Save(ctx context.Context, dataStorageRow storage.DataStorageRow) error
 
-	// Save сохраняет короткий URL с соответствующим полному URL и идентификатором пользователя.
-	Save(ShortURL string, URL string, userID string) error
+	// InsertOrGet атомарно сохраняет ссылку, если оригинального URL ещё нет в репозитории.
+	// Возвращает сохранённую ссылку и true или существующую ссылку на тот же URL и false.
+	InsertOrGet(ctx context.Context, dataStorageRow storage.DataStorageRow) (storage.DataStorageRow, bool, error)
 
 	// LoadData загружает данные о URL из хранилища в виде массива DataStorageRow.
-	LoadData() ([]storage.DataStorageRow, error)
+	LoadData(ctx context.Context) ([]storage.DataStorageRow, error)
 
 	// Ping проверяет состояние соединения с базой данных.
 	// Возвращает true, если соединение успешно.
-	Ping() bool
+	Ping(ctx context.Context) bool
 
 	// SaveBatch сохраняет пакет данных, представленных в виде массива DataStorageRow.
-	SaveBatch(dataStorageRows []storage.DataStorageRow) error
+	SaveBatch(ctx context.Context, dataStorageRows []storage.DataStorageRow) error
+
+	// RecordSplitClick учитывает переход на вариант A/B теста короткого URL.
+	RecordSplitClick(ctx context.Context, shortURL string, variant int) error
+
+	// RedeemClick атомарно учитывает переход по короткому URL с ограничением количества переходов.
+	// Возвращает количество оставшихся переходов и false, если лимит переходов исчерпан.
+	RedeemClick(ctx context.Context, shortURL string) (int, bool, error)
+
+	// SaveLinkMetadata сохраняет заголовок и Open Graph данные страницы перехода короткого URL.
+	SaveLinkMetadata(ctx context.Context, shortURL string, metadata storage.LinkMetadata) error
 }
 
 // URLRepository отвечает за взаимодействие между
@@ -35,6 +55,9 @@ type URLRepositoryInterface interface {
 type URLRepository struct {
 	// Storage представляет собой интерфейс для взаимодействия с хранилищем URL.
 	Storage storage.URLStorageInterface
+
+	// Timeout ограничивает время каждой операции хранилища. Нулевое значение не ограничивает его.
+	Timeout time.Duration
 }
 
 // GetStorage возвращает текущее хранилище URL, используемое в репозитории.
@@ -43,36 +66,90 @@ func (ur *URLRepository) GetStorage() storage.URLStorageInterface {
 }
 
 // GetURL получает URL по его короткому формату.
-func (ur *URLRepository) GetURL(shortURL string) (storage.GetURLRow, bool) {
-	return ur.Storage.GetURL(shortURL)
+func (ur *URLRepository) GetURL(ctx context.Context, shortURL string) (storage.GetURLRow, error) {
+	ctx, cancel := withTimeout(ctx, ur.Timeout)
+	defer cancel()
+
+	return ur.Storage.GetURL(ctx, shortURL)
 }
 
 // GetURLCount возвращает количество URL.
-func (ur *URLRepository) GetURLCount() int {
-	return ur.Storage.GetURLCount()
+func (ur *URLRepository) GetURLCount(ctx context.Context) int {
+	ctx, cancel := withTimeout(ctx, ur.Timeout)
+	defer cancel()
+
+	return ur.Storage.GetURLCount(ctx)
 }
 
 // GetShortURL возвращает короткий URL, если он существует.
-func (ur *URLRepository) GetShortURL(URL string) (string, error) {
-	return ur.Storage.GetShortURL(URL)
+func (ur *URLRepository) GetShortURL(ctx context.Context, URL string) (string, error) {
+	ctx, cancel := withTimeout(ctx, ur.Timeout)
+	defer cancel()
+
+	return ur.Storage.GetShortURL(ctx, URL)
 }
 
 // Save сохраняет короткий URL и оригинальный URL для пользователя.
-func (ur *URLRepository) Save(ShortURL string, URL string, userID string) error {
-	return ur.Storage.Save(ShortURL, URL, userID)
+func (ur *URLRepository) Save(ctx context.Context, dataStorageRow storage.DataStorageRow) error {
+	ctx, cancel := withTimeout(ctx, ur.Timeout)
+	defer cancel()
+
+	return ur.Storage.Save(ctx, dataStorageRow)
+}
+
+// InsertOrGet сохраняет ссылку или возвращает существующую ссылку на тот же URL.
+func (ur *URLRepository) InsertOrGet(
+	ctx context.Context, dataStorageRow storage.DataStorageRow) (storage.DataStorageRow, bool, error) {
+	ctx, cancel := withTimeout(ctx, ur.Timeout)
+	defer cancel()
+
+	return ur.Storage.InsertOrGet(ctx, dataStorageRow)
 }
 
 // LoadData загружает данные из хранилища.
-func (ur *URLRepository) LoadData() ([]storage.DataStorageRow, error) {
-	return ur.Storage.LoadData()
+func (ur *URLRepository) LoadData(ctx context.Context) ([]storage.DataStorageRow, error) {
+	ctx, cancel := withTimeout(ctx, ur.Timeout)
+	defer cancel()
+
+	return ur.Storage.LoadData(ctx)
 }
 
 // Ping проверяет доступность хранилища.
-func (ur *URLRepository) Ping() bool {
-	return ur.Storage.Ping()
+func (ur *URLRepository) Ping(ctx context.Context) bool {
+	ctx, cancel := withTimeout(ctx, ur.Timeout)
+	defer cancel()
+
+	return ur.Storage.Ping(ctx)
 }
 
 // SaveBatch сохраняет пакет данных в хранилище.
-func (ur *URLRepository) SaveBatch(dataStorageRows []storage.DataStorageRow) error {
-	return ur.Storage.SaveBatch(dataStorageRows)
+func (ur *URLRepository) SaveBatch(ctx context.Context, dataStorageRows []storage.DataStorageRow) error {
+	ctx, cancel := withTimeout(ctx, ur.Timeout)
+	defer cancel()
+
+	return ur.Storage.SaveBatch(ctx, dataStorageRows)
+}
+
+// RecordSplitClick учитывает переход на вариант A/B теста короткого URL.
+func (ur *URLRepository) RecordSplitClick(ctx context.Context, shortURL string, variant int) error {
+	ctx, cancel := withTimeout(ctx, ur.Timeout)
+	defer cancel()
+
+	return ur.Storage.RecordSplitClick(ctx, shortURL, variant)
+}
+
+// RedeemClick учитывает переход по короткому URL с ограничением количества переходов.
+func (ur *URLRepository) RedeemClick(ctx context.Context, shortURL string) (int, bool, error) {
+	ctx, cancel := withTimeout(ctx, ur.Timeout)
+	defer cancel()
+
+	return ur.Storage.RedeemClick(ctx, shortURL)
+}
+
+// SaveLinkMetadata сохраняет заголовок и Open Graph данные страницы перехода короткого URL.
+func (ur *URLRepository) SaveLinkMetadata(ctx context.Context, shortURL string, metadata storage.LinkMetadata) error {
+	ctx, cancel := withTimeout(ctx, ur.Timeout)
+	defer cancel()
+
+	return ur.Storage.SaveLinkMetadata(ctx, shortURL, metadata)
 }
@@ -1,7 +1,9 @@
 package repository
 
 import (
+	"context"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
@@ -18,44 +20,69 @@ func (m *MockURLStorage) SetConnection(conn storage.DBConnectionInterface) {
 }
 
 // GetURL реализует метод интерфейса URLStorageInterface
-func (m *MockURLStorage) GetURL(shortURL string) (storage.GetURLRow, bool) {
-	args := m.Called(shortURL)
-	return args.Get(0).(storage.GetURLRow), args.Bool(1)
+func (m *MockURLStorage) GetURL(ctx context.Context, shortURL string) (storage.GetURLRow, error) {
+	args := m.Called(ctx, shortURL)
+	return args.Get(0).(storage.GetURLRow), args.Error(1)
 }
 
 // GetURLCount реализует метод интерфейса URLStorageInterface
-func (m *MockURLStorage) GetURLCount() int {
-	args := m.Called()
+func (m *MockURLStorage) GetURLCount(ctx context.Context) int {
+	args := m.Called(ctx)
 	return args.Int(0)
 }
 
 // GetShortURL реализует метод интерфейса URLStorageInterface
-func (m *MockURLStorage) GetShortURL(URL string) (string, error) {
-	args := m.Called(URL)
+func (m *MockURLStorage) GetShortURL(ctx context.Context, URL string) (string, error) {
+	args := m.Called(ctx, URL)
 	return args.String(0), args.Error(1)
 }
 
 // Save реализует метод интерфейса URLStorageInterface
-func (m *MockURLStorage) Save(ShortURL string, URL string, userID string) error {
-	args := m.Called(ShortURL, URL, userID)
+func (m *MockURLStorage) Save(ctx context.Context, dataStorageRow storage.DataStorageRow) error {
+	args := m.Called(ctx, dataStorageRow)
 	return args.Error(0)
 }
 
+// InsertOrGet реализует метод интерфейса URLStorageInterface
+func (m *MockURLStorage) InsertOrGet(
+	ctx context.Context, dataStorageRow storage.DataStorageRow) (storage.DataStorageRow, bool, error) {
+	args := m.Called(ctx, dataStorageRow)
+	return args.Get(0).(storage.DataStorageRow), args.Bool(1), args.Error(2)
+}
+
 // LoadData реализует метод интерфейса URLStorageInterface
-func (m *MockURLStorage) LoadData() ([]storage.DataStorageRow, error) {
-	args := m.Called()
+func (m *MockURLStorage) LoadData(ctx context.Context) ([]storage.DataStorageRow, error) {
+	args := m.Called(ctx)
 	return args.Get(0).([]storage.DataStorageRow), args.Error(1)
 }
 
 // Ping реализует метод интерфейса URLStorageInterface
-func (m *MockURLStorage) Ping() bool {
-	args := m.Called()
+func (m *MockURLStorage) Ping(ctx context.Context) bool {
+	args := m.Called(ctx)
 	return args.Bool(0)
 }
 
 // SaveBatch реализует метод интерфейса URLStorageInterface
-func (m *MockURLStorage) SaveBatch(dataStorageRows []storage.DataStorageRow) error {
-	args := m.Called(dataStorageRows)
+func (m *MockURLStorage) SaveBatch(ctx context.Context, dataStorageRows []storage.DataStorageRow) error {
+	args := m.Called(ctx, dataStorageRows)
+	return args.Error(0)
+}
+
+// RecordSplitClick реализует метод интерфейса URLStorageInterface
+func (m *MockURLStorage) RecordSplitClick(ctx context.Context, shortURL string, variant int) error {
+	args := m.Called(ctx, shortURL, variant)
+	return args.Error(0)
+}
+
+// RedeemClick реализует метод интерфейса URLStorageInterface
+func (m *MockURLStorage) RedeemClick(ctx context.Context, shortURL string) (int, bool, error) {
+	args := m.Called(ctx, shortURL)
+	return args.Int(0), args.Bool(1), args.Error(2)
+}
+
+// SaveLinkMetadata реализует метод интерфейса URLStorageInterface
+func (m *MockURLStorage) SaveLinkMetadata(ctx context.Context, shortURL string, metadata storage.LinkMetadata) error {
+	args := m.Called(ctx, shortURL, metadata)
 	return args.Error(0)
 }
 
@@ -72,33 +99,53 @@ func (m *MockURLStorage) Close() {
 
 // Тесты для URLRepository
 func TestGetURL(t *testing.T) {
+	ctx := context.Background()
 	mockStorage := new(MockURLStorage)
 	repo := &URLRepository{Storage: mockStorage}
 
 	// Подготовка ожидаемого результата
 	expectedRow := storage.GetURLRow{URL: "http://example.com", IsDeleted: false}
-	mockStorage.On("GetURL", "shorturl").Return(expectedRow, true)
+	mockStorage.On("GetURL", mock.Anything, "shorturl").Return(expectedRow, nil)
 
 	// Вызов метода GetURL
-	row, found := repo.GetURL("shorturl")
+	row, err := repo.GetURL(ctx, "shorturl")
 
 	// Проверка результатов
-	assert.True(t, found)
+	assert.NoError(t, err)
 	assert.Equal(t, expectedRow, row)
 
 	// Проверка, что ожидания выполнены
 	mockStorage.AssertExpectations(t)
 }
 
+func TestGetURL_Timeout(t *testing.T) {
+	ctx := context.Background()
+	mockStorage := new(MockURLStorage)
+	repo := &URLRepository{Storage: mockStorage, Timeout: time.Second}
+
+	// Хранилище должно получить контекст с ограничением по времени
+	hasDeadline := mock.MatchedBy(func(ctx context.Context) bool {
+		_, ok := ctx.Deadline()
+		return ok
+	})
+	mockStorage.On("GetURL", hasDeadline, "shorturl").Return(storage.GetURLRow{}, storage.ErrNotFound)
+
+	_, err := repo.GetURL(ctx, "shorturl")
+
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+	mockStorage.AssertExpectations(t)
+}
+
 func TestGetURLCount(t *testing.T) {
+	ctx := context.Background()
 	mockStorage := new(MockURLStorage)
 	repo := &URLRepository{Storage: mockStorage}
 
 	// Подготовка ожидания
-	mockStorage.On("GetURLCount").Return(42)
+	mockStorage.On("GetURLCount", mock.Anything).Return(42)
 
 	// Вызов метода GetURLCount
-	count := repo.GetURLCount()
+	count := repo.GetURLCount(ctx)
 
 	// Проверка результата
 	assert.Equal(t, 42, count)
@@ -108,14 +155,15 @@ func TestGetURLCount(t *testing.T) {
 }
 
 func TestGetShortURL(t *testing.T) {
+	ctx := context.Background()
 	mockStorage := new(MockURLStorage)
 	repo := &URLRepository{Storage: mockStorage}
 
 	// Подготовка ожидаемого результата
-	mockStorage.On("GetShortURL", "http://example.com").Return("shorturl", nil)
+	mockStorage.On("GetShortURL", mock.Anything, "http://example.com").Return("shorturl", nil)
 
 	// Вызов метода GetShortURL
-	shortURL, err := repo.GetShortURL("http://example.com")
+	shortURL, err := repo.GetShortURL(ctx, "http://example.com")
 
 	// Проверка результата
 	assert.NoError(t, err)
@@ -126,14 +174,16 @@ func TestGetShortURL(t *testing.T) {
 }
 
 func TestSave(t *testing.T) {
+	ctx := context.Background()
 	mockStorage := new(MockURLStorage)
 	repo := &URLRepository{Storage: mockStorage}
 
 	// Подготовка ожидания
-	mockStorage.On("Save", "shorturl", "http://example.com", "user123").Return(nil)
+	dataStorageRow := storage.DataStorageRow{ShortURL: "shorturl", URL: "http://example.com", UserID: "user123"}
+	mockStorage.On("Save", mock.Anything, dataStorageRow).Return(nil)
 
 	// Вызов метода Save
-	err := repo.Save("shorturl", "http://example.com", "user123")
+	err := repo.Save(ctx, dataStorageRow)
 
 	// Проверка ошибок
 	assert.NoError(t, err)
@@ -142,16 +192,39 @@ func TestSave(t *testing.T) {
 	mockStorage.AssertExpectations(t)
 }
 
+func TestInsertOrGet(t *testing.T) {
+	ctx := context.Background()
+	mockStorage := new(MockURLStorage)
+	repo := &URLRepository{Storage: mockStorage}
+
+	// Подготовка ожидания: ссылка на URL уже существует
+	dataStorageRow := storage.DataStorageRow{ShortURL: "shorturl", URL: "http://example.com", UserID: "user123"}
+	existing := storage.DataStorageRow{ShortURL: "existing", URL: "http://example.com", UserID: "user1"}
+	mockStorage.On("InsertOrGet", mock.Anything, dataStorageRow).Return(existing, false, nil)
+
+	// Вызов метода InsertOrGet
+	stored, created, err := repo.InsertOrGet(ctx, dataStorageRow)
+
+	// Проверка результатов
+	assert.NoError(t, err)
+	assert.False(t, created)
+	assert.Equal(t, existing, stored)
+
+	// Проверка ожиданий
+	mockStorage.AssertExpectations(t)
+}
+
 func TestLoadData(t *testing.T) {
+	ctx := context.Background()
 	mockStorage := new(MockURLStorage)
 	repo := &URLRepository{Storage: mockStorage}
 
 	// Подготовка ожидаемого результата
 	expectedRows := []storage.DataStorageRow{{URL: "http://example.com", ShortURL: "shorturl"}}
-	mockStorage.On("LoadData").Return(expectedRows, nil)
+	mockStorage.On("LoadData", mock.Anything).Return(expectedRows, nil)
 
 	// Вызов метода LoadData
-	data, err := repo.LoadData()
+	data, err := repo.LoadData(ctx)
 
 	// Проверка ошибок
 	assert.NoError(t, err)
@@ -162,14 +235,15 @@ func TestLoadData(t *testing.T) {
 }
 
 func TestPing(t *testing.T) {
+	ctx := context.Background()
 	mockStorage := new(MockURLStorage)
 	repo := &URLRepository{Storage: mockStorage}
 
 	// Подготовка ожидания
-	mockStorage.On("Ping").Return(true)
+	mockStorage.On("Ping", mock.Anything).Return(true)
 
 	// Вызов метода Ping
-	result := repo.Ping()
+	result := repo.Ping(ctx)
 
 	// Проверка результата
 	assert.True(t, result)
@@ -179,6 +253,7 @@ func TestPing(t *testing.T) {
 }
 
 func TestSaveBatch(t *testing.T) {
+	ctx := context.Background()
 	mockStorage := new(MockURLStorage)
 	repo := &URLRepository{Storage: mockStorage}
 
@@ -189,10 +264,10 @@ func TestSaveBatch(t *testing.T) {
 	}
 
 	// Установка ожидания
-	mockStorage.On("SaveBatch", dataStorageRows).Return(nil)
+	mockStorage.On("SaveBatch", mock.Anything, dataStorageRows).Return(nil)
 
 	// Вызов метода SaveBatch
-	err := repo.SaveBatch(dataStorageRows)
+	err := repo.SaveBatch(ctx, dataStorageRows)
 
 	// Проверка ошибок
 	assert.NoError(t, err)
@@ -1,45 +1,108 @@
 package repository
 
-import "github.com/sub3er0/urlShorteningService/internal/storage"
+import (
+	"context"
+	"time"
+
+	"github.com/sub3er0/urlShorteningService/internal/storage"
+)
 
 // UserRepositoryInterface определяет методы для работы с репозиторием пользователей.
 // Этот интерфейс предоставляет доступ к операциям проверки существования пользователя,
 // сохранения пользователей, получения и удаления их URL.
 type UserRepositoryInterface interface {
 	// IsUserExist проверяет, существует ли пользователь по его уникальному идентификатору.
-	IsUserExist(uniqueID string) bool
+	IsUserExist(ctx context.Context, uniqueID string) bool
 
 	// SaveUser сохраняет нового пользователя с указанным уникальным идентификатором.
-	SaveUser(uniqueID string) error
+	SaveUser(ctx context.Context, uniqueID string) error
 
 	// GetUserUrls возвращает список URL, сохранённых для указанного пользователя.
-	GetUserUrls(uniqueID string) ([]storage.UserUrlsResponseBodyItem, error)
+	GetUserUrls(ctx context.Context, uniqueID string) ([]storage.UserUrlsResponseBodyItem, error)
 
 	// DeleteUserUrls удаляет указанный список коротких URL для указанного пользователя.
-	DeleteUserUrls(uniqueID string, shortURLs []string) error
+	DeleteUserUrls(ctx context.Context, uniqueID string, shortURLs []string) error
+
+	// UpdateUserURLDevices задает адреса перехода для мобильных устройств короткому URL пользователя.
+	UpdateUserURLDevices(
+		ctx context.Context, uniqueID string, shortURL string, deviceURLs storage.DeviceURLs) (bool, error)
+
+	// UpdateUserURLActivation задает время активации короткого URL пользователя.
+	UpdateUserURLActivation(ctx context.Context, uniqueID string, shortURL string, activeFrom *time.Time) (bool, error)
+
+	// GetUsersCount возвращает общее количество пользователей.
+	GetUsersCount(ctx context.Context) int
 }
 
 // UserRepository реализует UserRepositoryInterface.
 type UserRepository struct {
 	Storage storage.UserStorageInterface
+
+	// Timeout ограничивает время каждой операции хранилища. Нулевое значение не ограничивает его.
+	Timeout time.Duration
+
+	// URLCache получает короткие URL, изменённые пользователем. Может быть nil, если кеш не используется.
+	URLCache URLCacheInvalidator
 }
 
 // IsUserExist проверяет, существует ли пользователь по уникальному ID.
-func (ur *UserRepository) IsUserExist(uniqueID string) bool {
-	return ur.Storage.IsUserExist(uniqueID)
+func (ur *UserRepository) IsUserExist(ctx context.Context, uniqueID string) bool {
+	ctx, cancel := withTimeout(ctx, ur.Timeout)
+	defer cancel()
+
+	return ur.Storage.IsUserExist(ctx, uniqueID)
 }
 
 // SaveUser сохраняет пользователя с указанным уникальным ID.
-func (ur *UserRepository) SaveUser(uniqueID string) error {
-	return ur.Storage.SaveUser(uniqueID)
+func (ur *UserRepository) SaveUser(ctx context.Context, uniqueID string) error {
+	ctx, cancel := withTimeout(ctx, ur.Timeout)
+	defer cancel()
+
+	return ur.Storage.SaveUser(ctx, uniqueID)
 }
 
 // GetUserUrls возвращает список URL-адресов для указанного уникального ID пользователя.
-func (ur *UserRepository) GetUserUrls(uniqueID string) ([]storage.UserUrlsResponseBodyItem, error) {
-	return ur.Storage.GetUserUrls(uniqueID)
+func (ur *UserRepository) GetUserUrls(
+	ctx context.Context, uniqueID string) ([]storage.UserUrlsResponseBodyItem, error) {
+	ctx, cancel := withTimeout(ctx, ur.Timeout)
+	defer cancel()
+
+	return ur.Storage.GetUserUrls(ctx, uniqueID)
 }
 
 // DeleteUserUrls удаляет указанные URL-адреса для указанного уникального ID пользователя.
-func (ur *UserRepository) DeleteUserUrls(uniqueID string, shortURLS []string) error {
-	return ur.Storage.DeleteUserUrls(uniqueID, shortURLS)
+func (ur *UserRepository) DeleteUserUrls(ctx context.Context, uniqueID string, shortURLS []string) error {
+	ctx, cancel := withTimeout(ctx, ur.Timeout)
+	defer cancel()
+	defer invalidate(ur.URLCache, shortURLS...)
+
+	return ur.Storage.DeleteUserUrls(ctx, uniqueID, shortURLS)
+}
+
+// UpdateUserURLDevices задает адреса перехода для мобильных устройств короткому URL пользователя.
+func (ur *UserRepository) UpdateUserURLDevices(
+	ctx context.Context, uniqueID string, shortURL string, deviceURLs storage.DeviceURLs) (bool, error) {
+	ctx, cancel := withTimeout(ctx, ur.Timeout)
+	defer cancel()
+	defer invalidate(ur.URLCache, shortURL)
+
+	return ur.Storage.UpdateUserURLDevices(ctx, uniqueID, shortURL, deviceURLs)
+}
+
+// UpdateUserURLActivation задает время активации короткого URL пользователя.
+func (ur *UserRepository) UpdateUserURLActivation(
+	ctx context.Context, uniqueID string, shortURL string, activeFrom *time.Time) (bool, error) {
+	ctx, cancel := withTimeout(ctx, ur.Timeout)
+	defer cancel()
+	defer invalidate(ur.URLCache, shortURL)
+
+	return ur.Storage.UpdateUserURLActivation(ctx, uniqueID, shortURL, activeFrom)
+}
+
+// GetUsersCount возвращает количество пользователей.
+func (ur *UserRepository) GetUsersCount(ctx context.Context) int {
+	ctx, cancel := withTimeout(ctx, ur.Timeout)
+	defer cancel()
+
+	return ur.Storage.GetUsersCount(ctx)
 }
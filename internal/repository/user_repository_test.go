@@ -1,8 +1,10 @@
 package repository_test
 
 import (
+	"context"
 	"github.com/stretchr/testify/mock"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/sub3er0/urlShorteningService/internal/repository"
@@ -15,29 +17,55 @@ type MockUserStorage struct {
 }
 
 // IsUserExist реализует метод интерфейса UserStorageInterface.
-func (m *MockUserStorage) IsUserExist(uniqueID string) bool {
-	args := m.Called(uniqueID)
+func (m *MockUserStorage) IsUserExist(ctx context.Context, uniqueID string) bool {
+	args := m.Called(ctx, uniqueID)
 	return args.Bool(0)
 }
 
 // SaveUser реализует метод интерфейса UserStorageInterface.
-func (m *MockUserStorage) SaveUser(uniqueID string) error {
-	args := m.Called(uniqueID)
+func (m *MockUserStorage) SaveUser(ctx context.Context, uniqueID string) error {
+	args := m.Called(ctx, uniqueID)
 	return args.Error(0)
 }
 
 // GetUserUrls реализует метод интерфейса UserStorageInterface.
-func (m *MockUserStorage) GetUserUrls(uniqueID string) ([]storage.UserUrlsResponseBodyItem, error) {
-	args := m.Called(uniqueID)
+func (m *MockUserStorage) GetUserUrls(ctx context.Context, uniqueID string) ([]storage.UserUrlsResponseBodyItem, error) {
+	args := m.Called(ctx, uniqueID)
 	return args.Get(0).([]storage.UserUrlsResponseBodyItem), args.Error(1)
 }
 
 // DeleteUserUrls реализует метод интерфейса UserStorageInterface.
-func (m *MockUserStorage) DeleteUserUrls(uniqueID string, shortURLs []string) error {
-	args := m.Called(uniqueID, shortURLs)
+func (m *MockUserStorage) DeleteUserUrls(ctx context.Context, uniqueID string, shortURLs []string) error {
+	args := m.Called(ctx, uniqueID, shortURLs)
 	return args.Error(0)
 }
 
+// UpdateUserURLDevices реализует метод интерфейса UserStorageInterface.
+func (m *MockUserStorage) UpdateUserURLDevices(ctx context.Context,
+	uniqueID string, shortURL string, deviceURLs storage.DeviceURLs) (bool, error) {
+	args := m.Called(ctx, uniqueID, shortURL, deviceURLs)
+	return args.Bool(0), args.Error(1)
+}
+
+// UpdateUserURLActivation реализует метод интерфейса UserStorageInterface.
+func (m *MockUserStorage) UpdateUserURLActivation(ctx context.Context,
+	uniqueID string, shortURL string, activeFrom *time.Time) (bool, error) {
+	args := m.Called(ctx, uniqueID, shortURL, activeFrom)
+	return args.Bool(0), args.Error(1)
+}
+
+// GetUsersCount реализует метод интерфейса UserStorageInterface.
+func (m *MockUserStorage) GetUsersCount(ctx context.Context) int {
+	args := m.Called(ctx)
+	return args.Int(0)
+}
+
+// IsUserBanned реализует метод интерфейса UserStorageInterface.
+func (m *MockUserStorage) IsUserBanned(ctx context.Context, uniqueID string) bool {
+	args := m.Called(ctx, uniqueID)
+	return args.Bool(0)
+}
+
 // Init реализует метод интерфейса UserStorageInterface.
 func (m *MockUserStorage) Init(connectionString string) error {
 	args := m.Called(connectionString)
@@ -50,37 +78,40 @@ func (m *MockUserStorage) Close() {
 }
 
 func TestIsUserExist(t *testing.T) {
+	ctx := context.Background()
 	mockStorage := new(MockUserStorage)
 	repo := &repository.UserRepository{Storage: mockStorage}
 
-	mockStorage.On("IsUserExist", "user123").Return(true)
+	mockStorage.On("IsUserExist", mock.Anything, "user123").Return(true)
 
-	exists := repo.IsUserExist("user123")
+	exists := repo.IsUserExist(ctx, "user123")
 
 	assert.True(t, exists)
 	mockStorage.AssertExpectations(t)
 }
 
 func TestSaveUser(t *testing.T) {
+	ctx := context.Background()
 	mockStorage := new(MockUserStorage)
 	repo := &repository.UserRepository{Storage: mockStorage}
 
-	mockStorage.On("SaveUser", "user123").Return(nil)
+	mockStorage.On("SaveUser", mock.Anything, "user123").Return(nil)
 
-	err := repo.SaveUser("user123")
+	err := repo.SaveUser(ctx, "user123")
 
 	assert.NoError(t, err)
 	mockStorage.AssertExpectations(t)
 }
 
 func TestGetUserUrls(t *testing.T) {
+	ctx := context.Background()
 	mockStorage := new(MockUserStorage)
 	repo := &repository.UserRepository{Storage: mockStorage}
 
 	expectedUrls := []storage.UserUrlsResponseBodyItem{{OriginalURL: "http://example.com", ShortURL: "shorturl"}}
-	mockStorage.On("GetUserUrls", "user123").Return(expectedUrls, nil)
+	mockStorage.On("GetUserUrls", mock.Anything, "user123").Return(expectedUrls, nil)
 
-	urls, err := repo.GetUserUrls("user123")
+	urls, err := repo.GetUserUrls(ctx, "user123")
 
 	assert.NoError(t, err)
 	assert.Equal(t, expectedUrls, urls)
@@ -88,13 +119,84 @@ func TestGetUserUrls(t *testing.T) {
 }
 
 func TestDeleteUserUrls(t *testing.T) {
+	ctx := context.Background()
 	mockStorage := new(MockUserStorage)
 	repo := &repository.UserRepository{Storage: mockStorage}
 
-	mockStorage.On("DeleteUserUrls", "user123", []string{"shorturl"}).Return(nil)
+	mockStorage.On("DeleteUserUrls", mock.Anything, "user123", []string{"shorturl"}).Return(nil)
+
+	err := repo.DeleteUserUrls(ctx, "user123", []string{"shorturl"})
+
+	assert.NoError(t, err)
+	mockStorage.AssertExpectations(t)
+}
+
+// MockURLCache - структура-мок для интерфейса repository.URLCacheInvalidator
+type MockURLCache struct {
+	mock.Mock
+}
+
+func (m *MockURLCache) Invalidate(shortURLs ...string) {
+	m.Called(shortURLs)
+}
+
+func TestDeleteUserUrls_InvalidatesURLCache(t *testing.T) {
+	ctx := context.Background()
+	mockStorage := new(MockUserStorage)
+	mockCache := new(MockURLCache)
+	repo := &repository.UserRepository{Storage: mockStorage, URLCache: mockCache}
 
-	err := repo.DeleteUserUrls("user123", []string{"shorturl"})
+	mockStorage.On("DeleteUserUrls", mock.Anything, "user123", []string{"a", "b"}).Return(nil)
+	mockCache.On("Invalidate", []string{"a", "b"}).Return()
+
+	err := repo.DeleteUserUrls(ctx, "user123", []string{"a", "b"})
 
 	assert.NoError(t, err)
 	mockStorage.AssertExpectations(t)
+	mockCache.AssertExpectations(t)
+}
+
+func TestUpdateUserURLActivation_InvalidatesURLCache(t *testing.T) {
+	ctx := context.Background()
+	mockStorage := new(MockUserStorage)
+	mockCache := new(MockURLCache)
+	repo := &repository.UserRepository{Storage: mockStorage, URLCache: mockCache}
+
+	mockStorage.On("UpdateUserURLActivation", mock.Anything, "user123", "shorturl", (*time.Time)(nil)).Return(true, nil)
+	mockCache.On("Invalidate", []string{"shorturl"}).Return()
+
+	found, err := repo.UpdateUserURLActivation(ctx, "user123", "shorturl", nil)
+
+	assert.NoError(t, err)
+	assert.True(t, found)
+	mockStorage.AssertExpectations(t)
+	mockCache.AssertExpectations(t)
+}
+
+func TestUpdateUserURLDevices(t *testing.T) {
+	ctx := context.Background()
+	mockStorage := new(MockUserStorage)
+	repo := &repository.UserRepository{Storage: mockStorage}
+
+	deviceURLs := storage.DeviceURLs{IOSURL: "https://apps.apple.com/app/id1"}
+	mockStorage.On("UpdateUserURLDevices", mock.Anything, "user123", "shorturl", deviceURLs).Return(true, nil)
+
+	found, err := repo.UpdateUserURLDevices(ctx, "user123", "shorturl", deviceURLs)
+
+	assert.NoError(t, err)
+	assert.True(t, found)
+	mockStorage.AssertExpectations(t)
+}
+
+func TestGetUsersCount(t *testing.T) {
+	ctx := context.Background()
+	mockStorage := new(MockUserStorage)
+	repo := &repository.UserRepository{Storage: mockStorage}
+
+	mockStorage.On("GetUsersCount", mock.Anything).Return(5)
+
+	count := repo.GetUsersCount(ctx)
+
+	assert.Equal(t, 5, count)
+	mockStorage.AssertExpectations(t)
 }
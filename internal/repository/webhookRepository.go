@@ -0,0 +1,109 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/sub3er0/urlShorteningService/internal/storage"
+)
+
+// WebhookRepositoryInterface определяет методы для управления вебхуками и очередью доставки событий.
+type WebhookRepositoryInterface interface {
+	// SaveWebhook сохраняет вебхук и возвращает его с присвоенным идентификатором.
+	SaveWebhook(ctx context.Context, webhook storage.Webhook) (storage.Webhook, error)
+
+	// GetWebhooks возвращает вебхуки владельца.
+	GetWebhooks(ctx context.Context, userID string) ([]storage.Webhook, error)
+
+	// DeleteWebhook удаляет вебхук владельца.
+	DeleteWebhook(ctx context.Context, userID string, id int) (bool, error)
+
+	// GetEventWebhooks возвращает вебхуки, получающие события ссылок пользователя.
+	GetEventWebhooks(ctx context.Context, userID string) ([]storage.Webhook, error)
+
+	// EnqueueDeliveries добавляет доставки событий в очередь.
+	EnqueueDeliveries(ctx context.Context, deliveries []storage.WebhookDelivery) error
+
+	// GetDueDeliveries возвращает доставки, время попытки которых наступило.
+	GetDueDeliveries(ctx context.Context, now time.Time, limit int) ([]storage.WebhookDelivery, error)
+
+	// UpdateDelivery сохраняет результат попытки доставки.
+	UpdateDelivery(ctx context.Context, delivery storage.WebhookDelivery) error
+
+	// GetDeliveries возвращает последние доставки вебхука владельца.
+	GetDeliveries(ctx context.Context, userID string, webhookID int, limit int) ([]storage.WebhookDelivery, error)
+}
+
+// WebhookRepository реализует WebhookRepositoryInterface.
+type WebhookRepository struct {
+	Storage storage.WebhookStorageInterface
+
+	// Timeout ограничивает время каждой операции хранилища. Нулевое значение не ограничивает его.
+	Timeout time.Duration
+}
+
+// SaveWebhook сохраняет вебхук.
+func (wr *WebhookRepository) SaveWebhook(ctx context.Context, webhook storage.Webhook) (storage.Webhook, error) {
+	ctx, cancel := withTimeout(ctx, wr.Timeout)
+	defer cancel()
+
+	return wr.Storage.SaveWebhook(ctx, webhook)
+}
+
+// GetWebhooks возвращает вебхуки владельца.
+func (wr *WebhookRepository) GetWebhooks(ctx context.Context, userID string) ([]storage.Webhook, error) {
+	ctx, cancel := withTimeout(ctx, wr.Timeout)
+	defer cancel()
+
+	return wr.Storage.GetWebhooks(ctx, userID)
+}
+
+// DeleteWebhook удаляет вебхук владельца.
+func (wr *WebhookRepository) DeleteWebhook(ctx context.Context, userID string, id int) (bool, error) {
+	ctx, cancel := withTimeout(ctx, wr.Timeout)
+	defer cancel()
+
+	return wr.Storage.DeleteWebhook(ctx, userID, id)
+}
+
+// GetEventWebhooks возвращает вебхуки, получающие события ссылок пользователя.
+func (wr *WebhookRepository) GetEventWebhooks(ctx context.Context, userID string) ([]storage.Webhook, error) {
+	ctx, cancel := withTimeout(ctx, wr.Timeout)
+	defer cancel()
+
+	return wr.Storage.GetEventWebhooks(ctx, userID)
+}
+
+// EnqueueDeliveries добавляет доставки событий в очередь.
+func (wr *WebhookRepository) EnqueueDeliveries(ctx context.Context, deliveries []storage.WebhookDelivery) error {
+	ctx, cancel := withTimeout(ctx, wr.Timeout)
+	defer cancel()
+
+	return wr.Storage.EnqueueDeliveries(ctx, deliveries)
+}
+
+// GetDueDeliveries возвращает доставки, время попытки которых наступило.
+func (wr *WebhookRepository) GetDueDeliveries(
+	ctx context.Context, now time.Time, limit int) ([]storage.WebhookDelivery, error) {
+	ctx, cancel := withTimeout(ctx, wr.Timeout)
+	defer cancel()
+
+	return wr.Storage.GetDueDeliveries(ctx, now, limit)
+}
+
+// UpdateDelivery сохраняет результат попытки доставки.
+func (wr *WebhookRepository) UpdateDelivery(ctx context.Context, delivery storage.WebhookDelivery) error {
+	ctx, cancel := withTimeout(ctx, wr.Timeout)
+	defer cancel()
+
+	return wr.Storage.UpdateDelivery(ctx, delivery)
+}
+
+// GetDeliveries возвращает последние доставки вебхука владельца.
+func (wr *WebhookRepository) GetDeliveries(
+	ctx context.Context, userID string, webhookID int, limit int) ([]storage.WebhookDelivery, error) {
+	ctx, cancel := withTimeout(ctx, wr.Timeout)
+	defer cancel()
+
+	return wr.Storage.GetDeliveries(ctx, userID, webhookID, limit)
+}
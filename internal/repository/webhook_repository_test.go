@@ -0,0 +1,95 @@
+package repository_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/sub3er0/urlShorteningService/internal/repository"
+	"github.com/sub3er0/urlShorteningService/internal/storage"
+)
+
+// MockWebhookStorage - структура, реализующая интерфейс WebhookStorageInterface.
+type MockWebhookStorage struct {
+	mock.Mock
+}
+
+// SaveWebhook реализует метод интерфейса WebhookStorageInterface.
+func (m *MockWebhookStorage) SaveWebhook(ctx context.Context, webhook storage.Webhook) (storage.Webhook, error) {
+	args := m.Called(ctx, webhook)
+	return args.Get(0).(storage.Webhook), args.Error(1)
+}
+
+// GetWebhooks реализует метод интерфейса WebhookStorageInterface.
+func (m *MockWebhookStorage) GetWebhooks(ctx context.Context, userID string) ([]storage.Webhook, error) {
+	args := m.Called(ctx, userID)
+	return args.Get(0).([]storage.Webhook), args.Error(1)
+}
+
+// DeleteWebhook реализует метод интерфейса WebhookStorageInterface.
+func (m *MockWebhookStorage) DeleteWebhook(ctx context.Context, userID string, id int) (bool, error) {
+	args := m.Called(ctx, userID, id)
+	return args.Bool(0), args.Error(1)
+}
+
+// GetEventWebhooks реализует метод интерфейса WebhookStorageInterface.
+func (m *MockWebhookStorage) GetEventWebhooks(ctx context.Context, userID string) ([]storage.Webhook, error) {
+	args := m.Called(ctx, userID)
+	return args.Get(0).([]storage.Webhook), args.Error(1)
+}
+
+// EnqueueDeliveries реализует метод интерфейса WebhookStorageInterface.
+func (m *MockWebhookStorage) EnqueueDeliveries(ctx context.Context, deliveries []storage.WebhookDelivery) error {
+	args := m.Called(ctx, deliveries)
+	return args.Error(0)
+}
+
+// GetDueDeliveries реализует метод интерфейса WebhookStorageInterface.
+func (m *MockWebhookStorage) GetDueDeliveries(ctx context.Context, now time.Time, limit int) ([]storage.WebhookDelivery, error) {
+	args := m.Called(ctx, now, limit)
+	return args.Get(0).([]storage.WebhookDelivery), args.Error(1)
+}
+
+// UpdateDelivery реализует метод интерфейса WebhookStorageInterface.
+func (m *MockWebhookStorage) UpdateDelivery(ctx context.Context, delivery storage.WebhookDelivery) error {
+	args := m.Called(ctx, delivery)
+	return args.Error(0)
+}
+
+// GetDeliveries реализует метод интерфейса WebhookStorageInterface.
+func (m *MockWebhookStorage) GetDeliveries(ctx context.Context, userID string, webhookID int, limit int) ([]storage.WebhookDelivery, error) {
+	args := m.Called(ctx, userID, webhookID, limit)
+	return args.Get(0).([]storage.WebhookDelivery), args.Error(1)
+}
+
+func TestWebhookRepository_SaveWebhook(t *testing.T) {
+	ctx := context.Background()
+	mockStorage := new(MockWebhookStorage)
+	repo := &repository.WebhookRepository{Storage: mockStorage}
+
+	webhook := storage.Webhook{UserID: "user1", URL: "https://example.com/hook"}
+	mockStorage.On("SaveWebhook", mock.Anything, webhook).Return(storage.Webhook{ID: 1, UserID: "user1"}, nil)
+
+	saved, err := repo.SaveWebhook(ctx, webhook)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 1, saved.ID)
+	mockStorage.AssertExpectations(t)
+}
+
+func TestWebhookRepository_GetDeliveries(t *testing.T) {
+	ctx := context.Background()
+	mockStorage := new(MockWebhookStorage)
+	repo := &repository.WebhookRepository{Storage: mockStorage}
+
+	expected := []storage.WebhookDelivery{{ID: 1, WebhookID: 2}}
+	mockStorage.On("GetDeliveries", mock.Anything, "user1", 2, 10).Return(expected, nil)
+
+	deliveries, err := repo.GetDeliveries(ctx, "user1", 2, 10)
+
+	assert.NoError(t, err)
+	assert.Equal(t, expected, deliveries)
+	mockStorage.AssertExpectations(t)
+}
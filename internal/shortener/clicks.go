@@ -0,0 +1,45 @@
+package shortener
+
+import (
+	"context"
+	"errors"
+
+	"github.com/sub3er0/urlShorteningService/internal/storage"
+	"github.com/sub3er0/urlShorteningService/internal/webhook"
+)
+
+// ErrInvalidMaxClicks указывает, что лимит переходов задан некорректно.
+var ErrInvalidMaxClicks = errors.New("max_clicks must be non-negative and equal to 1 for one-time links")
+
+// clickLimit возвращает лимит переходов по ссылке с учётом признака одноразовой ссылки.
+// Нулевой лимит означает отсутствие ограничения.
+// Возвращает ErrInvalidMaxClicks, если лимит отрицательный или противоречит признаку одноразовой ссылки.
+func clickLimit(maxClicks int, oneTime bool) (int, error) {
+	if maxClicks < 0 || (oneTime && maxClicks > 1) {
+		return 0, ErrInvalidMaxClicks
+	}
+
+	if oneTime {
+		return 1, nil
+	}
+
+	return maxClicks, nil
+}
+
+// redeemClick учитывает переход по ссылке с ограничением количества переходов.
+// Для ссылок без ограничения всегда разрешает переход.
+// Переход, исчерпавший лимит, публикует событие истечения ссылки.
+// Возвращает false, если лимит переходов исчерпан.
+func (us *URLShortener) redeemClick(ctx context.Context, shortKey string, storedURL storage.GetURLRow) (bool, error) {
+	if storedURL.MaxClicks == 0 {
+		return true, nil
+	}
+
+	remaining, redeemed, err := us.URLRepository.RedeemClick(ctx, shortKey)
+
+	if redeemed && remaining == 0 {
+		us.emitLinkEvent(ctx, webhook.EventLinkExpired, storedURL.UserID, shortKey, storedURL.Domain, storedURL.URL)
+	}
+
+	return redeemed, err
+}
@@ -0,0 +1,50 @@
+package shortener
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/sub3er0/urlShorteningService/internal/storage"
+)
+
+// deviceURL выбирает адрес перехода по User-Agent запроса.
+// Для iOS и Android возвращает заданные для ссылки адреса.
+// Для остальных устройств и при отсутствии адреса возвращает false.
+func deviceURL(storedURL storage.GetURLRow, userAgent string) (string, bool) {
+	userAgent = strings.ToLower(userAgent)
+
+	switch {
+	case storedURL.IOSURL != "" && isIOS(userAgent):
+		return storedURL.IOSURL, true
+	case storedURL.AndroidURL != "" && strings.Contains(userAgent, "android"):
+		return storedURL.AndroidURL, true
+	default:
+		return "", false
+	}
+}
+
+// isIOS проверяет, отправлен ли запрос с устройства iOS.
+func isIOS(userAgent string) bool {
+	for _, device := range []string{"iphone", "ipad", "ipod"} {
+		if strings.Contains(userAgent, device) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// validateDeviceURLs проверяет, что заданные адреса перехода являются корректными URL.
+func validateDeviceURLs(deviceURLs storage.DeviceURLs) error {
+	for _, address := range []string{deviceURLs.IOSURL, deviceURLs.AndroidURL} {
+		if address == "" {
+			continue
+		}
+
+		if _, err := url.ParseRequestURI(address); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,106 @@
+package shortener
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// ErrUnknownDomain указывает, что запрошенный короткий домен не настроен.
+var ErrUnknownDomain = errors.New("unknown short domain")
+
+// ErrURLInOtherDomain указывает, что оригинальный URL уже сокращён в другом коротком домене.
+// Оригинальные URL и короткие ключи уникальны сразу во всех доменах, поэтому один оригинальный URL
+// сокращается только в одном домене, а ссылка другого домена по тому же ключу не находится.
+var ErrURLInOtherDomain = errors.New("url is already shortened in another short domain")
+
+// ParseDomains разбирает базовые адреса дополнительных коротких доменов
+// и возвращает соответствие хоста домена его базовому адресу.
+// Возвращает ошибку, если адрес задан некорректно.
+func ParseDomains(baseURLs []string) (map[string]string, error) {
+	domains := make(map[string]string, len(baseURLs))
+
+	for _, baseURL := range baseURLs {
+		host := hostOf(baseURL)
+
+		if host == "" {
+			return nil, fmt.Errorf("invalid short domain base URL: %q", baseURL)
+		}
+
+		domains[host] = normalizeBaseURL(baseURL)
+	}
+
+	return domains, nil
+}
+
+// hostOf возвращает хост базового адреса в нижнем регистре или пустую строку,
+// если адрес не удалось разобрать.
+func hostOf(baseURL string) string {
+	u, err := url.Parse(baseURL)
+
+	if err != nil {
+		return ""
+	}
+
+	return strings.ToLower(u.Host)
+}
+
+// normalizeBaseURL добавляет завершающий слеш к базовому адресу.
+func normalizeBaseURL(baseURL string) string {
+	if len(baseURL) > 0 && baseURL[len(baseURL)-1] != '/' {
+		return baseURL + "/"
+	}
+
+	return baseURL
+}
+
+// linkDomain приводит выбранный пользователем домен к хранимому виду.
+// Домен по умолчанию хранится как пустая строка.
+// Возвращает ErrUnknownDomain, если домен не настроен.
+func (us *URLShortener) linkDomain(domain string) (string, error) {
+	domain = strings.ToLower(domain)
+
+	if domain == "" || domain == hostOf(us.BaseURL) {
+		return "", nil
+	}
+
+	if _, ok := us.Domains[domain]; !ok {
+		return "", ErrUnknownDomain
+	}
+
+	return domain, nil
+}
+
+// requestDomain определяет домен ссылки по хосту запроса.
+// Запросы к неизвестным хостам относятся к домену по умолчанию.
+func (us *URLShortener) requestDomain(host string) string {
+	domain, err := us.linkDomain(host)
+
+	if err != nil {
+		return ""
+	}
+
+	return domain
+}
+
+// baseURLFor возвращает базовый адрес для домена ссылки.
+func (us *URLShortener) baseURLFor(domain string) string {
+	if baseURL, ok := us.Domains[domain]; ok {
+		return baseURL
+	}
+
+	return normalizeBaseURL(us.BaseURL)
+}
+
+// otherDomainError отвечает 409 Conflict на запрос сокращения URL, уже сокращённого в другом домене,
+// и указывает существующую ссылку.
+func (us *URLShortener) otherDomainError(w http.ResponseWriter, shortKey string, domain string) {
+	http.Error(w, fmt.Sprintf("%v: %s", ErrURLInOtherDomain, us.shortURLFor(shortKey, domain)), http.StatusConflict)
+}
+
+// shortURLFor формирует полный короткий URL для ключа и домена ссылки.
+func (us *URLShortener) shortURLFor(shortKey string, domain string) string {
+	return us.baseURLFor(domain) + shortKey
+}
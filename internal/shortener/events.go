@@ -0,0 +1,63 @@
+package shortener
+
+import (
+	"context"
+
+	"github.com/sub3er0/urlShorteningService/internal/storage"
+	"github.com/sub3er0/urlShorteningService/internal/webhook"
+)
+
+// emitLinkEvent публикует событие ссылки владельца, если публикация событий настроена.
+// Событие описывает уже выполненное изменение, поэтому ставится в очередь и при отключении клиента.
+func (us *URLShortener) emitLinkEvent(
+	ctx context.Context, eventType string, userID string, shortKey string, domain string, originalURL string) {
+	if us.Webhooks == nil {
+		return
+	}
+
+	us.Webhooks.Emit(context.WithoutCancel(ctx), userID, eventType, webhook.LinkData{
+		ShortKey:    shortKey,
+		ShortURL:    us.shortURLFor(shortKey, domain),
+		OriginalURL: originalURL,
+		UserID:      userID,
+	})
+}
+
+// emitCreatedEvents публикует события создания сохранённых ссылок.
+func (us *URLShortener) emitCreatedEvents(ctx context.Context, dataStorageRows []storage.DataStorageRow) {
+	for _, row := range dataStorageRows {
+		us.emitLinkEvent(ctx, webhook.EventLinkCreated, row.UserID, row.ShortURL, row.Domain, row.URL)
+	}
+}
+
+// emitStoredLinkEvent публикует событие ссылки по её текущему состоянию в хранилище.
+// Событие публикуется, только если ссылка принадлежит пользователю userID.
+func (us *URLShortener) emitStoredLinkEvent(ctx context.Context, eventType string, userID string, shortKey string) {
+	if us.Webhooks == nil {
+		return
+	}
+
+	storedURL, err := us.URLRepository.GetURL(ctx, shortKey)
+
+	if err != nil || storedURL.UserID != userID {
+		return
+	}
+
+	us.emitLinkEvent(ctx, eventType, userID, shortKey, storedURL.Domain, storedURL.URL)
+}
+
+// emitDeletedEvents публикует события удаления ссылок пользователя.
+// События публикуются только для ссылок, которые принадлежат пользователю и помечены удалёнными.
+func (us *URLShortener) emitDeletedEvents(ctx context.Context, userID string, shortKeys []string) {
+	if us.Webhooks == nil {
+		return
+	}
+
+	for _, shortKey := range shortKeys {
+		storedURL, err := us.URLRepository.GetURL(ctx, shortKey)
+
+		if err == nil && storedURL.IsDeleted && storedURL.UserID == userID {
+			us.emitLinkEvent(ctx, webhook.EventLinkDeleted, userID, shortKey, storedURL.Domain, storedURL.URL)
+		}
+	}
+}
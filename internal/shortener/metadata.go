@@ -0,0 +1,11 @@
+package shortener
+
+// collectMetadata запускает получение данных страницы перехода созданной ссылки,
+// если получение данных настроено.
+func (us *URLShortener) collectMetadata(shortKey string, originalURL string) {
+	if us.Metadata == nil {
+		return
+	}
+
+	us.Metadata.Collect(shortKey, originalURL)
+}
@@ -1,19 +1,22 @@
 package shortener
 
 import (
+	"context"
 	"encoding/json"
-	"fmt"
 	"io"
 	"log"
 	"math/rand"
 	"net/http"
 	"net/url"
 	"sync"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/sub3er0/urlShorteningService/internal/cookie"
+	"github.com/sub3er0/urlShorteningService/internal/metadata"
 	"github.com/sub3er0/urlShorteningService/internal/repository"
 	"github.com/sub3er0/urlShorteningService/internal/storage"
+	"github.com/sub3er0/urlShorteningService/internal/webhook"
 )
 
 // URLShortener представляет структуру, ответственную за обработку
@@ -32,11 +35,27 @@ type URLShortener struct {
 	// BaseURL представляет базовый адрес, который используется для сокращённых URL.
 	BaseURL string
 
+	// Domains сопоставляет хосты дополнительных коротких доменов их базовым адресам.
+	// Ссылки домена по умолчанию используют BaseURL.
+	Domains map[string]string
+
+	// ComingSoonPage содержит страницу, отдаваемую по ссылкам до времени их активации.
+	// Если страница не задана, для таких ссылок возвращается 404 Not Found.
+	ComingSoonPage []byte
+
 	// CookieManager управляет аутентификацией и обработкой куки в приложении.
 	CookieManager cookie.CookieManagerInterface
 
-	// RemoveChan — это канал, который используется для передачи коротких URL, которые нужно удалить.
-	RemoveChan chan string
+	// Webhooks публикует события жизненного цикла ссылок. Если не задан, события не публикуются.
+	Webhooks webhook.EmitterInterface
+
+	// Metadata получает заголовок и Open Graph данные страниц перехода созданных ссылок.
+	// Если не задан, данные не получаются.
+	Metadata metadata.CollectorInterface
+
+	// RemoveChan — это канал, который используется для передачи коротких URL, которые нужно удалить,
+	// вместе с пользователем, запросившим удаление.
+	RemoveChan chan RemoveRequest
 
 	// wg используется для управления ожидающими горутинами.
 	wg sync.WaitGroup
@@ -65,8 +84,17 @@ type URLShortenerInterface interface {
 	// DeleteUserUrls Удаляет короткие URL
 	DeleteUserUrls(w http.ResponseWriter, r *http.Request)
 
+	// UpdateUserURLDevices Задает адреса перехода для мобильных устройств короткому URL пользователя
+	UpdateUserURLDevices(w http.ResponseWriter, r *http.Request)
+
+	// UpdateUserURLActivation Задает время активации короткого URL пользователя
+	UpdateUserURLActivation(w http.ResponseWriter, r *http.Request)
+
 	// Worker Удаляет короткие URL
 	Worker()
+
+	// StatsHandler Возвращает статистику сервиса
+	StatsHandler(w http.ResponseWriter, r *http.Request)
 }
 
 // JSONResponseBody представляет структуру для ответа в формате JSON.
@@ -78,7 +106,25 @@ type JSONResponseBody struct {
 // RequestBody представляет структуру для запроса, содержащего URL.
 // Используется при получении короткого URL.
 type RequestBody struct {
-	URL string `json:"url"` // Полный URL для сокращения.
+	URL    string `json:"url"`              // Полный URL для сокращения.
+	Domain string `json:"domain,omitempty"` // Короткий домен ссылки, по умолчанию используется BaseURL.
+
+	storage.DeviceURLs // Адреса перехода для мобильных устройств.
+
+	Splits      []storage.SplitDestination `json:"splits,omitempty"`       // Варианты перехода для A/B тестирования.
+	StickySplit bool                       `json:"sticky_split,omitempty"` // Закрепление варианта за посетителем.
+
+	ActiveFrom *time.Time `json:"active_from,omitempty"` // Время активации ссылки, по умолчанию ссылка активна сразу.
+
+	MaxClicks int  `json:"max_clicks,omitempty"` // Допустимое количество переходов, по умолчанию без ограничения.
+	OneTime   bool `json:"one_time,omitempty"`   // Одноразовая ссылка, равносильно max_clicks = 1.
+}
+
+// RemoveRequest представляет короткий URL, удаляемый Worker, и пользователя, запросившего удаление.
+// Пользователь сохраняется при получении запроса, так как удаление выполняется после ответа клиенту.
+type RemoveRequest struct {
+	UserID   string // Идентификатор пользователя, запросившего удаление.
+	ShortURL string // Удаляемый короткий URL.
 }
 
 // DeleteRequestBody представляет структуру для запроса на удаление короткого URL.
@@ -90,8 +136,19 @@ type DeleteRequestBody struct {
 // BatchRequestBody представляет структуру для пакетных запросов на создание сокращенных URL.
 // Содержит идентификатор корреляции и оригинальный URL.
 type BatchRequestBody struct {
-	CorrelationID string `json:"correlation_id"` // Идентификатор корреляции для отслеживания в запросах.
-	OriginalURL   string `json:"original_url"`   // Оригинальный URL, который будет сокращён.
+	CorrelationID string `json:"correlation_id"`   // Идентификатор корреляции для отслеживания в запросах.
+	OriginalURL   string `json:"original_url"`     // Оригинальный URL, который будет сокращён.
+	Domain        string `json:"domain,omitempty"` // Короткий домен ссылки, по умолчанию используется BaseURL.
+
+	ActiveFrom *time.Time `json:"active_from,omitempty"` // Время активации ссылки, по умолчанию ссылка активна сразу.
+
+	MaxClicks int  `json:"max_clicks,omitempty"` // Допустимое количество переходов, по умолчанию без ограничения.
+	OneTime   bool `json:"one_time,omitempty"`   // Одноразовая ссылка, равносильно max_clicks = 1.
+}
+
+// ActivationRequestBody представляет структуру запроса на изменение времени активации короткого URL.
+type ActivationRequestBody struct {
+	ActiveFrom *time.Time `json:"active_from"` // Время активации ссылки, null делает ссылку активной сразу.
 }
 
 // BatchResponseBodyItem представляет элемент ответа для пакетных операций по сокращению URL.
@@ -101,6 +158,13 @@ type BatchResponseBodyItem struct {
 	ShortURL      string `json:"short_url"`      // Сокращенный URL.
 }
 
+// StatsResponseBody представляет структуру ответа со статистикой сервиса.
+type StatsResponseBody struct {
+	URLs  int                    `json:"urls"`            // Количество сокращённых URL в сервисе.
+	Users int                    `json:"users"`           // Количество пользователей в сервисе.
+	Cache *repository.CacheStats `json:"cache,omitempty"` // Обращения к кешу коротких URL, если он включен.
+}
+
 // ExistValueError представляет пользовательскую ошибку для случаев,
 // когда значение уже существует в системе.
 type ExistValueError struct {
@@ -112,26 +176,31 @@ type ExistValueError struct {
 var ErrShortURLExists = &ExistValueError{Text: "ShortURL already exists"}
 
 // Worker Удаляет короткие URL
+// Удаление выполняется после ответа клиенту, поэтому не зависит от контекста запроса.
+// Короткие URL удаляются от имени пользователя, запросившего их удаление.
 func (us *URLShortener) Worker() {
+	ctx := context.Background()
 	batchSize := 1
 	shortURLs := make([]string, 0, batchSize)
+	userID := ""
 
-	for urlFromChan := range us.RemoveChan {
-		shortURLs = append(shortURLs, urlFromChan)
+	for request := range us.RemoveChan {
+		if len(shortURLs) > 0 && request.UserID != userID {
+			us.DeleteUserUrlsBatch(ctx, userID, shortURLs)
+			shortURLs = shortURLs[:0]
+		}
+
+		userID = request.UserID
+		shortURLs = append(shortURLs, request.ShortURL)
 
 		if len(shortURLs) >= batchSize {
-			err := us.UserRepository.DeleteUserUrls(us.CookieManager.GetActualCookieValue(), shortURLs)
-			if err != nil {
-				log.Printf("Error while deleting urls")
-			}
+			us.DeleteUserUrlsBatch(ctx, userID, shortURLs)
 			shortURLs = shortURLs[:0]
 		}
 	}
 
 	if len(shortURLs) > 0 {
-		if err := us.UserRepository.DeleteUserUrls(us.CookieManager.GetActualCookieValue(), shortURLs); err != nil {
-			log.Printf("Error while deleting remaining URLs: %v", err)
-		}
+		us.DeleteUserUrlsBatch(ctx, userID, shortURLs)
 	}
 }
 
@@ -140,35 +209,71 @@ func (e *ExistValueError) Error() string {
 	return e.Text
 }
 
-// getShortURL возвращает короткий URL для заданного полного URL.
-// Если в репозитории не найдено, возвращает ошибку.
-// Параметры:
-//   - URL: полный URL для получения короткого URL.
-//
-// Возвращает короткий URL и ошибку, если произошла проблема.
-func (us *URLShortener) getShortURL(URL string) (string, error) {
-	return us.URLRepository.GetShortURL(URL)
-}
-
-// GetHandler Получает короткий URL из репозитория
+// GetHandler Получает короткий URL из репозитория.
+// Ссылка ищется по паре (хост запроса, ключ): ссылки другого домена не находятся.
+// Для устройств iOS и Android перенаправляет на заданные для них адреса, если они есть.
+// Для ссылок с A/B тестом перенаправляет на один из вариантов согласно весам.
+// Для ссылок, заблокированных администратором, возвращает 410 Gone с причиной блокировки.
+// До времени активации ссылки отдает страницу ComingSoonPage или 404 Not Found.
+// Для ссылок с ограничением количества переходов после исчерпания лимита возвращает 410 Gone.
 func (us *URLShortener) GetHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
 	id := r.PathValue("id")
 
-	storedURL, ok := us.URLRepository.GetURL(id)
+	storedURL, err := us.URLRepository.GetURL(ctx, id)
+
+	if err == nil && storedURL.Domain != us.requestDomain(r.Host) {
+		err = storage.ErrNotFound
+	}
 
-	if !ok {
+	if errors.Is(err, storage.ErrNotFound) {
 		http.Error(w, "NotFound", http.StatusNotFound)
-	} else if !storedURL.IsDeleted {
-		w.Header().Set("Location", storedURL.URL)
-		w.WriteHeader(http.StatusTemporaryRedirect)
+	} else if err != nil {
+		log.Printf("Get url error: %v", err)
+		storageError(w, err)
 	} else if storedURL.IsDeleted {
 		w.WriteHeader(http.StatusGone)
+	} else if storedURL.DisabledReason != "" {
+		http.Error(w, storedURL.DisabledReason, http.StatusGone)
+	} else if storedURL.ActiveFrom != nil && time.Now().Before(*storedURL.ActiveFrom) {
+		us.comingSoon(w)
+	} else if redeemed, err := us.redeemClick(ctx, id, storedURL); err != nil {
+		log.Printf("Redeem click error: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	} else if !redeemed {
+		w.WriteHeader(http.StatusGone)
+	} else {
+		if storedURL.IOSURL != "" || storedURL.AndroidURL != "" {
+			w.Header().Set("Vary", "User-Agent")
+		}
+
+		w.Header().Set("Location", us.redirectURL(w, r, id, storedURL))
+		w.WriteHeader(http.StatusTemporaryRedirect)
+
+		us.emitLinkEvent(ctx, webhook.EventLinkClicked, storedURL.UserID, id, storedURL.Domain, storedURL.URL)
+	}
+}
+
+// comingSoon отвечает на запрос перехода по ещё не активной ссылке.
+func (us *URLShortener) comingSoon(w http.ResponseWriter) {
+	if len(us.ComingSoonPage) == 0 {
+		http.Error(w, "NotFound", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+
+	if _, err := w.Write(us.ComingSoonPage); err != nil {
+		log.Printf("Write data error: %v", err)
 	}
 }
 
 // PingHandler Проверяет состояние соединения с репозиторием
 func (us *URLShortener) PingHandler(w http.ResponseWriter, r *http.Request) {
-	ok := us.URLRepository.Ping()
+	ctx := r.Context()
+	ok := us.URLRepository.Ping(ctx)
 
 	if ok {
 		w.WriteHeader(http.StatusOK)
@@ -178,8 +283,40 @@ func (us *URLShortener) PingHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// StatsHandler Возвращает количество сокращённых URL и пользователей в сервисе
+func (us *URLShortener) StatsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	responseBody := StatsResponseBody{
+		URLs:  us.URLRepository.GetURLCount(ctx),
+		Users: us.UserRepository.GetUsersCount(ctx),
+	}
+
+	if cache, ok := us.URLRepository.(repository.URLCacheStatsInterface); ok {
+		cacheStats := cache.CacheStats()
+		responseBody.Cache = &cacheStats
+	}
+
+	jsonData, err := json.Marshal(responseBody)
+
+	if err != nil {
+		log.Printf("Serialization fail: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	if _, err = w.Write(jsonData); err != nil {
+		log.Printf("Write data error: %v", err)
+	}
+}
+
 // JSONPostHandler Обрабатывает запрос на создание короткого URL в формате JSON
+// Оригинальный URL сокращается только в одном домене: если он уже сокращён в другом домене,
+// возвращает 409 Conflict с адресом существующей ссылки.
 func (us *URLShortener) JSONPostHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
 	body, err := io.ReadAll(r.Body)
 
 	if err != nil {
@@ -202,17 +339,59 @@ func (us *URLShortener) JSONPostHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	shortKey, err := us.getShortKey(bodyURL.String())
+	if err = validateDeviceURLs(requestBody.DeviceURLs); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err = validateSplits(requestBody.Splits); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	for i := range requestBody.Splits {
+		requestBody.Splits[i].Clicks = 0
+	}
+
+	maxClicks, err := clickLimit(requestBody.MaxClicks, requestBody.OneTime)
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	shortKey, domain, err := us.getShortKey(ctx, storage.DataStorageRow{
+		URL:         bodyURL.String(),
+		Domain:      requestBody.Domain,
+		DeviceURLs:  requestBody.DeviceURLs,
+		Splits:      requestBody.Splits,
+		StickySplit: requestBody.StickySplit,
+		ActiveFrom:  requestBody.ActiveFrom,
+		MaxClicks:   maxClicks,
+		UserID:      us.CookieManager.GetRequestUserID(r),
+	})
+
+	if errors.Is(err, ErrUnknownDomain) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if errors.Is(err, ErrURLInOtherDomain) {
+		us.otherDomainError(w, shortKey, domain)
+		return
+	}
 
 	var responseBody JSONResponseBody
-	responseBody.Result = shortKey
+	responseBody.Result = us.shortURLFor(shortKey, domain)
 
 	if errors.Is(err, ErrShortURLExists) {
 		err = us.buildJSONResponse(w, responseBody, true)
 	} else if err != nil {
-		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		log.Printf("Save url error: %v", err)
+		storageError(w, err)
 		return
 	} else {
+		us.collectMetadata(shortKey, bodyURL.String())
 		err = us.buildJSONResponse(w, responseBody, false)
 	}
 
@@ -223,7 +402,14 @@ func (us *URLShortener) JSONPostHandler(w http.ResponseWriter, r *http.Request)
 }
 
 // JSONBatchHandler Обрабатывает пакетные запросы на создание сокращенных URL
+// Каждая ссылка создается так же, как в JSONPostHandler: для уже сохранённых URL возвращаются
+// существующие ссылки, а события создания и сбор метаданных выполняются только для новых ссылок.
+// URL, уже сокращённый в другом домене, прерывает пакет ответом 409 Conflict.
+// Пакет не атомарен: все строки проверяются до сохранения, но если сохранение строки завершилось ошибкой,
+// ссылки предыдущих строк остаются созданными, а их события опубликованными. Повторный запрос того же
+// пакета безопасен: созданные ссылки возвращаются как существующие без повторных событий.
 func (us *URLShortener) JSONBatchHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
 	body, err := io.ReadAll(r.Body)
 
 	if err != nil {
@@ -240,57 +426,51 @@ func (us *URLShortener) JSONBatchHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	var responseBodyBatch []BatchResponseBodyItem
-	var dataStorageRows []storage.DataStorageRow
+	dataStorageRows := make([]storage.DataStorageRow, 0, len(requestBody))
+	userID := us.CookieManager.GetRequestUserID(r)
 
 	for _, requestBodyRow := range requestBody {
-		shortKey, getShortURLError := us.getShortURL(requestBodyRow.OriginalURL)
-
-		if getShortURLError != nil {
-			shortKey = generateShortKey()
-		}
-
-		responseBody := BatchResponseBodyItem{
-			CorrelationID: requestBodyRow.CorrelationID,
-			ShortURL:      us.BaseURL + shortKey,
-		}
-
-		if errors.Is(getShortURLError, ErrShortURLExists) {
-			responseBodyBatch = append(responseBodyBatch, responseBody)
-			continue
+		if _, err = us.linkDomain(requestBodyRow.Domain); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
 		}
 
-		responseBodyBatch = append(responseBodyBatch, responseBody)
+		maxClicks, err := clickLimit(requestBodyRow.MaxClicks, requestBodyRow.OneTime)
 
-		dataStorageRow := storage.DataStorageRow{
-			ShortURL: shortKey,
-			URL:      requestBodyRow.OriginalURL,
-			UserID:   us.CookieManager.GetActualCookieValue(),
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
 		}
-		dataStorageRows = append(dataStorageRows, dataStorageRow)
-
-		if len(responseBodyBatch) == 1000 {
-			getShortURLError = us.URLRepository.SaveBatch(dataStorageRows)
-			log.Printf("ERROR = %v", getShortURLError)
-
-			if getShortURLError != nil {
-				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-				return
-			}
 
-			dataStorageRows = dataStorageRows[:0]
-			us.URLRepository.Save(shortKey, requestBodyRow.OriginalURL, us.CookieManager.GetActualCookieValue())
-		}
+		dataStorageRows = append(dataStorageRows, storage.DataStorageRow{
+			URL:        requestBodyRow.OriginalURL,
+			Domain:     requestBodyRow.Domain,
+			ActiveFrom: requestBodyRow.ActiveFrom,
+			MaxClicks:  maxClicks,
+			UserID:     userID,
+		})
 	}
 
-	if len(dataStorageRows) > 0 {
-		err = us.URLRepository.SaveBatch(dataStorageRows)
-		log.Printf("ERROR = %v", err)
+	var responseBodyBatch []BatchResponseBodyItem
 
-		if err != nil {
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	for i, dataStorageRow := range dataStorageRows {
+		shortKey, domain, err := us.getShortKey(ctx, dataStorageRow)
+
+		if err == nil {
+			us.collectMetadata(shortKey, dataStorageRow.URL)
+		} else if errors.Is(err, ErrURLInOtherDomain) {
+			us.otherDomainError(w, shortKey, domain)
+			return
+		} else if !errors.Is(err, ErrShortURLExists) {
+			log.Printf("Save url error: %v", err)
+			storageError(w, err)
 			return
 		}
+
+		responseBodyBatch = append(responseBodyBatch, BatchResponseBodyItem{
+			CorrelationID: requestBody[i].CorrelationID,
+			ShortURL:      us.shortURLFor(shortKey, domain),
+		})
 	}
 
 	err = us.buildJSONBatchResponse(w, responseBodyBatch)
@@ -300,12 +480,12 @@ func (us *URLShortener) JSONBatchHandler(w http.ResponseWriter, r *http.Request)
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 		return
 	}
-	log.Printf("END BATCH HADLER")
 }
 
 // GetUserUrls Получает URL пользователя
 func (us *URLShortener) GetUserUrls(w http.ResponseWriter, r *http.Request) {
-	urls, err := us.UserRepository.GetUserUrls(us.CookieManager.GetActualCookieValue())
+	ctx := r.Context()
+	urls, err := us.UserRepository.GetUserUrls(ctx, us.CookieManager.GetRequestUserID(r))
 
 	if err != nil {
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
@@ -324,18 +504,11 @@ func (us *URLShortener) GetUserUrls(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func (us *URLShortener) saveBatch(w http.ResponseWriter, dataStorageRows []storage.DataStorageRow) error {
-	err := us.URLRepository.SaveBatch(dataStorageRows)
-
-	if err != nil {
-		return fmt.Errorf("ServerAddress is required")
-	}
-
-	return nil
-}
-
 // PostHandler Обрабатывает запрос на создание короткого URL
+// Оригинальный URL сокращается только в одном домене: если он уже сокращён в другом домене,
+// возвращает 409 Conflict с адресом существующей ссылки.
 func (us *URLShortener) PostHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
 	body, err := io.ReadAll(r.Body)
 
 	if err != nil {
@@ -351,15 +524,26 @@ func (us *URLShortener) PostHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	postURL := u.String()
-	shortKey, err := us.getShortKey(postURL)
+	shortKey, domain, err := us.getShortKey(ctx, storage.DataStorageRow{
+		URL:    postURL,
+		Domain: r.URL.Query().Get("domain"),
+		UserID: us.CookieManager.GetRequestUserID(r),
+	})
 
 	if errors.Is(err, ErrShortURLExists) {
-		us.buildResponse(w, shortKey, true)
+		us.buildResponse(w, us.shortURLFor(shortKey, domain), true)
+	} else if errors.Is(err, ErrUnknownDomain) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	} else if errors.Is(err, ErrURLInOtherDomain) {
+		us.otherDomainError(w, shortKey, domain)
+		return
 	} else if err != nil {
-		http.Error(w, "Internal Server Error", http.StatusBadRequest)
+		log.Printf("Save url error: %v", err)
+		storageError(w, err)
 		return
 	} else {
-		us.buildResponse(w, shortKey, false)
+		us.buildResponse(w, us.shortURLFor(shortKey, domain), false)
 	}
 
 	defer func(Body io.ReadCloser) {
@@ -373,29 +557,78 @@ func (us *URLShortener) PostHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 // getShortKey генерирует короткий ключ для заданного оригинального URL.
-// Если короткий URL уже существует, возвращает его и ошибку ErrShortURLExists.
-// Если короткого URL не существует, он создается и сохраняется в репозитории.
+// Если короткий URL уже существует, возвращает его, домен существующей ссылки и ошибку ErrShortURLExists,
+// а если существующая ссылка принадлежит другому домену — ошибку ErrURLInOtherDomain.
+// Если короткого URL не существует, он создается в выбранном домене и сохраняется в репозитории.
+// Проверка и сохранение выполняются репозиторием атомарно, поэтому одновременные запросы
+// для одного URL создают одну ссылку. При совпадении сгенерированного ключа с занятым
+// сохранение повторяется с новым ключом.
 // Параметры:
-//   - postURL: оригинальный URL, для которого требуется получить или создать короткий ключ.
+//   - dataStorageRow: создаваемая ссылка; URL содержит оригинальный URL, Domain - выбранный
+//     пользователем короткий домен, пустой для домена по умолчанию, UserID - владелец ссылки,
+//     выполняющий запрос. Короткий ключ назначается при сохранении.
 //
-// Возвращает короткий ключ и ошибку, если возникла проблема.
-func (us *URLShortener) getShortKey(postURL string) (string, error) {
-	shortKey, err := us.URLRepository.GetShortURL(postURL)
+// Возвращает короткий ключ, домен ссылки и ошибку, если возникла проблема.
+// Для ненастроенного домена возвращает ErrUnknownDomain, при сбое хранилища — его ошибку.
+func (us *URLShortener) getShortKey(ctx context.Context, dataStorageRow storage.DataStorageRow) (string, string, error) {
+	domain, err := us.linkDomain(dataStorageRow.Domain)
 
-	if err == nil {
-		return shortKey, ErrShortURLExists
+	if err != nil {
+		return "", "", err
 	}
 
-	shortKey = generateShortKey()
-	err = us.URLRepository.Save(shortKey, postURL, us.CookieManager.GetActualCookieValue())
+	dataStorageRow.Domain = domain
+
+	var stored storage.DataStorageRow
+	created := false
+
+	for attempt := 0; attempt < shortKeyAttempts; attempt++ {
+		dataStorageRow.ShortURL = generateShortKey()
+		stored, created, err = us.URLRepository.InsertOrGet(ctx, dataStorageRow)
+
+		if !errors.Is(err, storage.ErrConflict) {
+			break
+		}
+	}
 
 	if err != nil {
-		return "", err
+		return "", "", err
+	}
+
+	if !created && stored.Domain != domain {
+		return stored.ShortURL, stored.Domain, ErrURLInOtherDomain
+	}
+
+	if !created {
+		return stored.ShortURL, stored.Domain, ErrShortURLExists
+	}
+
+	us.emitCreatedEvents(ctx, []storage.DataStorageRow{dataStorageRow})
+
+	return dataStorageRow.ShortURL, domain, nil
+}
+
+// storageError отвечает на запрос, который не удалось выполнить из-за ошибки хранилища:
+// 404 Not Found для отсутствующей записи, 409 Conflict для нарушения уникальности,
+// 503 Service Unavailable для недоступного хранилища и 500 Internal Server Error для остальных ошибок.
+func storageError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, storage.ErrConflict):
+		status = http.StatusConflict
+	case errors.Is(err, storage.ErrUnavailable):
+		status = http.StatusServiceUnavailable
 	}
 
-	return shortKey, nil
+	http.Error(w, http.StatusText(status), status)
 }
 
+// shortKeyAttempts ограничивает количество попыток сохранить ссылку при совпадении сгенерированного ключа с занятым.
+const shortKeyAttempts = 3
+
 // generateShortKey создает новый короткий ключ длиной 6 знаков, состоящий из
 // букв и цифр. Использует криптографически безопасный генератор случайных чисел.
 // Возвращает сгенерированный короткий ключ.
@@ -415,7 +648,7 @@ func generateShortKey() string {
 // buildResponse формирует ответ на запрос с коротким URL.
 // Устанавливает заголовок типа контента и статус ответа в зависимости от того,
 // существует ли короткий URL или нет
-func (us *URLShortener) buildResponse(w http.ResponseWriter, shortKey string, isExist bool) {
+func (us *URLShortener) buildResponse(w http.ResponseWriter, shortURL string, isExist bool) {
 	w.Header().Set("content-type", "text/plain")
 
 	if !isExist {
@@ -424,11 +657,7 @@ func (us *URLShortener) buildResponse(w http.ResponseWriter, shortKey string, is
 		w.WriteHeader(http.StatusConflict)
 	}
 
-	if len(us.BaseURL) > 0 && us.BaseURL[len(us.BaseURL)-1] != '/' {
-		us.BaseURL = us.BaseURL + "/"
-	}
-
-	_, err := w.Write([]byte(us.BaseURL + shortKey))
+	_, err := w.Write([]byte(shortURL))
 
 	if err != nil {
 		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
@@ -441,7 +670,7 @@ func (us *URLShortener) buildResponse(w http.ResponseWriter, shortKey string, is
 // в зависимости от существования короткого URL.
 // Параметры:
 //   - w: объект ResponseWriter для записи ответа.
-//   - response: данные для сериализации в формате JSON.
+//   - response: данные для сериализации в формате JSON, содержащие полный короткий URL.
 //   - isExist: булево значение, указывающее, существует ли короткий URL.
 //
 // Возвращает ошибку, если произошла проблема с сериализацией или записью ответа.
@@ -453,11 +682,6 @@ func (us *URLShortener) buildJSONResponse(w http.ResponseWriter, response JSONRe
 		w.WriteHeader(http.StatusConflict)
 	}
 
-	if len(us.BaseURL) > 0 && us.BaseURL[len(us.BaseURL)-1] != '/' {
-		us.BaseURL = us.BaseURL + "/"
-	}
-
-	response.Result = us.BaseURL + response.Result
 	jsonData, err := json.Marshal(response)
 
 	if err != nil {
@@ -515,7 +739,7 @@ func (us *URLShortener) buildAllUserUrlsResponse(w http.ResponseWriter, response
 	w.WriteHeader(http.StatusOK)
 
 	for i := range response {
-		response[i].ShortURL = us.BaseURL + response[i].ShortURL
+		response[i].ShortURL = us.shortURLFor(response[i].ShortURL, response[i].Domain)
 	}
 
 	jsonData, err := json.Marshal(response)
@@ -535,15 +759,16 @@ func (us *URLShortener) buildAllUserUrlsResponse(w http.ResponseWriter, response
 	return nil
 }
 
-// DeleteUserUrlsBatch удаляет пакетные короткие URL для текущего пользователя.
+// DeleteUserUrlsBatch удаляет пакетные короткие URL пользователя.
 // Принимает массив коротких URL и обрабатывает их удаление в партиях заданного размера.
 //
 // Параметры:
+//   - userID: идентификатор пользователя, которому должны принадлежать удаляемые URL.
 //   - shortURLs: массив коротких URL, которые необходимо удалить.
 //
 // Метод не возвращает значений. Если возникает ошибка при удалении любого из URL,
 // она будет записана в лог, но выполнение продолжится для следующих URL.
-func (us *URLShortener) DeleteUserUrlsBatch(shortURLs []string) {
+func (us *URLShortener) DeleteUserUrlsBatch(ctx context.Context, userID string, shortURLs []string) {
 	batchSize := 100
 
 	for i := 0; i < len(shortURLs); i += batchSize {
@@ -553,9 +778,11 @@ func (us *URLShortener) DeleteUserUrlsBatch(shortURLs []string) {
 		}
 
 		urlsBatch := shortURLs[i:end]
-		err := us.UserRepository.DeleteUserUrls(us.CookieManager.GetActualCookieValue(), urlsBatch)
+		err := us.UserRepository.DeleteUserUrls(ctx, userID, urlsBatch)
 		if err != nil {
 			log.Printf("Error while deleting urls")
+		} else {
+			us.emitDeletedEvents(ctx, userID, urlsBatch)
 		}
 	}
 }
@@ -570,9 +797,72 @@ func (us *URLShortener) DeleteUserUrls(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	userID := us.CookieManager.GetRequestUserID(r)
+
 	for _, shortURL := range shortURLs {
-		us.RemoveChan <- shortURL
+		us.RemoveChan <- RemoveRequest{UserID: userID, ShortURL: shortURL}
 	}
 
 	w.WriteHeader(http.StatusAccepted)
 }
+
+// UpdateUserURLDevices Задает адреса перехода для мобильных устройств короткому URL пользователя.
+// Пустой адрес отключает перенаправление для соответствующего устройства.
+func (us *URLShortener) UpdateUserURLDevices(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	var deviceURLs storage.DeviceURLs
+
+	if err := json.NewDecoder(r.Body).Decode(&deviceURLs); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := validateDeviceURLs(deviceURLs); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	userID := us.CookieManager.GetRequestUserID(r)
+	found, err := us.UserRepository.UpdateUserURLDevices(ctx, userID, r.PathValue("id"), deviceURLs)
+
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	if !found {
+		http.Error(w, "NotFound", http.StatusNotFound)
+		return
+	}
+
+	us.emitStoredLinkEvent(ctx, webhook.EventLinkUpdated, userID, r.PathValue("id"))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// UpdateUserURLActivation Задает время активации короткого URL пользователя.
+// Значение null делает ссылку активной сразу.
+func (us *URLShortener) UpdateUserURLActivation(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	var requestBody ActivationRequestBody
+
+	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	userID := us.CookieManager.GetRequestUserID(r)
+	found, err := us.UserRepository.UpdateUserURLActivation(ctx, userID, r.PathValue("id"), requestBody.ActiveFrom)
+
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	if !found {
+		http.Error(w, "NotFound", http.StatusNotFound)
+		return
+	}
+
+	us.emitStoredLinkEvent(ctx, webhook.EventLinkUpdated, userID, r.PathValue("id"))
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -2,8 +2,10 @@ package shortener
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"strconv"
@@ -13,8 +15,10 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 	"github.com/sub3er0/urlShorteningService/internal/repository"
 	"github.com/sub3er0/urlShorteningService/internal/storage"
+	"github.com/sub3er0/urlShorteningService/internal/webhook"
 )
 
 // MockURLRepository - мок для URLRepositoryInterface.
@@ -23,44 +27,69 @@ type MockURLRepository struct {
 }
 
 // GetURL - реализует метод интерфейса URLRepositoryInterface.
-func (m *MockURLRepository) GetURL(shortURL string) (storage.GetURLRow, bool) {
-	args := m.Called(shortURL)
-	return args.Get(0).(storage.GetURLRow), args.Bool(1)
+func (m *MockURLRepository) GetURL(ctx context.Context, shortURL string) (storage.GetURLRow, error) {
+	args := m.Called(ctx, shortURL)
+	return args.Get(0).(storage.GetURLRow), args.Error(1)
 }
 
 // GetURLCount - реализует метод интерфейса URLRepositoryInterface.
-func (m *MockURLRepository) GetURLCount() int {
-	args := m.Called()
+func (m *MockURLRepository) GetURLCount(ctx context.Context) int {
+	args := m.Called(ctx)
 	return args.Int(0)
 }
 
 // GetShortURL - реализует метод интерфейса URLRepositoryInterface.
-func (m *MockURLRepository) GetShortURL(URL string) (string, error) {
-	args := m.Called(URL)
+func (m *MockURLRepository) GetShortURL(ctx context.Context, URL string) (string, error) {
+	args := m.Called(ctx, URL)
 	return args.String(0), args.Error(1)
 }
 
 // Save - реализует метод интерфейса URLRepositoryInterface.
-func (m *MockURLRepository) Save(ShortURL string, URL string, userID string) error {
-	args := m.Called(ShortURL, URL, userID)
+func (m *MockURLRepository) Save(ctx context.Context, dataStorageRow storage.DataStorageRow) error {
+	args := m.Called(ctx, dataStorageRow)
 	return args.Error(0)
 }
 
+// InsertOrGet - реализует метод интерфейса URLRepositoryInterface.
+func (m *MockURLRepository) InsertOrGet(
+	ctx context.Context, dataStorageRow storage.DataStorageRow) (storage.DataStorageRow, bool, error) {
+	args := m.Called(ctx, dataStorageRow)
+	return args.Get(0).(storage.DataStorageRow), args.Bool(1), args.Error(2)
+}
+
 // LoadData - реализует метод интерфейса URLRepositoryInterface.
-func (m *MockURLRepository) LoadData() ([]storage.DataStorageRow, error) {
-	args := m.Called()
+func (m *MockURLRepository) LoadData(ctx context.Context) ([]storage.DataStorageRow, error) {
+	args := m.Called(ctx)
 	return args.Get(0).([]storage.DataStorageRow), args.Error(1)
 }
 
 // Ping - реализует метод интерфейса URLRepositoryInterface.
-func (m *MockURLRepository) Ping() bool {
-	args := m.Called()
+func (m *MockURLRepository) Ping(ctx context.Context) bool {
+	args := m.Called(ctx)
 	return args.Bool(0)
 }
 
 // SaveBatch - реализует метод интерфейса URLRepositoryInterface.
-func (m *MockURLRepository) SaveBatch(dataStorageRows []storage.DataStorageRow) error {
-	args := m.Called(dataStorageRows)
+func (m *MockURLRepository) SaveBatch(ctx context.Context, dataStorageRows []storage.DataStorageRow) error {
+	args := m.Called(ctx, dataStorageRows)
+	return args.Error(0)
+}
+
+// RecordSplitClick - реализует метод интерфейса URLRepositoryInterface.
+func (m *MockURLRepository) RecordSplitClick(ctx context.Context, shortURL string, variant int) error {
+	args := m.Called(ctx, shortURL, variant)
+	return args.Error(0)
+}
+
+// RedeemClick - реализует метод интерфейса URLRepositoryInterface.
+func (m *MockURLRepository) RedeemClick(ctx context.Context, shortURL string) (int, bool, error) {
+	args := m.Called(ctx, shortURL)
+	return args.Int(0), args.Bool(1), args.Error(2)
+}
+
+// SaveLinkMetadata - реализует метод интерфейса URLRepositoryInterface.
+func (m *MockURLRepository) SaveLinkMetadata(ctx context.Context, shortURL string, metadata storage.LinkMetadata) error {
+	args := m.Called(ctx, shortURL, metadata)
 	return args.Error(0)
 }
 
@@ -70,29 +99,69 @@ type MockUserRepository struct {
 }
 
 // IsUserExist - реализует метод интерфейса UserRepositoryInterface.
-func (m *MockUserRepository) IsUserExist(uniqueID string) bool {
-	args := m.Called(uniqueID)
+func (m *MockUserRepository) IsUserExist(ctx context.Context, uniqueID string) bool {
+	args := m.Called(ctx, uniqueID)
 	return args.Bool(0)
 }
 
 // SaveUser - реализует метод интерфейса UserRepositoryInterface.
-func (m *MockUserRepository) SaveUser(uniqueID string) error {
-	args := m.Called(uniqueID)
+func (m *MockUserRepository) SaveUser(ctx context.Context, uniqueID string) error {
+	args := m.Called(ctx, uniqueID)
 	return args.Error(0)
 }
 
 // GetUserUrls - реализует метод интерфейса UserRepositoryInterface.
-func (m *MockUserRepository) GetUserUrls(uniqueID string) ([]storage.UserUrlsResponseBodyItem, error) {
-	args := m.Called(uniqueID)
+func (m *MockUserRepository) GetUserUrls(ctx context.Context, uniqueID string) ([]storage.UserUrlsResponseBodyItem, error) {
+	args := m.Called(ctx, uniqueID)
 	return args.Get(0).([]storage.UserUrlsResponseBodyItem), args.Error(1)
 }
 
 // DeleteUserUrls - реализует метод интерфейса UserRepositoryInterface.
-func (m *MockUserRepository) DeleteUserUrls(uniqueID string, shortURLs []string) error {
-	args := m.Called(uniqueID, shortURLs)
+func (m *MockUserRepository) DeleteUserUrls(ctx context.Context, uniqueID string, shortURLs []string) error {
+	args := m.Called(ctx, uniqueID, shortURLs)
 	return args.Error(0)
 }
 
+// UpdateUserURLDevices - реализует метод интерфейса UserRepositoryInterface.
+func (m *MockUserRepository) UpdateUserURLDevices(ctx context.Context,
+	uniqueID string, shortURL string, deviceURLs storage.DeviceURLs) (bool, error) {
+	args := m.Called(ctx, uniqueID, shortURL, deviceURLs)
+	return args.Bool(0), args.Error(1)
+}
+
+// UpdateUserURLActivation - реализует метод интерфейса UserRepositoryInterface
+func (m *MockUserRepository) UpdateUserURLActivation(ctx context.Context,
+	uniqueID string, shortURL string, activeFrom *time.Time) (bool, error) {
+	args := m.Called(ctx, uniqueID, shortURL, activeFrom)
+	return args.Bool(0), args.Error(1)
+}
+
+// GetUsersCount - реализует метод интерфейса UserRepositoryInterface.
+func (m *MockUserRepository) GetUsersCount(ctx context.Context) int {
+	args := m.Called(ctx)
+	return args.Int(0)
+}
+
+// MockWebhooks - мок для webhook.EmitterInterface.
+type MockWebhooks struct {
+	mock.Mock
+}
+
+// Emit - реализует метод интерфейса EmitterInterface.
+func (m *MockWebhooks) Emit(ctx context.Context, userID string, eventType string, data interface{}) {
+	m.Called(ctx, userID, eventType, data)
+}
+
+// MockMetadata - мок для CollectorInterface.
+type MockMetadata struct {
+	mock.Mock
+}
+
+// Collect - реализует метод интерфейса CollectorInterface.
+func (m *MockMetadata) Collect(shortKey string, originalURL string) {
+	m.Called(shortKey, originalURL)
+}
+
 // MockCookieManager - мок для CookieManagerInterface.
 type MockCookieManager struct {
 	mock.Mock
@@ -117,6 +186,12 @@ func (m *MockCookieManager) GetActualCookieValue() string {
 	return args.String(0)
 }
 
+// GetRequestUserID - реализует метод GetRequestUserID интерфейса CookieManagerInterface.
+func (m *MockCookieManager) GetRequestUserID(r *http.Request) string {
+	args := m.Called(r)
+	return args.String(0)
+}
+
 func TestWorker_SuccessfulDeletion(t *testing.T) {
 	userRepo := new(MockUserRepository)
 	cookieManager := &MockCookieManager{ActualCookieValue: "test_user_id"}
@@ -124,18 +199,17 @@ func TestWorker_SuccessfulDeletion(t *testing.T) {
 	us := &URLShortener{
 		UserRepository: userRepo,
 		CookieManager:  cookieManager,
-		RemoveChan:     make(chan string, 2), // создаем буферизированный канал
+		RemoveChan:     make(chan RemoveRequest, 2), // создаем буферизированный канал
 	}
 
 	shortURL := "shortURL1"
-	userRepo.On("DeleteUserUrls", cookieManager.ActualCookieValue, []string{shortURL}).Return(nil)
-	cookieManager.On("GetActualCookieValue").Return(cookieManager.ActualCookieValue)
+	userRepo.On("DeleteUserUrls", mock.Anything, cookieManager.ActualCookieValue, []string{shortURL}).Return(nil)
 
 	// Запускаем Worker в горутине
 	go us.Worker()
 
 	// Отправляем короткий URL в RemoveChan.
-	us.RemoveChan <- shortURL
+	us.RemoveChan <- RemoveRequest{UserID: cookieManager.ActualCookieValue, ShortURL: shortURL}
 
 	// Закрываем RemoveChan, чтобы сигнализировать о завершении.
 	close(us.RemoveChan)
@@ -154,17 +228,16 @@ func BenchmarkWorker(b *testing.B) {
 	us := &URLShortener{
 		UserRepository: userRepo,
 		CookieManager:  cookieManager,
-		RemoveChan:     make(chan string, 100),
+		RemoveChan:     make(chan RemoveRequest, 100),
 	}
 
 	for i := 0; i < b.N; i++ {
 		shortURL := "shortURL" + strconv.Itoa(i) // Генерация тестового короткого URL
-		userRepo.On("DeleteUserUrls", cookieManager.ActualCookieValue, []string{shortURL}).Return(nil)
-		cookieManager.On("GetActualCookieValue").Return(cookieManager.ActualCookieValue)
+		userRepo.On("DeleteUserUrls", mock.Anything, cookieManager.ActualCookieValue, []string{shortURL}).Return(nil)
 
 		go us.Worker()
 
-		us.RemoveChan <- shortURL
+		us.RemoveChan <- RemoveRequest{UserID: cookieManager.ActualCookieValue, ShortURL: shortURL}
 	}
 
 	close(us.RemoveChan)
@@ -179,16 +252,15 @@ func TestWorker_ErrorDuringDeletion(t *testing.T) {
 	us := &URLShortener{
 		UserRepository: userRepo,
 		CookieManager:  cookieManager,
-		RemoveChan:     make(chan string, 1),
+		RemoveChan:     make(chan RemoveRequest, 1),
 	}
 
 	shortURL := "shortURL1"
-	cookieManager.On("GetActualCookieValue").Return(cookieManager.ActualCookieValue)
-	userRepo.On("DeleteUserUrls", cookieManager.ActualCookieValue, []string{shortURL}).Return(errors.New("deletion error"))
+	userRepo.On("DeleteUserUrls", mock.Anything, cookieManager.ActualCookieValue, []string{shortURL}).Return(errors.New("deletion error"))
 
 	go us.Worker()
 
-	us.RemoveChan <- shortURL
+	us.RemoveChan <- RemoveRequest{UserID: cookieManager.ActualCookieValue, ShortURL: shortURL}
 	close(us.RemoveChan)
 
 	time.Sleep(100 * time.Millisecond) // Задержка для гарантии выполнения Worker
@@ -196,6 +268,36 @@ func TestWorker_ErrorDuringDeletion(t *testing.T) {
 	userRepo.AssertExpectations(t) // Проверяем, что DeleteUserUrls был вызван, даже если произошла ошибка
 }
 
+func TestWorker_DeletesAsRequestingUser(t *testing.T) {
+	userRepo := new(MockUserRepository)
+	cookieManager := &MockCookieManager{ActualCookieValue: "last_request_user"}
+
+	us := &URLShortener{
+		UserRepository: userRepo,
+		CookieManager:  cookieManager,
+		RemoveChan:     make(chan RemoveRequest, 2),
+	}
+
+	userRepo.On("DeleteUserUrls", mock.Anything, "user1", []string{"shortURL1"}).Return(nil).Once()
+	userRepo.On("DeleteUserUrls", mock.Anything, "user2", []string{"shortURL2"}).Return(nil).Once()
+
+	us.RemoveChan <- RemoveRequest{UserID: "user1", ShortURL: "shortURL1"}
+	us.RemoveChan <- RemoveRequest{UserID: "user2", ShortURL: "shortURL2"}
+	close(us.RemoveChan)
+
+	us.Worker()
+
+	userRepo.AssertExpectations(t)
+	cookieManager.AssertNotCalled(t, "GetActualCookieValue")
+}
+
+// savedRowWith сопоставляет сохраняемую запись по оригинальному URL и домену.
+func savedRowWith(URL string, domain string) interface{} {
+	return mock.MatchedBy(func(row storage.DataStorageRow) bool {
+		return row.URL == URL && row.Domain == domain
+	})
+}
+
 func TestGetHandler_URLNotFound(t *testing.T) {
 	mockRepo := new(MockURLRepository)
 	us := &URLShortener{URLRepository: mockRepo}
@@ -203,7 +305,7 @@ func TestGetHandler_URLNotFound(t *testing.T) {
 	req := httptest.NewRequest("GET", "/url/unknownID", nil)
 	w := httptest.NewRecorder()
 
-	mockRepo.On("GetURL", "").Return(storage.GetURLRow{}, false) // Установка ожидания для неопознанного URL
+	mockRepo.On("GetURL", mock.Anything, "").Return(storage.GetURLRow{}, storage.ErrNotFound) // Установка ожидания для неопознанного URL
 
 	us.GetHandler(w, req)
 
@@ -213,6 +315,47 @@ func TestGetHandler_URLNotFound(t *testing.T) {
 	mockRepo.AssertExpectations(t)
 }
 
+func TestGetHandler_StorageUnavailable(t *testing.T) {
+	mockRepo := new(MockURLRepository)
+	us := &URLShortener{URLRepository: mockRepo}
+
+	req := httptest.NewRequest("GET", "/url/knownID", nil)
+	w := httptest.NewRecorder()
+
+	mockRepo.On("GetURL", mock.Anything, "").
+		Return(storage.GetURLRow{}, fmt.Errorf("%w: connection reset", storage.ErrUnavailable))
+
+	us.GetHandler(w, req)
+
+	res := w.Result()
+	res.Body.Close()
+	assert.Equal(t, http.StatusServiceUnavailable, res.StatusCode, "Outage should not be reported as 404")
+}
+
+func TestJSONPostHandler_ShortKeyCollision(t *testing.T) {
+	mockRepo := new(MockURLRepository)
+	mockCookieManager := new(MockCookieManager)
+	us := &URLShortener{
+		URLRepository: mockRepo,
+		CookieManager: mockCookieManager,
+		BaseURL:       "http://short.url/",
+	}
+
+	// Сгенерированный ключ уже занят другой ссылкой: сохранение повторяется с новым ключом
+	mockCookieManager.On("GetRequestUserID", mock.Anything).Return("user1")
+	mockRepo.On("InsertOrGet", mock.Anything, savedRowWith("http://example.com", "")).
+		Return(storage.DataStorageRow{}, false, fmt.Errorf("%w: duplicate key value", storage.ErrConflict)).Once()
+	mockRepo.On("InsertOrGet", mock.Anything, savedRowWith("http://example.com", "")).
+		Return(storage.DataStorageRow{}, true, nil).Once()
+
+	req := httptest.NewRequest("POST", "/api/shorten", bytes.NewBufferString(`{"url":"http://example.com"}`))
+	w := httptest.NewRecorder()
+	us.JSONPostHandler(w, req)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+	mockRepo.AssertNumberOfCalls(t, "InsertOrGet", 2)
+}
+
 func TestGetHandler_URLExists(t *testing.T) {
 	mockRepo := new(MockURLRepository)
 	us := &URLShortener{URLRepository: mockRepo}
@@ -222,7 +365,7 @@ func TestGetHandler_URLExists(t *testing.T) {
 
 	expectedURL := "http://example.com"
 	storedRow := storage.GetURLRow{URL: expectedURL, IsDeleted: false}
-	mockRepo.On("GetURL", "").Return(storedRow, true) // Установка ожидания для существующего URL
+	mockRepo.On("GetURL", mock.Anything, "").Return(storedRow, nil) // Установка ожидания для существующего URL
 
 	// Act
 	us.GetHandler(w, req)
@@ -243,7 +386,7 @@ func TestGetHandler_URLIsDeleted(t *testing.T) {
 	w := httptest.NewRecorder()
 
 	storedRow := storage.GetURLRow{URL: "http://example.com", IsDeleted: true}
-	mockRepo.On("GetURL", "").Return(storedRow, true) // Установка ожидания для удаленного URL
+	mockRepo.On("GetURL", mock.Anything, "").Return(storedRow, nil) // Установка ожидания для удаленного URL
 
 	us.GetHandler(w, req)
 
@@ -253,6 +396,26 @@ func TestGetHandler_URLIsDeleted(t *testing.T) {
 	mockRepo.AssertExpectations(t)
 }
 
+func TestGetHandler_URLIsDisabled(t *testing.T) {
+	mockRepo := new(MockURLRepository)
+	us := &URLShortener{URLRepository: mockRepo}
+
+	req := httptest.NewRequest("GET", "/url/disabledID", nil)
+	w := httptest.NewRecorder()
+
+	storedRow := storage.GetURLRow{URL: "http://example.com", DisabledReason: "phishing"}
+	mockRepo.On("GetURL", mock.Anything, "").Return(storedRow, nil)
+
+	us.GetHandler(w, req)
+
+	res := w.Result()
+	defer res.Body.Close()
+	assert.Equal(t, http.StatusGone, res.StatusCode)
+	assert.Empty(t, res.Header.Get("Location"))
+	assert.Contains(t, w.Body.String(), "phishing")
+	mockRepo.AssertExpectations(t)
+}
+
 func TestPingHandler_SuccessfulConnection(t *testing.T) {
 	mockRepo := new(MockURLRepository)
 	us := &URLShortener{URLRepository: mockRepo}
@@ -260,7 +423,7 @@ func TestPingHandler_SuccessfulConnection(t *testing.T) {
 	req := httptest.NewRequest("GET", "/ping", nil)
 	w := httptest.NewRecorder()
 
-	mockRepo.On("Ping").Return(true) // Установка ожидания на успешный пинг
+	mockRepo.On("Ping", mock.Anything).Return(true) // Установка ожидания на успешный пинг
 
 	us.PingHandler(w, req)
 
@@ -277,7 +440,7 @@ func TestPingHandler_ConnectionError(t *testing.T) {
 	req := httptest.NewRequest("GET", "/ping", nil)
 	w := httptest.NewRecorder()
 
-	mockRepo.On("Ping").Return(false) // Установка ожидания на ошибку пинга
+	mockRepo.On("Ping", mock.Anything).Return(false) // Установка ожидания на ошибку пинга
 
 	us.PingHandler(w, req)
 
@@ -329,6 +492,75 @@ func (m *MockURLShortener) Worker() {
 	m.Called()
 }
 
+// StatsHandler - реализует метод интерфейса
+func (m *MockURLShortener) StatsHandler(w http.ResponseWriter, r *http.Request) {
+	m.Called(w, r)
+}
+
+func TestStatsHandler_Success(t *testing.T) {
+	mockURLRepo := new(MockURLRepository)
+	mockUserRepo := new(MockUserRepository)
+	us := &URLShortener{
+		URLRepository:  mockURLRepo,
+		UserRepository: mockUserRepo,
+	}
+
+	mockURLRepo.On("GetURLCount", mock.Anything).Return(42)
+	mockUserRepo.On("GetUsersCount", mock.Anything).Return(7)
+
+	req := httptest.NewRequest("GET", "/api/internal/stats", nil)
+	w := httptest.NewRecorder()
+
+	us.StatsHandler(w, req)
+
+	res := w.Result()
+	defer res.Body.Close()
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+
+	var responseBody StatsResponseBody
+	assert.NoError(t, json.NewDecoder(res.Body).Decode(&responseBody))
+	assert.Equal(t, StatsResponseBody{URLs: 42, Users: 7}, responseBody)
+
+	mockURLRepo.AssertExpectations(t)
+	mockUserRepo.AssertExpectations(t)
+}
+
+func TestStatsHandler_URLCache(t *testing.T) {
+	mockURLRepo := new(MockURLRepository)
+	mockUserRepo := new(MockUserRepository)
+	urlCache := repository.NewCachedURLRepository(mockURLRepo, 10, time.Minute, time.Minute)
+	us := &URLShortener{
+		URLRepository:  urlCache,
+		UserRepository: mockUserRepo,
+	}
+
+	mockURLRepo.On("GetURL", mock.Anything, "shortKey").Return(storage.GetURLRow{URL: "https://example.com"}, nil).Once()
+	mockURLRepo.On("GetURLCount", mock.Anything).Return(42)
+	mockUserRepo.On("GetUsersCount", mock.Anything).Return(7)
+
+	for i := 0; i < 3; i++ {
+		_, err := urlCache.GetURL(context.Background(), "shortKey")
+		assert.NoError(t, err)
+	}
+
+	req := httptest.NewRequest("GET", "/api/internal/stats", nil)
+	w := httptest.NewRecorder()
+
+	us.StatsHandler(w, req)
+
+	res := w.Result()
+	defer res.Body.Close()
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+
+	var responseBody StatsResponseBody
+	assert.NoError(t, json.NewDecoder(res.Body).Decode(&responseBody))
+	assert.Equal(t, StatsResponseBody{URLs: 42, Users: 7, Cache: &repository.CacheStats{Hits: 2, Misses: 1}},
+		responseBody)
+
+	mockURLRepo.AssertExpectations(t)
+	mockUserRepo.AssertExpectations(t)
+}
+
 func TestJSONPostHandler_Success(t *testing.T) {
 	mockRepo := new(MockURLRepository)
 	mockCookieManager := new(MockCookieManager)
@@ -346,9 +578,9 @@ func TestJSONPostHandler_Success(t *testing.T) {
 	w := httptest.NewRecorder()
 
 	// Установка ожидания
-	mockRepo.On("GetShortURL", mock.Anything).Return("", errors.New("short url not found"))
-	mockRepo.On("Save", mock.Anything, requestBody.URL, mock.Anything).Return(nil)
-	mockCookieManager.On("GetActualCookieValue").Return("")
+	mockRepo.On("InsertOrGet", mock.Anything, savedRowWith(requestBody.URL, "")).
+		Return(storage.DataStorageRow{}, true, nil)
+	mockCookieManager.On("GetRequestUserID", mock.Anything).Return("")
 
 	// Act
 	us.JSONPostHandler(w, req)
@@ -451,9 +683,9 @@ func TestJSONPostHandler_InternalServerErrorOnSave(t *testing.T) {
 	w := httptest.NewRecorder()
 
 	// Установка ожидания
-	mockRepo.On("GetShortURL", mock.Anything).Return("", errors.New("short url not found"))
-	mockRepo.On("Save", mock.Anything, requestBody.URL, mock.Anything).Return(errors.New("err"))
-	mockCookieManager.On("GetActualCookieValue").Return("")
+	mockRepo.On("InsertOrGet", mock.Anything, savedRowWith(requestBody.URL, "")).
+		Return(storage.DataStorageRow{}, false, errors.New("err"))
+	mockCookieManager.On("GetRequestUserID", mock.Anything).Return("")
 
 	// Act
 	us.JSONPostHandler(w, req)
@@ -467,9 +699,11 @@ func TestJSONPostHandler_InternalServerErrorOnSave(t *testing.T) {
 func TestJSONBatchHandler_Success(t *testing.T) {
 	mockRepo := new(MockURLRepository)
 	mockCookieManager := new(MockCookieManager)
+	mockWebhooks := new(MockWebhooks)
 	us := &URLShortener{
 		URLRepository: mockRepo,
 		CookieManager: mockCookieManager,
+		Webhooks:      mockWebhooks,
 		BaseURL:       "http://short.url/",
 	}
 
@@ -484,19 +718,31 @@ func TestJSONBatchHandler_Success(t *testing.T) {
 	req.Header.Set("Content-Type", "application/json")
 	w := httptest.NewRecorder()
 
-	// Установка ожиданий на методы
-	mockCookieManager.On("GetActualCookieValue").Return("")
-	mockRepo.On("GetShortURL", "http://example.com").Return("", nil)
-	mockRepo.On("GetShortURL", "http://anotherexample.com").Return("", nil)
-	mockRepo.On("SaveBatch", mock.Anything).Return(nil)
+	// Установка ожиданий на методы: первая ссылка создается, вторая уже сохранена
+	mockCookieManager.On("GetRequestUserID", mock.Anything).Return("user1")
+	mockRepo.On("InsertOrGet", mock.Anything, savedRowWith("http://example.com", "")).
+		Return(storage.DataStorageRow{}, true, nil)
+	mockRepo.On("InsertOrGet", mock.Anything, savedRowWith("http://anotherexample.com", "")).
+		Return(storage.DataStorageRow{ShortURL: "exists", URL: "http://anotherexample.com"}, false, nil)
+	mockWebhooks.On("Emit", mock.Anything, "user1", webhook.EventLinkCreated, mock.MatchedBy(func(data webhook.LinkData) bool {
+		return data.OriginalURL == "http://example.com"
+	})).Once()
 
 	// Act
 	us.JSONBatchHandler(w, req)
 
 	res := w.Result()
+	defer res.Body.Close()
 	assert.Equal(t, http.StatusCreated, res.StatusCode)
-	res.Body.Close()
+
+	var responseBody []BatchResponseBodyItem
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&responseBody))
+	require.Len(t, responseBody, 2)
+	assert.Equal(t, "1", responseBody[0].CorrelationID)
+	assert.Equal(t, BatchResponseBodyItem{CorrelationID: "2", ShortURL: "http://short.url/exists"}, responseBody[1])
+	mockRepo.AssertNotCalled(t, "SaveBatch", mock.Anything, mock.Anything)
 	mockRepo.AssertExpectations(t)
+	mockWebhooks.AssertExpectations(t)
 }
 
 func TestJSONBatchHandler_ReadError(t *testing.T) {
@@ -526,7 +772,7 @@ func TestJSONBatchHandler_JSONUnmarshalError(t *testing.T) {
 	assert.Equal(t, http.StatusBadRequest, res.StatusCode) // Ожидаем 400 Bad Request
 }
 
-func TestJSONBatchHandler_ErrorOnGetShortURL(t *testing.T) {
+func TestJSONBatchHandler_StorageUnavailable(t *testing.T) {
 	mockRepo := new(MockURLRepository)
 	mockCookieManager := new(MockCookieManager)
 	us := &URLShortener{
@@ -545,20 +791,20 @@ func TestJSONBatchHandler_ErrorOnGetShortURL(t *testing.T) {
 	req.Header.Set("Content-Type", "application/json")
 	w := httptest.NewRecorder()
 
-	// Установка ожидания на получение короткого URL, который вызывает ошибку
-	mockCookieManager.On("GetActualCookieValue", mock.Anything).Return("")
-	mockRepo.On("GetShortURL", "http://example.com").Return("", errors.New("get error"))
-	mockRepo.On("SaveBatch", mock.Anything).Return(nil)
+	// Установка ожидания на сохранение ссылки, которое вызывает ошибку
+	mockCookieManager.On("GetRequestUserID", mock.Anything).Return("")
+	mockRepo.On("InsertOrGet", mock.Anything, savedRowWith("http://example.com", "")).
+		Return(storage.DataStorageRow{}, false, fmt.Errorf("%w: connection refused", storage.ErrUnavailable))
 
 	// Act
 	us.JSONBatchHandler(w, req)
 
 	res := w.Result()
-	assert.Equal(t, http.StatusCreated, res.StatusCode) // Ожидаем 201
+	assert.Equal(t, http.StatusServiceUnavailable, res.StatusCode) // Ожидаем 503
 	res.Body.Close()
 }
 
-func TestJSONBatchHandler_ErrorOnSaveBatch(t *testing.T) {
+func TestJSONBatchHandler_ErrorOnSave(t *testing.T) {
 	mockRepo := new(MockURLRepository)
 	mockCookieManager := new(MockCookieManager)
 	us := &URLShortener{
@@ -578,10 +824,9 @@ func TestJSONBatchHandler_ErrorOnSaveBatch(t *testing.T) {
 	w := httptest.NewRecorder()
 
 	// Установка ожиданий
-	mockCookieManager.On("GetActualCookieValue", mock.Anything).Return("")
-	mockRepo.On("GetShortURL", "http://example.com").Return("", nil)                                         // Не найден
-	mockRepo.On("Save", mock.Anything, "http://example.com", mock.Anything).Return(errors.New("save error")) // Ошибка при сохранении
-	mockRepo.On("SaveBatch", mock.Anything).Return(errors.New("save error"))
+	mockCookieManager.On("GetRequestUserID", mock.Anything).Return("")
+	mockRepo.On("InsertOrGet", mock.Anything, savedRowWith("http://example.com", "")).
+		Return(storage.DataStorageRow{}, false, errors.New("save error"))
 
 	us.JSONBatchHandler(w, req)
 
@@ -590,6 +835,67 @@ func TestJSONBatchHandler_ErrorOnSaveBatch(t *testing.T) {
 	res.Body.Close()
 }
 
+func TestJSONBatchHandler_PartialFailureKeepsCreatedLinks(t *testing.T) {
+	mockRepo := new(MockURLRepository)
+	mockCookieManager := new(MockCookieManager)
+	mockWebhooks := new(MockWebhooks)
+	us := &URLShortener{
+		URLRepository: mockRepo,
+		CookieManager: mockCookieManager,
+		Webhooks:      mockWebhooks,
+		BaseURL:       "http://short.url/",
+	}
+
+	requestBody := []BatchRequestBody{
+		{CorrelationID: "1", OriginalURL: "http://example.com"},
+		{CorrelationID: "2", OriginalURL: "http://anotherexample.com"},
+		{CorrelationID: "3", OriginalURL: "http://third.example.com"},
+	}
+	jsonBody, _ := json.Marshal(requestBody)
+
+	// Первая ссылка создается, сохранение второй завершается ошибкой, третья не сохраняется
+	mockCookieManager.On("GetRequestUserID", mock.Anything).Return("user1")
+	mockRepo.On("InsertOrGet", mock.Anything, savedRowWith("http://example.com", "")).
+		Return(storage.DataStorageRow{}, true, nil).Once()
+	mockRepo.On("InsertOrGet", mock.Anything, savedRowWith("http://anotherexample.com", "")).
+		Return(storage.DataStorageRow{}, false, fmt.Errorf("%w: connection reset", storage.ErrUnavailable)).Once()
+	mockWebhooks.On("Emit", mock.Anything, "user1", webhook.EventLinkCreated, mock.MatchedBy(func(data webhook.LinkData) bool {
+		return data.OriginalURL == "http://example.com"
+	})).Once()
+
+	w := httptest.NewRecorder()
+	us.JSONBatchHandler(w, httptest.NewRequest("POST", "/api/shorten/batch", bytes.NewBuffer(jsonBody)))
+
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	mockRepo.AssertExpectations(t)
+	mockRepo.AssertNotCalled(t, "InsertOrGet", mock.Anything, savedRowWith("http://third.example.com", ""))
+	mockWebhooks.AssertExpectations(t)
+
+	// Повторный запрос возвращает созданную ссылку как существующую без повторного события
+	mockRepo.On("InsertOrGet", mock.Anything, savedRowWith("http://example.com", "")).
+		Return(storage.DataStorageRow{ShortURL: "first", URL: "http://example.com"}, false, nil).Once()
+	mockRepo.On("InsertOrGet", mock.Anything, savedRowWith("http://anotherexample.com", "")).
+		Return(storage.DataStorageRow{}, true, nil).Once()
+	mockRepo.On("InsertOrGet", mock.Anything, savedRowWith("http://third.example.com", "")).
+		Return(storage.DataStorageRow{}, true, nil).Once()
+	mockWebhooks.On("Emit", mock.Anything, "user1", webhook.EventLinkCreated, mock.MatchedBy(func(data webhook.LinkData) bool {
+		return data.OriginalURL != "http://example.com"
+	})).Twice()
+
+	w = httptest.NewRecorder()
+	us.JSONBatchHandler(w, httptest.NewRequest("POST", "/api/shorten/batch", bytes.NewBuffer(jsonBody)))
+
+	require.Equal(t, http.StatusCreated, w.Code)
+
+	var responseBody []BatchResponseBodyItem
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &responseBody))
+	require.Len(t, responseBody, 3)
+	assert.Equal(t, "http://short.url/first", responseBody[0].ShortURL)
+	mockRepo.AssertExpectations(t)
+	mockWebhooks.AssertExpectations(t)
+	mockWebhooks.AssertNumberOfCalls(t, "Emit", 3)
+}
+
 // Тест успешно получения URLs пользователя
 func TestGetUserUrls_Success(t *testing.T) {
 	mockRepo := new(MockUserRepository)
@@ -600,14 +906,14 @@ func TestGetUserUrls_Success(t *testing.T) {
 	}
 
 	// Предполагаем, что GetActualCookieValue вернет "test_user_id"
-	mockCookieManager.On("GetActualCookieValue").Return("test_user_id")
+	mockCookieManager.On("GetRequestUserID", mock.Anything).Return("test_user_id")
 
 	// Подготовка данных
 	expectedUrls := []storage.UserUrlsResponseBodyItem{
 		{ShortURL: "shortURL1"},
 		{ShortURL: "shortURL2"},
 	}
-	mockRepo.On("GetUserUrls", "test_user_id").Return(expectedUrls, nil) // Определяем, что должно быть возвращено
+	mockRepo.On("GetUserUrls", mock.Anything, "test_user_id").Return(expectedUrls, nil) // Определяем, что должно быть возвращено
 
 	// Создаем HTTP-запрос
 	req := httptest.NewRequest("GET", "/user/urls", nil)
@@ -638,8 +944,8 @@ func TestGetUserUrls_Error(t *testing.T) {
 		CookieManager:  mockCookieManager,
 	}
 
-	mockCookieManager.On("GetActualCookieValue").Return("test_user_id")
-	mockRepo.On("GetUserUrls", "test_user_id").Return([]storage.UserUrlsResponseBodyItem{}, errors.New("db error")) // Установка ожидания
+	mockCookieManager.On("GetRequestUserID", mock.Anything).Return("test_user_id")
+	mockRepo.On("GetUserUrls", mock.Anything, "test_user_id").Return([]storage.UserUrlsResponseBodyItem{}, errors.New("db error")) // Установка ожидания
 
 	req := httptest.NewRequest("GET", "/user/urls", nil)
 	w := httptest.NewRecorder()
@@ -663,8 +969,8 @@ func TestGetUserUrls_NoContent(t *testing.T) {
 		CookieManager:  mockCookieManager,
 	}
 
-	mockCookieManager.On("GetActualCookieValue").Return("test_user_id")
-	mockRepo.On("GetUserUrls", "test_user_id").Return([]storage.UserUrlsResponseBodyItem{}, nil) // Пустой список
+	mockCookieManager.On("GetRequestUserID", mock.Anything).Return("test_user_id")
+	mockRepo.On("GetUserUrls", mock.Anything, "test_user_id").Return([]storage.UserUrlsResponseBodyItem{}, nil) // Пустой список
 
 	req := httptest.NewRequest("GET", "/user/urls", nil)
 	w := httptest.NewRecorder()
@@ -694,9 +1000,9 @@ func TestPostHandler_Success(t *testing.T) {
 	w := httptest.NewRecorder()
 
 	// Устанавливаем ожидания
-	mockCookieManager.On("GetActualCookieValue").Return("")
-	mockRepo.On("GetShortURL", requestBody).Return("", errors.New("short url not found")) // URL не найден
-	mockRepo.On("Save", mock.Anything, requestBody, mock.Anything).Return(nil)            // Успешно сохранить
+	mockCookieManager.On("GetRequestUserID", mock.Anything).Return("")
+	mockRepo.On("InsertOrGet", mock.Anything, savedRowWith(requestBody, "")).
+		Return(storage.DataStorageRow{}, true, nil) // Успешно сохранить
 
 	// Act
 	us.PostHandler(w, req)
@@ -748,6 +1054,7 @@ func TestPostHandler_InvalidURL(t *testing.T) {
 
 // TestDeleteUserUrlsBatch_Success - тестирует успешное удаление URLs
 func TestDeleteUserUrlsBatch_Success(t *testing.T) {
+	ctx := context.Background()
 	mockRepo := new(MockUserRepository)
 	mockCookieManager := new(MockCookieManager)
 
@@ -756,22 +1063,20 @@ func TestDeleteUserUrlsBatch_Success(t *testing.T) {
 		CookieManager:  mockCookieManager,
 	}
 
-	// Устанавливаем ожидания для CookieManager
-	mockCookieManager.On("GetActualCookieValue").Return("test_user_id")
-
 	// Подготовка тестовых данных
 	shortURLs := []string{"shortURL1", "shortURL2", "shortURL3", "shortURL4", "shortURL5"}
 
 	// Устанавливаем ожидания на удаление
-	mockRepo.On("DeleteUserUrls", "test_user_id", mock.Anything).Return(nil).Once()
+	mockRepo.On("DeleteUserUrls", mock.Anything, "test_user_id", mock.Anything).Return(nil).Once()
 
-	us.DeleteUserUrlsBatch(shortURLs)
+	us.DeleteUserUrlsBatch(ctx, "test_user_id", shortURLs)
 
 	mockRepo.AssertExpectations(t)
 }
 
 // TestDeleteUserUrlsBatch_DeleteError - тестирует поведение при ошибке удаления
 func TestDeleteUserUrlsBatch_DeleteError(t *testing.T) {
+	ctx := context.Background()
 	mockRepo := new(MockUserRepository)
 	mockCookieManager := new(MockCookieManager)
 
@@ -780,22 +1085,20 @@ func TestDeleteUserUrlsBatch_DeleteError(t *testing.T) {
 		CookieManager:  mockCookieManager,
 	}
 
-	// Устанавливаем ожидания для CookieManager
-	mockCookieManager.On("GetActualCookieValue").Return("test_user_id")
-
 	// Подготовка тестовых данных
 	shortURLs := []string{"shortURL1", "shortURL2", "shortURL3"}
 
 	// Устанавливаем ожидание на удаление с ошибкой
-	mockRepo.On("DeleteUserUrls", mock.Anything, mock.Anything).Return(errors.New("delete error")).Once()
+	mockRepo.On("DeleteUserUrls", mock.Anything, mock.Anything, mock.Anything).Return(errors.New("delete error")).Once()
 
-	us.DeleteUserUrlsBatch(shortURLs)
+	us.DeleteUserUrlsBatch(ctx, "test_user_id", shortURLs)
 
 	mockRepo.AssertExpectations(t)
 }
 
 // TestDeleteUserUrlsBatch_WithBatches - тестирует поведение с несколькими батчами
 func TestDeleteUserUrlsBatch_WithBatches(t *testing.T) {
+	ctx := context.Background()
 	mockRepo := new(MockUserRepository)
 	mockCookieManager := new(MockCookieManager)
 
@@ -804,9 +1107,6 @@ func TestDeleteUserUrlsBatch_WithBatches(t *testing.T) {
 		CookieManager:  mockCookieManager,
 	}
 
-	// Устанавливаем ожидания для CookieManager
-	mockCookieManager.On("GetActualCookieValue").Return("test_user_id")
-
 	// Подготовка тестовых данных, больше чем 100 элементов
 	shortURLs := make([]string, 150)
 	for i := 0; i < 150; i++ {
@@ -814,12 +1114,12 @@ func TestDeleteUserUrlsBatch_WithBatches(t *testing.T) {
 	}
 
 	// Устанавливаем ожидание на удаление для первых 100
-	mockRepo.On("DeleteUserUrls", "test_user_id", shortURLs[:100]).Return(nil).Once()
+	mockRepo.On("DeleteUserUrls", mock.Anything, "test_user_id", shortURLs[:100]).Return(nil).Once()
 	// Устанавливаем ожидание на удаление для оставшихся 50
-	mockRepo.On("DeleteUserUrls", "test_user_id", shortURLs[100:150]).Return(nil).Once()
+	mockRepo.On("DeleteUserUrls", mock.Anything, "test_user_id", shortURLs[100:150]).Return(nil).Once()
 
 	// Act
-	us.DeleteUserUrlsBatch(shortURLs)
+	us.DeleteUserUrlsBatch(ctx, "test_user_id", shortURLs)
 
 	// Assert
 	mockRepo.AssertExpectations(t)
@@ -832,11 +1132,12 @@ func TestDeleteUserUrls_Success(t *testing.T) {
 	us := &URLShortener{
 		UserRepository: mockRepo,
 		CookieManager:  mockCookieManager,
-		RemoveChan:     make(chan string, 10), // Буферизированный канал
+		RemoveChan:     make(chan RemoveRequest, 10), // Буферизированный канал
 	}
 
 	shortURLs := []string{"shortURL1", "shortURL2", "shortURL3"}
 	body, _ := json.Marshal(shortURLs)
+	mockCookieManager.On("GetRequestUserID", mock.Anything).Return("test_user_id")
 
 	// Создаем тестовый HTTP-запрос
 	req := httptest.NewRequest("DELETE", "/user/urls", bytes.NewBuffer(body))
@@ -853,8 +1154,9 @@ func TestDeleteUserUrls_Success(t *testing.T) {
 
 	// Проверяем, что короткие URL отправлены в канал RemoveChan
 	close(us.RemoveChan)
-	for shortURL := range us.RemoveChan {
-		assert.Contains(t, shortURLs, shortURL) // Проверяем, что URL находится в нашем списке
+	for request := range us.RemoveChan {
+		assert.Contains(t, shortURLs, request.ShortURL) // Проверяем, что URL находится в нашем списке
+		assert.Equal(t, "test_user_id", request.UserID, "Deletion should keep the requesting user")
 	}
 
 	mockRepo.AssertExpectations(t)
@@ -894,3 +1196,726 @@ func TestDeleteUserUrls_EmptyBody(t *testing.T) {
 	res.Body.Close()
 	assert.Equal(t, http.StatusBadRequest, res.StatusCode) // Ожидаем статус 400 Bad Request
 }
+
+func TestParseDomains(t *testing.T) {
+	domains, err := ParseDomains([]string{"https://Go.Example.com", "https://s.example.org/"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"go.example.com": "https://Go.Example.com/",
+		"s.example.org":  "https://s.example.org/",
+	}, domains)
+
+	_, err = ParseDomains([]string{"not a url"})
+	assert.Error(t, err)
+}
+
+func TestPostHandler_Domain(t *testing.T) {
+	mockRepo := new(MockURLRepository)
+	mockCookieManager := new(MockCookieManager)
+	us := &URLShortener{
+		CookieManager: mockCookieManager,
+		URLRepository: mockRepo,
+		BaseURL:       "http://short.url",
+		Domains:       map[string]string{"go.example.com": "https://go.example.com/"},
+	}
+
+	mockCookieManager.On("GetRequestUserID", mock.Anything).Return("")
+	mockRepo.On("InsertOrGet", mock.Anything, savedRowWith("http://example.com", "go.example.com")).
+		Return(storage.DataStorageRow{}, true, nil)
+
+	req := httptest.NewRequest("POST", "/?domain=go.example.com", bytes.NewBufferString("http://example.com"))
+	w := httptest.NewRecorder()
+
+	us.PostHandler(w, req)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.True(t, strings.HasPrefix(w.Body.String(), "https://go.example.com/"))
+	// Базовый адрес по умолчанию не изменяется при формировании ответа
+	assert.Equal(t, "http://short.url", us.BaseURL)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestJSONPostHandler_UnknownDomain(t *testing.T) {
+	mockRepo := new(MockURLRepository)
+	mockCookieManager := new(MockCookieManager)
+	us := &URLShortener{
+		URLRepository: mockRepo,
+		CookieManager: mockCookieManager,
+		BaseURL:       "http://short.url/",
+	}
+
+	mockCookieManager.On("GetRequestUserID", mock.Anything).Return("")
+
+	jsonBody, _ := json.Marshal(RequestBody{URL: "http://example.com", Domain: "evil.example.com"})
+	req := httptest.NewRequest("POST", "/api/shorten", bytes.NewBuffer(jsonBody))
+	w := httptest.NewRecorder()
+
+	us.JSONPostHandler(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	mockRepo.AssertNotCalled(t, "Save", mock.Anything)
+}
+
+func TestJSONPostHandler_ExistingLinkKeepsDomain(t *testing.T) {
+	mockRepo := new(MockURLRepository)
+	mockCookieManager := new(MockCookieManager)
+	us := &URLShortener{
+		URLRepository: mockRepo,
+		CookieManager: mockCookieManager,
+		BaseURL:       "http://short.url/",
+		Domains:       map[string]string{"go.example.com": "https://go.example.com/"},
+	}
+
+	mockCookieManager.On("GetRequestUserID", mock.Anything).Return("")
+	mockRepo.On("InsertOrGet", mock.Anything, savedRowWith("http://example.com", "go.example.com")).
+		Return(storage.DataStorageRow{ShortURL: "abc", URL: "http://example.com", Domain: "go.example.com"}, false, nil)
+
+	jsonBody, _ := json.Marshal(RequestBody{URL: "http://example.com", Domain: "go.example.com"})
+	req := httptest.NewRequest("POST", "/api/shorten", bytes.NewBuffer(jsonBody))
+	w := httptest.NewRecorder()
+
+	us.JSONPostHandler(w, req)
+
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	var responseBody JSONResponseBody
+	assert.NoError(t, json.NewDecoder(w.Body).Decode(&responseBody))
+	assert.Equal(t, "https://go.example.com/abc", responseBody.Result)
+}
+
+func TestShortenHandlers_URLInOtherDomain(t *testing.T) {
+	existing := storage.DataStorageRow{ShortURL: "abc", URL: "http://example.com"}
+
+	tests := []struct {
+		name    string
+		handler func(us *URLShortener) http.HandlerFunc
+		request func() *http.Request
+	}{
+		{
+			name:    "JSON",
+			handler: func(us *URLShortener) http.HandlerFunc { return us.JSONPostHandler },
+			request: func() *http.Request {
+				jsonBody, _ := json.Marshal(RequestBody{URL: "http://example.com", Domain: "go.example.com"})
+				return httptest.NewRequest("POST", "/api/shorten", bytes.NewBuffer(jsonBody))
+			},
+		},
+		{
+			name:    "Plain text",
+			handler: func(us *URLShortener) http.HandlerFunc { return us.PostHandler },
+			request: func() *http.Request {
+				return httptest.NewRequest("POST", "/?domain=go.example.com", strings.NewReader("http://example.com"))
+			},
+		},
+		{
+			name:    "Batch",
+			handler: func(us *URLShortener) http.HandlerFunc { return us.JSONBatchHandler },
+			request: func() *http.Request {
+				jsonBody, _ := json.Marshal([]BatchRequestBody{
+					{CorrelationID: "1", OriginalURL: "http://example.com", Domain: "go.example.com"},
+				})
+				return httptest.NewRequest("POST", "/api/shorten/batch", bytes.NewBuffer(jsonBody))
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo := new(MockURLRepository)
+			mockCookieManager := new(MockCookieManager)
+			us := &URLShortener{
+				URLRepository: mockRepo,
+				CookieManager: mockCookieManager,
+				BaseURL:       "http://short.url/",
+				Domains:       map[string]string{"go.example.com": "https://go.example.com/"},
+			}
+
+			mockCookieManager.On("GetRequestUserID", mock.Anything).Return("")
+			mockRepo.On("InsertOrGet", mock.Anything, savedRowWith("http://example.com", "go.example.com")).
+				Return(existing, false, nil)
+
+			w := httptest.NewRecorder()
+
+			tt.handler(us)(w, tt.request())
+
+			// Ссылка домена по умолчанию не выдаётся за ссылку запрошенного домена
+			assert.Equal(t, http.StatusConflict, w.Code)
+			assert.Contains(t, w.Body.String(), ErrURLInOtherDomain.Error())
+			assert.Contains(t, w.Body.String(), "http://short.url/abc")
+		})
+	}
+}
+
+func TestGetHandler_Domain(t *testing.T) {
+	mockRepo := new(MockURLRepository)
+	us := &URLShortener{
+		URLRepository: mockRepo,
+		BaseURL:       "http://short.url/",
+		Domains:       map[string]string{"go.example.com": "https://go.example.com/"},
+	}
+
+	storedRow := storage.GetURLRow{URL: "http://example.com", Domain: "go.example.com"}
+	mockRepo.On("GetURL", mock.Anything, "abc").Return(storedRow, nil)
+
+	tests := []struct {
+		name       string
+		host       string
+		wantStatus int
+	}{
+		{name: "link domain", host: "go.example.com", wantStatus: http.StatusTemporaryRedirect},
+		{name: "default domain", host: "short.url", wantStatus: http.StatusNotFound},
+		{name: "unknown host", host: "other.example.com", wantStatus: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/abc", nil)
+			req.Host = tt.host
+			req.SetPathValue("id", "abc")
+			w := httptest.NewRecorder()
+
+			us.GetHandler(w, req)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+		})
+	}
+}
+
+func TestGetHandler_DeviceURLs(t *testing.T) {
+	mockRepo := new(MockURLRepository)
+	us := &URLShortener{URLRepository: mockRepo}
+
+	storedRow := storage.GetURLRow{
+		URL: "http://example.com",
+		DeviceURLs: storage.DeviceURLs{
+			IOSURL:     "https://apps.apple.com/app/id1",
+			AndroidURL: "https://play.google.com/store/apps/details?id=app",
+		},
+	}
+	mockRepo.On("GetURL", mock.Anything, "abc").Return(storedRow, nil)
+
+	tests := []struct {
+		name         string
+		userAgent    string
+		wantLocation string
+	}{
+		{
+			name:         "iOS",
+			userAgent:    "Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) AppleWebKit/605.1.15",
+			wantLocation: storedRow.IOSURL,
+		},
+		{
+			name:         "Android",
+			userAgent:    "Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36",
+			wantLocation: storedRow.AndroidURL,
+		},
+		{
+			name:         "desktop",
+			userAgent:    "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36",
+			wantLocation: storedRow.URL,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/abc", nil)
+			req.Header.Set("User-Agent", tt.userAgent)
+			req.SetPathValue("id", "abc")
+			w := httptest.NewRecorder()
+
+			us.GetHandler(w, req)
+
+			assert.Equal(t, http.StatusTemporaryRedirect, w.Code)
+			assert.Equal(t, tt.wantLocation, w.Header().Get("Location"))
+			assert.Equal(t, "User-Agent", w.Header().Get("Vary"))
+		})
+	}
+}
+
+func TestJSONPostHandler_DeviceURLs(t *testing.T) {
+	mockRepo := new(MockURLRepository)
+	mockCookieManager := new(MockCookieManager)
+	us := &URLShortener{
+		URLRepository: mockRepo,
+		CookieManager: mockCookieManager,
+		BaseURL:       "http://short.url/",
+	}
+
+	mockCookieManager.On("GetRequestUserID", mock.Anything).Return("")
+	mockRepo.On("InsertOrGet", mock.Anything, mock.MatchedBy(func(row storage.DataStorageRow) bool {
+		return row.IOSURL == "https://apps.apple.com/app/id1" && row.AndroidURL == ""
+	})).Return(storage.DataStorageRow{}, true, nil)
+
+	req := httptest.NewRequest("POST", "/api/shorten",
+		bytes.NewBufferString(`{"url":"http://example.com","ios_url":"https://apps.apple.com/app/id1"}`))
+	w := httptest.NewRecorder()
+
+	us.JSONPostHandler(w, req)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+	mockRepo.AssertExpectations(t)
+
+	req = httptest.NewRequest("POST", "/api/shorten",
+		bytes.NewBufferString(`{"url":"http://example.com","android_url":"not a url"}`))
+	w = httptest.NewRecorder()
+
+	us.JSONPostHandler(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestUpdateUserURLDevices(t *testing.T) {
+	userRepo := new(MockUserRepository)
+	cookieManager := new(MockCookieManager)
+	us := &URLShortener{
+		UserRepository: userRepo,
+		CookieManager:  cookieManager,
+	}
+
+	deviceURLs := storage.DeviceURLs{AndroidURL: "https://play.google.com/store/apps/details?id=app"}
+	cookieManager.On("GetRequestUserID", mock.Anything).Return("user1")
+	userRepo.On("UpdateUserURLDevices", mock.Anything, "user1", "abc", deviceURLs).Return(true, nil)
+	userRepo.On("UpdateUserURLDevices", mock.Anything, "user1", "missing", deviceURLs).Return(false, nil)
+
+	tests := []struct {
+		name       string
+		id         string
+		body       string
+		wantStatus int
+	}{
+		{
+			name:       "success",
+			id:         "abc",
+			body:       `{"android_url":"https://play.google.com/store/apps/details?id=app"}`,
+			wantStatus: http.StatusNoContent,
+		},
+		{
+			name:       "not found",
+			id:         "missing",
+			body:       `{"android_url":"https://play.google.com/store/apps/details?id=app"}`,
+			wantStatus: http.StatusNotFound,
+		},
+		{name: "invalid url", id: "abc", body: `{"ios_url":"invalid"}`, wantStatus: http.StatusBadRequest},
+		{name: "invalid json", id: "abc", body: `{`, wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("PUT", "/api/user/urls/"+tt.id+"/devices", bytes.NewBufferString(tt.body))
+			req.SetPathValue("id", tt.id)
+			w := httptest.NewRecorder()
+
+			us.UpdateUserURLDevices(w, req)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+		})
+	}
+}
+
+func TestPickSplit(t *testing.T) {
+	splits := []storage.SplitDestination{
+		{URL: "http://a.example.com", Weight: 70},
+		{URL: "http://b.example.com", Weight: 30},
+	}
+	counts := make([]int, len(splits))
+
+	for i := 0; i < 10000; i++ {
+		counts[pickSplit(splits)]++
+	}
+
+	assert.InDelta(t, 7000, counts[0], 500)
+	assert.InDelta(t, 3000, counts[1], 500)
+	assert.Equal(t, 0, pickSplit([]storage.SplitDestination{{URL: "http://a.example.com", Weight: 1}}))
+}
+
+func TestGetHandler_Splits(t *testing.T) {
+	mockRepo := new(MockURLRepository)
+	us := &URLShortener{URLRepository: mockRepo}
+
+	storedRow := storage.GetURLRow{
+		URL: "http://example.com",
+		Splits: []storage.SplitDestination{
+			{URL: "http://a.example.com", Weight: 1},
+			{URL: "http://b.example.com", Weight: 1},
+		},
+		StickySplit: true,
+	}
+	mockRepo.On("GetURL", mock.Anything, "abc").Return(storedRow, nil)
+	mockRepo.On("RecordSplitClick", mock.Anything, "abc", mock.Anything).Return(nil)
+
+	req := httptest.NewRequest("GET", "/abc", nil)
+	req.SetPathValue("id", "abc")
+	w := httptest.NewRecorder()
+
+	us.GetHandler(w, req)
+
+	assert.Equal(t, http.StatusTemporaryRedirect, w.Code)
+	cookies := w.Result().Cookies()
+	assert.Len(t, cookies, 1)
+	assert.Equal(t, "split_abc", cookies[0].Name)
+
+	variant, err := strconv.Atoi(cookies[0].Value)
+	assert.NoError(t, err)
+	assert.Equal(t, storedRow.Splits[variant].URL, w.Header().Get("Location"))
+	mockRepo.AssertCalled(t, "RecordSplitClick", mock.Anything, "abc", variant)
+
+	// Повторный посетитель получает закреплённый за ним вариант
+	for i := 0; i < 10; i++ {
+		req = httptest.NewRequest("GET", "/abc", nil)
+		req.SetPathValue("id", "abc")
+		req.AddCookie(cookies[0])
+		w = httptest.NewRecorder()
+
+		us.GetHandler(w, req)
+
+		assert.Equal(t, storedRow.Splits[variant].URL, w.Header().Get("Location"))
+		assert.Empty(t, w.Result().Cookies())
+	}
+}
+
+func TestJSONPostHandler_InvalidSplits(t *testing.T) {
+	us := &URLShortener{URLRepository: new(MockURLRepository)}
+
+	tests := []struct {
+		name string
+		body string
+	}{
+		{name: "zero weight", body: `{"url":"http://example.com","splits":[{"url":"http://a.example.com","weight":0}]}`},
+		{name: "invalid url", body: `{"url":"http://example.com","splits":[{"url":"invalid","weight":1}]}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/api/shorten", bytes.NewBufferString(tt.body))
+			w := httptest.NewRecorder()
+
+			us.JSONPostHandler(w, req)
+
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+		})
+	}
+}
+
+func TestGetHandler_ActiveFrom(t *testing.T) {
+	future := time.Now().Add(time.Hour)
+	past := time.Now().Add(-time.Hour)
+
+	tests := []struct {
+		name           string
+		activeFrom     *time.Time
+		comingSoonPage []byte
+		wantStatus     int
+		wantBody       string
+	}{
+		{name: "not active", activeFrom: &future, wantStatus: http.StatusNotFound},
+		{
+			name:           "coming soon page",
+			activeFrom:     &future,
+			comingSoonPage: []byte("<h1>Coming soon</h1>"),
+			wantStatus:     http.StatusOK,
+			wantBody:       "<h1>Coming soon</h1>",
+		},
+		{name: "active", activeFrom: &past, wantStatus: http.StatusTemporaryRedirect},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo := new(MockURLRepository)
+			us := &URLShortener{URLRepository: mockRepo, ComingSoonPage: tt.comingSoonPage}
+
+			storedRow := storage.GetURLRow{URL: "http://example.com", ActiveFrom: tt.activeFrom}
+			mockRepo.On("GetURL", mock.Anything, "abc").Return(storedRow, nil)
+
+			req := httptest.NewRequest("GET", "/abc", nil)
+			req.SetPathValue("id", "abc")
+			w := httptest.NewRecorder()
+
+			us.GetHandler(w, req)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+
+			if tt.wantBody != "" {
+				assert.Equal(t, tt.wantBody, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestJSONBatchHandler_ActiveFrom(t *testing.T) {
+	mockRepo := new(MockURLRepository)
+	mockCookieManager := new(MockCookieManager)
+	us := &URLShortener{
+		URLRepository: mockRepo,
+		CookieManager: mockCookieManager,
+		BaseURL:       "http://short.url/",
+	}
+
+	activeFrom := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	mockCookieManager.On("GetRequestUserID", mock.Anything).Return("")
+	mockRepo.On("InsertOrGet", mock.Anything, mock.MatchedBy(func(row storage.DataStorageRow) bool {
+		return row.ActiveFrom != nil && row.ActiveFrom.Equal(activeFrom)
+	})).Return(storage.DataStorageRow{}, true, nil)
+
+	req := httptest.NewRequest("POST", "/api/shorten/batch", bytes.NewBufferString(
+		`[{"correlation_id":"1","original_url":"http://example.com","active_from":"2030-01-01T00:00:00Z"}]`))
+	w := httptest.NewRecorder()
+
+	us.JSONBatchHandler(w, req)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+	mockRepo.AssertExpectations(t)
+}
+
+func TestUpdateUserURLActivation(t *testing.T) {
+	userRepo := new(MockUserRepository)
+	cookieManager := new(MockCookieManager)
+	us := &URLShortener{
+		UserRepository: userRepo,
+		CookieManager:  cookieManager,
+	}
+
+	activeFrom := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	cookieManager.On("GetRequestUserID", mock.Anything).Return("user1")
+	userRepo.On("UpdateUserURLActivation", mock.Anything, "user1", "abc", &activeFrom).Return(true, nil)
+	userRepo.On("UpdateUserURLActivation", mock.Anything, "user1", "abc", (*time.Time)(nil)).Return(true, nil)
+	userRepo.On("UpdateUserURLActivation", mock.Anything, "user1", "missing", (*time.Time)(nil)).Return(false, nil)
+
+	tests := []struct {
+		name       string
+		id         string
+		body       string
+		wantStatus int
+	}{
+		{name: "schedule", id: "abc", body: `{"active_from":"2030-01-01T00:00:00Z"}`, wantStatus: http.StatusNoContent},
+		{name: "activate now", id: "abc", body: `{"active_from":null}`, wantStatus: http.StatusNoContent},
+		{name: "not found", id: "missing", body: `{}`, wantStatus: http.StatusNotFound},
+		{name: "invalid time", id: "abc", body: `{"active_from":"tomorrow"}`, wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("PUT", "/api/user/urls/"+tt.id+"/activation", bytes.NewBufferString(tt.body))
+			req.SetPathValue("id", tt.id)
+			w := httptest.NewRecorder()
+
+			us.UpdateUserURLActivation(w, req)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+		})
+	}
+}
+
+func TestGetHandler_MaxClicks(t *testing.T) {
+	tests := []struct {
+		name       string
+		maxClicks  int
+		redeemed   bool
+		redeemErr  error
+		wantStatus int
+	}{
+		{name: "unlimited", wantStatus: http.StatusTemporaryRedirect},
+		{name: "redeemed", maxClicks: 1, redeemed: true, wantStatus: http.StatusTemporaryRedirect},
+		{name: "limit reached", maxClicks: 1, wantStatus: http.StatusGone},
+		{name: "redeem error", maxClicks: 1, redeemErr: errors.New("db error"), wantStatus: http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo := new(MockURLRepository)
+			us := &URLShortener{URLRepository: mockRepo}
+
+			mockRepo.On("GetURL", mock.Anything, "abc").Return(storage.GetURLRow{URL: "http://example.com", MaxClicks: tt.maxClicks}, nil)
+
+			if tt.maxClicks > 0 {
+				mockRepo.On("RedeemClick", mock.Anything, "abc").Return(0, tt.redeemed, tt.redeemErr)
+			}
+
+			req := httptest.NewRequest("GET", "/abc", nil)
+			req.SetPathValue("id", "abc")
+			w := httptest.NewRecorder()
+
+			us.GetHandler(w, req)
+
+			assert.Equal(t, tt.wantStatus, w.Code)
+			mockRepo.AssertExpectations(t)
+		})
+	}
+}
+
+func TestJSONPostHandler_MaxClicks(t *testing.T) {
+	mockRepo := new(MockURLRepository)
+	mockCookieManager := new(MockCookieManager)
+	us := &URLShortener{
+		URLRepository: mockRepo,
+		CookieManager: mockCookieManager,
+		BaseURL:       "http://short.url/",
+	}
+
+	mockCookieManager.On("GetRequestUserID", mock.Anything).Return("")
+	mockRepo.On("InsertOrGet", mock.Anything, mock.MatchedBy(func(row storage.DataStorageRow) bool {
+		return row.MaxClicks == 1
+	})).Return(storage.DataStorageRow{}, true, nil)
+
+	req := httptest.NewRequest("POST", "/api/shorten",
+		bytes.NewBufferString(`{"url":"http://example.com","one_time":true}`))
+	w := httptest.NewRecorder()
+
+	us.JSONPostHandler(w, req)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+	mockRepo.AssertExpectations(t)
+
+	for _, body := range []string{
+		`{"url":"http://example.com","max_clicks":-1}`,
+		`{"url":"http://example.com","max_clicks":5,"one_time":true}`,
+	} {
+		req = httptest.NewRequest("POST", "/api/shorten", bytes.NewBufferString(body))
+		w = httptest.NewRecorder()
+
+		us.JSONPostHandler(w, req)
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	}
+}
+
+func TestGetHandler_WebhookEvents(t *testing.T) {
+	mockRepo := new(MockURLRepository)
+	mockWebhooks := new(MockWebhooks)
+	us := &URLShortener{URLRepository: mockRepo, Webhooks: mockWebhooks, BaseURL: "http://short.url/"}
+
+	storedRow := storage.GetURLRow{URL: "http://example.com", UserID: "user1", MaxClicks: 2}
+	mockRepo.On("GetURL", mock.Anything, "abc").Return(storedRow, nil)
+	mockRepo.On("RedeemClick", mock.Anything, "abc").Return(1, true, nil).Once()
+	mockRepo.On("RedeemClick", mock.Anything, "abc").Return(0, true, nil).Once()
+
+	linkData := webhook.LinkData{
+		ShortKey: "abc", ShortURL: "http://short.url/abc", OriginalURL: "http://example.com", UserID: "user1",
+	}
+	mockWebhooks.On("Emit", mock.Anything, "user1", webhook.EventLinkClicked, linkData).Twice()
+	mockWebhooks.On("Emit", mock.Anything, "user1", webhook.EventLinkExpired, linkData).Once()
+
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest("GET", "/abc", nil)
+		req.SetPathValue("id", "abc")
+		w := httptest.NewRecorder()
+
+		us.GetHandler(w, req)
+
+		assert.Equal(t, http.StatusTemporaryRedirect, w.Code)
+	}
+
+	mockWebhooks.AssertExpectations(t)
+}
+
+func TestJSONPostHandler_WebhookCreated(t *testing.T) {
+	mockRepo := new(MockURLRepository)
+	mockCookieManager := new(MockCookieManager)
+	mockWebhooks := new(MockWebhooks)
+	us := &URLShortener{
+		URLRepository: mockRepo,
+		CookieManager: mockCookieManager,
+		Webhooks:      mockWebhooks,
+		BaseURL:       "http://short.url/",
+	}
+
+	mockCookieManager.On("GetRequestUserID", mock.Anything).Return("user1")
+	mockRepo.On("InsertOrGet", mock.Anything, savedRowWith("http://example.com", "")).
+		Return(storage.DataStorageRow{}, true, nil)
+	mockWebhooks.On("Emit", mock.Anything, "user1", webhook.EventLinkCreated, mock.MatchedBy(func(data webhook.LinkData) bool {
+		return data.OriginalURL == "http://example.com" && data.ShortURL == "http://short.url/"+data.ShortKey
+	})).Once()
+
+	req := httptest.NewRequest("POST", "/api/shorten", bytes.NewBufferString(`{"url":"http://example.com"}`))
+	w := httptest.NewRecorder()
+
+	us.JSONPostHandler(w, req)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+	mockWebhooks.AssertExpectations(t)
+}
+
+func TestDeleteUserUrlsBatch_WebhookDeleted(t *testing.T) {
+	ctx := context.Background()
+	mockRepo := new(MockURLRepository)
+	mockUserRepo := new(MockUserRepository)
+	mockCookieManager := new(MockCookieManager)
+	mockWebhooks := new(MockWebhooks)
+	us := &URLShortener{
+		URLRepository:  mockRepo,
+		UserRepository: mockUserRepo,
+		CookieManager:  mockCookieManager,
+		Webhooks:       mockWebhooks,
+		BaseURL:        "http://short.url/",
+	}
+
+	mockUserRepo.On("DeleteUserUrls", mock.Anything, "user1", []string{"own", "foreign"}).Return(nil)
+	mockRepo.On("GetURL", mock.Anything, "own").Return(storage.GetURLRow{URL: "http://a.example.com", UserID: "user1", IsDeleted: true}, nil)
+	mockRepo.On("GetURL", mock.Anything, "foreign").Return(storage.GetURLRow{URL: "http://b.example.com", UserID: "user2"}, nil)
+	mockWebhooks.On("Emit", mock.Anything, "user1", webhook.EventLinkDeleted, mock.MatchedBy(func(data webhook.LinkData) bool {
+		return data.ShortKey == "own"
+	})).Once()
+
+	us.DeleteUserUrlsBatch(ctx, "user1", []string{"own", "foreign"})
+
+	mockWebhooks.AssertExpectations(t)
+	mockWebhooks.AssertNumberOfCalls(t, "Emit", 1)
+}
+
+func TestJSONPostHandler_CollectsMetadata(t *testing.T) {
+	mockRepo := new(MockURLRepository)
+	mockCookieManager := new(MockCookieManager)
+	mockMetadata := new(MockMetadata)
+	us := &URLShortener{
+		URLRepository: mockRepo,
+		CookieManager: mockCookieManager,
+		Metadata:      mockMetadata,
+		BaseURL:       "http://short.url/",
+	}
+
+	mockCookieManager.On("GetRequestUserID", mock.Anything).Return("user1")
+	mockRepo.On("InsertOrGet", mock.Anything, savedRowWith("http://example.com", "")).
+		Return(storage.DataStorageRow{}, true, nil)
+	mockRepo.On("InsertOrGet", mock.Anything, savedRowWith("http://existing.example.com", "")).
+		Return(storage.DataStorageRow{ShortURL: "abc123", URL: "http://existing.example.com"}, false, nil)
+	mockMetadata.On("Collect", mock.AnythingOfType("string"), "http://example.com").Once()
+
+	req := httptest.NewRequest("POST", "/api/shorten", bytes.NewBufferString(`{"url":"http://example.com"}`))
+	w := httptest.NewRecorder()
+	us.JSONPostHandler(w, req)
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	req = httptest.NewRequest("POST", "/api/shorten", bytes.NewBufferString(`{"url":"http://existing.example.com"}`))
+	w = httptest.NewRecorder()
+	us.JSONPostHandler(w, req)
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	mockMetadata.AssertExpectations(t)
+}
+
+func TestJSONBatchHandler_CollectsMetadata(t *testing.T) {
+	mockRepo := new(MockURLRepository)
+	mockCookieManager := new(MockCookieManager)
+	mockMetadata := new(MockMetadata)
+	us := &URLShortener{
+		URLRepository: mockRepo,
+		CookieManager: mockCookieManager,
+		Metadata:      mockMetadata,
+		BaseURL:       "http://short.url/",
+	}
+
+	mockCookieManager.On("GetRequestUserID", mock.Anything).Return("user1")
+	mockRepo.On("InsertOrGet", mock.Anything, savedRowWith("http://a.example.com", "")).
+		Return(storage.DataStorageRow{}, true, nil)
+	mockRepo.On("InsertOrGet", mock.Anything, savedRowWith("http://b.example.com", "")).
+		Return(storage.DataStorageRow{ShortURL: "exists", URL: "http://b.example.com"}, false, nil)
+	mockMetadata.On("Collect", mock.AnythingOfType("string"), "http://a.example.com").Once()
+
+	body := `[{"correlation_id":"1","original_url":"http://a.example.com"},` +
+		`{"correlation_id":"2","original_url":"http://b.example.com"}]`
+	req := httptest.NewRequest("POST", "/api/shorten/batch", bytes.NewBufferString(body))
+	w := httptest.NewRecorder()
+	us.JSONBatchHandler(w, req)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+	mockMetadata.AssertExpectations(t)
+	mockMetadata.AssertNotCalled(t, "Collect", "exists", "http://b.example.com")
+}
@@ -0,0 +1,114 @@
+package shortener
+
+import (
+	"errors"
+	"log"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/sub3er0/urlShorteningService/internal/storage"
+)
+
+// splitCookiePrefix задает префикс имени cookie, закрепляющей вариант A/B теста за посетителем.
+const splitCookiePrefix = "split_"
+
+// splitCookieMaxAge задает время жизни cookie с вариантом A/B теста в секундах.
+const splitCookieMaxAge = 30 * 24 * 60 * 60
+
+// ErrInvalidSplitWeight указывает, что вес варианта A/B теста не положительный.
+var ErrInvalidSplitWeight = errors.New("split weight must be positive")
+
+// validateSplits проверяет адреса и веса вариантов A/B теста.
+func validateSplits(splits []storage.SplitDestination) error {
+	for _, split := range splits {
+		if split.Weight <= 0 {
+			return ErrInvalidSplitWeight
+		}
+
+		if _, err := url.ParseRequestURI(split.URL); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// pickSplit выбирает вариант A/B теста с вероятностью, пропорциональной его весу.
+// Возвращает индекс выбранного варианта.
+func pickSplit(splits []storage.SplitDestination) int {
+	total := 0
+
+	for _, split := range splits {
+		total += split.Weight
+	}
+
+	if total <= 0 {
+		return 0
+	}
+
+	n := rand.Intn(total)
+
+	for i, split := range splits {
+		if n < split.Weight {
+			return i
+		}
+
+		n -= split.Weight
+	}
+
+	return len(splits) - 1
+}
+
+// splitVariant определяет вариант A/B теста для посетителя.
+// Для ссылок с закреплением варианта используется вариант из cookie,
+// а новый вариант сохраняется в cookie.
+func splitVariant(w http.ResponseWriter, r *http.Request, shortURL string, storedURL storage.GetURLRow) int {
+	cookieName := splitCookiePrefix + shortURL
+
+	if storedURL.StickySplit {
+		if cookie, err := r.Cookie(cookieName); err == nil {
+			if variant, err := strconv.Atoi(cookie.Value); err == nil && variant >= 0 && variant < len(storedURL.Splits) {
+				return variant
+			}
+		}
+	}
+
+	variant := pickSplit(storedURL.Splits)
+
+	if storedURL.StickySplit {
+		http.SetCookie(w, &http.Cookie{
+			Name:     cookieName,
+			Value:    strconv.Itoa(variant),
+			Path:     "/",
+			MaxAge:   splitCookieMaxAge,
+			HttpOnly: true,
+		})
+	}
+
+	return variant
+}
+
+// redirectURL определяет адрес перехода по короткому URL.
+// Адреса для мобильных устройств имеют приоритет над вариантами A/B теста.
+// Выбранный вариант A/B теста учитывается в статистике переходов.
+func (us *URLShortener) redirectURL(
+	w http.ResponseWriter, r *http.Request, shortURL string, storedURL storage.GetURLRow) string {
+	ctx := r.Context()
+	if location, ok := deviceURL(storedURL, r.UserAgent()); ok {
+		return location
+	}
+
+	if len(storedURL.Splits) == 0 {
+		return storedURL.URL
+	}
+
+	variant := splitVariant(w, r, shortURL, storedURL)
+
+	if err := us.URLRepository.RecordSplitClick(ctx, shortURL, variant); err != nil {
+		log.Printf("Error while recording split click: %v", err)
+	}
+
+	return storedURL.Splits[variant].URL
+}
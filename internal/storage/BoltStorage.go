@@ -0,0 +1,1142 @@
+package storage
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"go.etcd.io/bbolt"
+)
+
+// Бакеты файла хранилища bbolt.
+var (
+	// boltBucketURLs хранит ссылки в формате JSON по короткому URL.
+	boltBucketURLs = []byte("urls")
+
+	// boltBucketURLIndex хранит обратный индекс оригинального URL в короткий URL.
+	boltBucketURLIndex = []byte("url_index")
+
+	// boltBucketUserLinks хранит для каждого пользователя вложенный бакет с его короткими URL.
+	boltBucketUserLinks = []byte("user_links")
+
+	// boltBucketUsers хранит пользователей и признак их блокировки.
+	boltBucketUsers = []byte("users")
+
+	// boltBucketHealth хранит результаты последней проверки адресов перехода по короткому URL.
+	boltBucketHealth = []byte("health")
+
+	// boltBucketMetadata хранит данные страниц перехода по короткому URL.
+	boltBucketMetadata = []byte("metadata")
+
+	// boltBucketAudit хранит журнал действий администратора по идентификатору записи.
+	boltBucketAudit = []byte("audit")
+
+	// boltBucketWebhooks хранит вебхуки по идентификатору.
+	boltBucketWebhooks = []byte("webhooks")
+
+	// boltBucketDeliveries хранит доставки событий вебхуков по идентификатору.
+	boltBucketDeliveries = []byte("deliveries")
+)
+
+// boltBuckets перечисляет бакеты, создаваемые при открытии хранилища.
+var boltBuckets = [][]byte{
+	boltBucketURLs, boltBucketURLIndex, boltBucketUserLinks, boltBucketUsers, boltBucketHealth,
+	boltBucketMetadata, boltBucketAudit, boltBucketWebhooks, boltBucketDeliveries,
+}
+
+// Значения признака блокировки пользователя в бакете users.
+var (
+	boltUserActive = []byte{0}
+	boltUserBanned = []byte{1}
+)
+
+// boltOpenTimeout ограничивает ожидание блокировки файла, занятого другим процессом.
+const boltOpenTimeout = time.Second
+
+// errBoltNotOpen возвращается при обращении к хранилищу, для которого не вызван Init.
+var errBoltNotOpen = fmt.Errorf("%w: bolt storage is not open", ErrUnavailable)
+
+// boltWebhookRecord представляет вебхук в файле хранилища вместе с владельцем,
+// который не сериализуется в самом вебхуке.
+type boltWebhookRecord struct {
+	UserID  string  `json:"user_id"`
+	Webhook Webhook `json:"webhook"`
+}
+
+// BoltStorage хранит данные во встроенной базе ключ-значение bbolt в одном файле.
+// В отличие от FileStorage, изменения записываются транзакционно и сразу на диск,
+// а поиск выполняется по индексам в файле без загрузки данных в память.
+// Все методы безопасны для одновременного вызова. Файл открывается одним процессом:
+// другой процесс ожидает его освобождения не дольше boltOpenTimeout.
+type BoltStorage struct {
+	// BoltStoragePath указывает путь к файлу хранилища.
+	BoltStoragePath string
+
+	// db представляет открытую базу bbolt.
+	db *bbolt.DB
+}
+
+// SetConnection заглушка для интерфейса
+func (bs *BoltStorage) SetConnection(conn DBConnectionInterface) {}
+
+// Init открывает файл хранилища по пути BoltStoragePath и создает недостающие бакеты.
+// Строка подключения не используется.
+func (bs *BoltStorage) Init(connectionString string) error {
+	db, err := bbolt.Open(bs.BoltStoragePath, 0600, &bbolt.Options{Timeout: boltOpenTimeout})
+
+	if err != nil {
+		return unavailable(err)
+	}
+
+	err = db.Update(func(tx *bbolt.Tx) error {
+		for _, name := range boltBuckets {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		db.Close()
+		return unavailable(err)
+	}
+
+	bs.db = db
+
+	return nil
+}
+
+// Close закрывает файл хранилища. Последующие обращения к хранилищу возвращают ErrUnavailable.
+func (bs *BoltStorage) Close() {
+	if bs.db != nil {
+		bs.db.Close()
+	}
+}
+
+// view выполняет fn в транзакции на чтение.
+// Ошибки хранилища возвращаются без изменений, остальные оборачиваются в ErrUnavailable.
+func (bs *BoltStorage) view(fn func(tx *bbolt.Tx) error) error {
+	if bs.db == nil {
+		return errBoltNotOpen
+	}
+
+	return unavailable(bs.db.View(fn))
+}
+
+// update выполняет fn в транзакции на запись. Если fn возвращает ошибку, изменения отменяются.
+// Ошибки хранилища возвращаются без изменений, остальные оборачиваются в ErrUnavailable.
+func (bs *BoltStorage) update(fn func(tx *bbolt.Tx) error) error {
+	if bs.db == nil {
+		return errBoltNotOpen
+	}
+
+	return unavailable(bs.db.Update(fn))
+}
+
+// boltKey кодирует идентификатор в ключ, сохраняющий порядок идентификаторов при обходе бакета.
+func boltKey(id int) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, uint64(id))
+
+	return key
+}
+
+// boltGet читает значение в формате JSON. Возвращает false, если ключа нет в бакете.
+func boltGet(bucket *bbolt.Bucket, key []byte, value interface{}) (bool, error) {
+	data := bucket.Get(key)
+
+	if data == nil {
+		return false, nil
+	}
+
+	return true, json.Unmarshal(data, value)
+}
+
+// boltPut сохраняет значение в формате JSON.
+func boltPut(bucket *bbolt.Bucket, key []byte, value interface{}) error {
+	data, err := json.Marshal(value)
+
+	if err != nil {
+		return err
+	}
+
+	return bucket.Put(key, data)
+}
+
+// findRow возвращает ссылку по короткому URL.
+func findBoltRow(tx *bbolt.Tx, shortURL string) (DataStorageRow, bool, error) {
+	var row DataStorageRow
+	found, err := boltGet(tx.Bucket(boltBucketURLs), []byte(shortURL), &row)
+
+	return row, found, err
+}
+
+// userBoltRow возвращает неудалённую ссылку пользователя.
+func userBoltRow(tx *bbolt.Tx, uniqueID string, shortURL string) (DataStorageRow, bool, error) {
+	row, found, err := findBoltRow(tx, shortURL)
+
+	if err != nil || !found || row.UserID != uniqueID || row.DeletedFlag {
+		return DataStorageRow{}, false, err
+	}
+
+	return row, true, nil
+}
+
+// linkBoltUser добавляет короткий URL в индекс ссылок пользователя. Ссылки без владельца не индексируются.
+func linkBoltUser(tx *bbolt.Tx, userID string, shortURL string) error {
+	if userID == "" {
+		return nil
+	}
+
+	links, err := tx.Bucket(boltBucketUserLinks).CreateBucketIfNotExists([]byte(userID))
+
+	if err != nil {
+		return err
+	}
+
+	return links.Put([]byte(shortURL), []byte{})
+}
+
+// unlinkBoltUser удаляет короткий URL из индекса ссылок пользователя.
+func unlinkBoltUser(tx *bbolt.Tx, userID string, shortURL string) error {
+	if links := tx.Bucket(boltBucketUserLinks).Bucket([]byte(userID)); links != nil {
+		return links.Delete([]byte(shortURL))
+	}
+
+	return nil
+}
+
+// insertBoltRow сохраняет новую ссылку, присваивает ей идентификатор и обновляет индексы.
+// Уникальность URL и короткого URL проверяется вызывающим.
+func insertBoltRow(tx *bbolt.Tx, dataStorageRow DataStorageRow) (DataStorageRow, error) {
+	urls := tx.Bucket(boltBucketURLs)
+	id, err := urls.NextSequence()
+
+	if err != nil {
+		return dataStorageRow, err
+	}
+
+	dataStorageRow.ID = int(id)
+
+	if err = boltPut(urls, []byte(dataStorageRow.ShortURL), dataStorageRow); err != nil {
+		return dataStorageRow, err
+	}
+
+	if err = tx.Bucket(boltBucketURLIndex).Put([]byte(dataStorageRow.URL), []byte(dataStorageRow.ShortURL)); err != nil {
+		return dataStorageRow, err
+	}
+
+	return dataStorageRow, linkBoltUser(tx, dataStorageRow.UserID, dataStorageRow.ShortURL)
+}
+
+// checkBoltRow проверяет, что ни URL, ни короткий URL ссылки ещё не сохранены.
+func checkBoltRow(tx *bbolt.Tx, dataStorageRow DataStorageRow) error {
+	if tx.Bucket(boltBucketURLs).Get([]byte(dataStorageRow.ShortURL)) != nil {
+		return errDuplicateShortURL
+	}
+
+	if tx.Bucket(boltBucketURLIndex).Get([]byte(dataStorageRow.URL)) != nil {
+		return errDuplicateURL
+	}
+
+	return nil
+}
+
+// updateRow применяет изменение к ссылке и сохраняет её.
+// Возвращает false, если короткий URL не найден или ссылка не подходит под условие match.
+func (bs *BoltStorage) updateRow(
+	shortURL string, match func(row DataStorageRow) bool, update func(row *DataStorageRow)) (bool, error) {
+	var found bool
+
+	err := bs.update(func(tx *bbolt.Tx) error {
+		row, ok, err := findBoltRow(tx, shortURL)
+
+		if err != nil || !ok || !match(row) {
+			return err
+		}
+
+		found = true
+		update(&row)
+
+		return boltPut(tx.Bucket(boltBucketURLs), []byte(shortURL), row)
+	})
+
+	return found && err == nil, err
+}
+
+// updateUserRow применяет изменение к неудалённой ссылке пользователя и сохраняет её.
+// Возвращает false, если короткий URL не найден среди неудалённых URL пользователя.
+func (bs *BoltStorage) updateUserRow(uniqueID string, shortURL string, update func(row *DataStorageRow)) (bool, error) {
+	return bs.updateRow(shortURL, func(row DataStorageRow) bool {
+		return row.UserID == uniqueID && !row.DeletedFlag
+	}, update)
+}
+
+// SaveBatch сохраняет пакет ссылок в одной транзакции.
+// Как и в базе данных, ссылки, уже сохранённые с той же парой URL и короткого URL, пропускаются,
+// а при любом другом совпадении URL или короткого URL пакет не сохраняется целиком.
+func (bs *BoltStorage) SaveBatch(ctx context.Context, dataStorageRows []DataStorageRow) error {
+	return bs.update(func(tx *bbolt.Tx) error {
+		for _, row := range dataStorageRows {
+			if shortURL := tx.Bucket(boltBucketURLIndex).Get([]byte(row.URL)); string(shortURL) == row.ShortURL {
+				continue
+			}
+
+			if err := checkBoltRow(tx, row); err != nil {
+				return err
+			}
+
+			if _, err := insertBoltRow(tx, row); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// ImportBatch сохраняет перенесённые ссылки. Хранилище не публикует событий создания ссылок,
+// поэтому перенос совпадает с SaveBatch.
+func (bs *BoltStorage) ImportBatch(ctx context.Context, dataStorageRows []DataStorageRow) error {
+	return bs.SaveBatch(ctx, dataStorageRows)
+}
+
+// Save сохраняет новый короткий URL с соответствующим полному URL, идентификатору пользователя и домену.
+// Возвращает ErrConflict, если URL или короткий URL уже сохранены.
+func (bs *BoltStorage) Save(ctx context.Context, dataStorageRow DataStorageRow) error {
+	return bs.update(func(tx *bbolt.Tx) error {
+		if err := checkBoltRow(tx, dataStorageRow); err != nil {
+			return err
+		}
+
+		_, err := insertBoltRow(tx, dataStorageRow)
+
+		return err
+	})
+}
+
+// InsertOrGet сохраняет ссылку, если оригинального URL ещё нет в хранилище.
+// Проверка и сохранение выполняются в одной транзакции на запись, поэтому одновременные вызовы
+// для одного URL создают одну ссылку.
+func (bs *BoltStorage) InsertOrGet(ctx context.Context, dataStorageRow DataStorageRow) (DataStorageRow, bool, error) {
+	var stored DataStorageRow
+	var created bool
+
+	err := bs.update(func(tx *bbolt.Tx) error {
+		if shortURL := tx.Bucket(boltBucketURLIndex).Get([]byte(dataStorageRow.URL)); shortURL != nil {
+			row, _, err := findBoltRow(tx, string(shortURL))
+			stored = DataStorageRow{ShortURL: row.ShortURL, URL: row.URL, UserID: row.UserID, Domain: row.Domain}
+
+			return err
+		}
+
+		if tx.Bucket(boltBucketURLs).Get([]byte(dataStorageRow.ShortURL)) != nil {
+			return errDuplicateShortURL
+		}
+
+		var err error
+		stored, err = insertBoltRow(tx, dataStorageRow)
+		created = err == nil
+
+		return err
+	})
+
+	if err != nil {
+		return DataStorageRow{}, false, err
+	}
+
+	return stored, created, nil
+}
+
+// LoadData возвращает все ссылки, в том числе удалённые и заблокированные, в порядке их создания.
+func (bs *BoltStorage) LoadData(ctx context.Context) ([]DataStorageRow, error) {
+	var rows []DataStorageRow
+
+	err := bs.view(func(tx *bbolt.Tx) error {
+		return tx.Bucket(boltBucketURLs).ForEach(func(key, value []byte) error {
+			var row DataStorageRow
+
+			if err := json.Unmarshal(value, &row); err != nil {
+				return err
+			}
+
+			rows = append(rows, row)
+
+			return nil
+		})
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(rows, func(i, j int) bool {
+		return rows[i].ID < rows[j].ID
+	})
+
+	return rows, nil
+}
+
+// GetURL возвращает URL для заданного короткого URL, в том числе удалённого.
+// Если короткого URL нет в хранилище, возвращает ErrNotFound.
+func (bs *BoltStorage) GetURL(ctx context.Context, shortURL string) (GetURLRow, error) {
+	var row DataStorageRow
+	var found bool
+
+	err := bs.view(func(tx *bbolt.Tx) error {
+		var err error
+		row, found, err = findBoltRow(tx, shortURL)
+
+		return err
+	})
+
+	if err != nil {
+		return GetURLRow{}, err
+	}
+
+	if !found {
+		return GetURLRow{}, ErrNotFound
+	}
+
+	return GetURLRow{
+		URL:            row.URL,
+		UserID:         row.UserID,
+		IsDeleted:      row.DeletedFlag,
+		DisabledReason: row.DisabledReason,
+		Domain:         row.Domain,
+		DeviceURLs:     row.DeviceURLs,
+		Splits:         row.Splits,
+		StickySplit:    row.StickySplit,
+		ActiveFrom:     row.ActiveFrom,
+		MaxClicks:      row.MaxClicks,
+		Clicks:         row.Clicks,
+	}, nil
+}
+
+// RecordSplitClick учитывает переход на вариант A/B теста короткого URL.
+func (bs *BoltStorage) RecordSplitClick(ctx context.Context, shortURL string, variant int) error {
+	_, err := bs.updateRow(shortURL, func(row DataStorageRow) bool {
+		return variant >= 0 && variant < len(row.Splits)
+	}, func(row *DataStorageRow) {
+		row.Splits[variant].Clicks++
+	})
+
+	return err
+}
+
+// RedeemClick учитывает переход по короткому URL с ограничением количества переходов.
+// Проверка и изменение счётчика выполняются в одной транзакции на запись.
+// Возвращает количество оставшихся переходов и false, если лимит переходов исчерпан.
+func (bs *BoltStorage) RedeemClick(ctx context.Context, shortURL string) (int, bool, error) {
+	var remaining int
+
+	redeemed, err := bs.updateRow(shortURL, func(row DataStorageRow) bool {
+		return row.Clicks < row.MaxClicks
+	}, func(row *DataStorageRow) {
+		row.Clicks++
+		remaining = row.MaxClicks - row.Clicks
+	})
+
+	if !redeemed {
+		return 0, false, err
+	}
+
+	return remaining, true, nil
+}
+
+// SaveLinkMetadata сохраняет заголовок и Open Graph данные страницы перехода короткого URL.
+func (bs *BoltStorage) SaveLinkMetadata(ctx context.Context, shortURL string, metadata LinkMetadata) error {
+	return bs.update(func(tx *bbolt.Tx) error {
+		if tx.Bucket(boltBucketURLs).Get([]byte(shortURL)) == nil {
+			return nil
+		}
+
+		return boltPut(tx.Bucket(boltBucketMetadata), []byte(shortURL), metadata)
+	})
+}
+
+// LoadLinkDetails возвращает данные страниц перехода и результаты проверки ссылок,
+// для которых они сохранены, упорядоченные по короткому URL.
+func (bs *BoltStorage) LoadLinkDetails(ctx context.Context) ([]LinkDetails, error) {
+	metadata := make(map[string]LinkMetadata)
+	health := make(map[string]LinkHealth)
+
+	err := bs.view(func(tx *bbolt.Tx) error {
+		err := tx.Bucket(boltBucketMetadata).ForEach(func(key, value []byte) error {
+			var linkMetadata LinkMetadata
+
+			if err := json.Unmarshal(value, &linkMetadata); err != nil {
+				return err
+			}
+
+			metadata[string(key)] = linkMetadata
+
+			return nil
+		})
+
+		if err != nil {
+			return err
+		}
+
+		return tx.Bucket(boltBucketHealth).ForEach(func(key, value []byte) error {
+			var linkHealth LinkHealth
+
+			if err := json.Unmarshal(value, &linkHealth); err != nil {
+				return err
+			}
+
+			health[string(key)] = linkHealth
+
+			return nil
+		})
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return collectLinkDetails(metadata, health), nil
+}
+
+// SaveLinkDetails сохраняет перенесённые данные страниц перехода и результаты проверки в одной транзакции.
+// Данные ссылок, которых нет в хранилище, пропускаются.
+func (bs *BoltStorage) SaveLinkDetails(ctx context.Context, details []LinkDetails) error {
+	return bs.update(func(tx *bbolt.Tx) error {
+		for _, item := range details {
+			if tx.Bucket(boltBucketURLs).Get([]byte(item.ShortURL)) == nil {
+				continue
+			}
+
+			if item.Metadata != nil {
+				if err := boltPut(tx.Bucket(boltBucketMetadata), []byte(item.ShortURL), item.Metadata); err != nil {
+					return err
+				}
+			}
+
+			if item.Health != nil {
+				if err := boltPut(tx.Bucket(boltBucketHealth), []byte(item.ShortURL), item.Health); err != nil {
+					return err
+				}
+			}
+		}
+
+		return nil
+	})
+}
+
+// GetURLCount возвращает количество сохранённых URL в хранилище, включая удалённые.
+func (bs *BoltStorage) GetURLCount(ctx context.Context) int {
+	var count int
+
+	bs.view(func(tx *bbolt.Tx) error {
+		count = tx.Bucket(boltBucketURLs).Stats().KeyN
+		return nil
+	})
+
+	return count
+}
+
+// GetShortURL ищет короткий URL для заданного оригинального URL по обратному индексу.
+// Возвращает короткий URL, если он найден, и ErrNotFound, если нет.
+func (bs *BoltStorage) GetShortURL(ctx context.Context, URL string) (string, error) {
+	var shortURL string
+
+	err := bs.view(func(tx *bbolt.Tx) error {
+		shortURL = string(tx.Bucket(boltBucketURLIndex).Get([]byte(URL)))
+		return nil
+	})
+
+	if err == nil && shortURL == "" {
+		err = ErrNotFound
+	}
+
+	return shortURL, err
+}
+
+// Ping проверяет, что файл хранилища открыт.
+func (bs *BoltStorage) Ping(ctx context.Context) bool {
+	return bs.view(func(tx *bbolt.Tx) error { return nil }) == nil
+}
+
+// IsUserExist проверяет, существует ли пользователь по уникальному идентификатору.
+func (bs *BoltStorage) IsUserExist(ctx context.Context, data string) bool {
+	var exists bool
+
+	bs.view(func(tx *bbolt.Tx) error {
+		exists = tx.Bucket(boltBucketUsers).Get([]byte(data)) != nil
+		return nil
+	})
+
+	return exists
+}
+
+// SaveUser сохраняет нового пользователя с указанным уникальным идентификатором.
+// Возвращает ErrConflict, если пользователь уже сохранён.
+func (bs *BoltStorage) SaveUser(ctx context.Context, uniqueID string) error {
+	return bs.update(func(tx *bbolt.Tx) error {
+		users := tx.Bucket(boltBucketUsers)
+
+		if users.Get([]byte(uniqueID)) != nil {
+			return errDuplicateUser
+		}
+
+		return users.Put([]byte(uniqueID), boltUserActive)
+	})
+}
+
+// LoadUsers возвращает всех пользователей, упорядоченных по идентификатору.
+func (bs *BoltStorage) LoadUsers(ctx context.Context) ([]User, error) {
+	var users []User
+
+	err := bs.view(func(tx *bbolt.Tx) error {
+		return tx.Bucket(boltBucketUsers).ForEach(func(key, value []byte) error {
+			users = append(users, User{UserID: string(key), Banned: value[0] == boltUserBanned[0]})
+			return nil
+		})
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
+// SaveUsers сохраняет пользователей в одной транзакции. Уже сохранённые пользователи блокируются,
+// если заблокированы в переданных данных.
+func (bs *BoltStorage) SaveUsers(ctx context.Context, users []User) error {
+	return bs.update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(boltBucketUsers)
+
+		for _, user := range users {
+			if value := bucket.Get([]byte(user.UserID)); value != nil && (value[0] == boltUserBanned[0] || !user.Banned) {
+				continue
+			}
+
+			value := boltUserActive
+
+			if user.Banned {
+				value = boltUserBanned
+			}
+
+			if err := bucket.Put([]byte(user.UserID), value); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// GetUserUrls возвращает неудалённые URL пользователя в порядке их создания.
+// Ссылки пользователя выбираются по индексу user_links без обхода всех ссылок.
+func (bs *BoltStorage) GetUserUrls(ctx context.Context, uniqueID string) ([]UserUrlsResponseBodyItem, error) {
+	var responseUrls []UserUrlsResponseBodyItem
+
+	err := bs.view(func(tx *bbolt.Tx) error {
+		links := tx.Bucket(boltBucketUserLinks).Bucket([]byte(uniqueID))
+
+		if links == nil {
+			return nil
+		}
+
+		var rows []DataStorageRow
+
+		err := links.ForEach(func(key, value []byte) error {
+			row, ok, err := userBoltRow(tx, uniqueID, string(key))
+
+			if ok {
+				rows = append(rows, row)
+			}
+
+			return err
+		})
+
+		if err != nil {
+			return err
+		}
+
+		sort.Slice(rows, func(i, j int) bool {
+			return rows[i].ID < rows[j].ID
+		})
+
+		for _, row := range rows {
+			item := UserUrlsResponseBodyItem{
+				OriginalURL: row.URL,
+				ShortURL:    row.ShortURL,
+				Domain:      row.Domain,
+				DeviceURLs:  row.DeviceURLs,
+				Splits:      row.Splits,
+				ActiveFrom:  row.ActiveFrom,
+				MaxClicks:   row.MaxClicks,
+				Clicks:      row.Clicks,
+			}
+
+			var health LinkHealth
+
+			if ok, err := boltGet(tx.Bucket(boltBucketHealth), []byte(row.ShortURL), &health); err != nil {
+				return err
+			} else if ok {
+				item.Health = &health
+			}
+
+			var metadata LinkMetadata
+
+			if ok, err := boltGet(tx.Bucket(boltBucketMetadata), []byte(row.ShortURL), &metadata); err != nil {
+				return err
+			} else if ok {
+				item.Metadata = &metadata
+			}
+
+			responseUrls = append(responseUrls, item)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return responseUrls, nil
+}
+
+// GetUsersCount возвращает количество пользователей в хранилище.
+func (bs *BoltStorage) GetUsersCount(ctx context.Context) int {
+	var count int
+
+	bs.view(func(tx *bbolt.Tx) error {
+		count = tx.Bucket(boltBucketUsers).Stats().KeyN
+		return nil
+	})
+
+	return count
+}
+
+// DeleteUserUrls помечает удалёнными указанные короткие URL пользователя в одной транзакции.
+// Короткие URL других пользователей не изменяются.
+func (bs *BoltStorage) DeleteUserUrls(ctx context.Context, uniqueID string, shortURLS []string) error {
+	return bs.update(func(tx *bbolt.Tx) error {
+		for _, shortURL := range shortURLS {
+			row, ok, err := userBoltRow(tx, uniqueID, shortURL)
+
+			if err != nil {
+				return err
+			}
+
+			if !ok {
+				continue
+			}
+
+			row.DeletedFlag = true
+
+			if err = boltPut(tx.Bucket(boltBucketURLs), []byte(shortURL), row); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// UpdateUserURLDevices задает адреса перехода для мобильных устройств короткому URL пользователя.
+// Возвращает false, если короткий URL не найден среди неудалённых URL пользователя.
+func (bs *BoltStorage) UpdateUserURLDevices(
+	ctx context.Context, uniqueID string, shortURL string, deviceURLs DeviceURLs) (bool, error) {
+	return bs.updateUserRow(uniqueID, shortURL, func(row *DataStorageRow) {
+		row.DeviceURLs = deviceURLs
+	})
+}
+
+// UpdateUserURLActivation задает время активации короткого URL пользователя.
+// Возвращает false, если короткий URL не найден среди неудалённых URL пользователя.
+func (bs *BoltStorage) UpdateUserURLActivation(
+	ctx context.Context, uniqueID string, shortURL string, activeFrom *time.Time) (bool, error) {
+	return bs.updateUserRow(uniqueID, shortURL, func(row *DataStorageRow) {
+		row.ActiveFrom = activeFrom
+	})
+}
+
+// IsUserBanned проверяет, заблокирован ли пользователь администратором.
+func (bs *BoltStorage) IsUserBanned(ctx context.Context, uniqueID string) bool {
+	var banned bool
+
+	bs.view(func(tx *bbolt.Tx) error {
+		value := tx.Bucket(boltBucketUsers).Get([]byte(uniqueID))
+		banned = value != nil && value[0] == boltUserBanned[0]
+
+		return nil
+	})
+
+	return banned
+}
+
+// SearchUrls возвращает ссылки всех пользователей, подходящие под фильтр.
+// Ссылки упорядочены по порядку сохранения.
+func (bs *BoltStorage) SearchUrls(ctx context.Context, filter URLSearchFilter) ([]DataStorageRow, error) {
+	rows, err := bs.LoadData(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return filterDataStorageRows(rows, filter), nil
+}
+
+// DisableURL блокирует короткий URL с указанной причиной.
+// Возвращает false, если короткий URL не найден.
+func (bs *BoltStorage) DisableURL(ctx context.Context, shortURL string, reason string) (bool, error) {
+	return bs.updateRow(shortURL, func(row DataStorageRow) bool {
+		return true
+	}, func(row *DataStorageRow) {
+		row.DisabledReason = reason
+	})
+}
+
+// ReassignURL передает короткий URL другому пользователю, перенося его в индексе ссылок пользователей.
+// Возвращает false, если короткий URL не найден.
+func (bs *BoltStorage) ReassignURL(ctx context.Context, shortURL string, userID string) (bool, error) {
+	var found bool
+
+	err := bs.update(func(tx *bbolt.Tx) error {
+		row, ok, err := findBoltRow(tx, shortURL)
+		found = ok
+
+		if err != nil || !ok || row.UserID == userID {
+			return err
+		}
+
+		if err = unlinkBoltUser(tx, row.UserID, shortURL); err != nil {
+			return err
+		}
+
+		row.UserID = userID
+
+		if err = linkBoltUser(tx, userID, shortURL); err != nil {
+			return err
+		}
+
+		return boltPut(tx.Bucket(boltBucketURLs), []byte(shortURL), row)
+	})
+
+	return found && err == nil, err
+}
+
+// BanUser блокирует пользователя. Если пользователь ещё не сохранён, он создается заблокированным.
+func (bs *BoltStorage) BanUser(ctx context.Context, userID string) error {
+	return bs.update(func(tx *bbolt.Tx) error {
+		return tx.Bucket(boltBucketUsers).Put([]byte(userID), boltUserBanned)
+	})
+}
+
+// SaveAuditRecord сохраняет запись журнала действий администратора.
+func (bs *BoltStorage) SaveAuditRecord(ctx context.Context, record AuditRecord) error {
+	return bs.update(func(tx *bbolt.Tx) error {
+		audit := tx.Bucket(boltBucketAudit)
+		id, err := audit.NextSequence()
+
+		if err != nil {
+			return err
+		}
+
+		record.ID = int(id)
+
+		return boltPut(audit, boltKey(record.ID), record)
+	})
+}
+
+// GetAuditRecords возвращает последние записи журнала действий администратора в порядке от новых к старым.
+func (bs *BoltStorage) GetAuditRecords(ctx context.Context, limit int) ([]AuditRecord, error) {
+	var records []AuditRecord
+
+	err := bs.view(func(tx *bbolt.Tx) error {
+		cursor := tx.Bucket(boltBucketAudit).Cursor()
+
+		for key, value := cursor.Last(); key != nil && (limit <= 0 || len(records) < limit); key, value = cursor.Prev() {
+			var record AuditRecord
+
+			if err := json.Unmarshal(value, &record); err != nil {
+				return err
+			}
+
+			records = append(records, record)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return records, nil
+}
+
+// loadBoltWebhooks возвращает все вебхуки по их идентификаторам.
+func loadBoltWebhooks(tx *bbolt.Tx) (map[int]Webhook, error) {
+	webhooks := make(map[int]Webhook)
+
+	err := tx.Bucket(boltBucketWebhooks).ForEach(func(key, value []byte) error {
+		var record boltWebhookRecord
+
+		if err := json.Unmarshal(value, &record); err != nil {
+			return err
+		}
+
+		record.Webhook.UserID = record.UserID
+		webhooks[record.Webhook.ID] = record.Webhook
+
+		return nil
+	})
+
+	return webhooks, err
+}
+
+// findBoltWebhook возвращает вебхук по идентификатору, если он принадлежит владельцу userID.
+func findBoltWebhook(tx *bbolt.Tx, userID string, id int) (bool, error) {
+	var record boltWebhookRecord
+	found, err := boltGet(tx.Bucket(boltBucketWebhooks), boltKey(id), &record)
+
+	return found && record.UserID == userID, err
+}
+
+// getWebhooks возвращает подходящие под условие вебхуки в порядке идентификаторов.
+func (bs *BoltStorage) getWebhooks(match func(webhook Webhook) bool) ([]Webhook, error) {
+	var webhooks map[int]Webhook
+
+	err := bs.view(func(tx *bbolt.Tx) error {
+		var err error
+		webhooks, err = loadBoltWebhooks(tx)
+
+		return err
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return sortedWebhooks(webhooks, match), nil
+}
+
+// SaveWebhook сохраняет вебхук и возвращает его с присвоенным идентификатором.
+func (bs *BoltStorage) SaveWebhook(ctx context.Context, webhook Webhook) (Webhook, error) {
+	err := bs.update(func(tx *bbolt.Tx) error {
+		webhooks := tx.Bucket(boltBucketWebhooks)
+		id, err := webhooks.NextSequence()
+
+		if err != nil {
+			return err
+		}
+
+		webhook.ID = int(id)
+
+		return boltPut(webhooks, boltKey(webhook.ID), boltWebhookRecord{UserID: webhook.UserID, Webhook: webhook})
+	})
+
+	if err != nil {
+		return Webhook{}, err
+	}
+
+	return webhook, nil
+}
+
+// GetWebhooks возвращает вебхуки владельца.
+func (bs *BoltStorage) GetWebhooks(ctx context.Context, userID string) ([]Webhook, error) {
+	return bs.getWebhooks(func(webhook Webhook) bool {
+		return webhook.UserID == userID
+	})
+}
+
+// DeleteWebhook удаляет вебхук владельца.
+func (bs *BoltStorage) DeleteWebhook(ctx context.Context, userID string, id int) (bool, error) {
+	var found bool
+
+	err := bs.update(func(tx *bbolt.Tx) error {
+		var err error
+		found, err = findBoltWebhook(tx, userID, id)
+
+		if err != nil || !found {
+			return err
+		}
+
+		return tx.Bucket(boltBucketWebhooks).Delete(boltKey(id))
+	})
+
+	return found && err == nil, err
+}
+
+// GetEventWebhooks возвращает вебхуки пользователя и вебхуки администратора.
+func (bs *BoltStorage) GetEventWebhooks(ctx context.Context, userID string) ([]Webhook, error) {
+	return bs.getWebhooks(func(webhook Webhook) bool {
+		return webhook.UserID == userID || webhook.UserID == ""
+	})
+}
+
+// EnqueueDeliveries добавляет доставки событий в очередь в одной транзакции.
+func (bs *BoltStorage) EnqueueDeliveries(ctx context.Context, deliveries []WebhookDelivery) error {
+	return bs.update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(boltBucketDeliveries)
+
+		for _, delivery := range deliveries {
+			id, err := bucket.NextSequence()
+
+			if err != nil {
+				return err
+			}
+
+			delivery.ID = int(id)
+			delivery.UpdatedAt = delivery.CreatedAt
+
+			if err = boltPut(bucket, boltKey(delivery.ID), delivery); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// GetDueDeliveries выбирает ожидающие доставки, время попытки которых наступило,
+// в порядке постановки в очередь и закрепляет их на время аренды в той же транзакции.
+// Доставки удалённых вебхуков пропускаются.
+func (bs *BoltStorage) GetDueDeliveries(ctx context.Context, now time.Time, limit int) ([]WebhookDelivery, error) {
+	var deliveries []WebhookDelivery
+
+	err := bs.update(func(tx *bbolt.Tx) error {
+		deliveries = nil
+		webhooks, err := loadBoltWebhooks(tx)
+
+		if err != nil {
+			return err
+		}
+
+		cursor := tx.Bucket(boltBucketDeliveries).Cursor()
+
+		for key, value := cursor.First(); key != nil && (limit <= 0 || len(deliveries) < limit); key, value = cursor.Next() {
+			var delivery WebhookDelivery
+
+			if err = json.Unmarshal(value, &delivery); err != nil {
+				return err
+			}
+
+			deliveries = append(deliveries, dueDeliveries([]WebhookDelivery{delivery}, webhooks, now, 0)...)
+		}
+
+		claimDeliveries(deliveries, now)
+
+		for _, delivery := range deliveries {
+			if err = boltPut(tx.Bucket(boltBucketDeliveries), boltKey(delivery.ID), delivery); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return deliveries, nil
+}
+
+// UpdateDelivery сохраняет результат попытки доставки.
+func (bs *BoltStorage) UpdateDelivery(ctx context.Context, delivery WebhookDelivery) error {
+	return bs.update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(boltBucketDeliveries)
+
+		if bucket.Get(boltKey(delivery.ID)) == nil {
+			return nil
+		}
+
+		return boltPut(bucket, boltKey(delivery.ID), delivery)
+	})
+}
+
+// GetDeliveries возвращает последние доставки вебхука владельца в порядке от новых к старым.
+func (bs *BoltStorage) GetDeliveries(
+	ctx context.Context, userID string, webhookID int, limit int) ([]WebhookDelivery, error) {
+	var deliveries []WebhookDelivery
+
+	err := bs.view(func(tx *bbolt.Tx) error {
+		if found, err := findBoltWebhook(tx, userID, webhookID); err != nil || !found {
+			return err
+		}
+
+		cursor := tx.Bucket(boltBucketDeliveries).Cursor()
+
+		for key, value := cursor.Last(); key != nil && (limit <= 0 || len(deliveries) < limit); key, value = cursor.Prev() {
+			var delivery WebhookDelivery
+
+			if err := json.Unmarshal(value, &delivery); err != nil {
+				return err
+			}
+
+			if delivery.WebhookID == webhookID {
+				deliveries = append(deliveries, delivery)
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return deliveries, nil
+}
+
+// GetHealthTargets возвращает неудалённые и незаблокированные ссылки для проверки.
+func (bs *BoltStorage) GetHealthTargets(ctx context.Context) ([]HealthTarget, error) {
+	var targets []HealthTarget
+
+	err := bs.view(func(tx *bbolt.Tx) error {
+		return tx.Bucket(boltBucketURLs).ForEach(func(key, value []byte) error {
+			var row DataStorageRow
+
+			if err := json.Unmarshal(value, &row); err != nil {
+				return err
+			}
+
+			if row.DeletedFlag || row.DisabledReason != "" {
+				return nil
+			}
+
+			target := HealthTarget{ShortURL: row.ShortURL, URL: row.URL}
+			var health LinkHealth
+
+			if ok, err := boltGet(tx.Bucket(boltBucketHealth), key, &health); err != nil {
+				return err
+			} else if ok {
+				target.Health = &health
+			}
+
+			targets = append(targets, target)
+
+			return nil
+		})
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return sortedHealthTargets(targets), nil
+}
+
+// SaveLinkHealth сохраняет результат проверки адреса перехода ссылки.
+func (bs *BoltStorage) SaveLinkHealth(ctx context.Context, shortURL string, health LinkHealth) error {
+	return bs.update(func(tx *bbolt.Tx) error {
+		if tx.Bucket(boltBucketURLs).Get([]byte(shortURL)) == nil {
+			return nil
+		}
+
+		return boltPut(tx.Bucket(boltBucketHealth), []byte(shortURL), health)
+	})
+}
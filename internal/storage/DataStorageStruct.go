@@ -2,6 +2,7 @@ package storage
 
 import (
 	"context"
+	"time"
 
 	"github.com/jackc/pgconn"
 	"github.com/jackc/pgx/v4"
@@ -10,11 +11,38 @@ import (
 // DataStorageRow представляет структуру для хранения информации о URL в хранилище.
 // Эта структура используется для работы с сохранёнными данными пользователя в базе данных.
 type DataStorageRow struct {
-	ID          int    `json:"uuid"`         // Уникальный идентификатор записи
-	ShortURL    string `json:"short_url"`    // Короткий URL
-	URL         string `json:"original_url"` // Полный оригинальный URL
-	UserID      string `json:"user_id"`      // Идентификатор пользователя, которому принадлежит запись
-	DeletedFlag bool   `json:"is_deleted"`   // Флаг, указывающий, удалён ли URL
+	ID             int    `json:"uuid"`                      // Уникальный идентификатор записи
+	ShortURL       string `json:"short_url"`                 // Короткий URL
+	URL            string `json:"original_url"`              // Полный оригинальный URL
+	UserID         string `json:"user_id"`                   // Идентификатор пользователя, которому принадлежит запись
+	DeletedFlag    bool   `json:"is_deleted"`                // Флаг, указывающий, удалён ли URL
+	DisabledReason string `json:"disabled_reason,omitempty"` // Причина блокировки URL администратором
+	Domain         string `json:"domain,omitempty"`          // Короткий домен ссылки, пустой для домена по умолчанию
+
+	DeviceURLs // Альтернативные адреса перехода для мобильных устройств
+
+	Splits      []SplitDestination `json:"splits,omitempty"`       // Варианты перехода для A/B тестирования
+	StickySplit bool               `json:"sticky_split,omitempty"` // Закрепление варианта за посетителем через cookie
+
+	ActiveFrom *time.Time `json:"active_from,omitempty"` // Время активации ссылки, nil для активных сразу ссылок
+
+	MaxClicks int `json:"max_clicks,omitempty"` // Допустимое количество переходов, 0 без ограничения
+	Clicks    int `json:"clicks,omitempty"`     // Количество учтённых переходов при ограничении
+}
+
+// SplitDestination представляет вариант перехода ссылки с A/B тестированием.
+// Вариант выбирается для каждого перехода с вероятностью, пропорциональной весу.
+type SplitDestination struct {
+	URL    string `json:"url"`              // Адрес перехода варианта
+	Weight int    `json:"weight"`           // Вес варианта
+	Clicks int    `json:"clicks,omitempty"` // Количество переходов на вариант
+}
+
+// DeviceURLs задает альтернативные адреса перехода ссылки для мобильных устройств.
+// Пустой адрес означает переход на основной URL.
+type DeviceURLs struct {
+	IOSURL     string `json:"ios_url,omitempty"`     // Адрес перехода для iOS
+	AndroidURL string `json:"android_url,omitempty"` // Адрес перехода для Android
 }
 
 // UserUrlsResponseBodyItem представляет элемент ответа, содержащий информацию о URL пользователя.
@@ -22,13 +50,57 @@ type DataStorageRow struct {
 type UserUrlsResponseBodyItem struct {
 	OriginalURL string `json:"original_url"` // Полный оригинальный URL
 	ShortURL    string `json:"short_url"`    // Короткий URL
+	Domain      string `json:"-"`            // Короткий домен ссылки, используется для построения ответа
+
+	DeviceURLs // Альтернативные адреса перехода для мобильных устройств
+
+	Splits []SplitDestination `json:"splits,omitempty"` // Варианты перехода для A/B тестирования со статистикой
+
+	ActiveFrom *time.Time `json:"active_from,omitempty"` // Время активации ссылки
+
+	MaxClicks int `json:"max_clicks,omitempty"` // Допустимое количество переходов
+	Clicks    int `json:"clicks,omitempty"`     // Количество учтённых переходов при ограничении
+
+	Health *LinkHealth `json:"health,omitempty"` // Результат последней проверки адреса перехода
+
+	Metadata *LinkMetadata `json:"metadata,omitempty"` // Заголовок и Open Graph данные страницы перехода
+}
+
+// LinkMetadata представляет заголовок и Open Graph данные страницы, на которую ведёт ссылка.
+type LinkMetadata struct {
+	Title         string    `json:"title,omitempty"`          // Содержимое тега <title>
+	OGTitle       string    `json:"og_title,omitempty"`       // Значение og:title
+	OGDescription string    `json:"og_description,omitempty"` // Значение og:description
+	OGImage       string    `json:"og_image,omitempty"`       // Абсолютный адрес изображения og:image
+	FetchedAt     time.Time `json:"fetched_at"`               // Время получения данных
+}
+
+// LinkDetails представляет данные страницы перехода и результат проверки одной ссылки,
+// которые хранятся отдельно от ссылки и переносятся вместе с ней.
+type LinkDetails struct {
+	ShortURL string        `json:"short_url"`          // Короткий URL ссылки
+	Metadata *LinkMetadata `json:"metadata,omitempty"` // Данные страницы перехода, nil если они не получены
+	Health   *LinkHealth   `json:"health,omitempty"`   // Результат последней проверки, nil если проверки не было
 }
 
 // GetURLRow представляет результат, возвращаемый при получении длинного URL по короткому.
 // Эта структура используется для обозначения состояния URL (например, удалён или активен).
 type GetURLRow struct {
-	URL       string // Полный URL
-	IsDeleted bool   // Указывает, удалён ли URL
+	URL            string // Полный URL
+	UserID         string // Идентификатор пользователя, которому принадлежит URL
+	IsDeleted      bool   // Указывает, удалён ли URL
+	DisabledReason string // Причина блокировки URL администратором, пустая для активных URL
+	Domain         string // Короткий домен ссылки, пустой для домена по умолчанию
+
+	DeviceURLs // Альтернативные адреса перехода для мобильных устройств
+
+	Splits      []SplitDestination // Варианты перехода для A/B тестирования
+	StickySplit bool               // Закрепление варианта за посетителем через cookie
+
+	ActiveFrom *time.Time // Время активации ссылки, nil для активных сразу ссылок
+
+	MaxClicks int // Допустимое количество переходов, 0 без ограничения
+	Clicks    int // Количество учтённых переходов при ограничении
 }
 
 // DBConnectionInterface определяет методы для взаимодействия с базой данных.
@@ -53,4 +125,7 @@ type DBConnectionInterface interface {
 	// SendBatch отправляет пакет запросов в базу данных.
 	// Возвращает результаты отправленных батчей.
 	SendBatch(ctx context.Context, b *pgx.Batch) pgx.BatchResults
+
+	// Begin начинает транзакцию.
+	Begin(ctx context.Context) (pgx.Tx, error)
 }
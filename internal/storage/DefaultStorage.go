@@ -3,55 +3,62 @@ package storage
 import (
 	"context"
 	"log"
-
-	"github.com/jackc/pgx/v4/pgxpool"
 )
 
 // DefaultStorage предоставляет реализацию для работы с хранилищем данных.
-// Она включает в себя соединение с базой данных и контекст для управления операциям.
+// Она включает в себя соединение с базой данных и применяет миграции схемы.
 type DefaultStorage struct {
 	// conn представляет подключение к базе данных, позволяющее выполнять команды и запросы.
 	conn DBConnectionInterface
 
-	// ctx представляет контекст, который используется для управления временем жизни запросов и операций.
-	ctx context.Context
+	// migrations заменяет встроенные миграции схемы, используется в тестах.
+	migrations []Migration
+}
+
+// SetConnection устанавливает объект подключения к бд
+func (ds *DefaultStorage) SetConnection(conn DBConnectionInterface) {
+	ds.conn = conn
+}
+
+// Connect открывает соединение с базой данных без изменения схемы.
+func (ds *DefaultStorage) Connect(connectionString string) error {
+	pool, err := NewPool(context.Background(), connectionString, PoolConfig{})
+
+	if err != nil {
+		return err
+	}
+
+	ds.conn = pool
+
+	return nil
 }
 
-// Init инициализирует соединение с базой данных по заданной строке подключения.
+// Init инициализирует соединение с базой данных по заданной строке подключения
+// и применяет к схеме ещё не применённые миграции.
 // Параметры:
 //   - connectionString: строка подключения к базе данных.
 //
-// Возвращает ошибку, если инициализация соединения не удалась или
-// если возникла ошибка при выполнении SQL-команд.
+// Возвращает ошибку, если не удалось подключиться к базе данных или применить миграции.
 func (ds *DefaultStorage) Init(connectionString string) error {
-	ds.ctx = context.Background()
-	var err error
-	ds.conn, err = pgxpool.Connect(ds.ctx, connectionString)
-
-	if err != nil {
-		log.Fatalf("Error while initializing db connection: %v", err)
+	if err := ds.Connect(connectionString); err != nil {
+		return err
 	}
 
-	createTableSQL := `
-	CREATE TABLE IF NOT EXISTS urls (
-		id SERIAL PRIMARY KEY,
-		url VARCHAR(100) UNIQUE,
-		short_url VARCHAR(100) UNIQUE,
-	    user_id VARCHAR(100),
-	    is_deleted BOOLEAN DEFAULT FALSE
-	);
-	ALTER TABLE urls ADD UNIQUE (url, short_url);
-
-	CREATE TABLE IF NOT EXISTS users_cookie (
-		id SERIAL PRIMARY KEY,
-		user_id VARCHAR(100) UNIQUE
-	);`
-
-	_, err = ds.conn.Exec(ds.ctx, createTableSQL)
+	return ds.Migrate(context.Background())
+}
+
+// Migrate применяет к схеме ещё не применённые миграции и выводит в лог их список.
+func (ds *DefaultStorage) Migrate(ctx context.Context) error {
+	applied, err := ds.MigrateUp(ctx)
+
 	if err != nil {
 		return err
 	}
 
+	if len(applied) > 0 {
+		log.Printf("Applied schema migrations: %v", applied)
+	}
+
 	return nil
 }
 
@@ -1,275 +1,1398 @@
 package storage
 
 import (
-	"bufio"
-	"encoding/json"
+	"context"
 	"errors"
-	"io"
+	"fmt"
 	"log"
 	"os"
+	"sort"
+	"sync"
+	"time"
 )
 
+// Типы записей файла хранилища. Записи URL хранятся без типа,
+// что сохраняет совместимость с файлами, созданными ранее.
+const (
+	fileRecordURL      = ""
+	fileRecordUser     = "user"
+	fileRecordBan      = "ban"
+	fileRecordDelete   = "delete"
+	fileRecordAudit    = "audit"
+	fileRecordWebhook  = "webhook"
+	fileRecordDelivery = "delivery"
+	fileRecordHealth   = "health"
+	fileRecordMetadata = "metadata"
+)
+
+// fileRecord представляет строку файла хранилища.
+// Поле Type определяет, какие из остальных полей заполнены.
+type fileRecord struct {
+	Type string `json:"type,omitempty"`
+	DataStorageRow
+	ShortURLs []string         `json:"short_urls,omitempty"`
+	Audit     *AuditRecord     `json:"audit,omitempty"`
+	Webhook   *Webhook         `json:"webhook,omitempty"`
+	Delivery  *WebhookDelivery `json:"delivery,omitempty"`
+	Health    *LinkHealth      `json:"health,omitempty"`
+	Metadata  *LinkMetadata    `json:"metadata,omitempty"`
+}
+
+// fileUserRecord представляет запись о сохранении пользователя в файле хранилища.
+type fileUserRecord struct {
+	Type   string `json:"type"`
+	UserID string `json:"user_id"`
+}
+
+// fileDeleteRecord представляет запись об удалении коротких URL пользователя в файле хранилища.
+// Запись удаляет только неудалённые короткие URL, принадлежащие пользователю на момент удаления.
+type fileDeleteRecord struct {
+	Type      string   `json:"type"`
+	UserID    string   `json:"user_id"`
+	ShortURLs []string `json:"short_urls"`
+}
+
+// fileBanRecord представляет запись о блокировке пользователя в файле хранилища.
+type fileBanRecord struct {
+	Type   string `json:"type"`
+	UserID string `json:"user_id"`
+}
+
+// fileAuditRecord представляет запись журнала действий администратора в файле хранилища.
+type fileAuditRecord struct {
+	Type  string      `json:"type"`
+	Audit AuditRecord `json:"audit"`
+}
+
+// fileWebhookRecord представляет запись о создании или удалении вебхука в файле хранилища.
+type fileWebhookRecord struct {
+	Type    string  `json:"type"`
+	UserID  string  `json:"user_id"`
+	Deleted bool    `json:"is_deleted,omitempty"`
+	Webhook Webhook `json:"webhook"`
+}
+
+// fileDeliveryRecord представляет состояние доставки события вебхука в файле хранилища.
+// Актуальной считается последняя запись доставки с тем же идентификатором.
+type fileDeliveryRecord struct {
+	Type     string          `json:"type"`
+	Delivery WebhookDelivery `json:"delivery"`
+}
+
+// fileHealthRecord представляет результат проверки адреса перехода ссылки в файле хранилища.
+// Актуальной считается последняя запись проверки с тем же коротким URL.
+type fileHealthRecord struct {
+	Type     string     `json:"type"`
+	ShortURL string     `json:"short_url"`
+	Health   LinkHealth `json:"health"`
+}
+
+// fileMetadataRecord представляет данные страницы перехода ссылки в файле хранилища.
+type fileMetadataRecord struct {
+	Type     string       `json:"type"`
+	ShortURL string       `json:"short_url"`
+	Metadata LinkMetadata `json:"metadata"`
+}
+
 // FileStorage представляет хранилище данных в файловой системе.
 // Она используется для сохранения и получения данных из файлов по заданному пути.
+// Изменения дописываются в конец файла, актуальной считается последняя запись.
+// Файл читается один раз при первом обращении к хранилищу, после чего чтение выполняется
+// из индексов в памяти, а запись дописывается в файл и применяется к индексам.
+// Все методы безопасны для одновременного вызова. Несколько процессов могут работать с одним файлом:
+// запись выполняется под блокировкой файла, перед ней применяются записи, дописанные другими процессами.
+// Чтение изменений других процессов не ожидает и видит их после ближайшей записи.
 type FileStorage struct {
 	// FileStoragePath указывает путь к файлу или директории, где будут храниться данные.
 	FileStoragePath string
+
+	// mu защищает индексы и запись в файл.
+	mu sync.RWMutex
+
+	// loadOnce обеспечивает однократное чтение файла, loadErr хранит ошибку чтения.
+	loadOnce sync.Once
+	loadErr  error
+
+	// file открыт на дозапись на всё время работы хранилища.
+	file *os.File
+
+	// SyncPolicy задает политику сброса записей на диск: SyncAlways, SyncInterval или SyncNever.
+	// Пустое значение соответствует SyncInterval.
+	SyncPolicy string
+
+	// SyncInterval задает период сброса записей на диск для политики SyncInterval.
+	// Нулевое значение соответствует DefaultSyncInterval.
+	SyncInterval time.Duration
+
+	// dirty указывает, что в файле есть записи, не сброшенные на диск.
+	dirty bool
+
+	// stopSync останавливает периодический сброс записей на диск.
+	stopSync chan struct{}
+
+	// size, records и garbage хранят размер файла, количество записей в нём
+	// и количество устаревших записей для принятия решения о сжатии.
+	size    int64
+	records int
+	garbage int
+
+	// CompactRatio задает долю устаревших записей, при которой файл сжимается автоматически.
+	// Нулевое значение соответствует DefaultCompactRatio, отрицательное отключает автоматическое сжатие.
+	CompactRatio float64
+
+	// CompactMinSize задает минимальный размер файла в байтах для автоматического сжатия.
+	// Нулевое значение соответствует DefaultCompactMinSize.
+	CompactMinSize int64
+
+	// rows хранит актуальные записи URL по короткому URL.
+	rows map[string]DataStorageRow
+
+	// order хранит короткие URL в порядке первого сохранения, positions — их позиции в order.
+	order     []string
+	positions map[string]int
+
+	// shortURLs хранит обратный индекс оригинального URL в короткий URL.
+	shortURLs map[string]string
+
+	// userLinks хранит короткие URL каждого пользователя.
+	userLinks map[string][]string
+
+	// users хранит сохранённых пользователей и признак их блокировки.
+	users map[string]bool
+
+	// auditRecords хранит журнал действий администратора.
+	auditRecords []AuditRecord
+
+	// webhooks хранит действующие вебхуки, lastWebhookID — последний присвоенный идентификатор.
+	webhooks      map[int]Webhook
+	lastWebhookID int
+
+	// deliveries хранит актуальные состояния доставок в порядке их идентификаторов.
+	deliveries []WebhookDelivery
+
+	// health хранит результаты последней проверки адресов перехода ссылок.
+	health map[string]LinkHealth
+
+	// metadata хранит заголовки и Open Graph данные страниц перехода ссылок.
+	metadata map[string]LinkMetadata
 }
 
 // SetConnection заглушка для интерфейса
 func (fs *FileStorage) SetConnection(conn DBConnectionInterface) {}
 
-// Init инициализирует хранилище данных. В этой реализации ничего не делает,
-// так как данные хранятся в файловой системе.
+// Init читает файл хранилища по пути FileStoragePath и строит индексы.
+// Строка подключения не используется. Если Init не вызван, файл читается при первом обращении.
 func (fs *FileStorage) Init(connectionString string) error {
-	return nil
+	return fs.load()
 }
 
-// Close закрывает хранилище данных. В этом случае ничего не нужно делать,
-// так как нет открытых ресурсов.
-func (fs *FileStorage) Close() {}
+// Close сбрасывает записи на диск и закрывает файл хранилища.
+func (fs *FileStorage) Close() {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
 
-// SaveBatch сохраняет пакет данных, представленных в виде массива DataStorageRow.
-// Возвращает ошибку, если сохранение не удалось.
-func (fs *FileStorage) SaveBatch(dataStorageRows []DataStorageRow) error {
-	urlCount := fs.GetURLCount()
-	for i := range dataStorageRows {
-		urlCount++
-		dataStorageRows[i].ID = urlCount
+	if fs.stopSync != nil {
+		close(fs.stopSync)
+		fs.stopSync = nil
 	}
 
-	var jsonRows []byte
+	if fs.file != nil {
+		fs.flush()
+		fs.file.Close()
+		fs.file = nil
+	}
+}
 
-	for _, dataStorageRow := range dataStorageRows {
-		jsonRow, err := json.Marshal(dataStorageRow)
-		jsonRows = append(jsonRows, jsonRow...)
-		jsonRows = append(jsonRows, '\n')
+// load однократно читает файл хранилища и строит индексы.
+func (fs *FileStorage) load() error {
+	fs.loadOnce.Do(func() {
+		fs.mu.Lock()
+		defer fs.mu.Unlock()
 
-		if err != nil {
-			return err
+		fs.loadErr = fs.readFile()
+	})
+
+	return fs.loadErr
+}
+
+// rlock загружает хранилище и захватывает блокировку на чтение.
+// Если загрузка не удалась, блокировка не захватывается.
+func (fs *FileStorage) rlock() error {
+	if err := fs.load(); err != nil {
+		return unavailable(err)
+	}
+
+	fs.mu.RLock()
+
+	return nil
+}
+
+// lock загружает хранилище, захватывает блокировку на запись и блокировку файла,
+// после чего применяет записи, дописанные другими процессами.
+// Если загрузка или блокировка файла не удалась, блокировки не захватываются.
+func (fs *FileStorage) lock() error {
+	if err := fs.load(); err != nil {
+		return unavailable(err)
+	}
+
+	fs.mu.Lock()
+
+	if err := fs.acquireFile(); err != nil {
+		fs.mu.Unlock()
+		return unavailable(err)
+	}
+
+	return nil
+}
+
+// unlock сжимает файл, если доля устаревших записей превысила порог,
+// и освобождает блокировку файла и блокировку на запись.
+func (fs *FileStorage) unlock() {
+	if fs.needsCompaction() {
+		if _, err := fs.compact(); err != nil {
+			log.Printf("Error while compacting file storage: %v", err)
 		}
 	}
 
-	file, err := os.OpenFile(fs.FileStoragePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if fs.file != nil {
+		unlockFile(fs.file)
+	}
 
-	if err != nil {
-		log.Printf("Error opening file:  %v\n", err)
+	fs.mu.Unlock()
+}
+
+// readFile открывает файл хранилища, применяет его записи к индексам
+// и запускает периодический сброс записей на диск.
+func (fs *FileStorage) readFile() error {
+	switch fs.SyncPolicy {
+	case "":
+		fs.SyncPolicy = SyncInterval
+	case SyncAlways, SyncInterval, SyncNever:
+	default:
+		return fmt.Errorf("unknown sync policy %q", fs.SyncPolicy)
+	}
+
+	if err := fs.open(); err != nil {
 		return err
 	}
 
-	defer file.Close()
+	if err := lockFile(fs.file); err != nil {
+		fs.file.Close()
+		fs.file = nil
+		return err
+	}
+
+	// Временный файл остается, если работа была прервана во время сжатия, до замены исходного файла.
+	// Удаление под блокировкой файла не затрагивает сжатие, которое выполняет другой процесс.
+	err := os.Remove(fs.compactPath())
+
+	if err == nil || errors.Is(err, os.ErrNotExist) {
+		err = fs.replay()
+	}
+
+	unlockFile(fs.file)
 
-	_, err = file.Write(jsonRows)
 	if err != nil {
+		fs.file.Close()
+		fs.file = nil
 		return err
 	}
 
+	if fs.SyncPolicy == SyncInterval {
+		fs.stopSync = make(chan struct{})
+		go fs.syncPeriodically(fs.stopSync)
+	}
+
 	return nil
 }
 
-// GetURL возвращает полный URL для заданного короткого URL.
-// Возвращает структуру GetURLRow и булевое значение, указывающее на существование.
-func (fs *FileStorage) GetURL(shortURL string) (GetURLRow, bool) {
-	file, err := os.OpenFile(fs.FileStoragePath, os.O_RDONLY|os.O_CREATE, 0666)
-	var getURLRow GetURLRow
+// open открывает файл хранилища и очищает индексы перед чтением файла. Вызывается под блокировкой на запись.
+func (fs *FileStorage) open() error {
+	file, err := os.OpenFile(fs.FileStoragePath, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0644)
 
 	if err != nil {
-		return getURLRow, false
+		return err
+	}
+
+	fs.file = file
+	fs.size = 0
+	fs.records = 0
+	fs.garbage = 0
+	fs.dirty = false
+
+	fs.rows = make(map[string]DataStorageRow)
+	fs.order = nil
+	fs.shortURLs = make(map[string]string)
+	fs.userLinks = make(map[string][]string)
+	fs.positions = make(map[string]int)
+	fs.users = make(map[string]bool)
+	fs.auditRecords = nil
+	fs.webhooks = make(map[int]Webhook)
+	fs.lastWebhookID = 0
+	fs.deliveries = nil
+	fs.health = make(map[string]LinkHealth)
+	fs.metadata = make(map[string]LinkMetadata)
+
+	return nil
+}
+
+// apply применяет прочитанную из файла запись к индексам. Вызывается под блокировкой на запись.
+func (fs *FileStorage) apply(record fileRecord) {
+	switch {
+	case record.Type == fileRecordURL:
+		fs.indexRow(record.DataStorageRow)
+	case record.Type == fileRecordUser:
+		fs.indexUser(record.UserID)
+	case record.Type == fileRecordBan:
+		fs.indexBan(record.UserID)
+	case record.Type == fileRecordDelete:
+		fs.indexDelete(record.UserID, record.ShortURLs)
+	case record.Type == fileRecordAudit && record.Audit != nil:
+		fs.auditRecords = append(fs.auditRecords, *record.Audit)
+	case record.Type == fileRecordWebhook && record.Webhook != nil:
+		fs.indexWebhook(record.UserID, *record.Webhook, record.DeletedFlag)
+	case record.Type == fileRecordDelivery && record.Delivery != nil:
+		fs.indexDelivery(*record.Delivery)
+	case record.Type == fileRecordHealth && record.Health != nil:
+		fs.indexHealth(record.ShortURL, *record.Health)
+	case record.Type == fileRecordMetadata && record.Metadata != nil:
+		fs.indexMetadata(record.ShortURL, *record.Metadata)
+	}
+}
+
+// indexRow заменяет актуальную запись URL и обновляет индексы. Вызывается под блокировкой на запись.
+func (fs *FileStorage) indexRow(dataStorageRow DataStorageRow) {
+	previous, ok := fs.rows[dataStorageRow.ShortURL]
+
+	if ok {
+		fs.garbage++
+	} else {
+		fs.positions[dataStorageRow.ShortURL] = len(fs.order)
+		fs.order = append(fs.order, dataStorageRow.ShortURL)
+	}
+
+	if !ok || previous.UserID != dataStorageRow.UserID {
+		fs.userLinks[previous.UserID] = removeLink(fs.userLinks[previous.UserID], dataStorageRow.ShortURL)
+		fs.userLinks[dataStorageRow.UserID] = append(fs.userLinks[dataStorageRow.UserID], dataStorageRow.ShortURL)
 	}
 
-	defer file.Close()
-	reader := bufio.NewReader(file)
-	var dataStorageRow DataStorageRow
+	if _, ok = fs.shortURLs[dataStorageRow.URL]; !ok {
+		fs.shortURLs[dataStorageRow.URL] = dataStorageRow.ShortURL
+	}
+
+	dataStorageRow.Splits = copySplits(dataStorageRow.Splits)
+	fs.rows[dataStorageRow.ShortURL] = dataStorageRow
+}
+
+// indexUser добавляет пользователя, не изменяя признак блокировки. Вызывается под блокировкой на запись.
+func (fs *FileStorage) indexUser(userID string) {
+	if _, ok := fs.users[userID]; ok {
+		fs.garbage++
+		return
+	}
+
+	fs.users[userID] = false
+}
+
+// indexBan блокирует пользователя, создавая его, если он ещё не сохранён. Вызывается под блокировкой на запись.
+func (fs *FileStorage) indexBan(userID string) {
+	if _, ok := fs.users[userID]; ok {
+		fs.garbage++
+	}
+
+	fs.users[userID] = true
+}
 
-	for {
-		data, err := reader.ReadBytes('\n')
+// indexDelete помечает удалёнными короткие URL пользователя. Вызывается под блокировкой на запись.
+// После сжатия файла удаление сохраняется в самих записях URL, поэтому запись об удалении устаревает сразу.
+func (fs *FileStorage) indexDelete(userID string, shortURLs []string) {
+	fs.garbage++
 
-		if err == io.EOF {
-			break
+	for _, shortURL := range shortURLs {
+		if dataStorageRow, ok := fs.userRow(userID, shortURL); ok {
+			dataStorageRow.DeletedFlag = true
+			fs.rows[shortURL] = dataStorageRow
 		}
+	}
+}
 
-		if err != nil {
-			return getURLRow, false
+// indexWebhook добавляет или удаляет вебхук. Вызывается под блокировкой на запись.
+// Идентификатор удалённого вебхука также учитывается, чтобы он не был присвоен повторно после сжатия файла.
+func (fs *FileStorage) indexWebhook(userID string, webhook Webhook, deleted bool) {
+	if webhook.ID > fs.lastWebhookID {
+		fs.lastWebhookID = webhook.ID
+	}
+
+	if deleted {
+		if _, ok := fs.webhooks[webhook.ID]; ok {
+			fs.garbage++
 		}
 
-		err = json.Unmarshal(data, &dataStorageRow)
+		fs.garbage++
+		delete(fs.webhooks, webhook.ID)
+		return
+	}
+
+	webhook.UserID = userID
+	fs.webhooks[webhook.ID] = webhook
+}
+
+// indexDelivery добавляет доставку или заменяет её состояние. Вызывается под блокировкой на запись.
+func (fs *FileStorage) indexDelivery(delivery WebhookDelivery) {
+	if id := delivery.ID; id > 0 && id <= len(fs.deliveries) {
+		fs.deliveries[id-1] = delivery
+		fs.garbage++
+		return
+	}
+
+	fs.deliveries = append(fs.deliveries, delivery)
+}
+
+// indexHealth заменяет результат проверки адреса перехода ссылки. Вызывается под блокировкой на запись.
+func (fs *FileStorage) indexHealth(shortURL string, health LinkHealth) {
+	if _, ok := fs.health[shortURL]; ok {
+		fs.garbage++
+	}
+
+	fs.health[shortURL] = health
+}
+
+// indexMetadata заменяет данные страницы перехода ссылки. Вызывается под блокировкой на запись.
+func (fs *FileStorage) indexMetadata(shortURL string, metadata LinkMetadata) {
+	if _, ok := fs.metadata[shortURL]; ok {
+		fs.garbage++
+	}
+
+	fs.metadata[shortURL] = metadata
+}
+
+// appendRecords сериализует записи и дописывает их в конец файла хранилища одной операцией записи.
+// Вызывается под блокировкой на запись и блокировкой файла.
+func (fs *FileStorage) appendRecords(records ...interface{}) error {
+	if fs.file == nil {
+		return os.ErrClosed
+	}
+
+	if len(records) == 0 {
+		return nil
+	}
+
+	var jsonRows []byte
+
+	for _, record := range records {
+		jsonRow, err := encodeRecord(record)
 
 		if err != nil {
-			return getURLRow, false
+			return err
 		}
 
-		getURLRow.URL = dataStorageRow.URL
-		if dataStorageRow.ShortURL == shortURL {
-			return getURLRow, true
-		}
+		jsonRows = append(jsonRows, jsonRow...)
+	}
+
+	if _, err := fs.file.Write(jsonRows); err != nil {
+		log.Printf("Error writing file:  %v\n", err)
+		return err
 	}
 
-	return getURLRow, false
+	fs.size += int64(len(jsonRows))
+	fs.records += len(records)
+	fs.dirty = true
+
+	if fs.SyncPolicy == SyncAlways {
+		return fs.flush()
+	}
+
+	return nil
 }
 
-// GetURLCount возвращает количество сохранённых URL в хранилище.
-func (fs *FileStorage) GetURLCount() int {
-	file, err := os.OpenFile(fs.FileStoragePath, os.O_RDONLY|os.O_CREATE, 0666)
+// writeRows дописывает записи URL в файл и применяет их к индексам. Вызывается под блокировкой на запись.
+func (fs *FileStorage) writeRows(dataStorageRows ...DataStorageRow) error {
+	records := make([]interface{}, 0, len(dataStorageRows))
 
-	if err != nil {
-		return 0
+	for _, dataStorageRow := range dataStorageRows {
+		records = append(records, dataStorageRow)
+	}
+
+	if err := fs.appendRecords(records...); err != nil {
+		return err
+	}
+
+	for _, dataStorageRow := range dataStorageRows {
+		fs.indexRow(dataStorageRow)
 	}
 
-	defer file.Close()
-	reader := bufio.NewReader(file)
-	count := 0
+	return nil
+}
+
+// findRow возвращает копию актуальной записи для заданного короткого URL. Вызывается под блокировкой.
+func (fs *FileStorage) findRow(shortURL string) (DataStorageRow, bool) {
+	dataStorageRow, ok := fs.rows[shortURL]
+	dataStorageRow.Splits = copySplits(dataStorageRow.Splits)
 
-	for {
-		_, err := reader.ReadBytes('\n')
+	return dataStorageRow, ok
+}
 
-		if err == io.EOF {
-			break
-		}
+// userRow возвращает копию неудалённой записи URL пользователя. Вызывается под блокировкой.
+func (fs *FileStorage) userRow(uniqueID string, shortURL string) (DataStorageRow, bool) {
+	dataStorageRow, found := fs.findRow(shortURL)
 
-		count++
+	if !found || dataStorageRow.UserID != uniqueID || dataStorageRow.DeletedFlag {
+		return DataStorageRow{}, false
 	}
 
-	return count
+	return dataStorageRow, true
 }
 
-// GetShortURL ищет короткий URL для заданного оригинального URL.
-// Возвращает короткий URL, если он найден, и ошибку, если нет.
-func (fs *FileStorage) GetShortURL(URL string) (string, error) {
-	file, err := os.OpenFile(fs.FileStoragePath, os.O_RDONLY|os.O_CREATE, 0666)
+// updateUserRow применяет изменение к неудалённому URL пользователя и дописывает обновлённую запись.
+// Возвращает false, если короткий URL не найден среди неудалённых URL пользователя.
+func (fs *FileStorage) updateUserRow(uniqueID string, shortURL string, update func(row *DataStorageRow)) (bool, error) {
+	if err := fs.lock(); err != nil {
+		return false, err
+	}
 
-	if err != nil {
-		return "", err
+	defer fs.unlock()
+
+	dataStorageRow, found := fs.userRow(uniqueID, shortURL)
+
+	if !found {
+		return false, nil
+	}
+
+	update(&dataStorageRow)
+
+	return true, fs.writeRows(dataStorageRow)
+}
+
+// updateRow применяет изменение к URL и дописывает обновлённую запись.
+// Возвращает false, если короткий URL не найден.
+func (fs *FileStorage) updateRow(shortURL string, update func(row *DataStorageRow)) (bool, error) {
+	if err := fs.lock(); err != nil {
+		return false, err
+	}
+
+	defer fs.unlock()
+
+	dataStorageRow, found := fs.findRow(shortURL)
+
+	if !found {
+		return false, nil
+	}
+
+	update(&dataStorageRow)
+
+	return true, fs.writeRows(dataStorageRow)
+}
+
+// SaveBatch сохраняет пакет данных, представленных в виде массива DataStorageRow.
+// Уже сохранённые ссылки с тем же оригинальным URL пропускаются. Если короткий или оригинальный URL
+// пакета занят другой ссылкой, пакет не сохраняется целиком и возвращается ошибка ErrConflict.
+// Идентификаторы записей назначаются хранилищем, переданный массив не изменяется.
+func (fs *FileStorage) SaveBatch(ctx context.Context, dataStorageRows []DataStorageRow) error {
+	if err := fs.lock(); err != nil {
+		return err
 	}
 
-	defer file.Close()
-	reader := bufio.NewReader(file)
-	var dataStorageRow DataStorageRow
+	defer fs.unlock()
+
+	pending := make(map[string]string, len(dataStorageRows))
+	pendingURLs := make(map[string]string, len(dataStorageRows))
+	rows := make([]DataStorageRow, 0, len(dataStorageRows))
 
-	for {
-		data, readError := reader.ReadBytes('\n')
+	for _, row := range dataStorageRows {
+		shortURL, ok := fs.shortURLs[row.URL]
 
-		if readError == io.EOF {
-			break
+		if !ok {
+			shortURL, ok = pendingURLs[row.URL]
 		}
 
-		if readError != nil {
-			return "", readError
+		if ok && shortURL == row.ShortURL {
+			continue
 		}
 
-		readError = json.Unmarshal(data, &dataStorageRow)
+		if ok {
+			return errDuplicateURL
+		}
 
-		if readError != nil {
-			return "", readError
+		if _, exists := fs.rows[row.ShortURL]; exists {
+			return errDuplicateShortURL
 		}
 
-		if dataStorageRow.URL == URL {
-			return dataStorageRow.ShortURL, nil
+		if _, exists := pending[row.ShortURL]; exists {
+			return errDuplicateShortURL
 		}
+
+		pending[row.ShortURL] = row.URL
+		pendingURLs[row.URL] = row.ShortURL
+		row.ID = fs.nextID() + len(rows)
+		rows = append(rows, row)
 	}
 
-	err = errors.New("short url not found")
-	return "", err
+	return fs.writeRows(rows...)
 }
 
-// Save сохраняет короткий URL с соответствующим полному URL и идентификатору пользователя.
-// Параметры:
-//   - ShortURL: короткий URL, который должен быть сохранён.
-//   - URL: полный (оригинальный) URL, который связан с коротким URL.
-//   - userID: идентификатор пользователя, который добавляет URL.
-//
-// Возвращает ошибку, если сохранение не удалось.
-func (fs *FileStorage) Save(ShortURL string, URL string, userID string) error {
-	row := DataStorageRow{
-		ID:       fs.GetURLCount(),
-		ShortURL: ShortURL,
-		URL:      URL,
+// ImportBatch сохраняет перенесённые ссылки. Хранилище не публикует событий создания ссылок,
+// поэтому перенос совпадает с SaveBatch.
+func (fs *FileStorage) ImportBatch(ctx context.Context, dataStorageRows []DataStorageRow) error {
+	return fs.SaveBatch(ctx, dataStorageRows)
+}
+
+// nextID возвращает идентификатор следующей новой записи URL. Вызывается под блокировкой.
+func (fs *FileStorage) nextID() int {
+	return len(fs.order) + 1
+}
+
+// GetURL возвращает полный URL для заданного короткого URL.
+// Если короткого URL нет в хранилище, возвращает ErrNotFound.
+func (fs *FileStorage) GetURL(ctx context.Context, shortURL string) (GetURLRow, error) {
+	var getURLRow GetURLRow
+
+	if err := fs.rlock(); err != nil {
+		return getURLRow, err
 	}
-	jsonRow, err := json.Marshal(row)
 
-	if err != nil {
-		return err
+	defer fs.mu.RUnlock()
+
+	dataStorageRow, found := fs.findRow(shortURL)
+
+	if !found {
+		return getURLRow, ErrNotFound
 	}
 
-	file, err := os.OpenFile(fs.FileStoragePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	getURLRow.URL = dataStorageRow.URL
+	getURLRow.UserID = dataStorageRow.UserID
+	getURLRow.IsDeleted = dataStorageRow.DeletedFlag
+	getURLRow.DisabledReason = dataStorageRow.DisabledReason
+	getURLRow.Domain = dataStorageRow.Domain
+	getURLRow.DeviceURLs = dataStorageRow.DeviceURLs
+	getURLRow.Splits = dataStorageRow.Splits
+	getURLRow.StickySplit = dataStorageRow.StickySplit
+	getURLRow.ActiveFrom = dataStorageRow.ActiveFrom
+	getURLRow.MaxClicks = dataStorageRow.MaxClicks
+	getURLRow.Clicks = dataStorageRow.Clicks
 
-	if err != nil {
-		log.Printf("Error opening file:  %v\n", err)
+	return getURLRow, nil
+}
+
+// RecordSplitClick учитывает переход на вариант A/B теста короткого URL, дописывая обновлённую запись.
+func (fs *FileStorage) RecordSplitClick(ctx context.Context, shortURL string, variant int) error {
+	if err := fs.lock(); err != nil {
 		return err
 	}
 
-	defer file.Close()
-	jsonRow = append(jsonRow, '\n')
-	_, err = file.Write(jsonRow)
-	if err != nil {
-		return err
+	defer fs.unlock()
+
+	dataStorageRow, found := fs.findRow(shortURL)
+
+	if !found || variant < 0 || variant >= len(dataStorageRow.Splits) {
+		return nil
 	}
 
-	return nil
+	dataStorageRow.Splits[variant].Clicks++
+
+	return fs.writeRows(dataStorageRow)
 }
 
-// LoadData загружает данные из хранилища и возвращает их в виде массива DataStorageRow.
-// Возвращает массив DataStorageRow и ошибку, если произошла ошибка чтения данных.
-func (fs *FileStorage) LoadData() ([]DataStorageRow, error) {
-	file, err := os.OpenFile(fs.FileStoragePath, os.O_RDONLY|os.O_CREATE, 0666)
+// RedeemClick учитывает переход по короткому URL с ограничением количества переходов,
+// дописывая обновлённую запись. Проверка и запись выполняются под блокировкой.
+// Возвращает количество оставшихся переходов и false, если лимит переходов исчерпан.
+func (fs *FileStorage) RedeemClick(ctx context.Context, shortURL string) (int, bool, error) {
+	if err := fs.lock(); err != nil {
+		return 0, false, err
+	}
 
-	if err != nil {
-		return nil, err
+	defer fs.unlock()
+
+	dataStorageRow, found := fs.findRow(shortURL)
+
+	if !found || dataStorageRow.Clicks >= dataStorageRow.MaxClicks {
+		return 0, false, nil
 	}
 
-	defer file.Close()
-	reader := bufio.NewReader(file)
-	var dataStorageRow DataStorageRow
-	var dataStorageRows []DataStorageRow
+	dataStorageRow.Clicks++
 
-	for {
-		data, err := reader.ReadBytes('\n')
+	if err := fs.writeRows(dataStorageRow); err != nil {
+		return 0, false, err
+	}
 
-		if err == io.EOF {
-			break
-		}
+	return dataStorageRow.MaxClicks - dataStorageRow.Clicks, true, nil
+}
 
-		if err != nil {
-			return nil, err
-		}
+// SaveLinkMetadata дописывает заголовок и Open Graph данные страницы перехода короткого URL.
+func (fs *FileStorage) SaveLinkMetadata(ctx context.Context, shortURL string, metadata LinkMetadata) error {
+	if err := fs.lock(); err != nil {
+		return err
+	}
 
-		err = json.Unmarshal(data, &dataStorageRow)
+	defer fs.unlock()
 
-		if err != nil {
-			return nil, err
-		}
+	err := fs.appendRecords(fileMetadataRecord{Type: fileRecordMetadata, ShortURL: shortURL, Metadata: metadata})
 
-		dataStorageRows = append(dataStorageRows, dataStorageRow)
+	if err == nil {
+		fs.indexMetadata(shortURL, metadata)
 	}
 
-	return dataStorageRows, nil
+	return err
 }
 
-// Ping проверяет состояние работы хранилища.
-// Возвращает true, так как хранилище работает в оперативной памяти.
-func (fs *FileStorage) Ping() bool {
-	return true
-}
+// LoadLinkDetails возвращает данные страниц перехода и результаты проверки ссылок,
+// для которых они сохранены, упорядоченные по короткому URL.
+func (fs *FileStorage) LoadLinkDetails(ctx context.Context) ([]LinkDetails, error) {
+	if err := fs.rlock(); err != nil {
+		return nil, err
+	}
 
-// IsUserExist проверяет, существует ли пользователь по уникальному идентификатору.
-// В данной реализации всегда возвращает false, так как InMemoryStorage не хранит пользователей.
-func (fs *FileStorage) IsUserExist(data string) bool {
-	return false
+	defer fs.mu.RUnlock()
+
+	return collectLinkDetails(fs.metadata, fs.health), nil
 }
 
-// SaveUser сохраняет нового пользователя с указанным уникальным идентификатором.
-// В данной реализации ничего не делает и всегда возвращает nil.
-func (fs *FileStorage) SaveUser(uniqueID string) error {
+// SaveLinkDetails дописывает перенесённые данные страниц перехода и результаты проверки одной операцией записи.
+// Данные ссылок, которых нет в хранилище, пропускаются.
+func (fs *FileStorage) SaveLinkDetails(ctx context.Context, details []LinkDetails) error {
+	if err := fs.lock(); err != nil {
+		return err
+	}
+
+	defer fs.unlock()
+
+	var records []interface{}
+
+	for _, item := range details {
+		if _, ok := fs.rows[item.ShortURL]; !ok {
+			continue
+		}
+
+		if item.Metadata != nil {
+			records = append(records,
+				fileMetadataRecord{Type: fileRecordMetadata, ShortURL: item.ShortURL, Metadata: *item.Metadata})
+		}
+
+		if item.Health != nil {
+			records = append(records,
+				fileHealthRecord{Type: fileRecordHealth, ShortURL: item.ShortURL, Health: *item.Health})
+		}
+	}
+
+	if len(records) == 0 {
+		return nil
+	}
+
+	if err := fs.appendRecords(records...); err != nil {
+		return err
+	}
+
+	for _, record := range records {
+		switch record := record.(type) {
+		case fileMetadataRecord:
+			fs.indexMetadata(record.ShortURL, record.Metadata)
+		case fileHealthRecord:
+			fs.indexHealth(record.ShortURL, record.Health)
+		}
+	}
+
 	return nil
 }
 
-// GetUserUrls возвращает список URL, сохранённых для указанного пользователя.
-// В данной реализации всегда возвращает nil, так как InMemoryStorage не хранит пользователей.
-func (fs *FileStorage) GetUserUrls(uniqueID string) ([]UserUrlsResponseBodyItem, error) {
-	return nil, nil
+// GetURLCount возвращает количество сохранённых URL в хранилище.
+func (fs *FileStorage) GetURLCount(ctx context.Context) int {
+	if err := fs.rlock(); err != nil {
+		return 0
+	}
+
+	defer fs.mu.RUnlock()
+
+	return len(fs.order)
 }
 
-// DeleteUserUrls удаляет указанные короткие URL для данного пользователя.
-// В данной реализации ничего не делает и всегда возвращает nil.
-func (fs *FileStorage) DeleteUserUrls(uniqueID string, shortURLS []string) error {
+// GetShortURL ищет короткий URL для заданного оригинального URL.
+// Возвращает короткий URL, если он найден, и ErrNotFound, если нет.
+func (fs *FileStorage) GetShortURL(ctx context.Context, URL string) (string, error) {
+	if err := fs.rlock(); err != nil {
+		return "", err
+	}
+
+	defer fs.mu.RUnlock()
+
+	shortURL, ok := fs.shortURLs[URL]
+
+	if !ok {
+		return "", ErrNotFound
+	}
+
+	return shortURL, nil
+}
+
+// Save сохраняет короткий URL с соответствующим полному URL, идентификатору пользователя и домену.
+// Параметры:
+//   - dataStorageRow: сохраняемая запись; идентификатор записи назначается хранилищем.
+//
+// Возвращает ErrConflict, если короткий или оригинальный URL уже сохранены, или ошибку записи.
+func (fs *FileStorage) Save(ctx context.Context, dataStorageRow DataStorageRow) error {
+	if err := fs.lock(); err != nil {
+		return err
+	}
+
+	defer fs.unlock()
+
+	if _, ok := fs.rows[dataStorageRow.ShortURL]; ok {
+		return errDuplicateShortURL
+	}
+
+	if _, ok := fs.shortURLs[dataStorageRow.URL]; ok {
+		return errDuplicateURL
+	}
+
+	dataStorageRow.ID = fs.nextID()
+
+	return fs.writeRows(dataStorageRow)
+}
+
+// InsertOrGet сохраняет ссылку, если оригинального URL ещё нет в хранилище.
+// Проверка и запись выполняются под блокировкой файла, поэтому одновременные вызовы
+// в том числе из разных процессов создают одну ссылку на URL.
+func (fs *FileStorage) InsertOrGet(ctx context.Context, dataStorageRow DataStorageRow) (DataStorageRow, bool, error) {
+	if err := fs.lock(); err != nil {
+		return DataStorageRow{}, false, err
+	}
+
+	defer fs.unlock()
+
+	if shortURL, ok := fs.shortURLs[dataStorageRow.URL]; ok {
+		row, _ := fs.findRow(shortURL)
+		return DataStorageRow{ShortURL: row.ShortURL, URL: row.URL, UserID: row.UserID, Domain: row.Domain}, false, nil
+	}
+
+	if _, ok := fs.rows[dataStorageRow.ShortURL]; ok {
+		return DataStorageRow{}, false, errDuplicateShortURL
+	}
+
+	dataStorageRow.ID = fs.nextID()
+
+	if err := fs.writeRows(dataStorageRow); err != nil {
+		return DataStorageRow{}, false, err
+	}
+
+	return dataStorageRow, true, nil
+}
+
+// LoadData загружает данные из хранилища и возвращает их в виде массива DataStorageRow.
+// Для каждого короткого URL возвращается актуальная запись в порядке первого сохранения.
+// Возвращает массив DataStorageRow и ошибку, если произошла ошибка чтения данных.
+func (fs *FileStorage) LoadData(ctx context.Context) ([]DataStorageRow, error) {
+	if err := fs.rlock(); err != nil {
+		return nil, err
+	}
+
+	defer fs.mu.RUnlock()
+
+	var dataStorageRows []DataStorageRow
+
+	for _, shortURL := range fs.order {
+		dataStorageRow, _ := fs.findRow(shortURL)
+		dataStorageRows = append(dataStorageRows, dataStorageRow)
+	}
+
+	return dataStorageRows, nil
+}
+
+// Ping проверяет состояние работы хранилища.
+// Возвращает true, если файл хранилища прочитан без ошибок.
+func (fs *FileStorage) Ping(ctx context.Context) bool {
+	return fs.load() == nil
+}
+
+// IsUserExist проверяет, существует ли пользователь по уникальному идентификатору.
+func (fs *FileStorage) IsUserExist(ctx context.Context, data string) bool {
+	if err := fs.rlock(); err != nil {
+		return false
+	}
+
+	defer fs.mu.RUnlock()
+
+	_, ok := fs.users[data]
+
+	return ok
+}
+
+// SaveUser сохраняет нового пользователя с указанным уникальным идентификатором, дописывая запись пользователя.
+// Возвращает ошибку, если пользователь уже сохранён.
+func (fs *FileStorage) SaveUser(ctx context.Context, uniqueID string) error {
+	if err := fs.lock(); err != nil {
+		return err
+	}
+
+	defer fs.unlock()
+
+	if _, ok := fs.users[uniqueID]; ok {
+		return errDuplicateUser
+	}
+
+	if err := fs.appendRecords(fileUserRecord{Type: fileRecordUser, UserID: uniqueID}); err != nil {
+		return err
+	}
+
+	fs.indexUser(uniqueID)
+
+	return nil
+}
+
+// LoadUsers возвращает всех пользователей, упорядоченных по идентификатору.
+func (fs *FileStorage) LoadUsers(ctx context.Context) ([]User, error) {
+	if err := fs.rlock(); err != nil {
+		return nil, err
+	}
+
+	defer fs.mu.RUnlock()
+
+	return sortedUsers(fs.users), nil
+}
+
+// SaveUsers дописывает в файл только новых пользователей и блокировки,
+// поэтому повторное сохранение тех же пользователей не увеличивает файл.
+func (fs *FileStorage) SaveUsers(ctx context.Context, users []User) error {
+	if err := fs.lock(); err != nil {
+		return err
+	}
+
+	defer fs.unlock()
+
+	var records []interface{}
+	saved := make(map[string]bool, len(users))
+
+	for _, user := range users {
+		banned, exists := fs.users[user.UserID]
+
+		if pending, ok := saved[user.UserID]; ok {
+			banned, exists = pending, true
+		}
+
+		switch {
+		case user.Banned && !banned:
+			records = append(records, fileBanRecord{Type: fileRecordBan, UserID: user.UserID})
+			saved[user.UserID] = true
+		case !exists:
+			records = append(records, fileUserRecord{Type: fileRecordUser, UserID: user.UserID})
+			saved[user.UserID] = false
+		}
+	}
+
+	if err := fs.appendRecords(records...); err != nil {
+		return err
+	}
+
+	for _, record := range records {
+		switch record := record.(type) {
+		case fileBanRecord:
+			fs.indexBan(record.UserID)
+		case fileUserRecord:
+			fs.indexUser(record.UserID)
+		}
+	}
+
+	return nil
+}
+
+// GetUserUrls возвращает неудалённые URL пользователя в порядке их первого сохранения.
+func (fs *FileStorage) GetUserUrls(ctx context.Context, uniqueID string) ([]UserUrlsResponseBodyItem, error) {
+	if err := fs.rlock(); err != nil {
+		return nil, err
+	}
+
+	defer fs.mu.RUnlock()
+
+	var rows []DataStorageRow
+
+	for _, shortURL := range fs.userLinks[uniqueID] {
+		if row, ok := fs.userRow(uniqueID, shortURL); ok {
+			rows = append(rows, row)
+		}
+	}
+
+	sort.Slice(rows, func(i, j int) bool {
+		return fs.positions[rows[i].ShortURL] < fs.positions[rows[j].ShortURL]
+	})
+
+	var responseUrls []UserUrlsResponseBodyItem
+
+	for _, row := range rows {
+		item := UserUrlsResponseBodyItem{
+			OriginalURL: row.URL,
+			ShortURL:    row.ShortURL,
+			Domain:      row.Domain,
+			DeviceURLs:  row.DeviceURLs,
+			Splits:      row.Splits,
+			ActiveFrom:  row.ActiveFrom,
+			MaxClicks:   row.MaxClicks,
+			Clicks:      row.Clicks,
+		}
+
+		if health, ok := fs.health[row.ShortURL]; ok {
+			item.Health = &health
+		}
+
+		if metadata, ok := fs.metadata[row.ShortURL]; ok {
+			item.Metadata = &metadata
+		}
+
+		responseUrls = append(responseUrls, item)
+	}
+
+	return responseUrls, nil
+}
+
+// GetUsersCount возвращает количество пользователей в хранилище.
+func (fs *FileStorage) GetUsersCount(ctx context.Context) int {
+	if err := fs.rlock(); err != nil {
+		return 0
+	}
+
+	defer fs.mu.RUnlock()
+
+	return len(fs.users)
+}
+
+// DeleteUserUrls помечает удалёнными указанные короткие URL пользователя, дописывая запись об удалении.
+// Короткие URL других пользователей не изменяются.
+func (fs *FileStorage) DeleteUserUrls(ctx context.Context, uniqueID string, shortURLS []string) error {
+	if err := fs.lock(); err != nil {
+		return err
+	}
+
+	defer fs.unlock()
+
+	var owned []string
+
+	for _, shortURL := range shortURLS {
+		if _, ok := fs.userRow(uniqueID, shortURL); ok {
+			owned = append(owned, shortURL)
+		}
+	}
+
+	if len(owned) == 0 {
+		return nil
+	}
+
+	if err := fs.appendRecords(fileDeleteRecord{Type: fileRecordDelete, UserID: uniqueID, ShortURLs: owned}); err != nil {
+		return err
+	}
+
+	fs.indexDelete(uniqueID, owned)
+
+	return nil
+}
+
+// UpdateUserURLDevices задает адреса перехода для мобильных устройств короткому URL пользователя,
+// дописывая обновлённую запись.
+// Возвращает false, если короткий URL не найден среди неудалённых URL пользователя.
+func (fs *FileStorage) UpdateUserURLDevices(
+	ctx context.Context, uniqueID string, shortURL string, deviceURLs DeviceURLs) (bool, error) {
+	return fs.updateUserRow(uniqueID, shortURL, func(row *DataStorageRow) {
+		row.DeviceURLs = deviceURLs
+	})
+}
+
+// UpdateUserURLActivation задает время активации короткого URL пользователя, дописывая обновлённую запись.
+// Возвращает false, если короткий URL не найден среди неудалённых URL пользователя.
+func (fs *FileStorage) UpdateUserURLActivation(
+	ctx context.Context, uniqueID string, shortURL string, activeFrom *time.Time) (bool, error) {
+	return fs.updateUserRow(uniqueID, shortURL, func(row *DataStorageRow) {
+		row.ActiveFrom = activeFrom
+	})
+}
+
+// IsUserBanned проверяет, заблокирован ли пользователь администратором.
+func (fs *FileStorage) IsUserBanned(ctx context.Context, uniqueID string) bool {
+	if err := fs.rlock(); err != nil {
+		return false
+	}
+
+	defer fs.mu.RUnlock()
+
+	return fs.users[uniqueID]
+}
+
+// SearchUrls возвращает ссылки всех пользователей, подходящие под фильтр.
+func (fs *FileStorage) SearchUrls(ctx context.Context, filter URLSearchFilter) ([]DataStorageRow, error) {
+	dataStorageRows, err := fs.LoadData(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return filterDataStorageRows(dataStorageRows, filter), nil
+}
+
+// DisableURL блокирует короткий URL с указанной причиной, дописывая обновлённую запись.
+// Возвращает false, если короткий URL не найден.
+func (fs *FileStorage) DisableURL(ctx context.Context, shortURL string, reason string) (bool, error) {
+	return fs.updateRow(shortURL, func(row *DataStorageRow) {
+		row.DisabledReason = reason
+	})
+}
+
+// ReassignURL передает короткий URL другому пользователю, дописывая обновлённую запись.
+// Возвращает false, если короткий URL не найден.
+func (fs *FileStorage) ReassignURL(ctx context.Context, shortURL string, userID string) (bool, error) {
+	return fs.updateRow(shortURL, func(row *DataStorageRow) {
+		row.UserID = userID
+	})
+}
+
+// BanUser блокирует пользователя с указанным идентификатором.
+// Если пользователь ещё не сохранён, он создается заблокированным.
+func (fs *FileStorage) BanUser(ctx context.Context, userID string) error {
+	if err := fs.lock(); err != nil {
+		return err
+	}
+
+	defer fs.unlock()
+
+	err := fs.appendRecords(fileBanRecord{Type: fileRecordBan, UserID: userID})
+
+	if err == nil {
+		fs.indexBan(userID)
+	}
+
+	return err
+}
+
+// SaveAuditRecord сохраняет запись журнала действий администратора.
+func (fs *FileStorage) SaveAuditRecord(ctx context.Context, record AuditRecord) error {
+	if err := fs.lock(); err != nil {
+		return err
+	}
+
+	defer fs.unlock()
+
+	record.ID = len(fs.auditRecords) + 1
+	err := fs.appendRecords(fileAuditRecord{Type: fileRecordAudit, Audit: record})
+
+	if err == nil {
+		fs.auditRecords = append(fs.auditRecords, record)
+	}
+
+	return err
+}
+
+// GetAuditRecords возвращает последние записи журнала действий администратора.
+func (fs *FileStorage) GetAuditRecords(ctx context.Context, limit int) ([]AuditRecord, error) {
+	if err := fs.rlock(); err != nil {
+		return nil, err
+	}
+
+	defer fs.mu.RUnlock()
+
+	return lastAuditRecords(fs.auditRecords, limit), nil
+}
+
+// SaveWebhook сохраняет вебхук и возвращает его с присвоенным идентификатором.
+func (fs *FileStorage) SaveWebhook(ctx context.Context, webhook Webhook) (Webhook, error) {
+	if err := fs.lock(); err != nil {
+		return webhook, err
+	}
+
+	defer fs.unlock()
+
+	webhook.ID = fs.lastWebhookID + 1
+
+	if err := fs.appendRecords(fileWebhookRecord{Type: fileRecordWebhook, UserID: webhook.UserID, Webhook: webhook}); err != nil {
+		return webhook, err
+	}
+
+	fs.indexWebhook(webhook.UserID, webhook, false)
+
+	return webhook, nil
+}
+
+// GetWebhooks возвращает вебхуки владельца.
+func (fs *FileStorage) GetWebhooks(ctx context.Context, userID string) ([]Webhook, error) {
+	if err := fs.rlock(); err != nil {
+		return nil, err
+	}
+
+	defer fs.mu.RUnlock()
+
+	return sortedWebhooks(fs.webhooks, func(webhook Webhook) bool {
+		return webhook.UserID == userID
+	}), nil
+}
+
+// DeleteWebhook удаляет вебхук владельца, дописывая запись об удалении.
+func (fs *FileStorage) DeleteWebhook(ctx context.Context, userID string, id int) (bool, error) {
+	if err := fs.lock(); err != nil {
+		return false, err
+	}
+
+	defer fs.unlock()
+
+	webhook, ok := fs.webhooks[id]
+
+	if !ok || webhook.UserID != userID {
+		return false, nil
+	}
+
+	err := fs.appendRecords(fileWebhookRecord{
+		Type: fileRecordWebhook, UserID: userID, Deleted: true, Webhook: Webhook{ID: id},
+	})
+
+	if err != nil {
+		return false, err
+	}
+
+	fs.indexWebhook(userID, webhook, true)
+
+	return true, nil
+}
+
+// GetEventWebhooks возвращает вебхуки пользователя и вебхуки администратора.
+func (fs *FileStorage) GetEventWebhooks(ctx context.Context, userID string) ([]Webhook, error) {
+	if err := fs.rlock(); err != nil {
+		return nil, err
+	}
+
+	defer fs.mu.RUnlock()
+
+	return sortedWebhooks(fs.webhooks, func(webhook Webhook) bool {
+		return webhook.UserID == userID || webhook.UserID == ""
+	}), nil
+}
+
+// EnqueueDeliveries добавляет доставки событий в очередь.
+func (fs *FileStorage) EnqueueDeliveries(ctx context.Context, deliveries []WebhookDelivery) error {
+	if err := fs.lock(); err != nil {
+		return err
+	}
+
+	defer fs.unlock()
+
+	stored := make([]WebhookDelivery, 0, len(deliveries))
+	records := make([]interface{}, 0, len(deliveries))
+
+	for i, delivery := range deliveries {
+		delivery.ID = len(fs.deliveries) + i + 1
+		delivery.UpdatedAt = delivery.CreatedAt
+		stored = append(stored, delivery)
+		records = append(records, fileDeliveryRecord{Type: fileRecordDelivery, Delivery: delivery})
+	}
+
+	if err := fs.appendRecords(records...); err != nil {
+		return err
+	}
+
+	for _, delivery := range stored {
+		fs.indexDelivery(delivery)
+	}
+
+	return nil
+}
+
+// GetDueDeliveries выбирает ожидающие доставки, время попытки которых наступило,
+// и закрепляет их на время аренды, дописывая обновлённые записи. Блокировка файла
+// не позволяет другим процессам выбрать те же доставки.
+func (fs *FileStorage) GetDueDeliveries(ctx context.Context, now time.Time, limit int) ([]WebhookDelivery, error) {
+	if err := fs.lock(); err != nil {
+		return nil, err
+	}
+
+	defer fs.unlock()
+
+	deliveries := dueDeliveries(fs.deliveries, fs.webhooks, now, limit)
+	claimDeliveries(deliveries, now)
+	records := make([]interface{}, 0, len(deliveries))
+
+	for _, delivery := range deliveries {
+		delivery.WebhookURL = ""
+		delivery.WebhookSecret = ""
+		records = append(records, fileDeliveryRecord{Type: fileRecordDelivery, Delivery: delivery})
+	}
+
+	if err := fs.appendRecords(records...); err != nil {
+		return nil, err
+	}
+
+	for _, record := range records {
+		fs.indexDelivery(record.(fileDeliveryRecord).Delivery)
+	}
+
+	return deliveries, nil
+}
+
+// UpdateDelivery сохраняет результат попытки доставки, дописывая обновлённую запись.
+func (fs *FileStorage) UpdateDelivery(ctx context.Context, delivery WebhookDelivery) error {
+	if err := fs.lock(); err != nil {
+		return err
+	}
+
+	defer fs.unlock()
+
+	delivery.WebhookURL = ""
+	delivery.WebhookSecret = ""
+
+	if err := fs.appendRecords(fileDeliveryRecord{Type: fileRecordDelivery, Delivery: delivery}); err != nil {
+		return err
+	}
+
+	fs.indexDelivery(delivery)
+
 	return nil
 }
+
+// GetDeliveries возвращает последние доставки вебхука владельца.
+func (fs *FileStorage) GetDeliveries(
+	ctx context.Context, userID string, webhookID int, limit int) ([]WebhookDelivery, error) {
+	if err := fs.rlock(); err != nil {
+		return nil, err
+	}
+
+	defer fs.mu.RUnlock()
+
+	if webhook, ok := fs.webhooks[webhookID]; !ok || webhook.UserID != userID {
+		return nil, nil
+	}
+
+	return webhookDeliveries(fs.deliveries, webhookID, limit), nil
+}
+
+// GetHealthTargets возвращает неудалённые и незаблокированные ссылки для проверки.
+func (fs *FileStorage) GetHealthTargets(ctx context.Context) ([]HealthTarget, error) {
+	if err := fs.rlock(); err != nil {
+		return nil, err
+	}
+
+	defer fs.mu.RUnlock()
+
+	targets := make([]HealthTarget, 0, len(fs.rows))
+
+	for shortURL, row := range fs.rows {
+		if row.DeletedFlag || row.DisabledReason != "" {
+			continue
+		}
+
+		target := HealthTarget{ShortURL: shortURL, URL: row.URL}
+
+		if linkHealth, ok := fs.health[shortURL]; ok {
+			target.Health = &linkHealth
+		}
+
+		targets = append(targets, target)
+	}
+
+	return sortedHealthTargets(targets), nil
+}
+
+// SaveLinkHealth дописывает результат проверки адреса перехода ссылки.
+func (fs *FileStorage) SaveLinkHealth(ctx context.Context, shortURL string, health LinkHealth) error {
+	if err := fs.lock(); err != nil {
+		return err
+	}
+
+	defer fs.unlock()
+
+	err := fs.appendRecords(fileHealthRecord{Type: fileRecordHealth, ShortURL: shortURL, Health: health})
+
+	if err == nil {
+		fs.indexHealth(shortURL, health)
+	}
+
+	return err
+}
@@ -1,12 +1,119 @@
 package storage
 
 import (
-	"errors"
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
 )
 
-// InMemoryStorage Пример реализации хранения в памяти
+// Ошибки нарушения уникальности, совпадающие по смыслу с ограничениями таблицы urls.
+var (
+	errDuplicateShortURL = fmt.Errorf("%w: short url already exists", ErrConflict)
+	errDuplicateURL      = fmt.Errorf("%w: url already exists", ErrConflict)
+	errDuplicateUser     = fmt.Errorf("%w: user already exists", ErrConflict)
+)
+
+// InMemoryStorage хранит ссылки и пользователей в оперативной памяти
+// и повторяет поведение хранилища в базе данных: уникальность URL и коротких URL,
+// владельцев ссылок и мягкое удаление. Все методы безопасны для одновременного вызова.
 type InMemoryStorage struct {
-	Urls map[string]string
+	// mu защищает ссылки, пользователей и журнал действий администратора.
+	mu sync.RWMutex
+
+	// rows хранит ссылки по короткому URL.
+	rows map[string]*DataStorageRow
+
+	// shortURLs хранит обратный индекс оригинального URL в короткий URL.
+	shortURLs map[string]string
+
+	// userLinks хранит короткие URL каждого пользователя.
+	userLinks map[string][]string
+
+	// users хранит сохранённых пользователей и признак их блокировки.
+	users map[string]bool
+
+	// health хранит результаты последней проверки адресов перехода ссылок.
+	health map[string]LinkHealth
+
+	// metadata хранит заголовки и Open Graph данные страниц перехода ссылок.
+	metadata map[string]LinkMetadata
+
+	// auditRecords хранит журнал действий администратора.
+	auditRecords []AuditRecord
+
+	// lastID хранит последний присвоенный идентификатор ссылки.
+	lastID int
+
+	// Webhooks хранит вебхуки по их идентификаторам.
+	Webhooks map[int]Webhook
+
+	// WebhookDeliveries хранит очередь и журнал доставок событий вебхуков.
+	// Идентификатор доставки совпадает с её позицией в срезе, увеличенной на единицу.
+	WebhookDeliveries []WebhookDelivery
+
+	// lastWebhookID хранит последний присвоенный идентификатор вебхука.
+	lastWebhookID int
+
+	// webhooksMu защищает вебхуки и доставки, с которыми параллельно работают обработчики и доставка событий.
+	webhooksMu sync.Mutex
+}
+
+// initMaps создает словари при первом изменении хранилища. Вызывается под блокировкой на запись.
+func (ims *InMemoryStorage) initMaps() {
+	if ims.rows != nil {
+		return
+	}
+
+	ims.rows = make(map[string]*DataStorageRow)
+	ims.shortURLs = make(map[string]string)
+	ims.userLinks = make(map[string][]string)
+	ims.users = make(map[string]bool)
+	ims.health = make(map[string]LinkHealth)
+	ims.metadata = make(map[string]LinkMetadata)
+}
+
+// insert добавляет ссылку в хранилище и индексы. Вызывается под блокировкой на запись.
+func (ims *InMemoryStorage) insert(dataStorageRow DataStorageRow) {
+	ims.lastID++
+	dataStorageRow.ID = ims.lastID
+	dataStorageRow.Splits = copySplits(dataStorageRow.Splits)
+
+	ims.rows[dataStorageRow.ShortURL] = &dataStorageRow
+	ims.shortURLs[dataStorageRow.URL] = dataStorageRow.ShortURL
+	ims.userLinks[dataStorageRow.UserID] = append(ims.userLinks[dataStorageRow.UserID], dataStorageRow.ShortURL)
+}
+
+// userRow возвращает неудалённую ссылку пользователя. Вызывается под блокировкой.
+func (ims *InMemoryStorage) userRow(uniqueID string, shortURL string) (*DataStorageRow, bool) {
+	row, ok := ims.rows[shortURL]
+
+	if !ok || row.UserID != uniqueID || row.DeletedFlag {
+		return nil, false
+	}
+
+	return row, true
+}
+
+// copySplits возвращает копию вариантов перехода, чтобы счётчики не изменялись за пределами блокировки.
+func copySplits(splits []SplitDestination) []SplitDestination {
+	if splits == nil {
+		return nil
+	}
+
+	return append([]SplitDestination(nil), splits...)
+}
+
+// removeLink возвращает короткие URL пользователя без указанного короткого URL.
+func removeLink(links []string, shortURL string) []string {
+	for i, link := range links {
+		if link == shortURL {
+			return append(links[:i:i], links[i+1:]...)
+		}
+	}
+
+	return links
 }
 
 // SetConnection заглушка для интерфейса
@@ -22,88 +129,682 @@ func (ims *InMemoryStorage) Init(connectionString string) error {
 func (ims *InMemoryStorage) Close() {}
 
 // SaveBatch сохраняет пакет данных, представленных в виде массива DataStorageRow.
-// Возвращает ошибку, если не удалось сохранить данные.
-func (ims *InMemoryStorage) SaveBatch(dataStorageRows []DataStorageRow) error {
+// Как и в базе данных, ссылки, уже сохранённые с той же парой URL и короткого URL, пропускаются,
+// а при любом другом совпадении URL или короткого URL пакет не сохраняется целиком.
+func (ims *InMemoryStorage) SaveBatch(ctx context.Context, dataStorageRows []DataStorageRow) error {
+	ims.mu.Lock()
+	defer ims.mu.Unlock()
+
+	ims.initMaps()
+	pending := make(map[string]string, len(dataStorageRows))
+	pendingURLs := make(map[string]string, len(dataStorageRows))
+	var rows []DataStorageRow
+
 	for _, row := range dataStorageRows {
-		ims.Urls[row.ShortURL] = row.URL
+		shortURL, ok := ims.shortURLs[row.URL]
+
+		if !ok {
+			shortURL, ok = pendingURLs[row.URL]
+		}
+
+		if ok && shortURL == row.ShortURL {
+			continue
+		}
+
+		if ok {
+			return errDuplicateURL
+		}
+
+		if _, exists := ims.rows[row.ShortURL]; exists {
+			return errDuplicateShortURL
+		}
+
+		if _, exists := pending[row.ShortURL]; exists {
+			return errDuplicateShortURL
+		}
+
+		pending[row.ShortURL] = row.URL
+		pendingURLs[row.URL] = row.ShortURL
+		rows = append(rows, row)
+	}
+
+	for _, row := range rows {
+		ims.insert(row)
+	}
+
+	return nil
+}
+
+// ImportBatch сохраняет перенесённые ссылки. Хранилище не публикует событий создания ссылок,
+// поэтому перенос совпадает с SaveBatch.
+func (ims *InMemoryStorage) ImportBatch(ctx context.Context, dataStorageRows []DataStorageRow) error {
+	return ims.SaveBatch(ctx, dataStorageRows)
+}
+
+// Save сохраняет новый короткий URL с соответствующим полному URL, идентификатору пользователя и домену.
+// Возвращает ошибку, если URL или короткий URL уже сохранены.
+func (ims *InMemoryStorage) Save(ctx context.Context, dataStorageRow DataStorageRow) error {
+	ims.mu.Lock()
+	defer ims.mu.Unlock()
+
+	ims.initMaps()
+
+	if _, ok := ims.rows[dataStorageRow.ShortURL]; ok {
+		return errDuplicateShortURL
+	}
+
+	if _, ok := ims.shortURLs[dataStorageRow.URL]; ok {
+		return errDuplicateURL
 	}
+
+	ims.insert(dataStorageRow)
+
 	return nil
 }
 
-// Save сохраняет новый короткий URL с соответствующим полному URL и идентификатору пользователя.
-// Возвращает ошибку, если не удалось сохранить данные.
-func (ims *InMemoryStorage) Save(ShorURL string, URL string, userID string) error {
-	ims.Urls[ShorURL] = URL
+// InsertOrGet сохраняет ссылку, если оригинального URL ещё нет в хранилище.
+// Проверка и сохранение выполняются под одной блокировкой, поэтому одновременные вызовы
+// для одного URL создают одну ссылку.
+func (ims *InMemoryStorage) InsertOrGet(
+	ctx context.Context, dataStorageRow DataStorageRow) (DataStorageRow, bool, error) {
+	ims.mu.Lock()
+	defer ims.mu.Unlock()
+
+	ims.initMaps()
+
+	if shortURL, ok := ims.shortURLs[dataStorageRow.URL]; ok {
+		row := ims.rows[shortURL]
+		return DataStorageRow{ShortURL: row.ShortURL, URL: row.URL, UserID: row.UserID, Domain: row.Domain}, false, nil
+	}
+
+	if _, ok := ims.rows[dataStorageRow.ShortURL]; ok {
+		return DataStorageRow{}, false, errDuplicateShortURL
+	}
+
+	ims.insert(dataStorageRow)
+
+	return dataStorageRow, true, nil
+}
+
+// LoadData возвращает все ссылки, в том числе удалённые и заблокированные, в порядке их создания.
+func (ims *InMemoryStorage) LoadData(ctx context.Context) ([]DataStorageRow, error) {
+	ims.mu.RLock()
+	rows := make([]DataStorageRow, 0, len(ims.rows))
+
+	for _, row := range ims.rows {
+		dataStorageRow := *row
+		dataStorageRow.Splits = copySplits(row.Splits)
+		rows = append(rows, dataStorageRow)
+	}
+
+	ims.mu.RUnlock()
+
+	sort.Slice(rows, func(i, j int) bool {
+		return rows[i].ID < rows[j].ID
+	})
+
+	return rows, nil
+}
+
+// GetURL возвращает URL для заданного короткого URL, в том числе удалённого.
+// Если короткого URL нет в хранилище, возвращает ErrNotFound.
+func (ims *InMemoryStorage) GetURL(ctx context.Context, shortURL string) (GetURLRow, error) {
+	ims.mu.RLock()
+	defer ims.mu.RUnlock()
+
+	row, ok := ims.rows[shortURL]
+
+	if !ok {
+		return GetURLRow{}, ErrNotFound
+	}
+
+	return GetURLRow{
+		URL:            row.URL,
+		UserID:         row.UserID,
+		IsDeleted:      row.DeletedFlag,
+		DisabledReason: row.DisabledReason,
+		Domain:         row.Domain,
+		DeviceURLs:     row.DeviceURLs,
+		Splits:         copySplits(row.Splits),
+		StickySplit:    row.StickySplit,
+		ActiveFrom:     row.ActiveFrom,
+		MaxClicks:      row.MaxClicks,
+		Clicks:         row.Clicks,
+	}, nil
+}
+
+// RecordSplitClick учитывает переход на вариант A/B теста короткого URL.
+func (ims *InMemoryStorage) RecordSplitClick(ctx context.Context, shortURL string, variant int) error {
+	ims.mu.Lock()
+	defer ims.mu.Unlock()
+
+	if row, ok := ims.rows[shortURL]; ok && variant >= 0 && variant < len(row.Splits) {
+		row.Splits[variant].Clicks++
+	}
+
 	return nil
 }
 
-// LoadData загружает данные из хранилища и возвращает их в виде массива DataStorageRow.
-// В данной реализации просто возвращает пустой массив.
-func (ims *InMemoryStorage) LoadData() ([]DataStorageRow, error) {
-	return make([]DataStorageRow, 0), nil
+// RedeemClick учитывает переход по короткому URL с ограничением количества переходов.
+// Проверка и изменение счётчика выполняются под блокировкой.
+// Возвращает количество оставшихся переходов и false, если лимит переходов исчерпан.
+func (ims *InMemoryStorage) RedeemClick(ctx context.Context, shortURL string) (int, bool, error) {
+	ims.mu.Lock()
+	defer ims.mu.Unlock()
+
+	row, ok := ims.rows[shortURL]
+
+	if !ok || row.Clicks >= row.MaxClicks {
+		return 0, false, nil
+	}
+
+	row.Clicks++
+
+	return row.MaxClicks - row.Clicks, true, nil
 }
 
-// GetURL возвращает URL для заданного короткого URL.
-// Возвращает структуру GetURLRow и булевое значение, указывающее на существование.
-func (ims *InMemoryStorage) GetURL(shortURL string) (GetURLRow, bool) {
-	var getURLRow GetURLRow
-	var ok bool
-	getURLRow.URL, ok = ims.Urls[shortURL]
+// LoadLinkDetails возвращает данные страниц перехода и результаты проверки ссылок,
+// для которых они сохранены, упорядоченные по короткому URL.
+func (ims *InMemoryStorage) LoadLinkDetails(ctx context.Context) ([]LinkDetails, error) {
+	ims.mu.RLock()
+	defer ims.mu.RUnlock()
 
-	return getURLRow, ok
+	return collectLinkDetails(ims.metadata, ims.health), nil
 }
 
-// GetURLCount возвращает количество сохранённых URL в хранилище.
-func (ims *InMemoryStorage) GetURLCount() int {
-	return len(ims.Urls)
+// SaveLinkDetails сохраняет перенесённые данные страниц перехода и результаты проверки.
+// Данные ссылок, которых нет в хранилище, пропускаются.
+func (ims *InMemoryStorage) SaveLinkDetails(ctx context.Context, details []LinkDetails) error {
+	ims.mu.Lock()
+	defer ims.mu.Unlock()
+
+	for _, item := range details {
+		if _, ok := ims.rows[item.ShortURL]; !ok {
+			continue
+		}
+
+		if item.Metadata != nil {
+			ims.metadata[item.ShortURL] = *item.Metadata
+		}
+
+		if item.Health != nil {
+			ims.health[item.ShortURL] = *item.Health
+		}
+	}
+
+	return nil
 }
 
-// GetShortURL ищет короткий URL для заданного оригинального URL.
-// Возвращает короткий URL, если он найден, и ошибку, если нет.
-func (ims *InMemoryStorage) GetShortURL(URL string) (string, error) {
-	err := errors.New("short url not found")
+// collectLinkDetails объединяет данные страниц перехода и результаты проверки по короткому URL
+// и упорядочивает их по короткому URL.
+func collectLinkDetails(metadata map[string]LinkMetadata, health map[string]LinkHealth) []LinkDetails {
+	byShortURL := make(map[string]*LinkDetails)
 
-	for k, v := range ims.Urls {
-		if v == URL {
-			return k, nil
+	item := func(shortURL string) *LinkDetails {
+		if _, ok := byShortURL[shortURL]; !ok {
+			byShortURL[shortURL] = &LinkDetails{ShortURL: shortURL}
 		}
+
+		return byShortURL[shortURL]
 	}
 
-	return "", err
+	for shortURL, linkMetadata := range metadata {
+		linkMetadata := linkMetadata
+		item(shortURL).Metadata = &linkMetadata
+	}
+
+	for shortURL, linkHealth := range health {
+		linkHealth := linkHealth
+		item(shortURL).Health = &linkHealth
+	}
+
+	details := make([]LinkDetails, 0, len(byShortURL))
+
+	for _, linkDetails := range byShortURL {
+		details = append(details, *linkDetails)
+	}
+
+	sort.Slice(details, func(i, j int) bool {
+		return details[i].ShortURL < details[j].ShortURL
+	})
+
+	return details
 }
 
-// Set добавляет данные в хранилище
-func (ims *InMemoryStorage) Set(shortURL, longURL string) error {
-	ims.Urls[shortURL] = longURL
+// SaveLinkMetadata сохраняет заголовок и Open Graph данные страницы перехода короткого URL.
+func (ims *InMemoryStorage) SaveLinkMetadata(ctx context.Context, shortURL string, metadata LinkMetadata) error {
+	ims.mu.Lock()
+	defer ims.mu.Unlock()
+
+	if _, ok := ims.rows[shortURL]; ok {
+		ims.metadata[shortURL] = metadata
+	}
+
 	return nil
 }
 
+// GetURLCount возвращает количество сохранённых URL в хранилище, включая удалённые.
+func (ims *InMemoryStorage) GetURLCount(ctx context.Context) int {
+	ims.mu.RLock()
+	defer ims.mu.RUnlock()
+
+	return len(ims.rows)
+}
+
+// GetShortURL ищет короткий URL для заданного оригинального URL по обратному индексу.
+// Возвращает короткий URL, если он найден, и ErrNotFound, если нет.
+func (ims *InMemoryStorage) GetShortURL(ctx context.Context, URL string) (string, error) {
+	ims.mu.RLock()
+	defer ims.mu.RUnlock()
+
+	shortURL, ok := ims.shortURLs[URL]
+
+	if !ok {
+		return "", ErrNotFound
+	}
+
+	return shortURL, nil
+}
+
+// Set добавляет в хранилище ссылку без владельца.
+func (ims *InMemoryStorage) Set(shortURL, longURL string) error {
+	return ims.Save(context.Background(), DataStorageRow{ShortURL: shortURL, URL: longURL})
+}
+
 // Ping проверяет состояние работы хранилища.
 // Возвращает true, так как хранилище работает в оперативной памяти.
-func (ims *InMemoryStorage) Ping() bool {
+func (ims *InMemoryStorage) Ping(ctx context.Context) bool {
 	return true
 }
 
 // IsUserExist проверяет, существует ли пользователь по уникальному идентификатору.
-// В данной реализации всегда возвращает false.
-func (ims *InMemoryStorage) IsUserExist(data string) bool {
-	return false
+func (ims *InMemoryStorage) IsUserExist(ctx context.Context, data string) bool {
+	ims.mu.RLock()
+	defer ims.mu.RUnlock()
+
+	_, ok := ims.users[data]
+
+	return ok
 }
 
 // SaveUser сохраняет нового пользователя с указанным уникальным идентификатором.
-// В данной реализации ничего не делает и всегда возвращает nil.
-func (ims *InMemoryStorage) SaveUser(uniqueID string) error {
+// Возвращает ошибку, если пользователь уже сохранён.
+func (ims *InMemoryStorage) SaveUser(ctx context.Context, uniqueID string) error {
+	ims.mu.Lock()
+	defer ims.mu.Unlock()
+
+	ims.initMaps()
+
+	if _, ok := ims.users[uniqueID]; ok {
+		return errDuplicateUser
+	}
+
+	ims.users[uniqueID] = false
+
+	return nil
+}
+
+// GetUserUrls возвращает неудалённые URL пользователя в порядке их создания.
+func (ims *InMemoryStorage) GetUserUrls(ctx context.Context, uniqueID string) ([]UserUrlsResponseBodyItem, error) {
+	ims.mu.RLock()
+	defer ims.mu.RUnlock()
+
+	var rows []*DataStorageRow
+
+	for _, shortURL := range ims.userLinks[uniqueID] {
+		if row, ok := ims.userRow(uniqueID, shortURL); ok {
+			rows = append(rows, row)
+		}
+	}
+
+	sort.Slice(rows, func(i, j int) bool {
+		return rows[i].ID < rows[j].ID
+	})
+
+	var responseUrls []UserUrlsResponseBodyItem
+
+	for _, row := range rows {
+		item := UserUrlsResponseBodyItem{
+			OriginalURL: row.URL,
+			ShortURL:    row.ShortURL,
+			Domain:      row.Domain,
+			DeviceURLs:  row.DeviceURLs,
+			Splits:      copySplits(row.Splits),
+			ActiveFrom:  row.ActiveFrom,
+			MaxClicks:   row.MaxClicks,
+			Clicks:      row.Clicks,
+		}
+
+		if health, ok := ims.health[row.ShortURL]; ok {
+			item.Health = &health
+		}
+
+		if metadata, ok := ims.metadata[row.ShortURL]; ok {
+			item.Metadata = &metadata
+		}
+
+		responseUrls = append(responseUrls, item)
+	}
+
+	return responseUrls, nil
+}
+
+// LoadUsers возвращает всех пользователей, упорядоченных по идентификатору.
+func (ims *InMemoryStorage) LoadUsers(ctx context.Context) ([]User, error) {
+	ims.mu.RLock()
+	defer ims.mu.RUnlock()
+
+	return sortedUsers(ims.users), nil
+}
+
+// SaveUsers сохраняет пользователей. Уже сохранённые пользователи блокируются,
+// если заблокированы в переданных данных.
+func (ims *InMemoryStorage) SaveUsers(ctx context.Context, users []User) error {
+	ims.mu.Lock()
+	defer ims.mu.Unlock()
+
+	ims.initMaps()
+
+	for _, user := range users {
+		ims.users[user.UserID] = ims.users[user.UserID] || user.Banned
+	}
+
+	return nil
+}
+
+// sortedUsers возвращает пользователей с признаком блокировки, упорядоченных по идентификатору.
+func sortedUsers(users map[string]bool) []User {
+	result := make([]User, 0, len(users))
+
+	for userID, banned := range users {
+		result = append(result, User{UserID: userID, Banned: banned})
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].UserID < result[j].UserID
+	})
+
+	return result
+}
+
+// GetUsersCount возвращает количество пользователей в хранилище.
+func (ims *InMemoryStorage) GetUsersCount(ctx context.Context) int {
+	ims.mu.RLock()
+	defer ims.mu.RUnlock()
+
+	return len(ims.users)
+}
+
+// DeleteUserUrls помечает удалёнными указанные короткие URL пользователя.
+// Короткие URL других пользователей не изменяются.
+func (ims *InMemoryStorage) DeleteUserUrls(ctx context.Context, uniqueID string, shortURLS []string) error {
+	ims.mu.Lock()
+	defer ims.mu.Unlock()
+
+	for _, shortURL := range shortURLS {
+		if row, ok := ims.userRow(uniqueID, shortURL); ok {
+			row.DeletedFlag = true
+		}
+	}
+
+	return nil
+}
+
+// UpdateUserURLDevices задает адреса перехода для мобильных устройств короткому URL пользователя.
+// Возвращает false, если короткий URL не найден среди неудалённых URL пользователя.
+func (ims *InMemoryStorage) UpdateUserURLDevices(
+	ctx context.Context, uniqueID string, shortURL string, deviceURLs DeviceURLs) (bool, error) {
+	ims.mu.Lock()
+	defer ims.mu.Unlock()
+
+	row, ok := ims.userRow(uniqueID, shortURL)
+
+	if ok {
+		row.DeviceURLs = deviceURLs
+	}
+
+	return ok, nil
+}
+
+// UpdateUserURLActivation задает время активации короткого URL пользователя.
+// Возвращает false, если короткий URL не найден среди неудалённых URL пользователя.
+func (ims *InMemoryStorage) UpdateUserURLActivation(
+	ctx context.Context, uniqueID string, shortURL string, activeFrom *time.Time) (bool, error) {
+	ims.mu.Lock()
+	defer ims.mu.Unlock()
+
+	row, ok := ims.userRow(uniqueID, shortURL)
+
+	if ok {
+		row.ActiveFrom = activeFrom
+	}
+
+	return ok, nil
+}
+
+// IsUserBanned проверяет, заблокирован ли пользователь администратором.
+func (ims *InMemoryStorage) IsUserBanned(ctx context.Context, uniqueID string) bool {
+	ims.mu.RLock()
+	defer ims.mu.RUnlock()
+
+	return ims.users[uniqueID]
+}
+
+// SearchUrls возвращает ссылки всех пользователей, подходящие под фильтр.
+// Ссылки упорядочены по порядку сохранения.
+func (ims *InMemoryStorage) SearchUrls(ctx context.Context, filter URLSearchFilter) ([]DataStorageRow, error) {
+	rows, err := ims.LoadData(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return filterDataStorageRows(rows, filter), nil
+}
+
+// DisableURL блокирует короткий URL с указанной причиной.
+// Возвращает false, если короткий URL не найден.
+func (ims *InMemoryStorage) DisableURL(ctx context.Context, shortURL string, reason string) (bool, error) {
+	ims.mu.Lock()
+	defer ims.mu.Unlock()
+
+	row, ok := ims.rows[shortURL]
+
+	if ok {
+		row.DisabledReason = reason
+	}
+
+	return ok, nil
+}
+
+// ReassignURL передает короткий URL другому пользователю.
+// Возвращает false, если короткий URL не найден.
+func (ims *InMemoryStorage) ReassignURL(ctx context.Context, shortURL string, userID string) (bool, error) {
+	ims.mu.Lock()
+	defer ims.mu.Unlock()
+
+	row, ok := ims.rows[shortURL]
+
+	if !ok || row.UserID == userID {
+		return ok, nil
+	}
+
+	ims.userLinks[row.UserID] = removeLink(ims.userLinks[row.UserID], shortURL)
+	row.UserID = userID
+	ims.userLinks[userID] = append(ims.userLinks[userID], shortURL)
+
+	return true, nil
+}
+
+// BanUser блокирует пользователя. Если пользователь ещё не сохранён, он создается заблокированным.
+func (ims *InMemoryStorage) BanUser(ctx context.Context, userID string) error {
+	ims.mu.Lock()
+	defer ims.mu.Unlock()
+
+	ims.initMaps()
+	ims.users[userID] = true
+
+	return nil
+}
+
+// SaveAuditRecord сохраняет запись журнала действий администратора.
+func (ims *InMemoryStorage) SaveAuditRecord(ctx context.Context, record AuditRecord) error {
+	ims.mu.Lock()
+	defer ims.mu.Unlock()
+
+	record.ID = len(ims.auditRecords) + 1
+	ims.auditRecords = append(ims.auditRecords, record)
+
 	return nil
 }
 
-// GetUserUrls возвращает список URL, сохранённых для указанного пользователя.
-// В данной реализации всегда возвращает nil.
-func (ims *InMemoryStorage) GetUserUrls(uniqueID string) ([]UserUrlsResponseBodyItem, error) {
-	return nil, nil
+// GetAuditRecords возвращает последние записи журнала действий администратора.
+func (ims *InMemoryStorage) GetAuditRecords(ctx context.Context, limit int) ([]AuditRecord, error) {
+	ims.mu.RLock()
+	defer ims.mu.RUnlock()
+
+	return lastAuditRecords(ims.auditRecords, limit), nil
 }
 
-// DeleteUserUrls удаляет указанные короткие URL для данного пользователя.
-// В данной реализации ничего не делает и всегда возвращает nil.
-func (ims *InMemoryStorage) DeleteUserUrls(uniqueID string, shortURLS []string) error {
+// SaveWebhook сохраняет вебхук и возвращает его с присвоенным идентификатором.
+func (ims *InMemoryStorage) SaveWebhook(ctx context.Context, webhook Webhook) (Webhook, error) {
+	ims.webhooksMu.Lock()
+	defer ims.webhooksMu.Unlock()
+
+	if ims.Webhooks == nil {
+		ims.Webhooks = make(map[int]Webhook)
+	}
+
+	ims.lastWebhookID++
+	webhook.ID = ims.lastWebhookID
+	ims.Webhooks[webhook.ID] = webhook
+
+	return webhook, nil
+}
+
+// GetWebhooks возвращает вебхуки владельца.
+func (ims *InMemoryStorage) GetWebhooks(ctx context.Context, userID string) ([]Webhook, error) {
+	ims.webhooksMu.Lock()
+	defer ims.webhooksMu.Unlock()
+
+	return sortedWebhooks(ims.Webhooks, func(webhook Webhook) bool {
+		return webhook.UserID == userID
+	}), nil
+}
+
+// DeleteWebhook удаляет вебхук владельца.
+func (ims *InMemoryStorage) DeleteWebhook(ctx context.Context, userID string, id int) (bool, error) {
+	ims.webhooksMu.Lock()
+	defer ims.webhooksMu.Unlock()
+
+	if webhook, ok := ims.Webhooks[id]; !ok || webhook.UserID != userID {
+		return false, nil
+	}
+
+	delete(ims.Webhooks, id)
+
+	return true, nil
+}
+
+// GetEventWebhooks возвращает вебхуки пользователя и вебхуки администратора.
+func (ims *InMemoryStorage) GetEventWebhooks(ctx context.Context, userID string) ([]Webhook, error) {
+	ims.webhooksMu.Lock()
+	defer ims.webhooksMu.Unlock()
+
+	return sortedWebhooks(ims.Webhooks, func(webhook Webhook) bool {
+		return webhook.UserID == userID || webhook.UserID == ""
+	}), nil
+}
+
+// EnqueueDeliveries добавляет доставки событий в очередь.
+func (ims *InMemoryStorage) EnqueueDeliveries(ctx context.Context, deliveries []WebhookDelivery) error {
+	ims.webhooksMu.Lock()
+	defer ims.webhooksMu.Unlock()
+
+	for _, delivery := range deliveries {
+		delivery.ID = len(ims.WebhookDeliveries) + 1
+		delivery.UpdatedAt = delivery.CreatedAt
+		ims.WebhookDeliveries = append(ims.WebhookDeliveries, delivery)
+	}
+
+	return nil
+}
+
+// GetDueDeliveries выбирает ожидающие доставки, время попытки которых наступило,
+// и закрепляет их на время аренды.
+func (ims *InMemoryStorage) GetDueDeliveries(ctx context.Context, now time.Time, limit int) ([]WebhookDelivery, error) {
+	ims.webhooksMu.Lock()
+	defer ims.webhooksMu.Unlock()
+
+	deliveries := dueDeliveries(ims.WebhookDeliveries, ims.Webhooks, now, limit)
+	claimDeliveries(deliveries, now)
+
+	for _, delivery := range deliveries {
+		ims.WebhookDeliveries[delivery.ID-1].NextAttemptAt = delivery.NextAttemptAt
+	}
+
+	return deliveries, nil
+}
+
+// UpdateDelivery сохраняет результат попытки доставки.
+func (ims *InMemoryStorage) UpdateDelivery(ctx context.Context, delivery WebhookDelivery) error {
+	ims.webhooksMu.Lock()
+	defer ims.webhooksMu.Unlock()
+
+	if delivery.ID > 0 && delivery.ID <= len(ims.WebhookDeliveries) {
+		delivery.WebhookURL = ""
+		delivery.WebhookSecret = ""
+		ims.WebhookDeliveries[delivery.ID-1] = delivery
+	}
+
+	return nil
+}
+
+// GetDeliveries возвращает последние доставки вебхука владельца.
+func (ims *InMemoryStorage) GetDeliveries(
+	ctx context.Context, userID string, webhookID int, limit int) ([]WebhookDelivery, error) {
+	ims.webhooksMu.Lock()
+	defer ims.webhooksMu.Unlock()
+
+	if webhook, ok := ims.Webhooks[webhookID]; !ok || webhook.UserID != userID {
+		return nil, nil
+	}
+
+	return webhookDeliveries(ims.WebhookDeliveries, webhookID, limit), nil
+}
+
+// GetHealthTargets возвращает неудалённые и незаблокированные ссылки для проверки.
+func (ims *InMemoryStorage) GetHealthTargets(ctx context.Context) ([]HealthTarget, error) {
+	ims.mu.RLock()
+	defer ims.mu.RUnlock()
+
+	targets := make([]HealthTarget, 0, len(ims.rows))
+
+	for shortURL, row := range ims.rows {
+		if row.DeletedFlag || row.DisabledReason != "" {
+			continue
+		}
+
+		target := HealthTarget{ShortURL: shortURL, URL: row.URL}
+
+		if health, ok := ims.health[shortURL]; ok {
+			target.Health = &health
+		}
+
+		targets = append(targets, target)
+	}
+
+	return sortedHealthTargets(targets), nil
+}
+
+// SaveLinkHealth сохраняет результат проверки адреса перехода ссылки.
+func (ims *InMemoryStorage) SaveLinkHealth(ctx context.Context, shortURL string, health LinkHealth) error {
+	ims.mu.Lock()
+	defer ims.mu.Unlock()
+
+	if _, ok := ims.rows[shortURL]; ok {
+		ims.health[shortURL] = health
+	}
+
 	return nil
 }
@@ -0,0 +1,221 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// AdminStorageInterface определяет методы хранилища, необходимые для модерации ссылок и пользователей.
+type AdminStorageInterface interface {
+	// SearchUrls возвращает ссылки всех пользователей, подходящие под фильтр.
+	SearchUrls(ctx context.Context, filter URLSearchFilter) ([]DataStorageRow, error)
+
+	// DisableURL блокирует короткий URL с указанной причиной.
+	// Возвращает false, если короткий URL не найден.
+	DisableURL(ctx context.Context, shortURL string, reason string) (bool, error)
+
+	// ReassignURL передает короткий URL другому пользователю.
+	// Возвращает false, если короткий URL не найден.
+	ReassignURL(ctx context.Context, shortURL string, userID string) (bool, error)
+
+	// BanUser блокирует пользователя с указанным идентификатором.
+	BanUser(ctx context.Context, userID string) error
+
+	// SaveAuditRecord сохраняет запись журнала действий администратора.
+	SaveAuditRecord(ctx context.Context, record AuditRecord) error
+
+	// GetAuditRecords возвращает последние записи журнала действий администратора.
+	GetAuditRecords(ctx context.Context, limit int) ([]AuditRecord, error)
+}
+
+// URLSearchFilter задает условия поиска ссылок администратором.
+type URLSearchFilter struct {
+	Query  string // Подстрока оригинального URL или точное значение короткого URL.
+	UserID string // Идентификатор владельца ссылки.
+	Limit  int    // Максимальное количество записей в ответе.
+	Offset int    // Количество пропускаемых записей.
+}
+
+// AuditRecord представляет запись журнала действий администратора.
+type AuditRecord struct {
+	ID        int       `json:"id"`         // Идентификатор записи
+	Action    string    `json:"action"`     // Выполненное действие
+	Target    string    `json:"target"`     // Объект действия: короткий URL или идентификатор пользователя
+	Details   string    `json:"details"`    // Дополнительные сведения о действии
+	Actor     string    `json:"actor"`      // Адрес, с которого выполнено действие
+	CreatedAt time.Time `json:"created_at"` // Время выполнения действия
+}
+
+// AdminStorage предоставляет реализацию хранилища модерации в базе данных.
+type AdminStorage struct {
+	// conn представляет соединение с базой данных, предоставляющее доступ к методам SQL.
+	conn DBConnectionInterface
+}
+
+// SetConnection устанавливает объект подключения к бд
+func (as *AdminStorage) SetConnection(conn DBConnectionInterface) {
+	as.conn = conn
+}
+
+// Init инициализирует соединение с базой данных по заданной строке подключения.
+func (as *AdminStorage) Init(connectionString string) error {
+	pool, err := NewPool(context.Background(), connectionString, PoolConfig{})
+
+	if err != nil {
+		return err
+	}
+
+	as.SetConnection(pool)
+
+	return nil
+}
+
+// Close закрывает соединение с базой данных.
+func (as *AdminStorage) Close() {
+	as.conn.Close()
+}
+
+// SearchUrls возвращает ссылки всех пользователей, подходящие под фильтр.
+func (as *AdminStorage) SearchUrls(ctx context.Context, filter URLSearchFilter) ([]DataStorageRow, error) {
+	query := fmt.Sprintf(`SELECT id, short_url, url, COALESCE(user_id, ''), is_deleted, disabled_reason, domain FROM %s
+	WHERE ($1 = '' OR url ILIKE '%%' || $1 || '%%' OR short_url = $1) AND ($2 = '' OR user_id = $2)
+	ORDER BY id LIMIT $3 OFFSET $4`, tableName)
+	rows, err := as.conn.Query(ctx, query, filter.Query, filter.UserID, filter.Limit, filter.Offset)
+
+	if err != nil {
+		return nil, wrapError(err)
+	}
+
+	defer rows.Close()
+
+	var dataStorageRows []DataStorageRow
+
+	for rows.Next() {
+		var row DataStorageRow
+
+		if err := rows.Scan(
+			&row.ID, &row.ShortURL, &row.URL, &row.UserID, &row.DeletedFlag, &row.DisabledReason, &row.Domain,
+		); err != nil {
+			return nil, wrapError(err)
+		}
+
+		dataStorageRows = append(dataStorageRows, row)
+	}
+
+	return dataStorageRows, nil
+}
+
+// DisableURL блокирует короткий URL с указанной причиной.
+func (as *AdminStorage) DisableURL(ctx context.Context, shortURL string, reason string) (bool, error) {
+	query := fmt.Sprintf("UPDATE %s SET disabled_reason = $2 WHERE short_url = $1", tableName)
+	tag, err := as.conn.Exec(ctx, query, shortURL, reason)
+
+	if err != nil {
+		return false, wrapError(err)
+	}
+
+	return tag.RowsAffected() > 0, nil
+}
+
+// ReassignURL передает короткий URL другому пользователю.
+func (as *AdminStorage) ReassignURL(ctx context.Context, shortURL string, userID string) (bool, error) {
+	query := fmt.Sprintf("UPDATE %s SET user_id = $2 WHERE short_url = $1", tableName)
+	tag, err := as.conn.Exec(ctx, query, shortURL, userID)
+
+	if err != nil {
+		return false, wrapError(err)
+	}
+
+	return tag.RowsAffected() > 0, nil
+}
+
+// BanUser блокирует пользователя. Если пользователь ещё не сохранён, он создается заблокированным.
+func (as *AdminStorage) BanUser(ctx context.Context, userID string) error {
+	query := `INSERT INTO users_cookie (user_id, is_banned) VALUES ($1, true)
+	ON CONFLICT (user_id) DO UPDATE SET is_banned = true`
+	_, err := as.conn.Exec(ctx, query, userID)
+	return wrapError(err)
+}
+
+// SaveAuditRecord сохраняет запись журнала действий администратора.
+func (as *AdminStorage) SaveAuditRecord(ctx context.Context, record AuditRecord) error {
+	query := "INSERT INTO admin_audit (action, target, details, actor, created_at) VALUES ($1, $2, $3, $4, $5)"
+	_, err := as.conn.Exec(ctx, query, record.Action, record.Target, record.Details, record.Actor, record.CreatedAt)
+	return wrapError(err)
+}
+
+// GetAuditRecords возвращает последние записи журнала действий администратора.
+func (as *AdminStorage) GetAuditRecords(ctx context.Context, limit int) ([]AuditRecord, error) {
+	query := "SELECT id, action, target, details, actor, created_at FROM admin_audit ORDER BY id DESC LIMIT $1"
+	rows, err := as.conn.Query(ctx, query, limit)
+
+	if err != nil {
+		return nil, wrapError(err)
+	}
+
+	defer rows.Close()
+
+	var records []AuditRecord
+
+	for rows.Next() {
+		var record AuditRecord
+
+		if err := rows.Scan(
+			&record.ID, &record.Action, &record.Target, &record.Details, &record.Actor, &record.CreatedAt,
+		); err != nil {
+			return nil, wrapError(err)
+		}
+
+		records = append(records, record)
+	}
+
+	return records, nil
+}
+
+// filterDataStorageRows применяет фильтр поиска к строкам хранилища.
+// Используется хранилищами, которые не поддерживают поиск средствами базы данных.
+func filterDataStorageRows(rows []DataStorageRow, filter URLSearchFilter) []DataStorageRow {
+	var result []DataStorageRow
+
+	for _, row := range rows {
+		if filter.UserID != "" && row.UserID != filter.UserID {
+			continue
+		}
+
+		if filter.Query != "" && row.ShortURL != filter.Query &&
+			!strings.Contains(strings.ToLower(row.URL), strings.ToLower(filter.Query)) {
+			continue
+		}
+
+		result = append(result, row)
+	}
+
+	if filter.Offset >= len(result) {
+		return nil
+	}
+
+	result = result[filter.Offset:]
+
+	if filter.Limit > 0 && filter.Limit < len(result) {
+		result = result[:filter.Limit]
+	}
+
+	return result
+}
+
+// lastAuditRecords возвращает последние записи журнала в порядке от новых к старым.
+func lastAuditRecords(records []AuditRecord, limit int) []AuditRecord {
+	var result []AuditRecord
+
+	for i := len(records) - 1; i >= 0; i-- {
+		if limit > 0 && len(result) >= limit {
+			break
+		}
+
+		result = append(result, records[i])
+	}
+
+	return result
+}
@@ -0,0 +1,151 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pashagolub/pgxmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAdminStorage_DisableURL(t *testing.T) {
+	ctx := context.Background()
+	mock, err := pgxmock.NewPool()
+	assert.NoError(t, err)
+	defer mock.Close()
+
+	storage := &AdminStorage{conn: mock}
+
+	mock.ExpectExec(`UPDATE urls SET disabled_reason = \$2 WHERE short_url = \$1`).
+		WithArgs("abc", "phishing").
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+
+	found, err := storage.DisableURL(ctx, "abc", "phishing")
+	assert.NoError(t, err)
+	assert.True(t, found)
+
+	mock.ExpectExec(`UPDATE urls SET disabled_reason = \$2 WHERE short_url = \$1`).
+		WithArgs("missing", "phishing").
+		WillReturnResult(pgxmock.NewResult("UPDATE", 0))
+
+	found, err = storage.DisableURL(ctx, "missing", "phishing")
+	assert.NoError(t, err)
+	assert.False(t, found)
+	assert.NoError(t, mock.ExpectationsWereMet(), "There should be no unfulfilled expectations")
+}
+
+func TestAdminStorage_SearchUrls(t *testing.T) {
+	ctx := context.Background()
+	mock, err := pgxmock.NewPool()
+	assert.NoError(t, err)
+	defer mock.Close()
+
+	storage := &AdminStorage{conn: mock}
+	filter := URLSearchFilter{Query: "example", Limit: 10}
+
+	mock.ExpectQuery(`SELECT id, short_url, url, COALESCE\(user_id, ''\), is_deleted, disabled_reason, domain FROM urls`).
+		WithArgs("example", "", 10, 0).
+		WillReturnRows(pgxmock.NewRows([]string{"id", "short_url", "url", "user_id", "is_deleted", "disabled_reason", "domain"}).
+			AddRow(1, "abc", "http://example.com", "user1", false, "", ""))
+
+	rows, err := storage.SearchUrls(ctx, filter)
+	assert.NoError(t, err)
+	assert.Equal(t, []DataStorageRow{{ID: 1, ShortURL: "abc", URL: "http://example.com", UserID: "user1"}}, rows)
+	assert.NoError(t, mock.ExpectationsWereMet(), "There should be no unfulfilled expectations")
+}
+
+func TestAdminStorage_BanUser(t *testing.T) {
+	ctx := context.Background()
+	mock, err := pgxmock.NewPool()
+	assert.NoError(t, err)
+	defer mock.Close()
+
+	storage := &AdminStorage{conn: mock}
+
+	mock.ExpectExec(`INSERT INTO users_cookie \(user_id, is_banned\) VALUES \(\$1, true\)`).
+		WithArgs("user1").
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+
+	assert.NoError(t, storage.BanUser(ctx, "user1"))
+	assert.NoError(t, mock.ExpectationsWereMet(), "There should be no unfulfilled expectations")
+}
+
+func TestInMemoryStorage_Admin(t *testing.T) {
+	ctx := context.Background()
+	storage := &InMemoryStorage{}
+	_ = storage.Save(ctx, DataStorageRow{ShortURL: "abc", URL: "http://example.com", UserID: "user1"})
+	_ = storage.Save(ctx, DataStorageRow{ShortURL: "def", URL: "http://example.org", UserID: "user2"})
+
+	rows, err := storage.SearchUrls(ctx, URLSearchFilter{Query: "EXAMPLE.COM"})
+	assert.NoError(t, err)
+	assert.Len(t, rows, 1)
+	assert.Equal(t, "abc", rows[0].ShortURL)
+
+	found, err := storage.DisableURL(ctx, "abc", "spam")
+	assert.NoError(t, err)
+	assert.True(t, found)
+
+	getURLRow, err := storage.GetURL(ctx, "abc")
+	assert.NoError(t, err)
+	assert.Equal(t, "spam", getURLRow.DisabledReason)
+
+	found, _ = storage.ReassignURL(ctx, "def", "user1")
+	assert.True(t, found)
+
+	rows, _ = storage.SearchUrls(ctx, URLSearchFilter{UserID: "user1"})
+	assert.Len(t, rows, 2)
+
+	found, _ = storage.DisableURL(ctx, "missing", "spam")
+	assert.False(t, found)
+
+	assert.NoError(t, storage.BanUser(ctx, "user1"))
+	assert.True(t, storage.IsUserBanned(ctx, "user1"))
+	assert.False(t, storage.IsUserBanned(ctx, "user2"))
+}
+
+func TestFileStorage_Admin(t *testing.T) {
+	ctx := context.Background()
+	clearTestFile()
+	defer clearTestFile()
+
+	fs := &FileStorage{FileStoragePath: testFilePath}
+	_ = fs.Save(ctx, DataStorageRow{ShortURL: "abc", URL: "http://example.com", UserID: "user1"})
+	_ = fs.Save(ctx, DataStorageRow{ShortURL: "def", URL: "http://example.org", UserID: "user2"})
+
+	found, err := fs.DisableURL(ctx, "abc", "spam")
+	assert.NoError(t, err)
+	assert.True(t, found)
+
+	found, err = fs.ReassignURL(ctx, "abc", "user2")
+	assert.NoError(t, err)
+	assert.True(t, found)
+
+	getURLRow, err := fs.GetURL(ctx, "abc")
+	assert.NoError(t, err)
+	assert.Equal(t, "spam", getURLRow.DisabledReason)
+
+	rows, err := fs.SearchUrls(ctx, URLSearchFilter{UserID: "user2"})
+	assert.NoError(t, err)
+	assert.Len(t, rows, 2)
+
+	assert.NoError(t, fs.BanUser(ctx, "user1"))
+	assert.True(t, fs.IsUserBanned(ctx, "user1"))
+
+	for _, action := range []string{"first", "second"} {
+		assert.NoError(t, fs.SaveAuditRecord(ctx, AuditRecord{Action: action, CreatedAt: time.Now()}))
+	}
+
+	records, err := fs.GetAuditRecords(ctx, 1)
+	assert.NoError(t, err)
+	assert.Len(t, records, 1)
+	assert.Equal(t, "second", records[0].Action)
+	assert.Equal(t, 2, records[0].ID)
+
+	// Служебные записи и обновления не учитываются как новые URL
+	assert.Equal(t, 2, fs.GetURLCount(ctx))
+
+	dataRows, err := fs.LoadData(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, dataRows, 2)
+}
@@ -0,0 +1,235 @@
+package storage
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestBoltStorage открывает хранилище bbolt во временном каталоге теста.
+func newTestBoltStorage(t *testing.T) *BoltStorage {
+	bs := &BoltStorage{BoltStoragePath: filepath.Join(t.TempDir(), "shortener.db")}
+	require.NoError(t, bs.Init(""))
+	t.Cleanup(bs.Close)
+
+	return bs
+}
+
+func TestBoltStorage_SaveAndGetURL(t *testing.T) {
+	ctx := context.Background()
+	bs := newTestBoltStorage(t)
+
+	require.NoError(t, bs.Save(ctx, DataStorageRow{ShortURL: "short1", URL: "http://example.com", UserID: "user1"}))
+
+	row, err := bs.GetURL(ctx, "short1")
+	require.NoError(t, err)
+	assert.Equal(t, GetURLRow{URL: "http://example.com", UserID: "user1"}, row)
+
+	shortURL, err := bs.GetShortURL(ctx, "http://example.com")
+	require.NoError(t, err)
+	assert.Equal(t, "short1", shortURL)
+
+	_, err = bs.GetURL(ctx, "missing")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	_, err = bs.GetShortURL(ctx, "http://missing.example.com")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	err = bs.Save(ctx, DataStorageRow{ShortURL: "short2", URL: "http://example.com"})
+	assert.ErrorIs(t, err, ErrConflict)
+
+	err = bs.Save(ctx, DataStorageRow{ShortURL: "short1", URL: "http://other.example.com"})
+	assert.ErrorIs(t, err, ErrConflict)
+
+	assert.Equal(t, 1, bs.GetURLCount(ctx))
+}
+
+func TestBoltStorage_InsertOrGet(t *testing.T) {
+	ctx := context.Background()
+	bs := newTestBoltStorage(t)
+
+	var wg sync.WaitGroup
+	created := make([]bool, 10)
+
+	for i := range created {
+		wg.Add(1)
+
+		go func(i int) {
+			defer wg.Done()
+
+			row, ok, err := bs.InsertOrGet(ctx, DataStorageRow{
+				ShortURL: string(rune('a' + i)), URL: "http://example.com", UserID: "user1",
+			})
+
+			assert.NoError(t, err)
+			assert.Equal(t, "http://example.com", row.URL)
+			created[i] = ok
+		}(i)
+	}
+
+	wg.Wait()
+
+	count := 0
+
+	for _, ok := range created {
+		if ok {
+			count++
+		}
+	}
+
+	assert.Equal(t, 1, count, "Only one link should be created for the same URL")
+	assert.Equal(t, 1, bs.GetURLCount(ctx))
+
+	shortURL, err := bs.GetShortURL(ctx, "http://example.com")
+	require.NoError(t, err)
+
+	_, _, err = bs.InsertOrGet(ctx, DataStorageRow{ShortURL: shortURL, URL: "http://other.example.com"})
+	assert.ErrorIs(t, err, ErrConflict)
+}
+
+func TestBoltStorage_SaveBatch(t *testing.T) {
+	ctx := context.Background()
+	bs := newTestBoltStorage(t)
+
+	rows := []DataStorageRow{
+		{ShortURL: "a", URL: "http://a.example.com", UserID: "user1"},
+		{ShortURL: "b", URL: "http://b.example.com", UserID: "user1"},
+	}
+
+	require.NoError(t, bs.SaveBatch(ctx, rows))
+	require.NoError(t, bs.SaveBatch(ctx, rows), "Identical links should be skipped")
+
+	err := bs.SaveBatch(ctx, []DataStorageRow{
+		{ShortURL: "c", URL: "http://c.example.com"},
+		{ShortURL: "d", URL: "http://a.example.com"},
+	})
+	assert.ErrorIs(t, err, ErrConflict)
+
+	loaded, err := bs.LoadData(ctx)
+	require.NoError(t, err)
+	require.Len(t, loaded, 2, "Conflicting batch should not be saved")
+	assert.Equal(t, "a", loaded[0].ShortURL)
+	assert.Equal(t, "b", loaded[1].ShortURL)
+}
+
+func TestBoltStorage_UserUrls(t *testing.T) {
+	ctx := context.Background()
+	bs := newTestBoltStorage(t)
+
+	require.NoError(t, bs.SaveBatch(ctx, []DataStorageRow{
+		{ShortURL: "a", URL: "http://a.example.com", UserID: "user1"},
+		{ShortURL: "b", URL: "http://b.example.com", UserID: "user1"},
+		{ShortURL: "c", URL: "http://c.example.com", UserID: "user2"},
+	}))
+	require.NoError(t, bs.SaveLinkHealth(ctx, "a", LinkHealth{Status: 200}))
+
+	require.NoError(t, bs.DeleteUserUrls(ctx, "user1", []string{"b", "c"}))
+
+	urls, err := bs.GetUserUrls(ctx, "user1")
+	require.NoError(t, err)
+	require.Len(t, urls, 1)
+	assert.Equal(t, "a", urls[0].ShortURL)
+	require.NotNil(t, urls[0].Health)
+	assert.Equal(t, 200, urls[0].Health.Status)
+
+	row, err := bs.GetURL(ctx, "c")
+	require.NoError(t, err)
+	assert.False(t, row.IsDeleted, "Links of other users should not be deleted")
+
+	activeFrom := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	updated, err := bs.UpdateUserURLActivation(ctx, "user1", "a", &activeFrom)
+	require.NoError(t, err)
+	assert.True(t, updated)
+
+	updated, err = bs.UpdateUserURLActivation(ctx, "user1", "c", &activeFrom)
+	require.NoError(t, err)
+	assert.False(t, updated)
+
+	found, err := bs.ReassignURL(ctx, "c", "user1")
+	require.NoError(t, err)
+	assert.True(t, found)
+
+	urls, err = bs.GetUserUrls(ctx, "user1")
+	require.NoError(t, err)
+	require.Len(t, urls, 2)
+	assert.Equal(t, activeFrom, *urls[0].ActiveFrom)
+	assert.Equal(t, "c", urls[1].ShortURL)
+
+	urls, err = bs.GetUserUrls(ctx, "user2")
+	require.NoError(t, err)
+	assert.Empty(t, urls)
+}
+
+func TestBoltStorage_Users(t *testing.T) {
+	ctx := context.Background()
+	bs := newTestBoltStorage(t)
+
+	require.NoError(t, bs.SaveUser(ctx, "user1"))
+	assert.ErrorIs(t, bs.SaveUser(ctx, "user1"), ErrConflict)
+	assert.True(t, bs.IsUserExist(ctx, "user1"))
+	assert.False(t, bs.IsUserBanned(ctx, "user1"))
+
+	require.NoError(t, bs.BanUser(ctx, "user2"))
+	require.NoError(t, bs.SaveUsers(ctx, []User{{UserID: "user1", Banned: true}, {UserID: "user2"}, {UserID: "user3"}}))
+
+	users, err := bs.LoadUsers(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []User{{UserID: "user1", Banned: true}, {UserID: "user2", Banned: true}, {UserID: "user3"}}, users)
+	assert.Equal(t, 3, bs.GetUsersCount(ctx))
+}
+
+func TestBoltStorage_RedeemClick(t *testing.T) {
+	ctx := context.Background()
+	bs := newTestBoltStorage(t)
+
+	require.NoError(t, bs.Save(ctx, DataStorageRow{ShortURL: "short1", URL: "http://example.com", MaxClicks: 2}))
+
+	remaining, ok, err := bs.RedeemClick(ctx, "short1")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, 1, remaining)
+
+	remaining, ok, err = bs.RedeemClick(ctx, "short1")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, 0, remaining)
+
+	_, ok, err = bs.RedeemClick(ctx, "short1")
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestBoltStorage_Reopen(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "shortener.db")
+
+	bs := &BoltStorage{BoltStoragePath: path}
+	require.NoError(t, bs.Init(""))
+	require.NoError(t, bs.Save(ctx, DataStorageRow{ShortURL: "short1", URL: "http://example.com", UserID: "user1"}))
+	require.NoError(t, bs.SaveUser(ctx, "user1"))
+	bs.Close()
+
+	_, err := bs.GetURL(ctx, "short1")
+	assert.ErrorIs(t, err, ErrUnavailable, "Closed storage should be unavailable")
+
+	reopened := &BoltStorage{BoltStoragePath: path}
+	require.NoError(t, reopened.Init(""))
+	defer reopened.Close()
+
+	row, err := reopened.GetURL(ctx, "short1")
+	require.NoError(t, err)
+	assert.Equal(t, "http://example.com", row.URL)
+	assert.True(t, reopened.IsUserExist(ctx, "user1"))
+
+	require.NoError(t, reopened.Save(ctx, DataStorageRow{ShortURL: "short2", URL: "http://other.example.com"}))
+
+	rows, err := reopened.LoadData(ctx)
+	require.NoError(t, err)
+	require.Len(t, rows, 2)
+	assert.Less(t, rows[0].ID, rows[1].ID, "Link IDs should keep increasing after reopening")
+}
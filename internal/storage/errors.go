@@ -0,0 +1,87 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+)
+
+// Ошибки хранилищ, общие для всех реализаций. Реализации оборачивают в них исходные ошибки,
+// поэтому проверять их следует через errors.Is.
+var (
+	// ErrNotFound означает, что запрошенной записи нет в хранилище.
+	ErrNotFound = errors.New("not found")
+
+	// ErrConflict означает, что запись нарушает ограничение уникальности.
+	ErrConflict = errors.New("conflict")
+
+	// ErrUnavailable означает, что хранилище недоступно: соединение потеряно,
+	// время ожидания истекло или хранилище закрыто.
+	ErrUnavailable = errors.New("storage unavailable")
+)
+
+// Коды ошибок PostgreSQL, сопоставляемые с ошибками хранилища.
+const (
+	pgUniqueViolation         = "23505"
+	pgConnectionExceptionCode = "08"
+	pgTooManyConnections      = "53300"
+	pgQueryCanceled           = "57014"
+	pgAdminShutdown           = "57P01"
+	pgCrashShutdown           = "57P02"
+	pgCannotConnectNow        = "57P03"
+)
+
+// wrapError сопоставляет ошибку базы данных с ошибками хранилища, сохраняя исходную ошибку в цепочке.
+// Отмена контекста вызывающим и ошибки, не связанные с базой данных, возвращаются без изменений.
+func wrapError(err error) error {
+	if err == nil || isStorageError(err) || errors.Is(err, context.Canceled) {
+		return err
+	}
+
+	if errors.Is(err, pgx.ErrNoRows) {
+		return fmt.Errorf("%w: %w", ErrNotFound, err)
+	}
+
+	var pgErr *pgconn.PgError
+
+	if errors.As(err, &pgErr) {
+		switch {
+		case pgErr.Code == pgUniqueViolation:
+			return fmt.Errorf("%w: %w", ErrConflict, err)
+		case strings.HasPrefix(pgErr.Code, pgConnectionExceptionCode), pgErr.Code == pgTooManyConnections,
+			pgErr.Code == pgQueryCanceled, pgErr.Code == pgAdminShutdown, pgErr.Code == pgCrashShutdown,
+			pgErr.Code == pgCannotConnectNow:
+			return fmt.Errorf("%w: %w", ErrUnavailable, err)
+		}
+
+		return err
+	}
+
+	var netErr net.Error
+
+	if errors.Is(err, context.DeadlineExceeded) || pgconn.Timeout(err) || pgconn.SafeToRetry(err) ||
+		errors.As(err, &netErr) {
+		return fmt.Errorf("%w: %w", ErrUnavailable, err)
+	}
+
+	return err
+}
+
+// unavailable оборачивает ошибку доступа к хранилищу в ErrUnavailable.
+func unavailable(err error) error {
+	if err == nil || isStorageError(err) {
+		return err
+	}
+
+	return fmt.Errorf("%w: %w", ErrUnavailable, err)
+}
+
+// isStorageError проверяет, сопоставлена ли ошибка с ошибкой хранилища.
+func isStorageError(err error) bool {
+	return errors.Is(err, ErrNotFound) || errors.Is(err, ErrConflict) || errors.Is(err, ErrUnavailable)
+}
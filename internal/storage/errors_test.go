@@ -0,0 +1,47 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWrapError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{name: "no rows", err: pgx.ErrNoRows, want: ErrNotFound},
+		{name: "unique violation", err: &pgconn.PgError{Code: "23505"}, want: ErrConflict},
+		{name: "connection failure", err: &pgconn.PgError{Code: "08006"}, want: ErrUnavailable},
+		{name: "too many connections", err: &pgconn.PgError{Code: "53300"}, want: ErrUnavailable},
+		{name: "deadline exceeded", err: context.DeadlineExceeded, want: ErrUnavailable},
+		{name: "network error", err: &net.OpError{Op: "dial", Err: errors.New("connection refused")}, want: ErrUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := wrapError(tt.err)
+
+			assert.ErrorIs(t, err, tt.want)
+			assert.ErrorIs(t, err, tt.err, "Original error should be kept")
+			assert.Equal(t, err, wrapError(err), "Wrapping should be idempotent")
+		})
+	}
+}
+
+func TestWrapError_Unchanged(t *testing.T) {
+	syntaxErr := &pgconn.PgError{Code: "42601"}
+	otherErr := errors.New("publish failed")
+
+	assert.Nil(t, wrapError(nil))
+	assert.Same(t, syntaxErr, wrapError(syntaxErr), "Unmapped database errors should be returned as is")
+	assert.Equal(t, otherErr, wrapError(otherErr))
+	assert.Equal(t, context.Canceled, wrapError(context.Canceled), "Cancellation by the caller is not an outage")
+}
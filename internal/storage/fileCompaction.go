@@ -0,0 +1,212 @@
+package storage
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// Пороги автоматического сжатия файла хранилища по умолчанию.
+const (
+	DefaultCompactRatio   = 0.5
+	DefaultCompactMinSize = 1 << 20
+)
+
+// CompactorInterface определяет метод сжатия хранилища, накапливающего устаревшие записи.
+type CompactorInterface interface {
+	// Compact перезаписывает хранилище, оставляя только актуальные записи.
+	Compact(ctx context.Context) (CompactionResult, error)
+}
+
+// CompactionResult описывает результат сжатия файла хранилища.
+type CompactionResult struct {
+	SizeBefore    int64 `json:"size_before"`    // Размер файла до сжатия в байтах
+	SizeAfter     int64 `json:"size_after"`     // Размер файла после сжатия в байтах
+	RecordsBefore int   `json:"records_before"` // Количество записей до сжатия
+	RecordsAfter  int   `json:"records_after"`  // Количество записей после сжатия
+}
+
+// Compact перезаписывает файл хранилища, оставляя только актуальные записи.
+// На время сжатия чтение и запись приостанавливаются.
+func (fs *FileStorage) Compact(ctx context.Context) (CompactionResult, error) {
+	if err := fs.lock(); err != nil {
+		return CompactionResult{}, err
+	}
+
+	defer fs.unlock()
+
+	return fs.compact()
+}
+
+// compact записывает актуальные записи во временный файл, сбрасывает его на диск
+// и атомарно заменяет им файл хранилища. Если работа прервется до замены, останется исходный файл,
+// после замены — сжатый, поэтому хранилище остается читаемым в любой момент.
+// Новый файл блокируется до замены, чтобы другие процессы не начали запись в него раньше завершения сжатия.
+// Вызывается под блокировкой на запись и блокировкой файла.
+func (fs *FileStorage) compact() (CompactionResult, error) {
+	result := CompactionResult{SizeBefore: fs.size, RecordsBefore: fs.records}
+
+	if fs.file == nil {
+		return result, os.ErrClosed
+	}
+
+	file, err := os.OpenFile(fs.compactPath(), os.O_RDWR|os.O_APPEND|os.O_CREATE|os.O_TRUNC, 0644)
+
+	if err != nil {
+		return result, err
+	}
+
+	records := fs.liveRecords()
+
+	if err = lockFile(file); err == nil {
+		err = writeRecords(file, records)
+	}
+
+	if err != nil {
+		file.Close()
+		os.Remove(fs.compactPath())
+		return result, err
+	}
+
+	info, err := file.Stat()
+
+	if err == nil {
+		err = os.Rename(fs.compactPath(), fs.FileStoragePath)
+	}
+
+	if err != nil {
+		file.Close()
+		os.Remove(fs.compactPath())
+		return result, err
+	}
+
+	fs.file.Close()
+	fs.file = file
+	fs.size = info.Size()
+	fs.records = len(records)
+	fs.garbage = 0
+	fs.dirty = false
+
+	result.SizeAfter = fs.size
+	result.RecordsAfter = fs.records
+
+	return result, syncDir(filepath.Dir(fs.FileStoragePath))
+}
+
+// needsCompaction проверяет, превысили ли размер файла и доля устаревших записей пороги сжатия.
+// Вызывается под блокировкой.
+func (fs *FileStorage) needsCompaction() bool {
+	ratio := fs.CompactRatio
+	minSize := fs.CompactMinSize
+
+	if ratio == 0 {
+		ratio = DefaultCompactRatio
+	}
+
+	if minSize == 0 {
+		minSize = DefaultCompactMinSize
+	}
+
+	if ratio < 0 || fs.file == nil || fs.size < minSize || fs.records == 0 {
+		return false
+	}
+
+	return float64(fs.garbage)/float64(fs.records) >= ratio
+}
+
+// liveRecords возвращает актуальные записи хранилища в порядке, при котором их чтение
+// восстанавливает те же индексы. Удаления URL сохраняются в самих записях URL.
+// Вызывается под блокировкой.
+func (fs *FileStorage) liveRecords() []interface{} {
+	records := make([]interface{}, 0, fs.records-fs.garbage)
+	userIDs := make([]string, 0, len(fs.users))
+
+	for userID := range fs.users {
+		userIDs = append(userIDs, userID)
+	}
+
+	sort.Strings(userIDs)
+
+	for _, userID := range userIDs {
+		if fs.users[userID] {
+			records = append(records, fileBanRecord{Type: fileRecordBan, UserID: userID})
+		} else {
+			records = append(records, fileUserRecord{Type: fileRecordUser, UserID: userID})
+		}
+	}
+
+	for _, shortURL := range fs.order {
+		records = append(records, fs.rows[shortURL])
+
+		if health, ok := fs.health[shortURL]; ok {
+			records = append(records, fileHealthRecord{Type: fileRecordHealth, ShortURL: shortURL, Health: health})
+		}
+
+		if metadata, ok := fs.metadata[shortURL]; ok {
+			records = append(records, fileMetadataRecord{Type: fileRecordMetadata, ShortURL: shortURL, Metadata: metadata})
+		}
+	}
+
+	for _, record := range fs.auditRecords {
+		records = append(records, fileAuditRecord{Type: fileRecordAudit, Audit: record})
+	}
+
+	for _, webhook := range sortedWebhooks(fs.webhooks, func(Webhook) bool { return true }) {
+		records = append(records, fileWebhookRecord{Type: fileRecordWebhook, UserID: webhook.UserID, Webhook: webhook})
+	}
+
+	if _, ok := fs.webhooks[fs.lastWebhookID]; !ok && fs.lastWebhookID > 0 {
+		records = append(records, fileWebhookRecord{
+			Type: fileRecordWebhook, Deleted: true, Webhook: Webhook{ID: fs.lastWebhookID},
+		})
+	}
+
+	for _, delivery := range fs.deliveries {
+		records = append(records, fileDeliveryRecord{Type: fileRecordDelivery, Delivery: delivery})
+	}
+
+	return records
+}
+
+// compactPath возвращает путь к временному файлу сжатия.
+func (fs *FileStorage) compactPath() string {
+	return fs.FileStoragePath + ".compact"
+}
+
+// writeRecords сериализует записи в файл и сбрасывает его на диск.
+func writeRecords(file *os.File, records []interface{}) error {
+	writer := bufio.NewWriter(file)
+
+	for _, record := range records {
+		data, err := encodeRecord(record)
+
+		if err != nil {
+			return err
+		}
+
+		if _, err = writer.Write(data); err != nil {
+			return err
+		}
+	}
+
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+
+	return file.Sync()
+}
+
+// syncDir сбрасывает на диск содержимое директории, чтобы переименование файла пережило сбой питания.
+func syncDir(path string) error {
+	dir, err := os.Open(path)
+
+	if err != nil {
+		return err
+	}
+
+	defer dir.Close()
+
+	return dir.Sync()
+}
@@ -0,0 +1,242 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Политики сброса записей файла хранилища на диск.
+const (
+	// SyncAlways сбрасывает каждую запись на диск до возврата из метода записи.
+	SyncAlways = "always"
+
+	// SyncInterval периодически сбрасывает записи на диск. При сбое могут потеряться записи последнего периода.
+	SyncInterval = "interval"
+
+	// SyncNever оставляет сброс записей на диск операционной системе.
+	SyncNever = "never"
+)
+
+// DefaultSyncInterval задает период сброса записей на диск по умолчанию.
+const DefaultSyncInterval = time.Second
+
+// checksumTable используется для вычисления контрольных сумм записей файла хранилища.
+var checksumTable = crc32.MakeTable(crc32.Castagnoli)
+
+// encodeRecord сериализует запись в строку файла хранилища вида "<json>\t<crc32c>\n".
+// JSON не содержит неэкранированных символов табуляции, поэтому контрольная сумма отделяется однозначно.
+func encodeRecord(record interface{}) ([]byte, error) {
+	data, err := json.Marshal(record)
+
+	if err != nil {
+		return nil, err
+	}
+
+	data = append(data, '\t')
+	data = strconv.AppendUint(data, uint64(crc32.Checksum(data[:len(data)-1], checksumTable)), 16)
+
+	return append(data, '\n'), nil
+}
+
+// decodeRecord разбирает строку файла хранилища и проверяет её контрольную сумму.
+// Строки без контрольной суммы, записанные ранее, принимаются без проверки.
+// Возвращает false, если строка не завершена, повреждена или не является записью.
+func decodeRecord(line []byte) (fileRecord, bool) {
+	var record fileRecord
+
+	if !bytes.HasSuffix(line, []byte{'\n'}) {
+		return record, false
+	}
+
+	data := bytes.TrimSuffix(line, []byte{'\n'})
+
+	if i := bytes.LastIndexByte(data, '\t'); i >= 0 {
+		checksum, err := strconv.ParseUint(string(data[i+1:]), 16, 32)
+
+		if err != nil || uint32(checksum) != crc32.Checksum(data[:i], checksumTable) {
+			return record, false
+		}
+
+		data = data[:i]
+	}
+
+	if err := json.Unmarshal(data, &record); err != nil {
+		return record, false
+	}
+
+	return record, true
+}
+
+// replay применяет к индексам записи, дописанные в файл после уже прочитанных.
+// Повреждённые записи в конце файла остаются после сбоя во время записи и отбрасываются
+// с усечением файла. Повреждённая запись, за которой следуют целые записи, считается ошибкой.
+// Вызывается под блокировкой на запись и блокировкой файла.
+func (fs *FileStorage) replay() error {
+	info, err := fs.file.Stat()
+
+	if err != nil || info.Size() <= fs.size {
+		return err
+	}
+
+	reader := bufio.NewReader(io.NewSectionReader(fs.file, fs.size, info.Size()-fs.size))
+	offset := fs.size
+	tornAt := int64(-1)
+
+	for {
+		line, err := reader.ReadBytes('\n')
+
+		if err != nil && err != io.EOF {
+			return err
+		}
+
+		if len(line) > 0 {
+			record, ok := decodeRecord(line)
+
+			switch {
+			case !ok && tornAt < 0:
+				tornAt = offset
+			case ok && tornAt >= 0:
+				return fmt.Errorf("%s: corrupted record at offset %d", fs.FileStoragePath, tornAt)
+			case ok:
+				fs.apply(record)
+				fs.records++
+			}
+
+			offset += int64(len(line))
+		}
+
+		if err == io.EOF {
+			break
+		}
+	}
+
+	if tornAt >= 0 {
+		log.Printf("Truncating torn record at offset %d of %s", tornAt, fs.FileStoragePath)
+
+		if err = fs.file.Truncate(tornAt); err != nil {
+			return err
+		}
+
+		if err = fs.file.Sync(); err != nil {
+			return err
+		}
+
+		offset = tornAt
+	}
+
+	fs.size = offset
+
+	return nil
+}
+
+// acquireFile захватывает блокировку файла и применяет записи, дописанные другими процессами.
+// Если другой процесс сжал файл и заменил его новым, файл открывается и читается заново.
+// Вызывается под блокировкой на запись.
+func (fs *FileStorage) acquireFile() error {
+	if fs.file == nil {
+		return os.ErrClosed
+	}
+
+	if err := lockFile(fs.file); err != nil {
+		return err
+	}
+
+	replaced, err := fs.replaced()
+
+	if err == nil && replaced {
+		err = fs.reopen()
+	}
+
+	if err == nil {
+		err = fs.replay()
+	}
+
+	if err != nil {
+		unlockFile(fs.file)
+		return err
+	}
+
+	return nil
+}
+
+// replaced проверяет, заменен ли файл хранилища другим файлом с тем же путём.
+func (fs *FileStorage) replaced() (bool, error) {
+	opened, err := fs.file.Stat()
+
+	if err != nil {
+		return false, err
+	}
+
+	current, err := os.Stat(fs.FileStoragePath)
+
+	if os.IsNotExist(err) {
+		return true, nil
+	}
+
+	if err != nil {
+		return false, err
+	}
+
+	return !os.SameFile(opened, current), nil
+}
+
+// reopen закрывает заменённый файл, открывает файл хранилища заново и захватывает его блокировку.
+// Индексы очищаются и строятся заново при чтении файла.
+func (fs *FileStorage) reopen() error {
+	fs.flush()
+	fs.file.Close()
+
+	if err := fs.open(); err != nil {
+		fs.file = nil
+		return err
+	}
+
+	return lockFile(fs.file)
+}
+
+// flush сбрасывает записи на диск, если есть несброшенные. Вызывается под блокировкой на запись.
+func (fs *FileStorage) flush() error {
+	if !fs.dirty || fs.file == nil {
+		return nil
+	}
+
+	if err := fs.file.Sync(); err != nil {
+		log.Printf("Error syncing file:  %v\n", err)
+		return err
+	}
+
+	fs.dirty = false
+
+	return nil
+}
+
+// syncPeriodically сбрасывает записи на диск с периодом SyncInterval до закрытия канала stop.
+func (fs *FileStorage) syncPeriodically(stop chan struct{}) {
+	interval := fs.SyncInterval
+
+	if interval <= 0 {
+		interval = DefaultSyncInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			fs.mu.Lock()
+			fs.flush()
+			fs.mu.Unlock()
+		}
+	}
+}
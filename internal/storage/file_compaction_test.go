@@ -0,0 +1,106 @@
+package storage
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileStorage_Compact(t *testing.T) {
+	ctx := context.Background()
+	clearTestFile()
+	defer clearTestFile()
+
+	fs := &FileStorage{FileStoragePath: testFilePath, CompactRatio: -1}
+	require.NoError(t, fs.SaveUser(ctx, "user1"))
+	require.NoError(t, fs.BanUser(ctx, "user2"))
+	require.NoError(t, fs.Save(ctx, DataStorageRow{ShortURL: "abc", URL: "http://example.com", UserID: "user1"}))
+	require.NoError(t, fs.Save(ctx, DataStorageRow{ShortURL: "def", URL: "http://example.org", UserID: "user1"}))
+
+	for i := 0; i < 10; i++ {
+		require.NoError(t, fs.SaveLinkHealth(ctx, "abc", LinkHealth{Status: 200 + i}))
+	}
+
+	require.NoError(t, fs.DeleteUserUrls(ctx, "user1", []string{"def"}))
+	webhook, err := fs.SaveWebhook(ctx, Webhook{UserID: "user1", URL: "https://example.com/hook"})
+	require.NoError(t, err)
+	_, err = fs.DeleteWebhook(ctx, "user1", webhook.ID)
+	require.NoError(t, err)
+
+	result, err := fs.Compact(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 17, result.RecordsBefore)
+	assert.Equal(t, 6, result.RecordsAfter, "users, links, last health and last webhook id should remain")
+	assert.Less(t, result.SizeAfter, result.SizeBefore)
+
+	info, err := os.Stat(testFilePath)
+	require.NoError(t, err)
+	assert.Equal(t, result.SizeAfter, info.Size())
+
+	// Запись после сжатия дописывается в новый файл
+	require.NoError(t, fs.Save(ctx, DataStorageRow{ShortURL: "ghi", URL: "http://example.net", UserID: "user1"}))
+	fs.Close()
+
+	reloaded := &FileStorage{FileStoragePath: testFilePath}
+	defer reloaded.Close()
+
+	assert.Equal(t, 2, reloaded.GetUsersCount(ctx))
+	assert.True(t, reloaded.IsUserBanned(ctx, "user2"))
+	assert.Equal(t, 3, reloaded.GetURLCount(ctx))
+
+	getURLRow, _ := reloaded.GetURL(ctx, "def")
+	assert.True(t, getURLRow.IsDeleted, "deletion should be kept in the link record")
+
+	urls, err := reloaded.GetUserUrls(ctx, "user1")
+	require.NoError(t, err)
+	require.Len(t, urls, 2)
+	require.NotNil(t, urls[0].Health)
+	assert.Equal(t, 209, urls[0].Health.Status)
+
+	webhook, err = reloaded.SaveWebhook(ctx, Webhook{UserID: "user1", URL: "https://example.com/hook"})
+	require.NoError(t, err)
+	assert.Equal(t, 2, webhook.ID, "ids of deleted webhooks should not be reused")
+}
+
+func TestFileStorage_CompactAutomatically(t *testing.T) {
+	ctx := context.Background()
+	clearTestFile()
+	defer clearTestFile()
+
+	fs := &FileStorage{FileStoragePath: testFilePath, CompactRatio: 0.5, CompactMinSize: 1}
+	defer fs.Close()
+
+	require.NoError(t, fs.Save(ctx, DataStorageRow{ShortURL: "abc", URL: "http://example.com"}))
+
+	for i := 0; i < 10; i++ {
+		require.NoError(t, fs.SaveLinkHealth(ctx, "abc", LinkHealth{Status: 200 + i}))
+	}
+
+	assert.LessOrEqual(t, fs.records, 3, "file should be compacted once half of the records are stale")
+	assert.Equal(t, 1, fs.GetURLCount(ctx))
+}
+
+func TestFileStorage_RemovesInterruptedCompaction(t *testing.T) {
+	ctx := context.Background()
+	clearTestFile()
+	defer clearTestFile()
+
+	fs := &FileStorage{FileStoragePath: testFilePath}
+	require.NoError(t, fs.Save(ctx, DataStorageRow{ShortURL: "abc", URL: "http://example.com"}))
+	fs.Close()
+
+	// Незавершённое сжатие оставляет временный файл, исходный файл при этом не изменяется
+	require.NoError(t, os.WriteFile(fs.compactPath(), []byte(`{"short_url":"par`), 0644))
+
+	reloaded := &FileStorage{FileStoragePath: testFilePath}
+	defer reloaded.Close()
+
+	require.NoError(t, reloaded.Init(""))
+	assert.Equal(t, 1, reloaded.GetURLCount(ctx))
+
+	_, err := os.Stat(reloaded.compactPath())
+	assert.True(t, os.IsNotExist(err), "temporary compaction file should be removed")
+}
@@ -0,0 +1,124 @@
+package storage
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncodeRecord(t *testing.T) {
+	line, err := encodeRecord(fileUserRecord{Type: fileRecordUser, UserID: "user1"})
+	require.NoError(t, err)
+
+	record, ok := decodeRecord(line)
+	assert.True(t, ok)
+	assert.Equal(t, "user1", record.UserID)
+
+	tests := []struct {
+		name string
+		line string
+	}{
+		{name: "torn line", line: string(line[:len(line)-5])},
+		{name: "checksum mismatch", line: `{"type":"user","user_id":"user2"}` + string(line[len(line)-10:])},
+		{name: "invalid json", line: "{\"type\":\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, ok := decodeRecord([]byte(tt.line))
+			assert.False(t, ok)
+		})
+	}
+
+	// Строки, записанные до появления контрольных сумм, читаются без проверки
+	record, ok = decodeRecord([]byte(`{"short_url":"abc","original_url":"http://example.com"}` + "\n"))
+	assert.True(t, ok)
+	assert.Equal(t, "abc", record.ShortURL)
+}
+
+func TestFileStorage_TruncatesTornRecord(t *testing.T) {
+	ctx := context.Background()
+	clearTestFile()
+	defer clearTestFile()
+
+	fs := &FileStorage{FileStoragePath: testFilePath, SyncPolicy: SyncAlways}
+	require.NoError(t, fs.Save(ctx, DataStorageRow{ShortURL: "abc", URL: "http://example.com", UserID: "user1"}))
+	fs.Close()
+
+	info, err := os.Stat(testFilePath)
+	require.NoError(t, err)
+
+	// Сбой во время записи оставляет незавершённую строку в конце файла
+	file, err := os.OpenFile(testFilePath, os.O_APPEND|os.O_WRONLY, 0644)
+	require.NoError(t, err)
+	_, err = file.WriteString(`{"short_url":"def","original_url":"http://exa`)
+	require.NoError(t, err)
+	file.Close()
+
+	reloaded := &FileStorage{FileStoragePath: testFilePath}
+	require.NoError(t, reloaded.Init(""))
+	assert.Equal(t, 1, reloaded.GetURLCount(ctx))
+
+	truncated, err := os.Stat(testFilePath)
+	require.NoError(t, err)
+	assert.Equal(t, info.Size(), truncated.Size(), "torn record should be truncated")
+
+	require.NoError(t, reloaded.Save(ctx, DataStorageRow{ShortURL: "def", URL: "http://example.org", UserID: "user1"}))
+	reloaded.Close()
+
+	reopened := &FileStorage{FileStoragePath: testFilePath}
+	defer reopened.Close()
+
+	require.NoError(t, reopened.Init(""))
+	assert.Equal(t, 2, reopened.GetURLCount(ctx))
+}
+
+func TestFileStorage_SharedBetweenProcesses(t *testing.T) {
+	ctx := context.Background()
+	clearTestFile()
+	defer clearTestFile()
+
+	// Каждый экземпляр открывает файл отдельно, как это делает отдельный процесс
+	first := &FileStorage{FileStoragePath: testFilePath, CompactRatio: -1}
+	second := &FileStorage{FileStoragePath: testFilePath, CompactRatio: -1}
+	defer first.Close()
+	defer second.Close()
+
+	require.NoError(t, first.Init(""))
+	require.NoError(t, second.Init(""))
+
+	require.NoError(t, first.Save(ctx, DataStorageRow{ShortURL: "abc", URL: "http://example.com", UserID: "user1"}))
+	require.NoError(t, second.SaveUser(ctx, "user1"))
+	assert.ErrorIs(t, first.SaveUser(ctx, "user1"), ErrConflict, "user saved by another process should be seen before writing")
+
+	_, err := first.GetURL(ctx, "abc")
+	assert.NoError(t, err)
+
+	_, err = second.DisableURL(ctx, "abc", "spam")
+	require.NoError(t, err)
+	_, err = second.Compact(ctx)
+	require.NoError(t, err)
+
+	// Запись после сжатия другим процессом выполняется в новый файл
+	require.NoError(t, first.Save(ctx, DataStorageRow{ShortURL: "def", URL: "http://example.org", UserID: "user1"}))
+
+	getURLRow, _ := first.GetURL(ctx, "abc")
+	assert.Equal(t, "spam", getURLRow.DisabledReason)
+
+	reloaded := &FileStorage{FileStoragePath: testFilePath}
+	defer reloaded.Close()
+
+	assert.Equal(t, 2, reloaded.GetURLCount(ctx))
+	assert.True(t, reloaded.IsUserExist(ctx, "user1"))
+}
+
+func TestFileStorage_UnknownSyncPolicy(t *testing.T) {
+	clearTestFile()
+	defer clearTestFile()
+
+	fs := &FileStorage{FileStoragePath: testFilePath, SyncPolicy: "sometimes"}
+	assert.Error(t, fs.Init(""))
+}
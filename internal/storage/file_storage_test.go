@@ -1,8 +1,13 @@
 package storage
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"os"
+	"sync"
 	"testing"
+	"time"
 )
 
 // Путь к тестовому файлу
@@ -15,16 +20,17 @@ func clearTestFile() {
 
 // Тест для метода Save
 func TestSave(t *testing.T) {
+	ctx := context.Background()
 	clearTestFile()
 	defer clearTestFile()
 
 	fs := &FileStorage{FileStoragePath: testFilePath}
-	err := fs.Save("short1", "http://example.com", "user1")
+	err := fs.Save(ctx, DataStorageRow{ShortURL: "short1", URL: "http://example.com", UserID: "user1"})
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
 
-	rows, err := fs.LoadData()
+	rows, err := fs.LoadData(ctx)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -36,15 +42,16 @@ func TestSave(t *testing.T) {
 
 // Тест для метода GetURL
 func TestGetURL(t *testing.T) {
+	ctx := context.Background()
 	clearTestFile()
 	defer clearTestFile()
 
 	fs := &FileStorage{FileStoragePath: testFilePath}
-	fs.Save("short1", "http://example.com", "user1")
+	fs.Save(ctx, DataStorageRow{ShortURL: "short1", URL: "http://example.com", UserID: "user1"})
 
-	getURLRow, found := fs.GetURL("short1")
-	if !found {
-		t.Fatal("expected to find short URL")
+	getURLRow, err := fs.GetURL(ctx, "short1")
+	if err != nil {
+		t.Fatalf("expected to find short URL: %v", err)
 	}
 	if getURLRow.URL != "http://example.com" {
 		t.Errorf("expected URL to be 'http://example.com', got '%s'", getURLRow.URL)
@@ -53,16 +60,17 @@ func TestGetURL(t *testing.T) {
 
 // Тест для метода GetShortURL
 func TestGetShortURL(t *testing.T) {
+	ctx := context.Background()
 	clearTestFile()
 	defer clearTestFile()
 
 	fs := &FileStorage{FileStoragePath: testFilePath}
-	err := fs.Save("short1", "http://example.com", "user1")
+	err := fs.Save(ctx, DataStorageRow{ShortURL: "short1", URL: "http://example.com", UserID: "user1"})
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
 
-	shortURL, err := fs.GetShortURL("http://example.com")
+	shortURL, err := fs.GetShortURL(ctx, "http://example.com")
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -73,14 +81,15 @@ func TestGetShortURL(t *testing.T) {
 
 // Тест для метода LoadData
 func TestLoadData(t *testing.T) {
+	ctx := context.Background()
 	clearTestFile()
 	defer clearTestFile()
 
 	fs := &FileStorage{FileStoragePath: testFilePath}
-	_ = fs.Save("short1", "http://example.com", "user1")
-	_ = fs.Save("short2", "http://example.org", "user2")
+	_ = fs.Save(ctx, DataStorageRow{ShortURL: "short1", URL: "http://example.com", UserID: "user1"})
+	_ = fs.Save(ctx, DataStorageRow{ShortURL: "short2", URL: "http://example.org", UserID: "user2"})
 
-	dataRows, err := fs.LoadData()
+	dataRows, err := fs.LoadData(ctx)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -92,18 +101,416 @@ func TestLoadData(t *testing.T) {
 
 // Тест для метода GetURLCount
 func TestGetURLCount(t *testing.T) {
+	ctx := context.Background()
 	clearTestFile()
 	defer clearTestFile()
 
 	fs := &FileStorage{FileStoragePath: testFilePath}
 
-	if count := fs.GetURLCount(); count != 0 {
+	if count := fs.GetURLCount(ctx); count != 0 {
 		t.Errorf("expected URL count to be 0, got %d", count)
 	}
 
-	_ = fs.Save("short1", "http://example.com", "user1")
+	_ = fs.Save(ctx, DataStorageRow{ShortURL: "short1", URL: "http://example.com", UserID: "user1"})
 
-	if count := fs.GetURLCount(); count != 1 {
+	if count := fs.GetURLCount(ctx); count != 1 {
 		t.Errorf("expected URL count to be 1, got %d", count)
 	}
 }
+
+// Тест для метода UpdateUserURLDevices
+func TestUpdateUserURLDevices(t *testing.T) {
+	ctx := context.Background()
+	clearTestFile()
+	defer clearTestFile()
+
+	fs := &FileStorage{FileStoragePath: testFilePath}
+	_ = fs.Save(ctx, DataStorageRow{ShortURL: "short1", URL: "http://example.com", UserID: "user1"})
+
+	deviceURLs := DeviceURLs{IOSURL: "https://apps.apple.com/app/id1"}
+
+	if found, err := fs.UpdateUserURLDevices(ctx, "user2", "short1", deviceURLs); err != nil || found {
+		t.Fatalf("expected link of another user not to be updated, got found=%v err=%v", found, err)
+	}
+
+	if found, err := fs.UpdateUserURLDevices(ctx, "user1", "short1", deviceURLs); err != nil || !found {
+		t.Fatalf("expected link to be updated, got found=%v err=%v", found, err)
+	}
+
+	getURLRow, err := fs.GetURL(ctx, "short1")
+	if err != nil {
+		t.Fatalf("expected to find short URL: %v", err)
+	}
+	if getURLRow.DeviceURLs != deviceURLs {
+		t.Errorf("expected device URLs %+v, got %+v", deviceURLs, getURLRow.DeviceURLs)
+	}
+	if getURLRow.URL != "http://example.com" {
+		t.Errorf("expected URL to be 'http://example.com', got '%s'", getURLRow.URL)
+	}
+}
+
+// Тест для метода RecordSplitClick
+func TestRecordSplitClick(t *testing.T) {
+	ctx := context.Background()
+	clearTestFile()
+	defer clearTestFile()
+
+	fs := &FileStorage{FileStoragePath: testFilePath}
+	_ = fs.Save(ctx, DataStorageRow{
+		ShortURL: "short1",
+		URL:      "http://example.com",
+		Splits:   []SplitDestination{{URL: "http://a.example.com", Weight: 70}, {URL: "http://b.example.com", Weight: 30}},
+	})
+
+	for _, variant := range []int{1, 1, 0, 5} {
+		if err := fs.RecordSplitClick(ctx, "short1", variant); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	getURLRow, _ := fs.GetURL(ctx, "short1")
+	if getURLRow.Splits[0].Clicks != 1 || getURLRow.Splits[1].Clicks != 2 {
+		t.Errorf("unexpected split clicks: %+v", getURLRow.Splits)
+	}
+
+	if count := fs.GetURLCount(ctx); count != 1 {
+		t.Errorf("expected URL count to be 1, got %d", count)
+	}
+}
+
+// Тест для метода UpdateUserURLActivation
+func TestUpdateUserURLActivation(t *testing.T) {
+	ctx := context.Background()
+	clearTestFile()
+	defer clearTestFile()
+
+	fs := &FileStorage{FileStoragePath: testFilePath}
+	_ = fs.Save(ctx, DataStorageRow{ShortURL: "short1", URL: "http://example.com", UserID: "user1"})
+
+	activeFrom := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	if found, err := fs.UpdateUserURLActivation(ctx, "user1", "short1", &activeFrom); err != nil || !found {
+		t.Fatalf("expected link to be updated, got found=%v err=%v", found, err)
+	}
+
+	getURLRow, _ := fs.GetURL(ctx, "short1")
+	if getURLRow.ActiveFrom == nil || !getURLRow.ActiveFrom.Equal(activeFrom) {
+		t.Errorf("expected activation time %v, got %v", activeFrom, getURLRow.ActiveFrom)
+	}
+
+	if found, _ := fs.UpdateUserURLActivation(ctx, "user2", "short1", nil); found {
+		t.Error("expected link of another user not to be updated")
+	}
+}
+
+// Тест для метода RedeemClick
+func TestRedeemClick(t *testing.T) {
+	ctx := context.Background()
+	clearTestFile()
+	defer clearTestFile()
+
+	fs := &FileStorage{FileStoragePath: testFilePath}
+	_ = fs.Save(ctx, DataStorageRow{ShortURL: "short1", URL: "http://example.com", MaxClicks: 2})
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	redeemedCount := 0
+
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			_, redeemed, err := fs.RedeemClick(ctx, "short1")
+
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+				return
+			}
+
+			if redeemed {
+				mu.Lock()
+				redeemedCount++
+				mu.Unlock()
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	if redeemedCount != 2 {
+		t.Errorf("expected 2 redeemed clicks, got %d", redeemedCount)
+	}
+
+	getURLRow, _ := fs.GetURL(ctx, "short1")
+	if getURLRow.Clicks != 2 || getURLRow.MaxClicks != 2 {
+		t.Errorf("unexpected click counters: clicks=%d max_clicks=%d", getURLRow.Clicks, getURLRow.MaxClicks)
+	}
+
+	if _, redeemed, _ := fs.RedeemClick(ctx, "missing"); redeemed {
+		t.Error("expected unknown link not to be redeemed")
+	}
+}
+
+// Тест восстановления индексов из файла
+func TestFileStorage_Reload(t *testing.T) {
+	ctx := context.Background()
+	clearTestFile()
+	defer clearTestFile()
+
+	fs := &FileStorage{FileStoragePath: testFilePath}
+	_ = fs.Save(ctx, DataStorageRow{ShortURL: "short1", URL: "http://example.com", UserID: "user1"})
+	_ = fs.SaveBatch(ctx, []DataStorageRow{{ShortURL: "short2", URL: "http://example.org", UserID: "user1"}})
+	_, _ = fs.ReassignURL(ctx, "short1", "user2")
+	_, _ = fs.DisableURL(ctx, "short2", "spam")
+	_ = fs.BanUser(ctx, "user3")
+	fs.Close()
+
+	reloaded := &FileStorage{FileStoragePath: testFilePath}
+	if err := reloaded.Init(""); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer reloaded.Close()
+
+	if count := reloaded.GetURLCount(ctx); count != 2 {
+		t.Errorf("expected URL count to be 2, got %d", count)
+	}
+
+	if shortURL, _ := reloaded.GetShortURL(ctx, "http://example.org"); shortURL != "short2" {
+		t.Errorf("expected short URL to be 'short2', got '%s'", shortURL)
+	}
+
+	getURLRow, _ := reloaded.GetURL(ctx, "short1")
+	if getURLRow.UserID != "user2" {
+		t.Errorf("expected owner to be 'user2', got '%s'", getURLRow.UserID)
+	}
+
+	getURLRow, _ = reloaded.GetURL(ctx, "short2")
+	if getURLRow.DisabledReason != "spam" {
+		t.Errorf("expected disabled reason to be 'spam', got '%s'", getURLRow.DisabledReason)
+	}
+
+	if !reloaded.IsUserBanned(ctx, "user3") {
+		t.Error("expected user ban to be restored")
+	}
+
+	if links := reloaded.userLinks["user1"]; len(links) != 1 || links[0] != "short2" {
+		t.Errorf("unexpected links of user1: %v", links)
+	}
+}
+
+// Тест ошибки чтения файла, повреждённого не в последней записи
+func TestFileStorage_InitCorruptedFile(t *testing.T) {
+	ctx := context.Background()
+	clearTestFile()
+	defer clearTestFile()
+
+	data := "{\"short_url\":\"short1\"}\nnot json\n{\"short_url\":\"short2\"}\n"
+
+	if err := os.WriteFile(testFilePath, []byte(data), 0644); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	fs := &FileStorage{FileStoragePath: testFilePath}
+
+	if err := fs.Init(""); err == nil {
+		t.Fatal("expected error for corrupted file")
+	}
+
+	if err := fs.Save(ctx, DataStorageRow{ShortURL: "short2", URL: "http://example.org"}); err == nil {
+		t.Error("expected writes to fail after failed load")
+	}
+}
+
+// Время записи и чтения не зависит от количества уже сохранённых URL
+func BenchmarkFileStorage_SaveAndGet(b *testing.B) {
+	ctx := context.Background()
+	clearTestFile()
+	defer clearTestFile()
+
+	fs := &FileStorage{FileStoragePath: testFilePath}
+	defer fs.Close()
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		shortURL := fmt.Sprintf("short%d", i)
+		_ = fs.Save(ctx, DataStorageRow{ShortURL: shortURL, URL: "http://example.com/" + shortURL})
+		fs.GetURL(ctx, shortURL)
+	}
+}
+
+// Тест хранения пользователей и удаления их URL
+func TestFileStorage_Users(t *testing.T) {
+	ctx := context.Background()
+	clearTestFile()
+	defer clearTestFile()
+
+	fs := &FileStorage{FileStoragePath: testFilePath}
+
+	if err := fs.SaveUser(ctx, "user1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := fs.SaveUser(ctx, "user1"); err == nil {
+		t.Error("expected error for duplicate user")
+	}
+
+	_ = fs.BanUser(ctx, "user2")
+	_ = fs.Save(ctx, DataStorageRow{ShortURL: "short1", URL: "http://example.com", UserID: "user1"})
+	_ = fs.Save(ctx, DataStorageRow{ShortURL: "short2", URL: "http://example.org", UserID: "user2"})
+	_ = fs.SaveBatch(ctx, []DataStorageRow{{ShortURL: "short3", URL: "http://example.net", UserID: "user1"}})
+	_ = fs.SaveLinkMetadata(ctx, "short3", LinkMetadata{Title: "Example"})
+
+	if err := fs.DeleteUserUrls(ctx, "user1", []string{"short1", "short2"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	fs.Close()
+
+	reloaded := &FileStorage{FileStoragePath: testFilePath}
+	defer reloaded.Close()
+
+	if !reloaded.IsUserExist(ctx, "user1") || !reloaded.IsUserExist(ctx, "user2") || reloaded.IsUserExist(ctx, "user3") {
+		t.Error("unexpected users after reload")
+	}
+
+	if count := reloaded.GetUsersCount(ctx); count != 2 {
+		t.Errorf("expected 2 users, got %d", count)
+	}
+
+	if !reloaded.IsUserBanned(ctx, "user2") || reloaded.IsUserBanned(ctx, "user1") {
+		t.Error("unexpected user bans after reload")
+	}
+
+	urls, err := reloaded.GetUserUrls(ctx, "user1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(urls) != 1 || urls[0].ShortURL != "short3" || urls[0].Metadata == nil || urls[0].Metadata.Title != "Example" {
+		t.Errorf("unexpected urls of user1: %+v", urls)
+	}
+
+	if getURLRow, _ := reloaded.GetURL(ctx, "short1"); !getURLRow.IsDeleted {
+		t.Error("expected short1 to be deleted")
+	}
+
+	if getURLRow, _ := reloaded.GetURL(ctx, "short2"); getURLRow.IsDeleted {
+		t.Error("expected link of another user not to be deleted")
+	}
+
+	if found, _ := reloaded.UpdateUserURLDevices(ctx, "user1", "short1", DeviceURLs{}); found {
+		t.Error("expected deleted link not to be updated")
+	}
+}
+
+func TestFileStorage_InsertOrGet(t *testing.T) {
+	ctx := context.Background()
+	clearTestFile()
+	defer clearTestFile()
+
+	fs := &FileStorage{FileStoragePath: testFilePath}
+	defer fs.Close()
+
+	row := DataStorageRow{ShortURL: "short1", URL: "http://example.com", UserID: "user1", Domain: "go.example.com"}
+	stored, created, err := fs.InsertOrGet(ctx, row)
+	if err != nil || !created || stored.ShortURL != "short1" {
+		t.Fatalf("expected link to be created, got %+v created=%v err=%v", stored, created, err)
+	}
+
+	stored, created, err = fs.InsertOrGet(ctx, DataStorageRow{ShortURL: "short2", URL: "http://example.com", UserID: "user2"})
+	if err != nil || created {
+		t.Fatalf("expected existing link to be returned, got created=%v err=%v", created, err)
+	}
+	if stored.ShortURL != "short1" || stored.Domain != "go.example.com" || stored.UserID != "user1" {
+		t.Errorf("expected existing link, got %+v", stored)
+	}
+
+	if _, _, err = fs.InsertOrGet(ctx, DataStorageRow{ShortURL: "short1", URL: "http://example.org"}); !errors.Is(err, ErrConflict) {
+		t.Errorf("expected conflict for a taken short URL, got %v", err)
+	}
+
+	if count := fs.GetURLCount(ctx); count != 1 {
+		t.Errorf("expected 1 link, got %d", count)
+	}
+}
+
+func TestFileStorage_SaveConflicts(t *testing.T) {
+	ctx := context.Background()
+	clearTestFile()
+	defer clearTestFile()
+
+	fs := &FileStorage{FileStoragePath: testFilePath}
+	defer fs.Close()
+
+	if err := fs.Save(ctx, DataStorageRow{ShortURL: "short1", URL: "http://example.com"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := fs.Save(ctx, DataStorageRow{ShortURL: "short2", URL: "http://example.com"}); !errors.Is(err, ErrConflict) {
+		t.Errorf("expected conflict for a saved URL, got %v", err)
+	}
+
+	if err := fs.Save(ctx, DataStorageRow{ShortURL: "short1", URL: "http://example.org"}); !errors.Is(err, ErrConflict) {
+		t.Errorf("expected conflict for a taken short URL, got %v", err)
+	}
+
+	row, err := fs.GetURL(ctx, "short1")
+	if err != nil || row.URL != "http://example.com" {
+		t.Errorf("expected saved link to be unchanged, got %+v err=%v", row, err)
+	}
+}
+
+func TestFileStorage_SaveBatch(t *testing.T) {
+	ctx := context.Background()
+	clearTestFile()
+	defer clearTestFile()
+
+	fs := &FileStorage{FileStoragePath: testFilePath}
+	defer fs.Close()
+
+	if err := fs.Save(ctx, DataStorageRow{ShortURL: "a", URL: "http://a.example.com"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	rows := []DataStorageRow{
+		{ShortURL: "a", URL: "http://a.example.com"},
+		{ShortURL: "b", URL: "http://b.example.com"},
+	}
+
+	if err := fs.SaveBatch(ctx, rows); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if rows[0].ID != 0 || rows[1].ID != 0 {
+		t.Errorf("expected batch rows not to be modified, got %+v", rows)
+	}
+
+	conflicts := [][]DataStorageRow{
+		{{ShortURL: "c", URL: "http://c.example.com"}, {ShortURL: "d", URL: "http://a.example.com"}},
+		{{ShortURL: "c", URL: "http://c.example.com"}, {ShortURL: "b", URL: "http://d.example.com"}},
+		{{ShortURL: "c", URL: "http://c.example.com"}, {ShortURL: "c", URL: "http://d.example.com"}},
+		{{ShortURL: "c", URL: "http://c.example.com"}, {ShortURL: "d", URL: "http://c.example.com"}},
+	}
+
+	for _, batch := range conflicts {
+		if err := fs.SaveBatch(ctx, batch); !errors.Is(err, ErrConflict) {
+			t.Errorf("expected conflict for batch %+v, got %v", batch, err)
+		}
+	}
+
+	loaded, err := fs.LoadData(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(loaded) != 2 {
+		t.Fatalf("expected conflicting batches not to be saved, got %+v", loaded)
+	}
+
+	if loaded[0].ID != 1 || loaded[1].ID != 2 {
+		t.Errorf("expected sequential IDs starting from 1, got %d and %d", loaded[0].ID, loaded[1].ID)
+	}
+}
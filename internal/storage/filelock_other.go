@@ -0,0 +1,14 @@
+//go:build !unix
+
+package storage
+
+import "os"
+
+// lockFile ничего не делает: рекомендательная блокировка файлов доступна только в unix-системах,
+// поэтому на других платформах файл хранилища должен использоваться одним процессом.
+func lockFile(file *os.File) error {
+	return nil
+}
+
+// unlockFile ничего не делает.
+func unlockFile(file *os.File) {}
@@ -0,0 +1,24 @@
+//go:build unix
+
+package storage
+
+import (
+	"os"
+	"syscall"
+)
+
+// lockFile захватывает эксклюзивную рекомендательную блокировку файла, ожидая её освобождения другими процессами.
+func lockFile(file *os.File) error {
+	for {
+		err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX)
+
+		if err != syscall.EINTR {
+			return err
+		}
+	}
+}
+
+// unlockFile освобождает блокировку файла.
+func unlockFile(file *os.File) {
+	_ = syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+}
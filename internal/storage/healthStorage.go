@@ -0,0 +1,108 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// HealthStorageInterface определяет методы хранения результатов проверки адресов перехода ссылок.
+type HealthStorageInterface interface {
+	// GetHealthTargets возвращает неудалённые и незаблокированные ссылки для проверки
+	// вместе с результатом их предыдущей проверки.
+	GetHealthTargets(ctx context.Context) ([]HealthTarget, error)
+
+	// SaveLinkHealth сохраняет результат проверки адреса перехода ссылки.
+	SaveLinkHealth(ctx context.Context, shortURL string, health LinkHealth) error
+}
+
+// LinkHealth представляет результат последней проверки адреса перехода ссылки.
+type LinkHealth struct {
+	Status    int       `json:"status"`             // HTTP статус ответа, 0 если ответ не получен
+	LatencyMs int64     `json:"latency_ms"`         // Время ответа в миллисекундах
+	CheckedAt time.Time `json:"checked_at"`         // Время проверки
+	Error     string    `json:"error,omitempty"`    // Описание ошибки неудачной проверки
+	Failures  int       `json:"failures,omitempty"` // Количество неудачных проверок подряд
+	Dead      bool      `json:"dead,omitempty"`     // Признак недоступной ссылки
+}
+
+// HealthTarget представляет ссылку, адрес перехода которой нужно проверить.
+type HealthTarget struct {
+	ShortURL string      // Короткий URL
+	URL      string      // Адрес перехода
+	Health   *LinkHealth // Результат предыдущей проверки, nil если ссылка не проверялась
+}
+
+// HealthStorage предоставляет реализацию хранения результатов проверки ссылок в базе данных.
+type HealthStorage struct {
+	// conn представляет соединение с базой данных, предоставляющее доступ к методам SQL.
+	conn DBConnectionInterface
+}
+
+// SetConnection устанавливает объект подключения к бд
+func (hs *HealthStorage) SetConnection(conn DBConnectionInterface) {
+	hs.conn = conn
+}
+
+// Init инициализирует соединение с базой данных по заданной строке подключения.
+func (hs *HealthStorage) Init(connectionString string) error {
+	pool, err := NewPool(context.Background(), connectionString, PoolConfig{})
+
+	if err != nil {
+		return err
+	}
+
+	hs.SetConnection(pool)
+
+	return nil
+}
+
+// Close закрывает соединение с базой данных.
+func (hs *HealthStorage) Close() {
+	hs.conn.Close()
+}
+
+// GetHealthTargets возвращает неудалённые и незаблокированные ссылки для проверки.
+func (hs *HealthStorage) GetHealthTargets(ctx context.Context) ([]HealthTarget, error) {
+	rows, err := hs.conn.Query(ctx, fmt.Sprintf(
+		`SELECT short_url, url, health FROM %s
+		WHERE is_deleted = false AND disabled_reason = '' ORDER BY short_url`, tableName))
+
+	if err != nil {
+		return nil, wrapError(err)
+	}
+
+	defer rows.Close()
+
+	var targets []HealthTarget
+
+	for rows.Next() {
+		var target HealthTarget
+
+		if err := rows.Scan(&target.ShortURL, &target.URL, &target.Health); err != nil {
+			return nil, wrapError(err)
+		}
+
+		targets = append(targets, target)
+	}
+
+	return targets, wrapError(rows.Err())
+}
+
+// SaveLinkHealth сохраняет результат проверки адреса перехода ссылки.
+func (hs *HealthStorage) SaveLinkHealth(ctx context.Context, shortURL string, health LinkHealth) error {
+	_, err := hs.conn.Exec(ctx, fmt.Sprintf("UPDATE %s SET health = $1 WHERE short_url = $2", tableName),
+		health, shortURL)
+
+	return wrapError(err)
+}
+
+// sortedHealthTargets возвращает цели проверки, упорядоченные по короткому URL.
+func sortedHealthTargets(targets []HealthTarget) []HealthTarget {
+	sort.Slice(targets, func(i, j int) bool {
+		return targets[i].ShortURL < targets[j].ShortURL
+	})
+
+	return targets
+}
@@ -0,0 +1,72 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pashagolub/pgxmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHealthStorage_GetHealthTargets(t *testing.T) {
+	ctx := context.Background()
+	mock, err := pgxmock.NewPool()
+	assert.NoError(t, err)
+	defer mock.Close()
+
+	storage := &HealthStorage{conn: mock}
+
+	mock.ExpectQuery(`SELECT short_url, url, health FROM urls\s+WHERE is_deleted = false AND disabled_reason = ''`).
+		WillReturnRows(pgxmock.NewRows([]string{"short_url", "url", "health"}).
+			AddRow("abc", "http://example.com", nil).
+			AddRow("xyz", "http://example.org", &LinkHealth{Status: 500, Failures: 2}))
+
+	targets, err := storage.GetHealthTargets(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, targets, 2)
+	assert.Nil(t, targets[0].Health)
+	assert.Equal(t, 2, targets[1].Health.Failures)
+	assert.NoError(t, mock.ExpectationsWereMet(), "There should be no unfulfilled expectations")
+}
+
+func TestHealthStorage_SaveLinkHealth(t *testing.T) {
+	ctx := context.Background()
+	mock, err := pgxmock.NewPool()
+	assert.NoError(t, err)
+	defer mock.Close()
+
+	storage := &HealthStorage{conn: mock}
+	health := LinkHealth{Status: 200, LatencyMs: 15, CheckedAt: time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)}
+
+	mock.ExpectExec(`UPDATE urls SET health = \$1 WHERE short_url = \$2`).
+		WithArgs(health, "abc").
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+
+	assert.NoError(t, storage.SaveLinkHealth(ctx, "abc", health))
+	assert.NoError(t, mock.ExpectationsWereMet(), "There should be no unfulfilled expectations")
+}
+
+func TestFileStorage_LinkHealth(t *testing.T) {
+	ctx := context.Background()
+	clearTestFile()
+	defer clearTestFile()
+
+	fs := &FileStorage{FileStoragePath: testFilePath}
+	_ = fs.Save(ctx, DataStorageRow{ShortURL: "abc", URL: "http://example.com"})
+	_ = fs.Save(ctx, DataStorageRow{ShortURL: "xyz", URL: "http://example.org"})
+	_, _ = fs.DisableURL(ctx, "xyz", "spam")
+
+	assert.NoError(t, fs.SaveLinkHealth(ctx, "abc", LinkHealth{Status: 500, Failures: 1}))
+	assert.NoError(t, fs.SaveLinkHealth(ctx, "abc", LinkHealth{Status: 500, Failures: 2, Dead: true}))
+
+	targets, err := fs.GetHealthTargets(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, targets, 1, "disabled links should not be checked")
+	assert.Equal(t, "http://example.com", targets[0].URL)
+	assert.Equal(t, 2, targets[0].Health.Failures, "the latest health record should win")
+	assert.True(t, targets[0].Health.Dead)
+
+	// Служебные записи не учитываются как URL
+	assert.Equal(t, 2, fs.GetURLCount(ctx))
+}
@@ -1,12 +1,17 @@
 package storage
 
 import (
+	"context"
+	"fmt"
 	"github.com/stretchr/testify/assert"
+	"sync"
+	"sync/atomic"
 	"testing"
 )
 
 func TestInMemoryStorage(t *testing.T) {
-	storage := &InMemoryStorage{Urls: make(map[string]string)}
+	ctx := context.Background()
+	storage := &InMemoryStorage{}
 
 	// Тестируем Init
 	err := storage.Init("")
@@ -17,28 +22,43 @@ func TestInMemoryStorage(t *testing.T) {
 	url := "http://example.com"
 	userID := "user123"
 
-	err = storage.Save(shortURL, url, userID)
+	err = storage.Save(ctx, DataStorageRow{ShortURL: shortURL, URL: url, UserID: userID, Domain: "go.example.com"})
 	assert.NoError(t, err, "Save should not return an error")
 
-	// Проверяем, что URL сохранен
-	assert.Equal(t, url, storage.Urls[shortURL], "Saved URL should match")
+	// Проверяем, что повторное сохранение URL или короткого URL завершается ошибкой, как в базе данных
+	assert.Error(t, storage.Save(ctx, DataStorageRow{ShortURL: shortURL, URL: "http://other.com"}))
+	assert.Error(t, storage.Save(ctx, DataStorageRow{ShortURL: "other", URL: url}))
 
 	// Тестим GetURL
-	getURLRow, ok := storage.GetURL(shortURL)
-	assert.True(t, ok, "GetURL should return true")
+	getURLRow, err := storage.GetURL(ctx, shortURL)
+	assert.NoError(t, err, "GetURL should return true")
 	assert.Equal(t, url, getURLRow.URL, "GetURL should return the correct URL")
+	assert.Equal(t, "go.example.com", getURLRow.Domain, "GetURL should return the link domain")
+
+	// Тестируем UpdateUserURLDevices
+	deviceURLs := DeviceURLs{IOSURL: "https://apps.apple.com/app/id1"}
+	found, err := storage.UpdateUserURLDevices(ctx, "another", shortURL, deviceURLs)
+	assert.NoError(t, err)
+	assert.False(t, found, "UpdateUserURLDevices should not update a link of another user")
+
+	found, err = storage.UpdateUserURLDevices(ctx, userID, shortURL, deviceURLs)
+	assert.NoError(t, err)
+	assert.True(t, found, "UpdateUserURLDevices should update the user link")
+
+	getURLRow, _ = storage.GetURL(ctx, shortURL)
+	assert.Equal(t, deviceURLs, getURLRow.DeviceURLs, "GetURL should return device URLs")
 
 	// Тестим GetShortURL
-	retrievedShortURL, err := storage.GetShortURL(url)
+	retrievedShortURL, err := storage.GetShortURL(ctx, url)
 	assert.NoError(t, err, "GetShortURL should not return an error")
 	assert.Equal(t, shortURL, retrievedShortURL, "GetShortURL should return the correct short URL")
 
 	// Проверка на несуществующий URL
-	_, err = storage.GetShortURL("http://nonexistent.com")
+	_, err = storage.GetShortURL(ctx, "http://nonexistent.com")
 	assert.Error(t, err, "Expected error for nonexistent URL")
 
 	// Тестим GetURLCount
-	count := storage.GetURLCount()
+	count := storage.GetURLCount(ctx)
 	assert.Equal(t, 1, count, "Expected URL count to be 1")
 
 	// Тестим SaveBatch
@@ -46,23 +66,208 @@ func TestInMemoryStorage(t *testing.T) {
 		{ShortURL: "short.ly/abc", URL: "http://example2.com"},
 		{ShortURL: "short.ly/def", URL: "http://example3.com"},
 	}
-	err = storage.SaveBatch(dataRows)
+	err = storage.SaveBatch(ctx, dataRows)
 	assert.NoError(t, err, "SaveBatch should not return an error")
 
 	// Проверяем сохранение нескольких URL
 	for _, row := range dataRows {
-		assert.Equal(t, row.URL, storage.Urls[row.ShortURL], "Expected saved URL to match")
+		getURLRow, err := storage.GetURL(ctx, row.ShortURL)
+		assert.NoError(t, err, "Expected batch URL to be saved")
+		assert.Equal(t, row.URL, getURLRow.URL, "Expected saved URL to match")
 	}
 
 	// Тестим LoadData
-	loadedData, err := storage.LoadData()
+	loadedData, err := storage.LoadData(ctx)
 	assert.NoError(t, err, "LoadData should not return an error")
-	assert.Empty(t, loadedData, "Expected loaded data length to be 0")
+	if assert.Len(t, loadedData, 3, "Expected all saved URLs to be loaded") {
+		assert.Equal(t, "short.ly/xyz", loadedData[0].ShortURL)
+		assert.Equal(t, "user123", loadedData[0].UserID)
+		assert.Equal(t, "short.ly/def", loadedData[2].ShortURL)
+	}
 
 	// Тестирование Ping
-	assert.True(t, storage.Ping(), "Expected Ping to return true")
+	assert.True(t, storage.Ping(ctx), "Expected Ping to return true")
 
 	_ = storage.Set("shortURL", "longURL")
-	url, _ = storage.GetShortURL("longURL")
+	url, _ = storage.GetShortURL(ctx, "longURL")
 	assert.Equal(t, "shortURL", url)
 }
+
+func TestInMemoryStorage_RecordSplitClick(t *testing.T) {
+	ctx := context.Background()
+	storage := &InMemoryStorage{}
+	_ = storage.Save(ctx, DataStorageRow{
+		ShortURL: "split",
+		URL:      "http://example.com",
+		Splits:   []SplitDestination{{URL: "http://a.example.com", Weight: 1}},
+	})
+
+	assert.NoError(t, storage.RecordSplitClick(ctx, "split", 0))
+	assert.NoError(t, storage.RecordSplitClick(ctx, "split", 3), "RecordSplitClick should ignore unknown variants")
+
+	getURLRow, _ := storage.GetURL(ctx, "split")
+	assert.Equal(t, 1, getURLRow.Splits[0].Clicks, "RecordSplitClick should count the click")
+}
+
+func TestInMemoryStorage_RedeemClick(t *testing.T) {
+	ctx := context.Background()
+	storage := &InMemoryStorage{}
+	_ = storage.Save(ctx, DataStorageRow{ShortURL: "limited", URL: "http://example.com", MaxClicks: 3})
+
+	var redeemedCount atomic.Int32
+	var wg sync.WaitGroup
+
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			if _, redeemed, err := storage.RedeemClick(ctx, "limited"); err == nil && redeemed {
+				redeemedCount.Add(1)
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	assert.Equal(t, int32(3), redeemedCount.Load(), "RedeemClick should not exceed the click limit")
+
+	getURLRow, _ := storage.GetURL(ctx, "limited")
+	assert.Equal(t, 3, getURLRow.Clicks, "GetURL should return redeemed clicks")
+}
+
+func TestInMemoryStorage_Users(t *testing.T) {
+	ctx := context.Background()
+	storage := &InMemoryStorage{}
+
+	assert.False(t, storage.IsUserExist(ctx, "user1"))
+	assert.NoError(t, storage.SaveUser(ctx, "user1"))
+	assert.Error(t, storage.SaveUser(ctx, "user1"), "SaveUser should reject duplicate users")
+	assert.True(t, storage.IsUserExist(ctx, "user1"))
+
+	assert.NoError(t, storage.BanUser(ctx, "user2"))
+	assert.True(t, storage.IsUserExist(ctx, "user2"), "BanUser should create unknown users")
+	assert.Equal(t, 2, storage.GetUsersCount(ctx))
+
+	_ = storage.Save(ctx, DataStorageRow{ShortURL: "abc", URL: "http://a.example.com", UserID: "user1"})
+	_ = storage.Save(ctx, DataStorageRow{ShortURL: "def", URL: "http://b.example.com", UserID: "user1"})
+	_ = storage.Save(ctx, DataStorageRow{ShortURL: "ghi", URL: "http://c.example.com", UserID: "user2"})
+	_ = storage.SaveLinkHealth(ctx, "abc", LinkHealth{Status: 200})
+
+	urls, err := storage.GetUserUrls(ctx, "user1")
+	assert.NoError(t, err)
+	assert.Len(t, urls, 2)
+	assert.Equal(t, "abc", urls[0].ShortURL, "GetUserUrls should return links in creation order")
+	assert.Equal(t, 200, urls[0].Health.Status)
+
+	assert.NoError(t, storage.DeleteUserUrls(ctx, "user1", []string{"def", "ghi"}))
+
+	urls, _ = storage.GetUserUrls(ctx, "user1")
+	assert.Len(t, urls, 1, "deleted links should not be listed")
+
+	getURLRow, err := storage.GetURL(ctx, "def")
+	assert.NoError(t, err, "deleted links should still be found")
+	assert.True(t, getURLRow.IsDeleted)
+
+	getURLRow, _ = storage.GetURL(ctx, "ghi")
+	assert.False(t, getURLRow.IsDeleted, "links of another user should not be deleted")
+
+	found, _ := storage.UpdateUserURLActivation(ctx, "user1", "def", nil)
+	assert.False(t, found, "deleted links should not be updated")
+	assert.Equal(t, 3, storage.GetURLCount(ctx), "deleted links should be counted")
+
+	found, _ = storage.ReassignURL(ctx, "ghi", "user1")
+	assert.True(t, found)
+
+	urls, _ = storage.GetUserUrls(ctx, "user1")
+	assert.Len(t, urls, 2)
+	urls, _ = storage.GetUserUrls(ctx, "user2")
+	assert.Empty(t, urls, "reassigned links should be removed from the previous owner")
+}
+
+func TestInMemoryStorage_SaveBatchConflicts(t *testing.T) {
+	ctx := context.Background()
+	storage := &InMemoryStorage{}
+	_ = storage.Save(ctx, DataStorageRow{ShortURL: "abc", URL: "http://a.example.com"})
+
+	err := storage.SaveBatch(ctx, []DataStorageRow{
+		{ShortURL: "abc", URL: "http://a.example.com"},
+		{ShortURL: "def", URL: "http://b.example.com"},
+	})
+	assert.NoError(t, err, "already saved pairs should be skipped")
+	assert.Equal(t, 2, storage.GetURLCount(ctx))
+
+	err = storage.SaveBatch(ctx, []DataStorageRow{
+		{ShortURL: "ghi", URL: "http://c.example.com"},
+		{ShortURL: "jkl", URL: "http://a.example.com"},
+	})
+	assert.ErrorIs(t, err, ErrConflict, "conflicting URLs should fail the batch")
+
+	_, err = storage.GetURL(ctx, "ghi")
+	assert.ErrorIs(t, err, ErrNotFound, "failed batch should not be saved partially")
+}
+
+func TestInMemoryStorage_Concurrent(t *testing.T) {
+	ctx := context.Background()
+	storage := &InMemoryStorage{}
+	var wg sync.WaitGroup
+
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+
+		go func(i int) {
+			defer wg.Done()
+
+			shortURL := fmt.Sprintf("short%d", i)
+			userID := fmt.Sprintf("user%d", i%5)
+
+			_ = storage.Save(ctx, DataStorageRow{ShortURL: shortURL, URL: "http://example.com/" + shortURL, UserID: userID})
+			_, _ = storage.GetURL(ctx, shortURL)
+			_, _ = storage.GetShortURL(ctx, "http://example.com/"+shortURL)
+			_, _ = storage.GetUserUrls(ctx, userID)
+			_ = storage.DeleteUserUrls(ctx, userID, []string{shortURL})
+			_, _ = storage.SearchUrls(ctx, URLSearchFilter{})
+		}(i)
+	}
+
+	wg.Wait()
+
+	assert.Equal(t, 50, storage.GetURLCount(ctx))
+}
+
+func TestInMemoryStorage_InsertOrGet(t *testing.T) {
+	ctx := context.Background()
+	storage := &InMemoryStorage{}
+	var created int32
+	var wg sync.WaitGroup
+
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+
+		go func(i int) {
+			defer wg.Done()
+
+			row := DataStorageRow{ShortURL: fmt.Sprintf("short%d", i), URL: "http://example.com", UserID: "user1"}
+			stored, ok, err := storage.InsertOrGet(ctx, row)
+			assert.NoError(t, err)
+
+			if ok {
+				atomic.AddInt32(&created, 1)
+			} else {
+				assert.NotEqual(t, row.ShortURL, stored.ShortURL, "Existing link should be returned")
+			}
+		}(i)
+	}
+
+	wg.Wait()
+
+	assert.Equal(t, int32(1), created, "Concurrent requests for one URL should create one link")
+	assert.Equal(t, 1, storage.GetURLCount(ctx))
+
+	shortURL, err := storage.GetShortURL(ctx, "http://example.com")
+	assert.NoError(t, err)
+
+	_, _, err = storage.InsertOrGet(ctx, DataStorageRow{ShortURL: shortURL, URL: "http://example.org"})
+	assert.ErrorIs(t, err, ErrConflict, "Taken short URL should be reported as a conflict")
+}
@@ -1,18 +1,238 @@
 package storage
 
+import (
+	"context"
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+
+	"github.com/jackc/pgx/v4"
+)
+
 const tableName = "urls"
 
-// URL представляет структуру таблицы urls.
-type URL struct {
-	ID        uint   `gorm:"primaryKey"`
-	URL       string `gorm:"uniqueIndex;size:100"`
-	ShortURL  string `gorm:"uniqueIndex;size:100"`
-	UserID    string `gorm:"size:100"`
-	IsDeleted bool   `gorm:"default:false"`
+// migrationLockKey — ключ advisory lock, под которым применяются миграции.
+// Он не даёт нескольким экземплярам сервиса менять схему одновременно.
+const migrationLockKey int64 = 7_020_463_120_104_311
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// migrationFileName описывает имя файла миграции: <версия>_<название>.<up|down>.sql.
+var migrationFileName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// Migration представляет версию схемы базы данных.
+type Migration struct {
+	Version int    // Номер версии, миграции применяются в порядке возрастания
+	Name    string // Название миграции из имени файла
+	Up      string // SQL применения миграции
+	Down    string // SQL отката миграции
+}
+
+// loadMigrations читает миграции из директории dir и упорядочивает их по версии.
+// Каждая версия должна иметь файлы применения и отката.
+func loadMigrations(fsys fs.FS, dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+
+	if err != nil {
+		return nil, err
+	}
+
+	migrations := make(map[int]*Migration)
+
+	for _, entry := range entries {
+		matches := migrationFileName.FindStringSubmatch(entry.Name())
+
+		if entry.IsDir() || matches == nil {
+			return nil, fmt.Errorf("unexpected migration file %q", entry.Name())
+		}
+
+		version, _ := strconv.Atoi(matches[1])
+		data, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+
+		if err != nil {
+			return nil, err
+		}
+
+		migration, ok := migrations[version]
+
+		if !ok {
+			migration = &Migration{Version: version, Name: matches[2]}
+			migrations[version] = migration
+		} else if migration.Name != matches[2] {
+			return nil, fmt.Errorf("migration %d has different names %q and %q", version, migration.Name, matches[2])
+		}
+
+		if matches[3] == "up" {
+			migration.Up = string(data)
+		} else {
+			migration.Down = string(data)
+		}
+	}
+
+	result := make([]Migration, 0, len(migrations))
+
+	for _, migration := range migrations {
+		if migration.Up == "" || migration.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s must have both up and down files", migration.Version, migration.Name)
+		}
+
+		result = append(result, *migration)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Version < result[j].Version
+	})
+
+	return result, nil
+}
+
+// schemaMigrations возвращает миграции хранилища: заданные явно или встроенные в сервис.
+func (ds *DefaultStorage) schemaMigrations() ([]Migration, error) {
+	if ds.migrations != nil {
+		return ds.migrations, nil
+	}
+
+	return loadMigrations(migrationFiles, "migrations")
+}
+
+// MigrateUp применяет все ещё не применённые миграции в одной транзакции
+// и возвращает их версии. При ошибке схема остаётся в исходном состоянии.
+func (ds *DefaultStorage) MigrateUp(ctx context.Context) ([]int, error) {
+	migrations, err := ds.schemaMigrations()
+
+	if err != nil {
+		return nil, err
+	}
+
+	var applied []int
+
+	err = ds.inMigrationTx(ctx, func(tx pgx.Tx, versions map[int]bool) error {
+		for _, migration := range migrations {
+			if versions[migration.Version] {
+				continue
+			}
+
+			if _, err := tx.Exec(ctx, migration.Up); err != nil {
+				return fmt.Errorf("apply migration %d_%s: %w", migration.Version, migration.Name, err)
+			}
+
+			if _, err := tx.Exec(ctx, "INSERT INTO schema_migrations (version, name) VALUES ($1, $2)",
+				migration.Version, migration.Name); err != nil {
+				return err
+			}
+
+			applied = append(applied, migration.Version)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return applied, nil
+}
+
+// MigrateDown откатывает steps последних применённых миграций в одной транзакции
+// и возвращает их версии в порядке отката.
+func (ds *DefaultStorage) MigrateDown(ctx context.Context, steps int) ([]int, error) {
+	migrations, err := ds.schemaMigrations()
+
+	if err != nil {
+		return nil, err
+	}
+
+	var reverted []int
+
+	err = ds.inMigrationTx(ctx, func(tx pgx.Tx, versions map[int]bool) error {
+		for i := len(migrations) - 1; i >= 0 && len(reverted) < steps; i-- {
+			migration := migrations[i]
+
+			if !versions[migration.Version] {
+				continue
+			}
+
+			if _, err := tx.Exec(ctx, migration.Down); err != nil {
+				return fmt.Errorf("revert migration %d_%s: %w", migration.Version, migration.Name, err)
+			}
+
+			if _, err := tx.Exec(ctx, "DELETE FROM schema_migrations WHERE version = $1", migration.Version); err != nil {
+				return err
+			}
+
+			reverted = append(reverted, migration.Version)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return reverted, nil
 }
 
-// UserCookie представляет структуру таблицы users_cookie.
-type UserCookie struct {
-	ID     uint   `gorm:"primaryKey"`
-	UserID string `gorm:"uniqueIndex;size:100"`
+// inMigrationTx выполняет изменение схемы в транзакции под advisory lock.
+// Функции передаются версии уже применённых миграций.
+func (ds *DefaultStorage) inMigrationTx(
+	ctx context.Context, migrate func(tx pgx.Tx, versions map[int]bool) error) error {
+	tx, err := ds.conn.Begin(ctx)
+
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback(ctx)
+
+	if _, err = tx.Exec(ctx, "SELECT pg_advisory_xact_lock($1)", migrationLockKey); err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		name VARCHAR(255) NOT NULL,
+		applied_at TIMESTAMP NOT NULL DEFAULT NOW()
+	)`)
+
+	if err != nil {
+		return err
+	}
+
+	rows, err := tx.Query(ctx, "SELECT version FROM schema_migrations")
+
+	if err != nil {
+		return err
+	}
+
+	versions := make(map[int]bool)
+
+	for rows.Next() {
+		var version int
+
+		if err = rows.Scan(&version); err != nil {
+			rows.Close()
+			return err
+		}
+
+		versions[version] = true
+	}
+
+	rows.Close()
+
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	if err = migrate(tx, versions); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
 }
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS users_cookie;
+DROP TABLE IF EXISTS urls;
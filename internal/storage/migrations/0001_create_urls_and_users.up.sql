@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS urls (
+	id SERIAL PRIMARY KEY,
+	url VARCHAR(100) UNIQUE,
+	short_url VARCHAR(100) UNIQUE,
+	user_id VARCHAR(100),
+	is_deleted BOOLEAN DEFAULT FALSE,
+	UNIQUE (url, short_url)
+);
+
+CREATE TABLE IF NOT EXISTS users_cookie (
+	id SERIAL PRIMARY KEY,
+	user_id VARCHAR(100) UNIQUE
+);
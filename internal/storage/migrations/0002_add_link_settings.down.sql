@@ -0,0 +1,12 @@
+ALTER TABLE users_cookie DROP COLUMN IF EXISTS is_banned;
+ALTER TABLE urls DROP COLUMN IF EXISTS metadata;
+ALTER TABLE urls DROP COLUMN IF EXISTS health;
+ALTER TABLE urls DROP COLUMN IF EXISTS clicks;
+ALTER TABLE urls DROP COLUMN IF EXISTS max_clicks;
+ALTER TABLE urls DROP COLUMN IF EXISTS active_from;
+ALTER TABLE urls DROP COLUMN IF EXISTS sticky_split;
+ALTER TABLE urls DROP COLUMN IF EXISTS splits;
+ALTER TABLE urls DROP COLUMN IF EXISTS android_url;
+ALTER TABLE urls DROP COLUMN IF EXISTS ios_url;
+ALTER TABLE urls DROP COLUMN IF EXISTS domain;
+ALTER TABLE urls DROP COLUMN IF EXISTS disabled_reason;
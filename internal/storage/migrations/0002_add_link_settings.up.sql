@@ -0,0 +1,12 @@
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS disabled_reason TEXT NOT NULL DEFAULT '';
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS domain VARCHAR(255) NOT NULL DEFAULT '';
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS ios_url TEXT NOT NULL DEFAULT '';
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS android_url TEXT NOT NULL DEFAULT '';
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS splits JSONB NOT NULL DEFAULT '[]';
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS sticky_split BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS active_from TIMESTAMPTZ;
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS max_clicks INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS clicks INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS health JSONB;
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS metadata JSONB;
+ALTER TABLE users_cookie ADD COLUMN IF NOT EXISTS is_banned BOOLEAN NOT NULL DEFAULT FALSE;
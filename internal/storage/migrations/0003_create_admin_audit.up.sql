@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS admin_audit (
+	id SERIAL PRIMARY KEY,
+	action VARCHAR(50) NOT NULL,
+	target VARCHAR(100) NOT NULL,
+	details TEXT NOT NULL DEFAULT '',
+	actor VARCHAR(100) NOT NULL DEFAULT '',
+	created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
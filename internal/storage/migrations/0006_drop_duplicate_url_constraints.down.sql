@@ -0,0 +1,2 @@
+-- Удалённые повторяющиеся ограничения не восстанавливаются.
+SELECT 1;
@@ -0,0 +1,13 @@
+-- До появления миграций каждый запуск сервиса добавлял ограничение UNIQUE (url, short_url)
+-- с новым именем urls_url_short_url_key1, urls_url_short_url_key2 и т. д. Оставляем только первое.
+DO $$
+DECLARE
+	constraint_name TEXT;
+BEGIN
+	FOR constraint_name IN
+		SELECT conname FROM pg_constraint
+		WHERE conrelid = 'urls'::regclass AND contype = 'u' AND conname ~ '^urls_url_short_url_key[0-9]+$'
+	LOOP
+		EXECUTE format('ALTER TABLE urls DROP CONSTRAINT %I', constraint_name);
+	END LOOP;
+END $$;
@@ -0,0 +1,8 @@
+-- Индекс оригинальных URL шардированного хранилища. Ссылка хранится на шарде своего короткого URL,
+-- а запись индекса — на шарде, выбранном по хешу оригинального URL. Таблица создаётся на всех шардах
+-- и не используется хранилищем с одной базой данных.
+CREATE TABLE IF NOT EXISTS url_shards (
+	url TEXT PRIMARY KEY,
+	short_url TEXT NOT NULL,
+	claimed_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
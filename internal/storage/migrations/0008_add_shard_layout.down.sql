@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS shard_layout;
+ALTER TABLE urls DROP COLUMN IF EXISTS created_at;
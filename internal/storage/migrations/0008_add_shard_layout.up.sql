@@ -0,0 +1,13 @@
+-- Время создания ссылки задаёт общий порядок ссылок всех шардов. Ссылкам, созданным до миграции,
+-- назначается время её применения, порядок между ними определяется шардом и идентификатором.
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS created_at TIMESTAMPTZ NOT NULL DEFAULT now();
+
+-- Положение базы данных в шардированном хранилище: номер шарда и количество шардов, для которых
+-- размещены её данные. Таблица содержит не более одной строки и не используется хранилищем
+-- с одной базой данных.
+CREATE TABLE IF NOT EXISTS shard_layout (
+	singleton BOOLEAN PRIMARY KEY DEFAULT TRUE CHECK (singleton),
+	shard_index INTEGER NOT NULL,
+	shard_count INTEGER NOT NULL,
+	updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
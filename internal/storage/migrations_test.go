@@ -0,0 +1,128 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"testing/fstest"
+
+	"github.com/pashagolub/pgxmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadMigrations_Embedded(t *testing.T) {
+	migrations, err := loadMigrations(migrationFiles, "migrations")
+
+	require.NoError(t, err)
+	require.NotEmpty(t, migrations)
+
+	for i, migration := range migrations {
+		assert.Equal(t, i+1, migration.Version, "Migration versions should be sequential")
+		assert.NotEmpty(t, migration.Up)
+		assert.NotEmpty(t, migration.Down)
+	}
+}
+
+func TestLoadMigrations_Invalid(t *testing.T) {
+	_, err := loadMigrations(fstest.MapFS{
+		"migrations/0001_init.up.sql": {Data: []byte("CREATE TABLE a ();")},
+	}, "migrations")
+	assert.Error(t, err, "Migration without down file should be rejected")
+
+	_, err = loadMigrations(fstest.MapFS{
+		"migrations/init.sql": {Data: []byte("CREATE TABLE a ();")},
+	}, "migrations")
+	assert.Error(t, err, "Migration without version should be rejected")
+}
+
+// expectMigrationTx задаёт ожидания начала транзакции миграций с уже применёнными версиями.
+func expectMigrationTx(mock pgxmock.PgxPoolIface, versions ...int) {
+	rows := pgxmock.NewRows([]string{"version"})
+
+	for _, version := range versions {
+		rows.AddRow(version)
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`SELECT pg_advisory_xact_lock\(\$1\)`).
+		WithArgs(migrationLockKey).
+		WillReturnResult(pgxmock.NewResult("SELECT", 1))
+	mock.ExpectExec("CREATE TABLE IF NOT EXISTS schema_migrations").
+		WillReturnResult(pgxmock.NewResult("CREATE TABLE", 0))
+	mock.ExpectQuery("SELECT version FROM schema_migrations").WillReturnRows(rows)
+}
+
+func testMigrations() []Migration {
+	return []Migration{
+		{Version: 1, Name: "create_a", Up: "CREATE TABLE a", Down: "DROP TABLE a"},
+		{Version: 2, Name: "create_b", Up: "CREATE TABLE b", Down: "DROP TABLE b"},
+	}
+}
+
+func TestDefaultStorage_MigrateUp(t *testing.T) {
+	ctx := context.Background()
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+
+	ds := &DefaultStorage{conn: mock, migrations: testMigrations()}
+
+	expectMigrationTx(mock, 1)
+	mock.ExpectExec("CREATE TABLE b").WillReturnResult(pgxmock.NewResult("CREATE TABLE", 0))
+	mock.ExpectExec(`INSERT INTO schema_migrations \(version, name\) VALUES \(\$1, \$2\)`).
+		WithArgs(2, "create_b").
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	mock.ExpectCommit()
+
+	applied, err := ds.MigrateUp(ctx)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []int{2}, applied, "Only pending migrations should be applied")
+	assert.NoError(t, mock.ExpectationsWereMet(), "There should be no unfulfilled expectations")
+}
+
+func TestDefaultStorage_MigrateUpRollsBackOnError(t *testing.T) {
+	ctx := context.Background()
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+
+	ds := &DefaultStorage{conn: mock, migrations: testMigrations()}
+
+	expectMigrationTx(mock)
+	mock.ExpectExec("CREATE TABLE a").WillReturnResult(pgxmock.NewResult("CREATE TABLE", 0))
+	mock.ExpectExec("INSERT INTO schema_migrations").
+		WithArgs(1, "create_a").
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+	mock.ExpectExec("CREATE TABLE b").WillReturnError(errors.New("syntax error"))
+	mock.ExpectRollback()
+
+	applied, err := ds.MigrateUp(ctx)
+
+	assert.ErrorContains(t, err, "apply migration 2_create_b")
+	assert.Empty(t, applied)
+	assert.NoError(t, mock.ExpectationsWereMet(), "There should be no unfulfilled expectations")
+}
+
+func TestDefaultStorage_MigrateDown(t *testing.T) {
+	ctx := context.Background()
+	mock, err := pgxmock.NewPool()
+	require.NoError(t, err)
+	defer mock.Close()
+
+	ds := &DefaultStorage{conn: mock, migrations: testMigrations()}
+
+	expectMigrationTx(mock, 1, 2)
+	mock.ExpectExec("DROP TABLE b").WillReturnResult(pgxmock.NewResult("DROP TABLE", 0))
+	mock.ExpectExec(`DELETE FROM schema_migrations WHERE version = \$1`).
+		WithArgs(2).
+		WillReturnResult(pgxmock.NewResult("DELETE", 1))
+	mock.ExpectCommit()
+
+	reverted, err := ds.MigrateDown(ctx, 1)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []int{2}, reverted, "Only the latest migration should be reverted")
+	assert.NoError(t, mock.ExpectationsWereMet(), "There should be no unfulfilled expectations")
+}
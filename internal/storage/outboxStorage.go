@@ -0,0 +1,177 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// Типы событий, записываемых в outbox.
+const (
+	OutboxLinkCreated = "link.created"
+	OutboxLinkDeleted = "link.deleted"
+)
+
+// OutboxStorageInterface определяет методы чтения событий outbox для их публикации.
+type OutboxStorageInterface interface {
+	// ProcessEvents передает в функцию publish неотправленные события в порядке их записи
+	// и помечает их отправленными, если publish завершилась без ошибки.
+	// Возвращает количество отправленных событий.
+	ProcessEvents(ctx context.Context, limit int, publish func(events []OutboxEvent) error) (int, error)
+}
+
+// OutboxEvent представляет событие изменения ссылки, записанное в outbox
+// в одной транзакции с самим изменением.
+type OutboxEvent struct {
+	ID          int64           `json:"id"`           // Порядковый номер события
+	EventType   string          `json:"event_type"`   // Тип события
+	AggregateID string          `json:"aggregate_id"` // Короткий URL, к которому относится событие
+	Payload     json.RawMessage `json:"payload"`      // Данные события в формате JSON
+	CreatedAt   time.Time       `json:"created_at"`   // Время записи события
+}
+
+// OutboxStorage предоставляет реализацию чтения outbox в базе данных.
+type OutboxStorage struct {
+	// conn представляет соединение с базой данных, предоставляющее доступ к методам SQL.
+	conn DBConnectionInterface
+}
+
+// SetConnection устанавливает объект подключения к бд
+func (obs *OutboxStorage) SetConnection(conn DBConnectionInterface) {
+	obs.conn = conn
+}
+
+// Init инициализирует соединение с базой данных по заданной строке подключения.
+func (obs *OutboxStorage) Init(connectionString string) error {
+	pool, err := NewPool(context.Background(), connectionString, PoolConfig{})
+
+	if err != nil {
+		return err
+	}
+
+	obs.SetConnection(pool)
+
+	return nil
+}
+
+// Close закрывает соединение с базой данных.
+func (obs *OutboxStorage) Close() {
+	obs.conn.Close()
+}
+
+// ProcessEvents выбирает неотправленные события с блокировкой строк, передает их в publish
+// и помечает отправленными в той же транзакции. Блокировка с SKIP LOCKED позволяет
+// нескольким экземплярам сервиса публиковать события без повторов.
+// Если publish вернула ошибку, транзакция откатывается и события будут выбраны повторно.
+func (obs *OutboxStorage) ProcessEvents(
+	ctx context.Context, limit int, publish func(events []OutboxEvent) error) (int, error) {
+	tx, err := obs.conn.Begin(ctx)
+
+	if err != nil {
+		return 0, wrapError(err)
+	}
+
+	defer tx.Rollback(ctx)
+
+	events, err := obs.lockEvents(ctx, tx, limit)
+
+	if err != nil || len(events) == 0 {
+		return 0, wrapError(err)
+	}
+
+	if err = publish(events); err != nil {
+		return 0, err
+	}
+
+	ids := make([]int64, 0, len(events))
+
+	for _, event := range events {
+		ids = append(ids, event.ID)
+	}
+
+	if _, err = tx.Exec(ctx, "UPDATE outbox SET sent_at = NOW() WHERE id = ANY($1)", ids); err != nil {
+		return 0, wrapError(err)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return 0, wrapError(err)
+	}
+
+	return len(events), nil
+}
+
+// lockEvents выбирает и блокирует неотправленные события в порядке их записи.
+func (obs *OutboxStorage) lockEvents(ctx context.Context, tx pgx.Tx, limit int) ([]OutboxEvent, error) {
+	rows, err := tx.Query(ctx, `SELECT id, event_type, aggregate_id, payload, created_at FROM outbox
+	WHERE sent_at IS NULL ORDER BY id LIMIT $1 FOR UPDATE SKIP LOCKED`, limit)
+
+	if err != nil {
+		return nil, wrapError(err)
+	}
+
+	defer rows.Close()
+
+	var events []OutboxEvent
+
+	for rows.Next() {
+		var event OutboxEvent
+		var payload string
+
+		if err := rows.Scan(&event.ID, &event.EventType, &event.AggregateID, &payload, &event.CreatedAt); err != nil {
+			return nil, wrapError(err)
+		}
+
+		event.Payload = json.RawMessage(payload)
+		events = append(events, event)
+	}
+
+	return events, wrapError(rows.Err())
+}
+
+// withOutbox дополняет изменяющий ссылки запрос записью событий в outbox.
+// Запрос changeSQL должен быть INSERT или UPDATE таблицы urls без RETURNING.
+// Событие записывается только для действительно изменённых строк и в том же запросе,
+// поэтому оно не может появиться без изменения или потеряться при его фиксации.
+func withOutbox(changeSQL string, eventType string) string {
+	return fmt.Sprintf(`WITH changed AS (%s RETURNING short_url, url, user_id, domain)
+	%s`, changeSQL, outboxInsert("changed", eventType))
+}
+
+// outboxInsert возвращает запрос записи в outbox событий для строк ссылок из source.
+// source — имя общего табличного выражения со столбцами short_url, url, user_id и domain, возможно с условием.
+func outboxInsert(source string, eventType string) string {
+	return fmt.Sprintf(`INSERT INTO outbox (event_type, aggregate_id, payload)
+	SELECT '%s', short_url, json_build_object(
+		'short_key', short_url, 'original_url', url, 'user_id', COALESCE(user_id, ''), 'domain', domain)
+	FROM %s`, eventType, source)
+}
+
+// sendBatchInTx выполняет пакет запросов в одной транзакции.
+// Если хотя бы один запрос завершился ошибкой, изменения всего пакета откатываются.
+func sendBatchInTx(ctx context.Context, conn DBConnectionInterface, batch *pgx.Batch) error {
+	tx, err := conn.Begin(ctx)
+
+	if err != nil {
+		return wrapError(err)
+	}
+
+	defer tx.Rollback(ctx)
+
+	br := tx.SendBatch(ctx, batch)
+
+	for i := 0; i < batch.Len(); i++ {
+		if _, err = br.Exec(); err != nil {
+			br.Close()
+			return wrapError(err)
+		}
+	}
+
+	if err = br.Close(); err != nil {
+		return wrapError(err)
+	}
+
+	return wrapError(tx.Commit(ctx))
+}
@@ -0,0 +1,87 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/pashagolub/pgxmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestURLStorage_SaveWritesOutboxEvent(t *testing.T) {
+	ctx := context.Background()
+	mock, err := pgxmock.NewPool()
+	assert.NoError(t, err)
+	defer mock.Close()
+
+	storage := &URLStorage{conn: mock}
+
+	mock.ExpectExec(`WITH changed AS \(INSERT INTO urls.*RETURNING short_url, url, user_id, domain\)\s+`+
+		`INSERT INTO outbox \(event_type, aggregate_id, payload\)\s+SELECT 'link.created', short_url`).
+		WithArgs("xyz", "http://example.com", "user1", "", "", "", []SplitDestination(nil), false, (*time.Time)(nil), 0).
+		WillReturnResult(pgxmock.NewResult("INSERT", 1))
+
+	err = storage.Save(ctx, DataStorageRow{ShortURL: "xyz", URL: "http://example.com", UserID: "user1"})
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet(), "There should be no unfulfilled expectations")
+}
+
+func TestOutboxStorage_ProcessEvents(t *testing.T) {
+	ctx := context.Background()
+	mock, err := pgxmock.NewPool()
+	assert.NoError(t, err)
+	defer mock.Close()
+
+	storage := &OutboxStorage{conn: mock}
+	createdAt := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT id, event_type, aggregate_id, payload, created_at FROM outbox\s+` +
+		`WHERE sent_at IS NULL ORDER BY id LIMIT \$1 FOR UPDATE SKIP LOCKED`).
+		WithArgs(10).
+		WillReturnRows(pgxmock.NewRows([]string{"id", "event_type", "aggregate_id", "payload", "created_at"}).
+			AddRow(int64(1), OutboxLinkCreated, "abc", `{"short_key":"abc"}`, createdAt).
+			AddRow(int64(2), OutboxLinkDeleted, "abc", `{"short_key":"abc"}`, createdAt))
+	mock.ExpectExec(`UPDATE outbox SET sent_at = NOW\(\) WHERE id = ANY\(\$1\)`).
+		WithArgs([]int64{1, 2}).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 2))
+	mock.ExpectCommit()
+
+	var published []OutboxEvent
+	sent, err := storage.ProcessEvents(ctx, 10, func(events []OutboxEvent) error {
+		published = events
+		return nil
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, 2, sent)
+	assert.Len(t, published, 2)
+	assert.JSONEq(t, `{"short_key":"abc"}`, string(published[0].Payload))
+	assert.NoError(t, mock.ExpectationsWereMet(), "There should be no unfulfilled expectations")
+}
+
+func TestOutboxStorage_ProcessEventsPublishError(t *testing.T) {
+	ctx := context.Background()
+	mock, err := pgxmock.NewPool()
+	assert.NoError(t, err)
+	defer mock.Close()
+
+	storage := &OutboxStorage{conn: mock}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT id, event_type, aggregate_id, payload, created_at FROM outbox`).
+		WithArgs(10).
+		WillReturnRows(pgxmock.NewRows([]string{"id", "event_type", "aggregate_id", "payload", "created_at"}).
+			AddRow(int64(1), OutboxLinkCreated, "abc", `{}`, time.Now()))
+	mock.ExpectRollback()
+
+	sent, err := storage.ProcessEvents(ctx, 10, func(events []OutboxEvent) error {
+		return errors.New("sink unavailable")
+	})
+
+	assert.Error(t, err)
+	assert.Equal(t, 0, sent)
+	assert.NoError(t, mock.ExpectationsWereMet(), "events should stay unsent when publishing fails")
+}
@@ -0,0 +1,133 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgconn/stmtcache"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// Режимы кеша подготовленных выражений соединений пула.
+const (
+	// StatementCacheModePrepare подготавливает именованные выражения на сервере.
+	StatementCacheModePrepare = "prepare"
+
+	// StatementCacheModeDescribe кеширует только описание выражений, совместим с PgBouncer в режиме транзакций.
+	StatementCacheModeDescribe = "describe"
+
+	// StatementCacheModeNone отключает кеш подготовленных выражений.
+	StatementCacheModeNone = "none"
+)
+
+// statementCacheCapacity задает количество выражений в кеше каждого соединения.
+const statementCacheCapacity = 512
+
+// defaultConnectRetryBackoff задает паузу перед первой повторной попыткой подключения, если она не указана.
+const defaultConnectRetryBackoff = time.Second
+
+// maxConnectRetryBackoff ограничивает паузу между попытками подключения.
+const maxConnectRetryBackoff = 30 * time.Second
+
+// connectPool создает пул соединений, подменяется в тестах.
+var connectPool = pgxpool.ConnectConfig
+
+// PoolConfig задает параметры пула соединений с базой данных.
+// Нулевые значения оставляют настройки из строки подключения или значения по умолчанию pgx.
+type PoolConfig struct {
+	MaxConns            int32         // Максимальное количество соединений пула
+	MinConns            int32         // Количество соединений, поддерживаемых открытыми
+	MaxConnIdleTime     time.Duration // Время, после которого простаивающее соединение закрывается
+	MaxConnLifetime     time.Duration // Время, после которого соединение пересоздается
+	StatementCacheMode  string        // Режим кеша подготовленных выражений: prepare, describe или none
+	ConnectRetries      int           // Количество повторных попыток подключения при старте
+	ConnectRetryBackoff time.Duration // Пауза перед первой повторной попыткой, удваивается с каждой попыткой
+}
+
+// NewPool создает пул соединений с базой данных, общий для всех хранилищ.
+// Неудачное подключение повторяется ConnectRetries раз с экспоненциально растущей паузой.
+// Возвращает ErrUnavailable, если подключиться так и не удалось.
+func NewPool(ctx context.Context, connectionString string, cfg PoolConfig) (*pgxpool.Pool, error) {
+	poolConfig, err := parsePoolConfig(connectionString, cfg)
+
+	if err != nil {
+		return nil, err
+	}
+
+	backoff := cfg.ConnectRetryBackoff
+
+	if backoff <= 0 {
+		backoff = defaultConnectRetryBackoff
+	}
+
+	for attempt := 0; ; attempt++ {
+		pool, err := connectPool(ctx, poolConfig)
+
+		if err == nil {
+			return pool, nil
+		}
+
+		if attempt >= cfg.ConnectRetries {
+			return nil, unavailable(err)
+		}
+
+		log.Printf("Error while connecting to database, retrying in %s: %v", backoff, err)
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(backoff):
+		}
+
+		backoff = min(backoff*2, maxConnectRetryBackoff)
+	}
+}
+
+// parsePoolConfig разбирает строку подключения и применяет к ней параметры пула.
+func parsePoolConfig(connectionString string, cfg PoolConfig) (*pgxpool.Config, error) {
+	poolConfig, err := pgxpool.ParseConfig(connectionString)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.MaxConns > 0 {
+		poolConfig.MaxConns = cfg.MaxConns
+	}
+
+	if cfg.MinConns > 0 {
+		poolConfig.MinConns = cfg.MinConns
+	}
+
+	if cfg.MaxConnIdleTime > 0 {
+		poolConfig.MaxConnIdleTime = cfg.MaxConnIdleTime
+	}
+
+	if cfg.MaxConnLifetime > 0 {
+		poolConfig.MaxConnLifetime = cfg.MaxConnLifetime
+	}
+
+	switch cfg.StatementCacheMode {
+	case "":
+	case StatementCacheModePrepare:
+		poolConfig.ConnConfig.BuildStatementCache = statementCache(stmtcache.ModePrepare)
+	case StatementCacheModeDescribe:
+		poolConfig.ConnConfig.BuildStatementCache = statementCache(stmtcache.ModeDescribe)
+	case StatementCacheModeNone:
+		poolConfig.ConnConfig.BuildStatementCache = nil
+	default:
+		return nil, fmt.Errorf("unknown statement cache mode %q", cfg.StatementCacheMode)
+	}
+
+	return poolConfig, nil
+}
+
+// statementCache возвращает конструктор кеша подготовленных выражений в заданном режиме.
+func statementCache(mode int) func(conn *pgconn.PgConn) stmtcache.Cache {
+	return func(conn *pgconn.PgConn) stmtcache.Cache {
+		return stmtcache.New(conn, mode, statementCacheCapacity)
+	}
+}
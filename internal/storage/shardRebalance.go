@@ -0,0 +1,466 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrRebalanceRequired указывает, что размещение данных на шардах не соответствует списку шардов:
+// шарды добавлены, удалены или переставлены, либо ссылки сохранены без индекса url_shards.
+// Данные размещаются заново командой shortener-migrate -rebalance.
+var ErrRebalanceRequired = errors.New("shard placement does not match the shard list, run shortener-migrate -rebalance")
+
+// rebalanceBatchSize задает количество ссылок, переносимых между шардами одной транзакцией.
+const rebalanceBatchSize = 1000
+
+// shardLinkColumns перечисляет столбцы ссылки, переносимые между шардами.
+const shardLinkColumns = `url, short_url, user_id, is_deleted, disabled_reason, domain, ios_url, android_url,
+	splits, sticky_split, active_from, max_clicks, clicks, health, metadata, created_at`
+
+// RebalanceResult описывает результат размещения данных на шардах.
+type RebalanceResult struct {
+	URLs       int `json:"urls"`       // Количество ссылок, перенесённых на шард их короткого URL
+	Users      int `json:"users"`      // Количество пользователей, перенесённых на шард их идентификатора
+	Index      int `json:"index"`      // Количество записей индекса, перенесённых на шард оригинального URL
+	Backfilled int `json:"backfilled"` // Количество записей индекса, добавленных для ссылок без записи
+}
+
+// shardLayout описывает сохранённое положение базы данных в шардированном хранилище.
+type shardLayout struct {
+	index   *int // Номер шарда, nil, если положение ещё не сохранено
+	count   *int // Количество шардов
+	hasURLs bool // На шарде есть ссылки
+	indexed bool // На шарде есть записи индекса url_shards
+}
+
+// shardLink содержит все столбцы ссылки для переноса между шардами.
+// JSON столбцы переносятся текстом, чтобы не зависеть от их структуры.
+type shardLink struct {
+	url, shortURL, disabledReason, domain, iosURL, androidURL, splits string
+	userID, health, metadata                                          *string
+	isDeleted, stickySplit                                            bool
+	activeFrom                                                        *time.Time
+	maxClicks, clicks                                                 int
+	createdAt                                                         time.Time
+}
+
+// CheckLayout проверяет, что данные шардов размещены для текущего списка шардов.
+// Возвращает ErrRebalanceRequired, если шард размещён под другим номером или для другого количества
+// шардов, если на шарде без сохранённого положения уже есть ссылки, или если ссылки есть,
+// а индекс url_shards пуст. Шардам без сохранённого положения и без ссылок положение сохраняется.
+func (ss *ShardedStorage) CheckLayout(ctx context.Context) error {
+	layouts := make([]shardLayout, len(ss.shards))
+
+	err := ss.scatter(func(index int, shard *dbShard) error {
+		layout, err := readShardLayout(ctx, shard.conn)
+		layouts[index] = layout
+
+		return err
+	})
+
+	if err != nil {
+		return err
+	}
+
+	hasURLs, indexed := false, false
+
+	for i, layout := range layouts {
+		if layout.index != nil && (*layout.index != i || *layout.count != len(ss.shards)) {
+			return fmt.Errorf("%w: shard %d is placed as shard %d of %d", ErrRebalanceRequired,
+				i, *layout.index, *layout.count)
+		}
+
+		if layout.index == nil && layout.hasURLs {
+			return fmt.Errorf("%w: shard %d has links placed without sharding", ErrRebalanceRequired, i)
+		}
+
+		hasURLs = hasURLs || layout.hasURLs
+		indexed = indexed || layout.indexed
+	}
+
+	if hasURLs && !indexed {
+		return fmt.Errorf("%w: url_shards index is empty", ErrRebalanceRequired)
+	}
+
+	for i, layout := range layouts {
+		if layout.index == nil {
+			if err = ss.writeLayout(ctx, i); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Rebalance размещает данные на шардах текущего списка: переносит записи индекса url_shards,
+// ссылки и пользователей на шарды их ключей, добавляет в индекс ссылки без записи
+// и сохраняет положение каждого шарда. Используется после изменения списка шардов и для баз данных,
+// ссылки которых сохранены без шардирования.
+// Выполняется при остановленном сервисе. Перенос идемпотентен: прерванное размещение
+// продолжается повторным вызовом.
+func (ss *ShardedStorage) Rebalance(ctx context.Context) (RebalanceResult, error) {
+	var result RebalanceResult
+
+	for i := range ss.shards {
+		moved, err := ss.relocateIndex(ctx, i)
+		result.Index += moved
+
+		if err != nil {
+			return result, err
+		}
+	}
+
+	for i := range ss.shards {
+		moved, err := ss.relocateURLs(ctx, i)
+		result.URLs += moved
+
+		if err != nil {
+			return result, err
+		}
+
+		moved, err = ss.relocateUsers(ctx, i)
+		result.Users += moved
+
+		if err != nil {
+			return result, err
+		}
+	}
+
+	for i := range ss.shards {
+		backfilled, err := ss.backfillIndex(ctx, i)
+		result.Backfilled += backfilled
+
+		if err != nil {
+			return result, err
+		}
+	}
+
+	for i := range ss.shards {
+		if err := ss.writeLayout(ctx, i); err != nil {
+			return result, err
+		}
+	}
+
+	return result, nil
+}
+
+// readShardLayout читает сохранённое положение шарда и наличие на нём ссылок и записей индекса.
+func readShardLayout(ctx context.Context, conn DBConnectionInterface) (shardLayout, error) {
+	var layout shardLayout
+
+	rows, err := conn.Query(ctx, `SELECT
+		(SELECT shard_index FROM shard_layout), (SELECT shard_count FROM shard_layout),
+		EXISTS (SELECT 1 FROM urls), EXISTS (SELECT 1 FROM url_shards)`)
+
+	if err != nil {
+		return layout, wrapError(err)
+	}
+
+	defer rows.Close()
+
+	if !rows.Next() {
+		if err = rows.Err(); err == nil {
+			err = ErrNotFound
+		}
+
+		return layout, wrapError(err)
+	}
+
+	err = rows.Scan(&layout.index, &layout.count, &layout.hasURLs, &layout.indexed)
+
+	return layout, wrapError(err)
+}
+
+// writeLayout сохраняет положение шарда для текущего списка шардов.
+func (ss *ShardedStorage) writeLayout(ctx context.Context, index int) error {
+	_, err := ss.shards[index].conn.Exec(ctx, `INSERT INTO shard_layout (shard_index, shard_count) VALUES ($1, $2)
+		ON CONFLICT (singleton) DO UPDATE
+		SET shard_index = EXCLUDED.shard_index, shard_count = EXCLUDED.shard_count, updated_at = now()`,
+		index, len(ss.shards))
+
+	return wrapError(err)
+}
+
+// queryPairs возвращает пары строк, выбранные запросом из двух столбцов.
+func queryPairs(ctx context.Context, conn DBConnectionInterface, query string) ([][2]string, error) {
+	rows, err := conn.Query(ctx, query)
+
+	if err != nil {
+		return nil, wrapError(err)
+	}
+
+	defer rows.Close()
+
+	var pairs [][2]string
+
+	for rows.Next() {
+		var pair [2]string
+
+		if err = rows.Scan(&pair[0], &pair[1]); err != nil {
+			return nil, wrapError(err)
+		}
+
+		pairs = append(pairs, pair)
+	}
+
+	return pairs, wrapError(rows.Err())
+}
+
+// misplaced группирует пары, первый элемент которых принадлежит другому шарду, по номерам этих шардов.
+func (ss *ShardedStorage) misplaced(source int, pairs [][2]string) map[int][][2]string {
+	groups := make(map[int][][2]string)
+
+	for _, pair := range pairs {
+		if target := ss.ring.shard(pair[0]); target != source {
+			groups[target] = append(groups[target], pair)
+		}
+	}
+
+	return groups
+}
+
+// insertIndex добавляет записи индекса url_shards, которых ещё нет на шарде.
+// Возвращает количество добавленных записей.
+func insertIndex(ctx context.Context, conn DBConnectionInterface, pairs [][2]string) (int, error) {
+	urls := make([]string, 0, len(pairs))
+	shortURLs := make([]string, 0, len(pairs))
+
+	for _, pair := range pairs {
+		urls = append(urls, pair[0])
+		shortURLs = append(shortURLs, pair[1])
+	}
+
+	tag, err := conn.Exec(ctx, `INSERT INTO url_shards (url, short_url)
+		SELECT * FROM unnest($1::text[], $2::text[]) ON CONFLICT (url) DO NOTHING`, urls, shortURLs)
+
+	if err != nil {
+		return 0, wrapError(err)
+	}
+
+	return int(tag.RowsAffected()), nil
+}
+
+// relocateIndex переносит записи индекса url_shards шарда source на шарды их оригинальных URL.
+// Возвращает количество перенесённых записей.
+func (ss *ShardedStorage) relocateIndex(ctx context.Context, source int) (int, error) {
+	pairs, err := queryPairs(ctx, ss.shards[source].conn, "SELECT url, short_url FROM url_shards")
+
+	if err != nil {
+		return 0, err
+	}
+
+	moved := 0
+
+	for target, group := range ss.misplaced(source, pairs) {
+		for _, chunk := range chunks(group, rebalanceBatchSize) {
+			if _, err = insertIndex(ctx, ss.shards[target].conn, chunk); err != nil {
+				return moved, err
+			}
+
+			urls := make([]string, 0, len(chunk))
+
+			for _, pair := range chunk {
+				urls = append(urls, pair[0])
+			}
+
+			if _, err = ss.shards[source].conn.Exec(ctx,
+				"DELETE FROM url_shards WHERE url = ANY($1)", urls); err != nil {
+				return moved, wrapError(err)
+			}
+
+			moved += len(chunk)
+		}
+	}
+
+	return moved, nil
+}
+
+// relocateURLs переносит ссылки шарда source на шарды их коротких URL.
+// Ссылка сначала сохраняется на новом шарде и только затем удаляется со старого,
+// поэтому при прерывании переноса ссылка не теряется. Возвращает количество перенесённых ссылок.
+func (ss *ShardedStorage) relocateURLs(ctx context.Context, source int) (int, error) {
+	pairs, err := queryPairs(ctx, ss.shards[source].conn, fmt.Sprintf("SELECT short_url, url FROM %s", tableName))
+
+	if err != nil {
+		return 0, err
+	}
+
+	moved := 0
+
+	for target, group := range ss.misplaced(source, pairs) {
+		for _, chunk := range chunks(group, rebalanceBatchSize) {
+			shortURLs := make([]string, 0, len(chunk))
+
+			for _, pair := range chunk {
+				shortURLs = append(shortURLs, pair[0])
+			}
+
+			links, err := loadShardLinks(ctx, ss.shards[source].conn, shortURLs)
+
+			if err != nil {
+				return moved, err
+			}
+
+			if err = saveShardLinks(ctx, ss.shards[target].conn, links); err != nil {
+				return moved, err
+			}
+
+			if _, err = ss.shards[source].conn.Exec(ctx,
+				fmt.Sprintf("DELETE FROM %s WHERE short_url = ANY($1)", tableName), shortURLs); err != nil {
+				return moved, wrapError(err)
+			}
+
+			moved += len(links)
+		}
+	}
+
+	return moved, nil
+}
+
+// relocateUsers переносит пользователей шарда source на шарды их идентификаторов.
+// Возвращает количество перенесённых пользователей.
+func (ss *ShardedStorage) relocateUsers(ctx context.Context, source int) (int, error) {
+	users, err := ss.shards[source].users.LoadUsers(ctx)
+
+	if err != nil {
+		return 0, err
+	}
+
+	groups := make(map[int][]User)
+
+	for _, user := range users {
+		if target := ss.ring.shard(user.UserID); target != source {
+			groups[target] = append(groups[target], user)
+		}
+	}
+
+	moved := 0
+
+	for target, group := range groups {
+		for _, chunk := range chunks(group, rebalanceBatchSize) {
+			if err = ss.shards[target].users.SaveUsers(ctx, chunk); err != nil {
+				return moved, err
+			}
+
+			userIDs := make([]string, 0, len(chunk))
+
+			for _, user := range chunk {
+				userIDs = append(userIDs, user.UserID)
+			}
+
+			if _, err = ss.shards[source].conn.Exec(ctx,
+				"DELETE FROM users_cookie WHERE user_id = ANY($1)", userIDs); err != nil {
+				return moved, wrapError(err)
+			}
+
+			moved += len(chunk)
+		}
+	}
+
+	return moved, nil
+}
+
+// backfillIndex добавляет в индекс url_shards записи для ссылок шарда source, которых в нём нет.
+// Возвращает количество добавленных записей.
+func (ss *ShardedStorage) backfillIndex(ctx context.Context, source int) (int, error) {
+	pairs, err := queryPairs(ctx, ss.shards[source].conn, fmt.Sprintf("SELECT url, short_url FROM %s", tableName))
+
+	if err != nil {
+		return 0, err
+	}
+
+	groups := make(map[int][][2]string)
+
+	for _, pair := range pairs {
+		index := ss.ring.shard(pair[0])
+		groups[index] = append(groups[index], pair)
+	}
+
+	backfilled := 0
+
+	for index, group := range groups {
+		for _, chunk := range chunks(group, rebalanceBatchSize) {
+			inserted, err := insertIndex(ctx, ss.shards[index].conn, chunk)
+			backfilled += inserted
+
+			if err != nil {
+				return backfilled, err
+			}
+		}
+	}
+
+	return backfilled, nil
+}
+
+// loadShardLinks читает все столбцы ссылок с заданными короткими URL.
+func loadShardLinks(ctx context.Context, conn DBConnectionInterface, shortURLs []string) ([]shardLink, error) {
+	rows, err := conn.Query(ctx, fmt.Sprintf(`SELECT url, short_url, user_id, is_deleted,
+		disabled_reason, domain, ios_url, android_url, splits::text, sticky_split, active_from, max_clicks, clicks,
+		health::text, metadata::text, created_at FROM %s WHERE short_url = ANY($1) ORDER BY id`, tableName), shortURLs)
+
+	if err != nil {
+		return nil, wrapError(err)
+	}
+
+	defer rows.Close()
+
+	var links []shardLink
+
+	for rows.Next() {
+		var link shardLink
+
+		if err = rows.Scan(&link.url, &link.shortURL, &link.userID, &link.isDeleted, &link.disabledReason,
+			&link.domain, &link.iosURL, &link.androidURL, &link.splits, &link.stickySplit, &link.activeFrom,
+			&link.maxClicks, &link.clicks, &link.health, &link.metadata, &link.createdAt); err != nil {
+			return nil, wrapError(err)
+		}
+
+		links = append(links, link)
+	}
+
+	return links, wrapError(rows.Err())
+}
+
+// saveShardLinks сохраняет перенесённые ссылки одной транзакцией.
+// Ссылки, уже сохранённые прерванным переносом, пропускаются.
+func saveShardLinks(ctx context.Context, conn DBConnectionInterface, links []shardLink) error {
+	tx, err := conn.Begin(ctx)
+
+	if err != nil {
+		return wrapError(err)
+	}
+
+	defer tx.Rollback(ctx)
+
+	query := fmt.Sprintf(`INSERT INTO %s (%s) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9::jsonb, $10, $11, $12, $13,
+		$14::jsonb, $15::jsonb, $16) ON CONFLICT DO NOTHING`, tableName, shardLinkColumns)
+
+	for _, link := range links {
+		if _, err = tx.Exec(ctx, query, link.url, link.shortURL, link.userID, link.isDeleted, link.disabledReason,
+			link.domain, link.iosURL, link.androidURL, link.splits, link.stickySplit, link.activeFrom,
+			link.maxClicks, link.clicks, link.health, link.metadata, link.createdAt); err != nil {
+			return wrapError(err)
+		}
+	}
+
+	return wrapError(tx.Commit(ctx))
+}
+
+// chunks делит значения на части не больше size элементов.
+func chunks[T any](values []T, size int) [][]T {
+	var result [][]T
+
+	for len(values) > size {
+		result = append(result, values[:size])
+		values = values[size:]
+	}
+
+	if len(values) > 0 {
+		result = append(result, values)
+	}
+
+	return result
+}
@@ -0,0 +1,154 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgconn"
+	"github.com/pashagolub/pgxmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// layoutColumns перечисляет столбцы запроса положения шарда.
+var layoutColumns = []string{"shard_index", "shard_count", "has_urls", "indexed"}
+
+func TestShardedStorage_CheckLayout_Refuses(t *testing.T) {
+	zero, one, two := 0, 1, 2
+
+	tests := []struct {
+		name    string
+		layouts [][]interface{}
+	}{
+		{
+			name: "Shard added after placement",
+			layouts: [][]interface{}{
+				{&zero, &one, true, true},
+				{nil, nil, false, false},
+			},
+		},
+		{
+			name: "Links saved without sharding",
+			layouts: [][]interface{}{
+				{nil, nil, true, false},
+				{nil, nil, false, false},
+			},
+		},
+		{
+			name: "Empty url_shards index",
+			layouts: [][]interface{}{
+				{&zero, &two, true, false},
+				{&one, &two, true, false},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ss, mocks := newTestShardedStorage(t, 2)
+
+			for i, layout := range tt.layouts {
+				mocks[i].ExpectQuery("FROM shard_layout").
+					WillReturnRows(pgxmock.NewRows(layoutColumns).AddRow(layout...))
+			}
+
+			err := ss.CheckLayout(context.Background())
+
+			assert.ErrorIs(t, err, ErrRebalanceRequired)
+
+			for _, mock := range mocks {
+				assert.NoError(t, mock.ExpectationsWereMet(), "Layout should not be written")
+			}
+		})
+	}
+}
+
+func TestShardedStorage_CheckLayout_WritesLayout(t *testing.T) {
+	ss, mocks := newTestShardedStorage(t, 2)
+	zero, two := 0, 2
+
+	mocks[0].ExpectQuery("FROM shard_layout").
+		WillReturnRows(pgxmock.NewRows(layoutColumns).AddRow(&zero, &two, true, true))
+	mocks[1].ExpectQuery("FROM shard_layout").
+		WillReturnRows(pgxmock.NewRows(layoutColumns).AddRow(nil, nil, false, false))
+	mocks[1].ExpectExec("INSERT INTO shard_layout").
+		WithArgs(1, 2).
+		WillReturnResult(pgconn.CommandTag("INSERT 0 1"))
+
+	require.NoError(t, ss.CheckLayout(context.Background()))
+
+	for _, mock := range mocks {
+		assert.NoError(t, mock.ExpectationsWereMet())
+	}
+}
+
+func TestShardedStorage_Rebalance(t *testing.T) {
+	ss, mocks := newTestShardedStorage(t, 2)
+	shortURL := keysOnShards(ss, "short")[1]
+	originalURL := keysOnShards(ss, "http://host.example.com/")[1]
+	userID := keysOnShards(ss, "user")[1]
+	created := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	linkColumns := []string{"url", "short_url", "user_id", "is_deleted", "disabled_reason", "domain", "ios_url",
+		"android_url", "splits", "sticky_split", "active_from", "max_clicks", "clicks", "health", "metadata",
+		"created_at"}
+
+	// Ссылка и пользователь сохранены на первом шарде до добавления второго, индекс url_shards пуст.
+	for _, mock := range mocks {
+		mock.ExpectQuery("SELECT url, short_url FROM url_shards").
+			WillReturnRows(pgxmock.NewRows([]string{"url", "short_url"}))
+	}
+
+	mocks[0].ExpectQuery("SELECT short_url, url FROM urls").
+		WillReturnRows(pgxmock.NewRows([]string{"short_url", "url"}).AddRow(shortURL, originalURL))
+	mocks[0].ExpectQuery("SELECT url, short_url, user_id").
+		WithArgs([]string{shortURL}).
+		WillReturnRows(pgxmock.NewRows(linkColumns).AddRow(originalURL, shortURL, &userID, false, "", "", "", "",
+			"[]", false, nil, 0, 5, nil, nil, created))
+	mocks[1].ExpectBegin()
+	mocks[1].ExpectExec("INSERT INTO urls").
+		WithArgs(originalURL, shortURL, &userID, false, "", "", "", "", "[]", false, pgxmock.AnyArg(), 0, 5,
+			pgxmock.AnyArg(), pgxmock.AnyArg(), created).
+		WillReturnResult(pgconn.CommandTag("INSERT 0 1"))
+	mocks[1].ExpectCommit()
+	mocks[0].ExpectExec("DELETE FROM urls").
+		WithArgs([]string{shortURL}).
+		WillReturnResult(pgconn.CommandTag("DELETE 1"))
+
+	mocks[0].ExpectQuery("FROM users_cookie").
+		WillReturnRows(pgxmock.NewRows([]string{"user_id", "is_banned"}).AddRow(userID, true))
+	mocks[1].ExpectExec("INSERT INTO users_cookie").
+		WithArgs([]string{userID}, []bool{true}).
+		WillReturnResult(pgconn.CommandTag("INSERT 0 1"))
+	mocks[0].ExpectExec("DELETE FROM users_cookie").
+		WithArgs([]string{userID}).
+		WillReturnResult(pgconn.CommandTag("DELETE 1"))
+
+	mocks[1].ExpectQuery("SELECT short_url, url FROM urls").
+		WillReturnRows(pgxmock.NewRows([]string{"short_url", "url"}).AddRow(shortURL, originalURL))
+	mocks[1].ExpectQuery("FROM users_cookie").
+		WillReturnRows(pgxmock.NewRows([]string{"user_id", "is_banned"}).AddRow(userID, true))
+
+	mocks[0].ExpectQuery("SELECT url, short_url FROM urls").
+		WillReturnRows(pgxmock.NewRows([]string{"url", "short_url"}))
+	mocks[1].ExpectQuery("SELECT url, short_url FROM urls").
+		WillReturnRows(pgxmock.NewRows([]string{"url", "short_url"}).AddRow(originalURL, shortURL))
+	mocks[1].ExpectExec("INSERT INTO url_shards").
+		WithArgs([]string{originalURL}, []string{shortURL}).
+		WillReturnResult(pgconn.CommandTag("INSERT 0 1"))
+
+	for i, mock := range mocks {
+		mock.ExpectExec("INSERT INTO shard_layout").
+			WithArgs(i, 2).
+			WillReturnResult(pgconn.CommandTag("INSERT 0 1"))
+	}
+
+	result, err := ss.Rebalance(context.Background())
+
+	require.NoError(t, err)
+	assert.Equal(t, RebalanceResult{URLs: 1, Users: 1, Backfilled: 1}, result)
+
+	for _, mock := range mocks {
+		assert.NoError(t, mock.ExpectationsWereMet())
+	}
+}
@@ -0,0 +1,798 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"sync"
+	"time"
+)
+
+// shardVirtualNodes задает количество точек каждого шарда на кольце консистентного хеширования.
+const shardVirtualNodes = 512
+
+// shardClaimTimeout задает время, после которого запись индекса URL без ссылки на шарде короткого URL
+// считается оставшейся после сбоя и может быть занята другой ссылкой.
+const shardClaimTimeout = time.Minute
+
+// shardClaimWait ограничивает ожидание ссылки, оригинальный URL которой уже занят в индексе другим вызовом,
+// но ещё не сохранён на шарде короткого URL.
+const shardClaimWait = 5 * time.Second
+
+// shardClaimPollInterval задает первую паузу между проверками такой ссылки, удваиваемую с каждой проверкой
+// до maxShardClaimPollInterval.
+const shardClaimPollInterval = 10 * time.Millisecond
+
+// maxShardClaimPollInterval ограничивает паузу между проверками ссылки, сохраняемой другим вызовом.
+const maxShardClaimPollInterval = 500 * time.Millisecond
+
+// hashRing распределяет ключи по шардам консистентным хешированием.
+// Добавление шарда в конец списка переносит на него около 1/N ключей, не перемещая остальные.
+type hashRing struct {
+	points []uint64 // Отсортированные точки кольца
+	shards []int    // Номер шарда каждой точки
+}
+
+// newHashRing строит кольцо для заданного количества шардов.
+func newHashRing(shards int) *hashRing {
+	type point struct {
+		hash  uint64
+		shard int
+	}
+
+	points := make([]point, 0, shards*shardVirtualNodes)
+
+	for shard := 0; shard < shards; shard++ {
+		for node := 0; node < shardVirtualNodes; node++ {
+			points = append(points, point{hash: shardHash(fmt.Sprintf("shard-%d-%d", shard, node)), shard: shard})
+		}
+	}
+
+	sort.Slice(points, func(i, j int) bool {
+		return points[i].hash < points[j].hash
+	})
+
+	ring := &hashRing{points: make([]uint64, len(points)), shards: make([]int, len(points))}
+
+	for i, point := range points {
+		ring.points[i] = point.hash
+		ring.shards[i] = point.shard
+	}
+
+	return ring
+}
+
+// shard возвращает номер шарда для ключа: первую точку кольца по часовой стрелке от хеша ключа.
+func (r *hashRing) shard(key string) int {
+	hash := shardHash(key)
+	i := sort.Search(len(r.points), func(i int) bool {
+		return r.points[i] >= hash
+	})
+
+	if i == len(r.points) {
+		i = 0
+	}
+
+	return r.shards[i]
+}
+
+// shardHash возвращает хеш ключа FNV-1a с перемешиванием битов, чтобы близкие ключи
+// равномерно распределялись по кольцу.
+func shardHash(key string) uint64 {
+	hasher := fnv.New64a()
+	hasher.Write([]byte(key))
+	hash := hasher.Sum64()
+
+	hash ^= hash >> 33
+	hash *= 0xff51afd7ed558ccd
+	hash ^= hash >> 33
+	hash *= 0xc4ceb9fe1a85ec53
+	hash ^= hash >> 33
+
+	return hash
+}
+
+// dbShard объединяет хранилища одной базы данных шардированного хранилища.
+type dbShard struct {
+	conn   DBConnectionInterface
+	urls   *URLStorage
+	users  *UsersStorage
+	admin  *AdminStorage
+	health *HealthStorage
+}
+
+// ShardedStorage распределяет ссылки и пользователей по нескольким базам данных PostgreSQL.
+// Ссылка хранится на шарде, выбранном консистентным хешированием её короткого URL,
+// пользователь — на шарде его идентификатора. Поиск по оригинальному URL выполняется через индекс
+// url_shards на шарде хеша оригинального URL, который также обеспечивает уникальность URL между шардами.
+// Запросы по всем ссылкам пользователя и выборки по всем ссылкам выполняются на всех шардах параллельно.
+// Журнал действий администратора хранится на первом шарде.
+// Порядок шардов определяет размещение данных. Положение каждого шарда сохраняется в таблице shard_layout
+// и проверяется CheckLayout при запуске; после изменения списка шардов данные размещаются заново
+// командой shortener-migrate -rebalance.
+type ShardedStorage struct {
+	shards []dbShard
+	ring   *hashRing
+}
+
+// NewShardedStorage создает хранилище поверх соединений с шардами в порядке их конфигурации.
+func NewShardedStorage(conns []DBConnectionInterface) *ShardedStorage {
+	ss := &ShardedStorage{ring: newHashRing(len(conns))}
+
+	for _, conn := range conns {
+		ss.shards = append(ss.shards, dbShard{
+			conn:   conn,
+			urls:   &URLStorage{conn: conn},
+			users:  &UsersStorage{conn: conn},
+			admin:  &AdminStorage{conn: conn},
+			health: &HealthStorage{conn: conn},
+		})
+	}
+
+	return ss
+}
+
+// SetConnection заглушка для интерфейса, соединения с шардами передаются в NewShardedStorage.
+func (ss *ShardedStorage) SetConnection(conn DBConnectionInterface) {}
+
+// Init заглушка для интерфейса, соединения с шардами передаются в NewShardedStorage.
+func (ss *ShardedStorage) Init(connectionString string) error {
+	return nil
+}
+
+// Close закрывает соединения со всеми шардами.
+func (ss *ShardedStorage) Close() {
+	for _, shard := range ss.shards {
+		shard.conn.Close()
+	}
+}
+
+// shardFor возвращает шард, хранящий ключ: короткий URL, идентификатор пользователя или оригинальный URL индекса.
+func (ss *ShardedStorage) shardFor(key string) *dbShard {
+	return &ss.shards[ss.ring.shard(key)]
+}
+
+// scatter параллельно выполняет fn на всех шардах и возвращает их ошибки.
+func (ss *ShardedStorage) scatter(fn func(index int, shard *dbShard) error) error {
+	errs := make([]error, len(ss.shards))
+	var wg sync.WaitGroup
+
+	for i := range ss.shards {
+		wg.Add(1)
+
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = fn(i, &ss.shards[i])
+		}(i)
+	}
+
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
+
+// shardURLs группирует короткие URL по номерам хранящих их шардов.
+func (ss *ShardedStorage) shardURLs(shortURLs []string) map[int][]string {
+	groups := make(map[int][]string)
+
+	for _, shortURL := range shortURLs {
+		index := ss.ring.shard(shortURL)
+		groups[index] = append(groups[index], shortURL)
+	}
+
+	return groups
+}
+
+// claimURL занимает оригинальный URL ссылки в индексе url_shards.
+// Возвращает короткий URL, которому принадлежит оригинальный URL, и true, если URL занят этим вызовом.
+// Запись индекса без ссылки старше shardClaimTimeout остаётся после сбоя между записью индекса
+// и ссылки и передается новой ссылке.
+func (ss *ShardedStorage) claimURL(ctx context.Context, dataStorageRow DataStorageRow) (string, bool, error) {
+	index := ss.shardFor(dataStorageRow.URL)
+	rows, err := index.conn.Query(ctx, `INSERT INTO url_shards (url, short_url) VALUES ($1, $2)
+		ON CONFLICT (url) DO UPDATE SET url = EXCLUDED.url
+		RETURNING short_url, (xmax = 0) AS inserted, claimed_at < now() - $3 * interval '1 millisecond' AS stale`,
+		dataStorageRow.URL, dataStorageRow.ShortURL, shardClaimTimeout.Milliseconds())
+
+	if err != nil {
+		return "", false, wrapError(err)
+	}
+
+	defer rows.Close()
+
+	var shortURL string
+	var inserted, stale bool
+
+	if !rows.Next() {
+		if err = rows.Err(); err == nil {
+			err = ErrNotFound
+		}
+
+		return "", false, wrapError(err)
+	}
+
+	if err = rows.Scan(&shortURL, &inserted, &stale); err != nil {
+		return "", false, wrapError(err)
+	}
+
+	rows.Close()
+
+	if inserted || !stale || shortURL == dataStorageRow.ShortURL {
+		return shortURL, inserted, nil
+	}
+
+	if _, err = ss.shardFor(shortURL).urls.GetURL(ctx, shortURL); !errors.Is(err, ErrNotFound) {
+		return shortURL, false, err
+	}
+
+	tag, err := index.conn.Exec(ctx,
+		"UPDATE url_shards SET short_url = $3, claimed_at = now() WHERE url = $1 AND short_url = $2",
+		dataStorageRow.URL, shortURL, dataStorageRow.ShortURL)
+
+	if err != nil {
+		return "", false, wrapError(err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return shortURL, false, nil
+	}
+
+	return dataStorageRow.ShortURL, true, nil
+}
+
+// releaseURLs освобождает оригинальные URL ссылок, которые не удалось сохранить.
+// Выполняется и после отмены запроса, чтобы индекс не указывал на несохранённые ссылки.
+func (ss *ShardedStorage) releaseURLs(ctx context.Context, dataStorageRows ...DataStorageRow) {
+	ctx = context.WithoutCancel(ctx)
+
+	for _, row := range dataStorageRows {
+		ss.shardFor(row.URL).conn.Exec(ctx, "DELETE FROM url_shards WHERE url = $1 AND short_url = $2",
+			row.URL, row.ShortURL)
+	}
+}
+
+// GetURL возвращает строку короткого URL с его шарда.
+func (ss *ShardedStorage) GetURL(ctx context.Context, shortURL string) (GetURLRow, error) {
+	return ss.shardFor(shortURL).urls.GetURL(ctx, shortURL)
+}
+
+// GetURLCount возвращает общее количество URL на всех шардах.
+// Недоступные шарды не учитываются.
+func (ss *ShardedStorage) GetURLCount(ctx context.Context) int {
+	counts := make([]int, len(ss.shards))
+
+	ss.scatter(func(index int, shard *dbShard) error {
+		counts[index] = shard.urls.GetURLCount(ctx)
+		return nil
+	})
+
+	return sumShards(counts)
+}
+
+// GetShortURL возвращает короткий URL для оригинального URL по индексу url_shards.
+// Если оригинального URL нет в индексе, возвращает ErrNotFound.
+func (ss *ShardedStorage) GetShortURL(ctx context.Context, URL string) (string, error) {
+	rows, err := ss.shardFor(URL).conn.Query(ctx, "SELECT short_url FROM url_shards WHERE url = $1", URL)
+
+	if err != nil {
+		return "", wrapError(err)
+	}
+
+	defer rows.Close()
+
+	if !rows.Next() {
+		if err = rows.Err(); err == nil {
+			err = ErrNotFound
+		}
+
+		return "", wrapError(err)
+	}
+
+	var shortURL string
+
+	if err = rows.Scan(&shortURL); err != nil {
+		return "", wrapError(err)
+	}
+
+	return shortURL, nil
+}
+
+// Ping проверяет соединения со всеми шардами.
+func (ss *ShardedStorage) Ping(ctx context.Context) bool {
+	err := ss.scatter(func(index int, shard *dbShard) error {
+		return shard.conn.Ping(ctx)
+	})
+
+	return err == nil
+}
+
+// Save занимает оригинальный URL в индексе и сохраняет ссылку на шарде её короткого URL.
+// Если оригинальный URL уже занят или ссылку не удалось сохранить, индекс не изменяется.
+func (ss *ShardedStorage) Save(ctx context.Context, dataStorageRow DataStorageRow) error {
+	_, claimed, err := ss.claimURL(ctx, dataStorageRow)
+
+	if err != nil {
+		return err
+	}
+
+	if !claimed {
+		return errDuplicateURL
+	}
+
+	if err = ss.shardFor(dataStorageRow.ShortURL).urls.Save(ctx, dataStorageRow); err != nil {
+		ss.releaseURLs(ctx, dataStorageRow)
+		return err
+	}
+
+	return nil
+}
+
+// InsertOrGet сохраняет ссылку, если оригинального URL ещё нет в индексе.
+// Атомарность между шардами обеспечивает индекс url_shards: оригинальный URL занимает только один вызов.
+// Если существующая ссылка ещё сохраняется другим вызовом, её сохранение ожидается не дольше shardClaimWait,
+// чтобы вернуть её с владельцем и доменом. Если другой вызов освободил оригинальный URL, он занимается заново.
+// Если ссылка так и не сохранена, возвращается ErrUnavailable.
+func (ss *ShardedStorage) InsertOrGet(
+	ctx context.Context, dataStorageRow DataStorageRow) (DataStorageRow, bool, error) {
+	deadline := time.Now().Add(shardClaimWait)
+	delay := shardClaimPollInterval
+
+	for {
+		shortURL, claimed, err := ss.claimURL(ctx, dataStorageRow)
+
+		if err != nil {
+			return DataStorageRow{}, false, err
+		}
+
+		if claimed {
+			if err = ss.shardFor(dataStorageRow.ShortURL).urls.Save(ctx, dataStorageRow); err != nil {
+				ss.releaseURLs(ctx, dataStorageRow)
+				return DataStorageRow{}, false, err
+			}
+
+			return dataStorageRow, true, nil
+		}
+
+		getURLRow, err := ss.GetURL(ctx, shortURL)
+
+		if err == nil {
+			return DataStorageRow{
+				ShortURL: shortURL, URL: dataStorageRow.URL, UserID: getURLRow.UserID, Domain: getURLRow.Domain,
+			}, false, nil
+		}
+
+		if !errors.Is(err, ErrNotFound) {
+			return DataStorageRow{}, false, err
+		}
+
+		if time.Now().Add(delay).After(deadline) {
+			return DataStorageRow{}, false, fmt.Errorf("%w: link %s for %s is still being saved",
+				ErrUnavailable, shortURL, dataStorageRow.URL)
+		}
+
+		select {
+		case <-ctx.Done():
+			return DataStorageRow{}, false, ctx.Err()
+		case <-time.After(delay):
+		}
+
+		delay = min(delay*2, maxShardClaimPollInterval)
+	}
+}
+
+// LoadData загружает ссылки всех шардов: шарды по порядку, ссылки шарда в порядке их создания.
+func (ss *ShardedStorage) LoadData(ctx context.Context) ([]DataStorageRow, error) {
+	results := make([][]DataStorageRow, len(ss.shards))
+
+	err := ss.scatter(func(index int, shard *dbShard) error {
+		rows, err := shard.urls.LoadData(ctx)
+		results[index] = rows
+
+		return err
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return concatShards(results), nil
+}
+
+// SaveBatch занимает оригинальные URL пакета в индексе и сохраняет ссылки на шардах их коротких URL.
+// Ссылки, уже сохранённые с той же парой URL и короткого URL, пропускаются. Пакет сохраняется
+// атомарно в пределах каждого шарда: при ошибке шарда его ссылки не сохраняются и освобождаются в индексе,
+// а ссылки остальных шардов остаются сохранёнными.
+func (ss *ShardedStorage) SaveBatch(ctx context.Context, dataStorageRows []DataStorageRow) error {
+	return ss.saveBatch(ctx, dataStorageRows, (*URLStorage).SaveBatch)
+}
+
+// ImportBatch сохраняет перенесённые ссылки так же, как SaveBatch, но без событий их создания в outbox шардов.
+func (ss *ShardedStorage) ImportBatch(ctx context.Context, dataStorageRows []DataStorageRow) error {
+	return ss.saveBatch(ctx, dataStorageRows, (*URLStorage).ImportBatch)
+}
+
+// LoadLinkDetails собирает данные страниц перехода и результаты проверки ссылок со всех шардов
+// и упорядочивает их по короткому URL.
+func (ss *ShardedStorage) LoadLinkDetails(ctx context.Context) ([]LinkDetails, error) {
+	results := make([][]LinkDetails, len(ss.shards))
+
+	err := ss.scatter(func(index int, shard *dbShard) error {
+		details, err := shard.urls.LoadLinkDetails(ctx)
+		results[index] = details
+
+		return err
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	details := concatShards(results)
+
+	sort.Slice(details, func(i, j int) bool {
+		return details[i].ShortURL < details[j].ShortURL
+	})
+
+	return details, nil
+}
+
+// SaveLinkDetails сохраняет перенесённые данные страниц перехода и результаты проверки на шардах коротких URL.
+func (ss *ShardedStorage) SaveLinkDetails(ctx context.Context, details []LinkDetails) error {
+	groups := make([][]LinkDetails, len(ss.shards))
+
+	for _, item := range details {
+		index := ss.ring.shard(item.ShortURL)
+		groups[index] = append(groups[index], item)
+	}
+
+	return ss.scatter(func(index int, shard *dbShard) error {
+		if len(groups[index]) == 0 {
+			return nil
+		}
+
+		return shard.urls.SaveLinkDetails(ctx, groups[index])
+	})
+}
+
+// saveBatch занимает оригинальные URL пакета в индексе и сохраняет ссылки на шардах функцией save.
+func (ss *ShardedStorage) saveBatch(ctx context.Context, dataStorageRows []DataStorageRow,
+	save func(*URLStorage, context.Context, []DataStorageRow) error) error {
+	var claimed []DataStorageRow
+
+	for _, row := range dataStorageRows {
+		shortURL, ok, err := ss.claimURL(ctx, row)
+
+		if err == nil && !ok && shortURL != row.ShortURL {
+			err = errDuplicateURL
+		}
+
+		if err != nil {
+			ss.releaseURLs(ctx, claimed...)
+			return err
+		}
+
+		if ok {
+			claimed = append(claimed, row)
+		}
+	}
+
+	groups := make([][]DataStorageRow, len(ss.shards))
+
+	for _, row := range dataStorageRows {
+		index := ss.ring.shard(row.ShortURL)
+		groups[index] = append(groups[index], row)
+	}
+
+	failed := make([]bool, len(ss.shards))
+
+	err := ss.scatter(func(index int, shard *dbShard) error {
+		if len(groups[index]) == 0 {
+			return nil
+		}
+
+		err := save(shard.urls, ctx, groups[index])
+		failed[index] = err != nil
+
+		return err
+	})
+
+	if err != nil {
+		var released []DataStorageRow
+
+		for _, row := range claimed {
+			if failed[ss.ring.shard(row.ShortURL)] {
+				released = append(released, row)
+			}
+		}
+
+		ss.releaseURLs(ctx, released...)
+	}
+
+	return err
+}
+
+// RecordSplitClick учитывает переход на вариант A/B теста на шарде короткого URL.
+func (ss *ShardedStorage) RecordSplitClick(ctx context.Context, shortURL string, variant int) error {
+	return ss.shardFor(shortURL).urls.RecordSplitClick(ctx, shortURL, variant)
+}
+
+// RedeemClick учитывает переход по короткому URL с ограничением количества переходов на его шарде.
+func (ss *ShardedStorage) RedeemClick(ctx context.Context, shortURL string) (int, bool, error) {
+	return ss.shardFor(shortURL).urls.RedeemClick(ctx, shortURL)
+}
+
+// SaveLinkMetadata сохраняет данные страницы перехода на шарде короткого URL.
+func (ss *ShardedStorage) SaveLinkMetadata(ctx context.Context, shortURL string, metadata LinkMetadata) error {
+	return ss.shardFor(shortURL).urls.SaveLinkMetadata(ctx, shortURL, metadata)
+}
+
+// IsUserExist проверяет, существует ли пользователь на шарде его идентификатора.
+func (ss *ShardedStorage) IsUserExist(ctx context.Context, uniqueID string) bool {
+	return ss.shardFor(uniqueID).users.IsUserExist(ctx, uniqueID)
+}
+
+// IsUserBanned проверяет, заблокирован ли пользователь, на шарде его идентификатора.
+func (ss *ShardedStorage) IsUserBanned(ctx context.Context, uniqueID string) bool {
+	return ss.shardFor(uniqueID).users.IsUserBanned(ctx, uniqueID)
+}
+
+// SaveUser сохраняет пользователя на шарде его идентификатора.
+func (ss *ShardedStorage) SaveUser(ctx context.Context, uniqueID string) error {
+	return ss.shardFor(uniqueID).users.SaveUser(ctx, uniqueID)
+}
+
+// LoadUsers возвращает пользователей всех шардов: шарды по порядку, пользователи шарда в порядке создания.
+func (ss *ShardedStorage) LoadUsers(ctx context.Context) ([]User, error) {
+	results := make([][]User, len(ss.shards))
+
+	err := ss.scatter(func(index int, shard *dbShard) error {
+		users, err := shard.users.LoadUsers(ctx)
+		results[index] = users
+
+		return err
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return concatShards(results), nil
+}
+
+// SaveUsers сохраняет пользователей на шардах их идентификаторов.
+func (ss *ShardedStorage) SaveUsers(ctx context.Context, users []User) error {
+	groups := make([][]User, len(ss.shards))
+
+	for _, user := range users {
+		index := ss.ring.shard(user.UserID)
+		groups[index] = append(groups[index], user)
+	}
+
+	return ss.scatter(func(index int, shard *dbShard) error {
+		if len(groups[index]) == 0 {
+			return nil
+		}
+
+		return shard.users.SaveUsers(ctx, groups[index])
+	})
+}
+
+// GetUserUrls возвращает URL пользователя со всех шардов, шарды по порядку.
+// Ссылки пользователя распределены по шардам коротких URL, поэтому запрос выполняется на всех шардах.
+func (ss *ShardedStorage) GetUserUrls(ctx context.Context, uniqueID string) ([]UserUrlsResponseBodyItem, error) {
+	results := make([][]UserUrlsResponseBodyItem, len(ss.shards))
+
+	err := ss.scatter(func(index int, shard *dbShard) error {
+		urls, err := shard.users.GetUserUrls(ctx, uniqueID)
+		results[index] = urls
+
+		return err
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return concatShards(results), nil
+}
+
+// GetUsersCount возвращает общее количество пользователей на всех шардах.
+// Недоступные шарды не учитываются.
+func (ss *ShardedStorage) GetUsersCount(ctx context.Context) int {
+	counts := make([]int, len(ss.shards))
+
+	ss.scatter(func(index int, shard *dbShard) error {
+		counts[index] = shard.users.GetUsersCount(ctx)
+		return nil
+	})
+
+	return sumShards(counts)
+}
+
+// DeleteUserUrls удаляет короткие URL пользователя параллельно на хранящих их шардах.
+// Удаление атомарно в пределах каждого шарда.
+func (ss *ShardedStorage) DeleteUserUrls(ctx context.Context, uniqueID string, shortURLs []string) error {
+	groups := ss.shardURLs(shortURLs)
+
+	return ss.scatter(func(index int, shard *dbShard) error {
+		if len(groups[index]) == 0 {
+			return nil
+		}
+
+		return shard.users.DeleteUserUrls(ctx, uniqueID, groups[index])
+	})
+}
+
+// UpdateUserURLDevices задает адреса перехода для мобильных устройств на шарде короткого URL.
+func (ss *ShardedStorage) UpdateUserURLDevices(
+	ctx context.Context, uniqueID string, shortURL string, deviceURLs DeviceURLs) (bool, error) {
+	return ss.shardFor(shortURL).users.UpdateUserURLDevices(ctx, uniqueID, shortURL, deviceURLs)
+}
+
+// UpdateUserURLActivation задает время активации на шарде короткого URL.
+func (ss *ShardedStorage) UpdateUserURLActivation(
+	ctx context.Context, uniqueID string, shortURL string, activeFrom *time.Time) (bool, error) {
+	return ss.shardFor(shortURL).users.UpdateUserURLActivation(ctx, uniqueID, shortURL, activeFrom)
+}
+
+// shardSearchRow содержит найденную ссылку шарда с ключом её глобального порядка.
+type shardSearchRow struct {
+	row       DataStorageRow
+	createdAt time.Time
+	shard     int
+}
+
+// SearchUrls возвращает ссылки всех шардов, подходящие под фильтр.
+// Идентификаторы ссылок назначаются каждым шардом независимо, поэтому ссылки упорядочиваются
+// по времени создания, номеру шарда и идентификатору. Каждый шард возвращает первые Offset+Limit ссылок
+// в этом порядке, после объединения которых выбирается запрошенная страница.
+func (ss *ShardedStorage) SearchUrls(ctx context.Context, filter URLSearchFilter) ([]DataStorageRow, error) {
+	results := make([][]shardSearchRow, len(ss.shards))
+
+	err := ss.scatter(func(index int, shard *dbShard) error {
+		rows, err := searchShardUrls(ctx, shard.conn, filter.Query, filter.UserID, filter.Offset+filter.Limit)
+
+		for i := range rows {
+			rows[i].shard = index
+		}
+
+		results[index] = rows
+
+		return err
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	found := concatShards(results)
+
+	sort.Slice(found, func(i, j int) bool {
+		if !found[i].createdAt.Equal(found[j].createdAt) {
+			return found[i].createdAt.Before(found[j].createdAt)
+		}
+
+		if found[i].shard != found[j].shard {
+			return found[i].shard < found[j].shard
+		}
+
+		return found[i].row.ID < found[j].row.ID
+	})
+
+	if filter.Offset >= len(found) {
+		return nil, nil
+	}
+
+	rows := make([]DataStorageRow, 0, min(filter.Limit, len(found)-filter.Offset))
+
+	for _, item := range found[filter.Offset:min(filter.Offset+filter.Limit, len(found))] {
+		rows = append(rows, item.row)
+	}
+
+	return rows, nil
+}
+
+// searchShardUrls возвращает первые limit ссылок шарда, подходящих под фильтр,
+// в порядке времени создания и идентификатора.
+func searchShardUrls(
+	ctx context.Context, conn DBConnectionInterface, query, userID string, limit int) ([]shardSearchRow, error) {
+	rows, err := conn.Query(ctx, fmt.Sprintf(`SELECT id, short_url, url, COALESCE(user_id, ''), is_deleted,
+	disabled_reason, domain, created_at FROM %s
+	WHERE ($1 = '' OR url ILIKE '%%' || $1 || '%%' OR short_url = $1) AND ($2 = '' OR user_id = $2)
+	ORDER BY created_at, id LIMIT $3`, tableName), query, userID, limit)
+
+	if err != nil {
+		return nil, wrapError(err)
+	}
+
+	defer rows.Close()
+
+	var found []shardSearchRow
+
+	for rows.Next() {
+		var item shardSearchRow
+
+		if err := rows.Scan(
+			&item.row.ID, &item.row.ShortURL, &item.row.URL, &item.row.UserID, &item.row.DeletedFlag,
+			&item.row.DisabledReason, &item.row.Domain, &item.createdAt,
+		); err != nil {
+			return nil, wrapError(err)
+		}
+
+		found = append(found, item)
+	}
+
+	return found, wrapError(rows.Err())
+}
+
+// DisableURL блокирует короткий URL на его шарде.
+func (ss *ShardedStorage) DisableURL(ctx context.Context, shortURL string, reason string) (bool, error) {
+	return ss.shardFor(shortURL).admin.DisableURL(ctx, shortURL, reason)
+}
+
+// ReassignURL передает короткий URL другому пользователю на шарде короткого URL.
+func (ss *ShardedStorage) ReassignURL(ctx context.Context, shortURL string, userID string) (bool, error) {
+	return ss.shardFor(shortURL).admin.ReassignURL(ctx, shortURL, userID)
+}
+
+// BanUser блокирует пользователя на шарде его идентификатора.
+func (ss *ShardedStorage) BanUser(ctx context.Context, userID string) error {
+	return ss.shardFor(userID).admin.BanUser(ctx, userID)
+}
+
+// SaveAuditRecord сохраняет запись журнала действий администратора на первом шарде.
+func (ss *ShardedStorage) SaveAuditRecord(ctx context.Context, record AuditRecord) error {
+	return ss.shards[0].admin.SaveAuditRecord(ctx, record)
+}
+
+// GetAuditRecords возвращает последние записи журнала действий администратора с первого шарда.
+func (ss *ShardedStorage) GetAuditRecords(ctx context.Context, limit int) ([]AuditRecord, error) {
+	return ss.shards[0].admin.GetAuditRecords(ctx, limit)
+}
+
+// GetHealthTargets возвращает ссылки для проверки со всех шардов.
+func (ss *ShardedStorage) GetHealthTargets(ctx context.Context) ([]HealthTarget, error) {
+	results := make([][]HealthTarget, len(ss.shards))
+
+	err := ss.scatter(func(index int, shard *dbShard) error {
+		targets, err := shard.health.GetHealthTargets(ctx)
+		results[index] = targets
+
+		return err
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return sortedHealthTargets(concatShards(results)), nil
+}
+
+// SaveLinkHealth сохраняет результат проверки адреса перехода на шарде короткого URL.
+func (ss *ShardedStorage) SaveLinkHealth(ctx context.Context, shortURL string, health LinkHealth) error {
+	return ss.shardFor(shortURL).health.SaveLinkHealth(ctx, shortURL, health)
+}
+
+// concatShards объединяет результаты шардов в порядке шардов.
+func concatShards[T any](results [][]T) []T {
+	var all []T
+
+	for _, result := range results {
+		all = append(all, result...)
+	}
+
+	return all
+}
+
+// sumShards возвращает сумму значений шардов.
+func sumShards(values []int) int {
+	total := 0
+
+	for _, value := range values {
+		total += value
+	}
+
+	return total
+}
@@ -0,0 +1,371 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgconn"
+	"github.com/pashagolub/pgxmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestShardedStorage создает шардированное хранилище поверх моков соединений с шардами.
+func newTestShardedStorage(t *testing.T, shards int) (*ShardedStorage, []pgxmock.PgxPoolIface) {
+	var mocks []pgxmock.PgxPoolIface
+	var conns []DBConnectionInterface
+
+	for i := 0; i < shards; i++ {
+		mock, err := pgxmock.NewPool()
+		require.NoError(t, err)
+		t.Cleanup(mock.Close)
+
+		mocks = append(mocks, mock)
+		conns = append(conns, mock)
+	}
+
+	return NewShardedStorage(conns), mocks
+}
+
+// keysOnShards подбирает по одному ключу с префиксом prefix для каждого шарда.
+func keysOnShards(ss *ShardedStorage, prefix string) []string {
+	keys := make([]string, len(ss.shards))
+	found := 0
+
+	for i := 0; found < len(keys); i++ {
+		key := fmt.Sprintf("%s%d", prefix, i)
+
+		if shard := ss.ring.shard(key); keys[shard] == "" {
+			keys[shard] = key
+			found++
+		}
+	}
+
+	return keys
+}
+
+func TestHashRing_Distribution(t *testing.T) {
+	ring := newHashRing(4)
+	counts := make([]int, 4)
+
+	for i := 0; i < 10000; i++ {
+		counts[ring.shard(fmt.Sprintf("key%d", i))]++
+	}
+
+	for shard, count := range counts {
+		assert.InDelta(t, 2500, count, 500, "Shard %d should get about a quarter of keys", shard)
+	}
+}
+
+func TestHashRing_AddShard(t *testing.T) {
+	before := newHashRing(4)
+	after := newHashRing(5)
+	moved := 0
+
+	for i := 0; i < 10000; i++ {
+		key := fmt.Sprintf("key%d", i)
+
+		if shard := after.shard(key); shard != before.shard(key) {
+			assert.Equal(t, 4, shard, "Keys should only move to the new shard")
+			moved++
+		}
+	}
+
+	assert.InDelta(t, 2000, moved, 500, "About 1/5 of keys should move to the new shard")
+}
+
+func TestShardedStorage_GetURL(t *testing.T) {
+	ctx := context.Background()
+	ss, mocks := newTestShardedStorage(t, 3)
+	keys := keysOnShards(ss, "short")
+
+	mocks[1].ExpectQuery("SELECT url, COALESCE\\(user_id, ''\\).* FROM urls WHERE short_url = \\$1").
+		WithArgs(keys[1]).
+		WillReturnRows(pgxmock.NewRows([]string{
+			"url", "user_id", "is_deleted", "disabled_reason", "domain", "ios_url", "android_url", "splits",
+			"sticky_split", "active_from", "max_clicks", "clicks",
+		}).AddRow("http://example.com", "user1", false, "", "", "", "", []SplitDestination(nil), false,
+			(*time.Time)(nil), 0, 0))
+
+	row, err := ss.GetURL(ctx, keys[1])
+
+	require.NoError(t, err)
+	assert.Equal(t, "http://example.com", row.URL)
+
+	for _, mock := range mocks {
+		assert.NoError(t, mock.ExpectationsWereMet(), "Only the shard of the key should be queried")
+	}
+}
+
+func TestShardedStorage_InsertOrGet(t *testing.T) {
+	ctx := context.Background()
+	ss, mocks := newTestShardedStorage(t, 2)
+	row := DataStorageRow{ShortURL: keysOnShards(ss, "short")[1], URL: "http://example.com", UserID: "user1"}
+	index := mocks[ss.ring.shard(row.URL)]
+
+	index.ExpectQuery("INSERT INTO url_shards").
+		WithArgs(row.URL, row.ShortURL, shardClaimTimeout.Milliseconds()).
+		WillReturnRows(pgxmock.NewRows([]string{"short_url", "inserted", "stale"}).AddRow(row.ShortURL, true, false))
+	mocks[1].ExpectExec("INSERT INTO urls").WillReturnResult(pgxmock.NewResult("INSERT", 1))
+
+	stored, created, err := ss.InsertOrGet(ctx, row)
+
+	require.NoError(t, err)
+	assert.True(t, created)
+	assert.Equal(t, row, stored)
+
+	for _, mock := range mocks {
+		assert.NoError(t, mock.ExpectationsWereMet())
+	}
+}
+
+func TestShardedStorage_InsertOrGet_Existing(t *testing.T) {
+	ctx := context.Background()
+	ss, mocks := newTestShardedStorage(t, 2)
+	existing := keysOnShards(ss, "short")[0]
+	row := DataStorageRow{ShortURL: "new", URL: "http://example.com", UserID: "user2"}
+	index := mocks[ss.ring.shard(row.URL)]
+
+	index.ExpectQuery("INSERT INTO url_shards").
+		WillReturnRows(pgxmock.NewRows([]string{"short_url", "inserted", "stale"}).AddRow(existing, false, false))
+	mocks[0].ExpectQuery("FROM urls WHERE short_url = \\$1").
+		WithArgs(existing).
+		WillReturnRows(pgxmock.NewRows([]string{
+			"url", "user_id", "is_deleted", "disabled_reason", "domain", "ios_url", "android_url", "splits",
+			"sticky_split", "active_from", "max_clicks", "clicks",
+		}).AddRow("http://example.com", "user1", false, "", "go.example.com", "", "", []SplitDestination(nil), false,
+			(*time.Time)(nil), 0, 0))
+
+	stored, created, err := ss.InsertOrGet(ctx, row)
+
+	require.NoError(t, err)
+	assert.False(t, created)
+	assert.Equal(t, DataStorageRow{
+		ShortURL: existing, URL: "http://example.com", UserID: "user1", Domain: "go.example.com",
+	}, stored)
+
+	for _, mock := range mocks {
+		assert.NoError(t, mock.ExpectationsWereMet())
+	}
+}
+
+func TestShardedStorage_InsertOrGet_StaleClaim(t *testing.T) {
+	ctx := context.Background()
+	ss, mocks := newTestShardedStorage(t, 2)
+	keys := keysOnShards(ss, "short")
+	row := DataStorageRow{ShortURL: keys[1], URL: "http://example.com"}
+	index := mocks[ss.ring.shard(row.URL)]
+
+	index.ExpectQuery("INSERT INTO url_shards").
+		WillReturnRows(pgxmock.NewRows([]string{"short_url", "inserted", "stale"}).AddRow(keys[0], false, true))
+	mocks[0].ExpectQuery("FROM urls WHERE short_url = \\$1").
+		WithArgs(keys[0]).
+		WillReturnRows(pgxmock.NewRows([]string{
+			"url", "user_id", "is_deleted", "disabled_reason", "domain", "ios_url", "android_url", "splits",
+			"sticky_split", "active_from", "max_clicks", "clicks",
+		}))
+	index.ExpectExec("UPDATE url_shards SET short_url = \\$3").
+		WithArgs(row.URL, keys[0], keys[1]).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	mocks[1].ExpectExec("INSERT INTO urls").WillReturnResult(pgxmock.NewResult("INSERT", 1))
+
+	stored, created, err := ss.InsertOrGet(ctx, row)
+
+	require.NoError(t, err)
+	assert.True(t, created, "Claim left without a link should be taken over")
+	assert.Equal(t, row, stored)
+
+	for _, mock := range mocks {
+		assert.NoError(t, mock.ExpectationsWereMet())
+	}
+}
+
+func TestShardedStorage_InsertOrGet_ClaimInFlight(t *testing.T) {
+	ctx := context.Background()
+	ss, mocks := newTestShardedStorage(t, 2)
+	keys := keysOnShards(ss, "short")
+	row := DataStorageRow{ShortURL: keys[1], URL: "http://example.com", UserID: "user2"}
+	index := mocks[ss.ring.shard(row.URL)]
+	urlColumns := []string{
+		"url", "user_id", "is_deleted", "disabled_reason", "domain", "ios_url", "android_url", "splits",
+		"sticky_split", "active_from", "max_clicks", "clicks",
+	}
+
+	// Другой вызов занял оригинальный URL, но ещё не сохранил ссылку на шарде её короткого URL.
+	index.ExpectQuery("INSERT INTO url_shards").
+		WillReturnRows(pgxmock.NewRows([]string{"short_url", "inserted", "stale"}).AddRow(keys[0], false, false))
+	mocks[0].ExpectQuery("FROM urls WHERE short_url = \\$1").
+		WithArgs(keys[0]).
+		WillReturnRows(pgxmock.NewRows(urlColumns))
+	index.ExpectQuery("INSERT INTO url_shards").
+		WillReturnRows(pgxmock.NewRows([]string{"short_url", "inserted", "stale"}).AddRow(keys[0], false, false))
+	mocks[0].ExpectQuery("FROM urls WHERE short_url = \\$1").
+		WithArgs(keys[0]).
+		WillReturnRows(pgxmock.NewRows(urlColumns).AddRow("http://example.com", "user1", false, "", "go.example.com",
+			"", "", []SplitDestination(nil), false, (*time.Time)(nil), 0, 0))
+
+	stored, created, err := ss.InsertOrGet(ctx, row)
+
+	require.NoError(t, err)
+	assert.False(t, created)
+	assert.Equal(t, DataStorageRow{
+		ShortURL: keys[0], URL: "http://example.com", UserID: "user1", Domain: "go.example.com",
+	}, stored, "Link saved by another call should be returned with its owner and domain")
+
+	for _, mock := range mocks {
+		assert.NoError(t, mock.ExpectationsWereMet())
+	}
+}
+
+func TestShardedStorage_Save_ReleasesClaim(t *testing.T) {
+	ctx := context.Background()
+	ss, mocks := newTestShardedStorage(t, 2)
+	row := DataStorageRow{ShortURL: keysOnShards(ss, "short")[0], URL: "http://example.com"}
+	index := mocks[ss.ring.shard(row.URL)]
+
+	index.ExpectQuery("INSERT INTO url_shards").
+		WillReturnRows(pgxmock.NewRows([]string{"short_url", "inserted", "stale"}).AddRow(row.ShortURL, true, false))
+	mocks[0].ExpectExec("INSERT INTO urls").WillReturnError(&pgconn.PgError{Code: pgUniqueViolation})
+	index.ExpectExec("DELETE FROM url_shards WHERE url = \\$1 AND short_url = \\$2").
+		WithArgs(row.URL, row.ShortURL).
+		WillReturnResult(pgxmock.NewResult("DELETE", 1))
+
+	err := ss.Save(ctx, row)
+
+	assert.ErrorIs(t, err, ErrConflict)
+
+	for _, mock := range mocks {
+		assert.NoError(t, mock.ExpectationsWereMet())
+	}
+}
+
+func TestShardedStorage_Save_DuplicateURL(t *testing.T) {
+	ctx := context.Background()
+	ss, mocks := newTestShardedStorage(t, 2)
+	row := DataStorageRow{ShortURL: "new", URL: "http://example.com"}
+
+	mocks[ss.ring.shard(row.URL)].ExpectQuery("INSERT INTO url_shards").
+		WillReturnRows(pgxmock.NewRows([]string{"short_url", "inserted", "stale"}).AddRow("old", false, false))
+
+	err := ss.Save(ctx, row)
+
+	assert.ErrorIs(t, err, ErrConflict)
+
+	for _, mock := range mocks {
+		assert.NoError(t, mock.ExpectationsWereMet())
+	}
+}
+
+func TestShardedStorage_GetShortURL(t *testing.T) {
+	ctx := context.Background()
+	ss, mocks := newTestShardedStorage(t, 2)
+	index := mocks[ss.ring.shard("http://example.com")]
+
+	index.ExpectQuery("SELECT short_url FROM url_shards WHERE url = \\$1").
+		WithArgs("http://example.com").
+		WillReturnRows(pgxmock.NewRows([]string{"short_url"}).AddRow("abc"))
+	index.ExpectQuery("SELECT short_url FROM url_shards WHERE url = \\$1").
+		WithArgs("http://example.com").
+		WillReturnRows(pgxmock.NewRows([]string{"short_url"}))
+
+	shortURL, err := ss.GetShortURL(ctx, "http://example.com")
+	require.NoError(t, err)
+	assert.Equal(t, "abc", shortURL)
+
+	_, err = ss.GetShortURL(ctx, "http://example.com")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	assert.NoError(t, index.ExpectationsWereMet())
+}
+
+func TestShardedStorage_GetUserUrls(t *testing.T) {
+	ctx := context.Background()
+	ss, mocks := newTestShardedStorage(t, 3)
+	columns := []string{
+		"url", "short_url", "domain", "ios_url", "android_url", "splits", "active_from", "max_clicks", "clicks",
+		"health", "metadata",
+	}
+
+	for i, mock := range mocks {
+		rows := pgxmock.NewRows(columns)
+
+		if i != 1 {
+			rows.AddRow(fmt.Sprintf("http://%d.example.com", i), fmt.Sprintf("short%d", i), "", "", "",
+				[]SplitDestination(nil), (*time.Time)(nil), 0, 0, (*LinkHealth)(nil), (*LinkMetadata)(nil))
+		}
+
+		mock.ExpectQuery("FROM urls WHERE user_id = \\$1 AND is_deleted = false").
+			WithArgs("user1").
+			WillReturnRows(rows)
+	}
+
+	urls, err := ss.GetUserUrls(ctx, "user1")
+
+	require.NoError(t, err)
+	require.Len(t, urls, 2)
+	assert.Equal(t, "short0", urls[0].ShortURL)
+	assert.Equal(t, "short2", urls[1].ShortURL)
+
+	for _, mock := range mocks {
+		assert.NoError(t, mock.ExpectationsWereMet())
+	}
+}
+
+func TestShardedStorage_GetUserUrls_ShardUnavailable(t *testing.T) {
+	ctx := context.Background()
+	ss, mocks := newTestShardedStorage(t, 2)
+
+	mocks[0].ExpectQuery("FROM urls WHERE user_id = \\$1").
+		WillReturnRows(pgxmock.NewRows([]string{
+			"url", "short_url", "domain", "ios_url", "android_url", "splits", "active_from", "max_clicks", "clicks",
+			"health", "metadata",
+		}))
+	mocks[1].ExpectQuery("FROM urls WHERE user_id = \\$1").
+		WillReturnError(&pgconn.PgError{Code: pgCannotConnectNow})
+
+	_, err := ss.GetUserUrls(ctx, "user1")
+
+	assert.ErrorIs(t, err, ErrUnavailable)
+}
+
+func TestShardedStorage_ShardURLs(t *testing.T) {
+	ss, _ := newTestShardedStorage(t, 3)
+	keys := keysOnShards(ss, "short")
+	more := keysOnShards(ss, "other")
+
+	groups := ss.shardURLs([]string{keys[0], keys[2], more[0]})
+
+	assert.Equal(t, map[int][]string{0: {keys[0], more[0]}, 2: {keys[2]}}, groups)
+}
+
+func TestShardedStorage_SearchUrls(t *testing.T) {
+	ctx := context.Background()
+	ss, mocks := newTestShardedStorage(t, 2)
+	columns := []string{"id", "short_url", "url", "user_id", "is_deleted", "disabled_reason", "domain", "created_at"}
+	created := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// Идентификаторы назначаются шардами независимо и совпадают, порядок задаётся временем создания.
+	mocks[0].ExpectQuery("ORDER BY created_at, id").
+		WithArgs("example", "", 3).
+		WillReturnRows(pgxmock.NewRows(columns).
+			AddRow(1, "a", "http://a.example.com", "", false, "", "", created).
+			AddRow(2, "c", "http://c.example.com", "", false, "", "", created.Add(2*time.Minute)))
+	mocks[1].ExpectQuery("ORDER BY created_at, id").
+		WithArgs("example", "", 3).
+		WillReturnRows(pgxmock.NewRows(columns).
+			AddRow(1, "b", "http://b.example.com", "", false, "", "", created.Add(time.Minute)).
+			AddRow(2, "d", "http://d.example.com", "", false, "", "", created.Add(2*time.Minute)))
+
+	rows, err := ss.SearchUrls(ctx, URLSearchFilter{Query: "example", Limit: 2, Offset: 1})
+
+	require.NoError(t, err)
+	require.Len(t, rows, 2)
+	assert.Equal(t, "b", rows[0].ShortURL)
+	assert.Equal(t, "c", rows[1].ShortURL, "Links created at the same time should be ordered by shard")
+
+	for _, mock := range mocks {
+		assert.NoError(t, mock.ExpectationsWereMet())
+	}
+}
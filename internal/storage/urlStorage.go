@@ -2,12 +2,9 @@ package storage
 
 import (
 	"context"
-	"errors"
 	"fmt"
-	"log"
 
 	"github.com/jackc/pgx/v4"
-	"github.com/jackc/pgx/v4/pgxpool"
 )
 
 // URLStorageInterface определяет методы для работы с хранилищем URL.
@@ -16,25 +13,42 @@ type URLStorageInterface interface {
 	SetConnection(conn DBConnectionInterface)
 
 	// GetURL получит URL по его короткому формату.
-	GetURL(shortURL string) (GetURLRow, bool)
+	// Если короткого URL нет в хранилище, возвращает ErrNotFound.
+	GetURL(ctx context.Context, shortURL string) (GetURLRow, error)
 
 	// GetURLCount возвращает общее количество URL в хранилище.
-	GetURLCount() int
+	GetURLCount(ctx context.Context) int
 
 	// GetShortURL возвращает короткий формат URL для заданного полного URL.
-	GetShortURL(URL string) (string, error)
+	// Если полного URL нет в хранилище, возвращает ErrNotFound.
+	GetShortURL(ctx context.Context, URL string) (string, error)
 
-	// Save сохраняет короткий URL с соответствующим полным URL и идентификатором пользователя.
-	Save(ShortURL string, URL string, userID string) error
+	// Save сохраняет короткий URL с соответствующим полным URL, идентификатором пользователя и доменом.
+	Save(ctx context.Context, dataStorageRow DataStorageRow) error
+
+	// InsertOrGet атомарно сохраняет ссылку, если оригинального URL ещё нет в хранилище.
+	// Возвращает сохранённую ссылку и true, если она создана этим вызовом, или существующую ссылку
+	// на тот же URL и false. Если короткий URL уже занят другой ссылкой, возвращает ErrConflict.
+	InsertOrGet(ctx context.Context, dataStorageRow DataStorageRow) (DataStorageRow, bool, error)
 
 	// LoadData загружает данные из хранилища в массив DataStorageRow.
-	LoadData() ([]DataStorageRow, error)
+	LoadData(ctx context.Context) ([]DataStorageRow, error)
 
 	// Ping проверяет состояние подключения к базе данных.
-	Ping() bool
+	Ping(ctx context.Context) bool
 
 	// SaveBatch сохраняет пакет данных, представленных в виде массива DataStorageRow.
-	SaveBatch(dataStorageRows []DataStorageRow) error
+	SaveBatch(ctx context.Context, dataStorageRows []DataStorageRow) error
+
+	// RecordSplitClick учитывает переход на вариант A/B теста короткого URL.
+	RecordSplitClick(ctx context.Context, shortURL string, variant int) error
+
+	// RedeemClick атомарно учитывает переход по короткому URL с ограничением количества переходов.
+	// Возвращает количество оставшихся переходов и false, если лимит переходов исчерпан.
+	RedeemClick(ctx context.Context, shortURL string) (int, bool, error)
+
+	// SaveLinkMetadata сохраняет заголовок и Open Graph данные страницы перехода короткого URL.
+	SaveLinkMetadata(ctx context.Context, shortURL string, metadata LinkMetadata) error
 
 	// Init инициализирует соединение с хранилищем данных, используя заданную строку подключения.
 	Init(connectionString string) error
@@ -43,17 +57,29 @@ type URLStorageInterface interface {
 	Close()
 }
 
+// LinkExportInterface определяет методы переноса ссылок между хранилищами.
+type LinkExportInterface interface {
+	// ImportBatch сохраняет перенесённые ссылки так же, как SaveBatch, но без событий их создания:
+	// перенос не должен повторно оповещать подписчиков о существующих ссылках.
+	ImportBatch(ctx context.Context, dataStorageRows []DataStorageRow) error
+
+	// LoadLinkDetails возвращает данные страниц перехода и результаты проверки ссылок,
+	// для которых они сохранены, упорядоченные по короткому URL.
+	LoadLinkDetails(ctx context.Context) ([]LinkDetails, error)
+
+	// SaveLinkDetails сохраняет перенесённые данные страниц перехода и результаты проверки.
+	// Данные ссылок, которых нет в хранилище, пропускаются.
+	SaveLinkDetails(ctx context.Context, details []LinkDetails) error
+}
+
 // CommandTag - интерфейс для работы с результатами выполнения команд.
 type CommandTag interface{}
 
 // URLStorage предоставляет методы для работы с хранилищем URL в базе данных.
-// Она управляет соединением с базой данных и контекстом, необходимым для выполнения операций.
+// Все операции выполняются в контексте вызывающего, поэтому отмена запроса клиента прерывает их.
 type URLStorage struct {
 	// conn представляет соединение с базой данных, предоставляющее доступ к методам SQL.
 	conn DBConnectionInterface
-
-	// ctx представляет контекст, используемый для управления временем жизни запросов и операций.
-	ctx context.Context
 }
 
 // SetConnection устанавливает объект подключения к бд
@@ -62,61 +88,97 @@ func (us *URLStorage) SetConnection(conn DBConnectionInterface) {
 }
 
 // GetURL возвращает строку, соответствующую заданному короткому URL.
-// Возвращает структуру GetURLRow и булевое значение, указывающее на успех или неудачу.
-func (us *URLStorage) GetURL(shortURL string) (GetURLRow, bool) {
+// Если строки нет, возвращает ErrNotFound, при потере соединения с базой данных — ErrUnavailable.
+func (us *URLStorage) GetURL(ctx context.Context, shortURL string) (GetURLRow, error) {
 	var getURLRow GetURLRow
-	query := fmt.Sprintf("SELECT url, is_deleted FROM %s WHERE short_url = $1", tableName)
-	rows, err := us.conn.Query(us.ctx, query, shortURL)
+	query := fmt.Sprintf(
+		`SELECT url, COALESCE(user_id, ''), is_deleted, disabled_reason, domain, ios_url, android_url, splits,
+		sticky_split, active_from, max_clicks, clicks FROM %s WHERE short_url = $1`, tableName)
+	rows, err := us.conn.Query(ctx, query, shortURL)
 
 	if err != nil {
-		return getURLRow, false
+		return getURLRow, wrapError(err)
 	}
 
+	defer rows.Close()
+
 	rowsCount := 0
 
 	for rows.Next() {
-		if err := rows.Scan(&getURLRow.URL, &getURLRow.IsDeleted); err != nil {
-			return getURLRow, false
+		if err := rows.Scan(
+			&getURLRow.URL, &getURLRow.UserID, &getURLRow.IsDeleted, &getURLRow.DisabledReason, &getURLRow.Domain,
+			&getURLRow.IOSURL, &getURLRow.AndroidURL, &getURLRow.Splits, &getURLRow.StickySplit, &getURLRow.ActiveFrom,
+			&getURLRow.MaxClicks, &getURLRow.Clicks,
+		); err != nil {
+			return getURLRow, wrapError(err)
 		}
 
 		rowsCount++
 	}
 
+	if err = rows.Err(); err != nil {
+		return getURLRow, wrapError(err)
+	}
+
 	if rowsCount == 0 {
-		return getURLRow, false
+		return getURLRow, ErrNotFound
 	}
 
-	return getURLRow, true
+	return getURLRow, nil
 }
 
 // GetURLCount возвращает общее количество URL в хранилище.
-func (us *URLStorage) GetURLCount() int {
-	return 0
+// В случае ошибки выполнения запроса возвращает 0.
+func (us *URLStorage) GetURLCount(ctx context.Context) int {
+	query := fmt.Sprintf("SELECT COUNT(*) FROM %s", tableName)
+	rows, err := us.conn.Query(ctx, query)
+
+	if err != nil {
+		return 0
+	}
+
+	defer rows.Close()
+
+	count := 0
+
+	for rows.Next() {
+		if err := rows.Scan(&count); err != nil {
+			return 0
+		}
+	}
+
+	return count
 }
 
 // GetShortURL возвращает короткий URL для указанного полного URL.
-// Если в репозитории не найдено, возвращает ошибку.
-func (us *URLStorage) GetShortURL(URL string) (string, error) {
+// Если в репозитории не найдено, возвращает ErrNotFound.
+func (us *URLStorage) GetShortURL(ctx context.Context, URL string) (string, error) {
 	query := fmt.Sprintf("SELECT short_url FROM %s WHERE url = $1", tableName)
-	rows, err := us.conn.Query(us.ctx, query, URL)
+	rows, err := us.conn.Query(ctx, query, URL)
 
 	if err != nil {
-		return "", err
+		return "", wrapError(err)
 	}
 
+	defer rows.Close()
+
 	shortURL := ""
 	rowsCount := 0
 
 	for rows.Next() {
 		if err := rows.Scan(&shortURL); err != nil {
-			return "", err
+			return "", wrapError(err)
 		}
 
 		rowsCount++
 	}
 
+	if err = rows.Err(); err != nil {
+		return "", wrapError(err)
+	}
+
 	if rowsCount == 0 {
-		return "", errors.New("not found")
+		return "", ErrNotFound
 	}
 
 	return shortURL, nil
@@ -124,37 +186,116 @@ func (us *URLStorage) GetShortURL(URL string) (string, error) {
 
 // Init инициализирует соединение с базой данных по заданной строке подключения.
 func (us *URLStorage) Init(connectionString string) error {
-	us.ctx = context.Background()
-	var err error
-	us.conn, err = pgxpool.Connect(us.ctx, connectionString)
+	pool, err := NewPool(context.Background(), connectionString, PoolConfig{})
 
 	if err != nil {
-		log.Fatalf("Error while initializing db connection: %v", err)
+		return err
 	}
 
+	us.SetConnection(pool)
+
 	return nil
 }
 
 // Ping проверяет состояние соединения с базой данных.
 // Возвращает true, если соединение успешно, и false, если возникает ошибка.
-func (us *URLStorage) Ping() bool {
-	if err := us.conn.Ping(us.ctx); err != nil {
+func (us *URLStorage) Ping(ctx context.Context) bool {
+	if err := us.conn.Ping(ctx); err != nil {
 		return false
 	}
 
 	return true
 }
 
-// Save сохраняет короткий URL с соответствующим полному URL и идентификатором пользователя.
-func (us *URLStorage) Save(ShortURL string, URL string, userID string) error {
-	query := fmt.Sprintf("INSERT INTO %s (short_url, url, user_id) VALUES ($1, $2, $3)", tableName)
-	_, err := us.conn.Exec(us.ctx, query, ShortURL, URL, userID)
-	return err
+// Save сохраняет короткий URL с соответствующим полному URL, идентификатором пользователя и доменом.
+// Вместе со ссылкой в outbox записывается событие её создания.
+func (us *URLStorage) Save(ctx context.Context, dataStorageRow DataStorageRow) error {
+	query := withOutbox(fmt.Sprintf(`INSERT INTO %s
+		(short_url, url, user_id, domain, ios_url, android_url, splits, sticky_split, active_from, max_clicks)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`, tableName), OutboxLinkCreated)
+	_, err := us.conn.Exec(
+		ctx, query, dataStorageRow.ShortURL, dataStorageRow.URL, dataStorageRow.UserID, dataStorageRow.Domain,
+		dataStorageRow.IOSURL, dataStorageRow.AndroidURL, dataStorageRow.Splits, dataStorageRow.StickySplit,
+		dataStorageRow.ActiveFrom, dataStorageRow.MaxClicks)
+	return wrapError(err)
 }
 
-// LoadData загружает данные из хранилища и возвращает их.
-func (us *URLStorage) LoadData() ([]DataStorageRow, error) {
-	return nil, nil
+// InsertOrGet сохраняет ссылку одним запросом INSERT ... ON CONFLICT (url) DO UPDATE.
+// Обновление не меняет существующую строку, но блокирует её и позволяет вернуть её через RETURNING;
+// xmax = 0 отличает вставленную строку от существующей. Событие создания записывается в outbox
+// только для вставленной строки.
+func (us *URLStorage) InsertOrGet(ctx context.Context, dataStorageRow DataStorageRow) (DataStorageRow, bool, error) {
+	query := fmt.Sprintf(`WITH saved AS (
+		INSERT INTO %s
+		(short_url, url, user_id, domain, ios_url, android_url, splits, sticky_split, active_from, max_clicks)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		ON CONFLICT (url) DO UPDATE SET url = EXCLUDED.url
+		RETURNING short_url, url, user_id, domain, (xmax = 0) AS inserted
+	), event AS (%s)
+	SELECT short_url, COALESCE(user_id, ''), domain, inserted FROM saved`,
+		tableName, outboxInsert("saved WHERE inserted", OutboxLinkCreated))
+	rows, err := us.conn.Query(
+		ctx, query, dataStorageRow.ShortURL, dataStorageRow.URL, dataStorageRow.UserID, dataStorageRow.Domain,
+		dataStorageRow.IOSURL, dataStorageRow.AndroidURL, dataStorageRow.Splits, dataStorageRow.StickySplit,
+		dataStorageRow.ActiveFrom, dataStorageRow.MaxClicks)
+
+	if err != nil {
+		return DataStorageRow{}, false, wrapError(err)
+	}
+
+	defer rows.Close()
+
+	stored := DataStorageRow{URL: dataStorageRow.URL}
+	inserted := false
+
+	if !rows.Next() {
+		if err = rows.Err(); err == nil {
+			err = ErrNotFound
+		}
+
+		return DataStorageRow{}, false, wrapError(err)
+	}
+
+	if err = rows.Scan(&stored.ShortURL, &stored.UserID, &stored.Domain, &inserted); err != nil {
+		return DataStorageRow{}, false, wrapError(err)
+	}
+
+	if inserted {
+		return dataStorageRow, true, nil
+	}
+
+	return stored, false, nil
+}
+
+// LoadData загружает все ссылки, в том числе удалённые и заблокированные, в порядке их создания.
+func (us *URLStorage) LoadData(ctx context.Context) ([]DataStorageRow, error) {
+	query := fmt.Sprintf(
+		`SELECT id, short_url, url, COALESCE(user_id, ''), is_deleted, disabled_reason, domain, ios_url, android_url,
+		splits, sticky_split, active_from, max_clicks, clicks FROM %s ORDER BY id`, tableName)
+	rows, err := us.conn.Query(ctx, query)
+
+	if err != nil {
+		return nil, wrapError(err)
+	}
+
+	defer rows.Close()
+
+	var dataStorageRows []DataStorageRow
+
+	for rows.Next() {
+		var row DataStorageRow
+
+		if err := rows.Scan(
+			&row.ID, &row.ShortURL, &row.URL, &row.UserID, &row.DeletedFlag, &row.DisabledReason, &row.Domain,
+			&row.IOSURL, &row.AndroidURL, &row.Splits, &row.StickySplit, &row.ActiveFrom, &row.MaxClicks, &row.Clicks,
+		); err != nil {
+			return nil, wrapError(err)
+		}
+
+		dataStorageRows = append(dataStorageRows, row)
+	}
+
+	return dataStorageRows, wrapError(rows.Err())
 }
 
 // Close закрывает соединение с базой данных.
@@ -163,23 +304,123 @@ func (us *URLStorage) Close() {
 }
 
 // SaveBatch сохраняет пакетные данные, представленные в виде массива DataStorageRow.
-func (us *URLStorage) SaveBatch(dataStorageRows []DataStorageRow) error {
+// Пакет сохраняется в одной транзакции вместе с событиями создания добавленных ссылок в outbox.
+// Признаки удаления и блокировки и счётчик переходов сохраняются, что позволяет переносить ссылки
+// из другого хранилища. Ссылки, уже сохранённые с той же парой URL и короткого URL, пропускаются.
+func (us *URLStorage) SaveBatch(ctx context.Context, dataStorageRows []DataStorageRow) error {
+	return sendBatchInTx(ctx, us.conn, insertBatch(withOutbox(insertURLQuery, OutboxLinkCreated), dataStorageRows))
+}
+
+// ImportBatch сохраняет перенесённые ссылки в одной транзакции без событий в outbox.
+// Ссылки, уже сохранённые с той же парой URL и короткого URL, пропускаются.
+func (us *URLStorage) ImportBatch(ctx context.Context, dataStorageRows []DataStorageRow) error {
+	return sendBatchInTx(ctx, us.conn, insertBatch(insertURLQuery, dataStorageRows))
+}
+
+// LoadLinkDetails возвращает данные страниц перехода и результаты проверки ссылок,
+// для которых они сохранены, упорядоченные по короткому URL.
+func (us *URLStorage) LoadLinkDetails(ctx context.Context) ([]LinkDetails, error) {
+	query := fmt.Sprintf(`SELECT short_url, metadata, health FROM %s
+		WHERE metadata IS NOT NULL OR health IS NOT NULL ORDER BY short_url`, tableName)
+	rows, err := us.conn.Query(ctx, query)
+
+	if err != nil {
+		return nil, wrapError(err)
+	}
+
+	defer rows.Close()
+
+	var details []LinkDetails
+
+	for rows.Next() {
+		var item LinkDetails
+
+		if err = rows.Scan(&item.ShortURL, &item.Metadata, &item.Health); err != nil {
+			return nil, wrapError(err)
+		}
+
+		details = append(details, item)
+	}
+
+	return details, wrapError(rows.Err())
+}
+
+// SaveLinkDetails сохраняет перенесённые данные страниц перехода и результаты проверки в одной транзакции.
+// Отсутствующие в переданных данных значения не изменяются.
+func (us *URLStorage) SaveLinkDetails(ctx context.Context, details []LinkDetails) error {
+	batch := &pgx.Batch{}
+	query := fmt.Sprintf(`UPDATE %s SET metadata = COALESCE($2, metadata), health = COALESCE($3, health)
+		WHERE short_url = $1`, tableName)
+
+	for _, item := range details {
+		batch.Queue(query, item.ShortURL, item.Metadata, item.Health)
+	}
+
+	return sendBatchInTx(ctx, us.conn, batch)
+}
+
+// insertURLQuery добавляет ссылку со всеми сохраняемыми при переносе полями.
+const insertURLQuery = `INSERT INTO urls
+	(url, short_url, user_id, domain, ios_url, android_url, splits, sticky_split, active_from, max_clicks,
+	is_deleted, disabled_reason, clicks)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13) ON CONFLICT (url, short_url) DO NOTHING`
+
+// insertBatch формирует пакет из запроса query для каждой ссылки.
+func insertBatch(query string, dataStorageRows []DataStorageRow) *pgx.Batch {
 	batch := &pgx.Batch{}
 	for _, dataStorageRow := range dataStorageRows {
-		batch.Queue(
-			"INSERT INTO urls (url, short_url, user_id) VALUES ($1, $2, $3) ON CONFLICT (url, short_url) DO NOTHING",
-			dataStorageRow.URL, dataStorageRow.ShortURL, dataStorageRow.UserID)
+		batch.Queue(query,
+			dataStorageRow.URL, dataStorageRow.ShortURL, dataStorageRow.UserID, dataStorageRow.Domain,
+			dataStorageRow.IOSURL, dataStorageRow.AndroidURL, dataStorageRow.Splits, dataStorageRow.StickySplit,
+			dataStorageRow.ActiveFrom, dataStorageRow.MaxClicks, dataStorageRow.DeletedFlag,
+			dataStorageRow.DisabledReason, dataStorageRow.Clicks)
 	}
 
-	br := us.conn.SendBatch(context.Background(), batch)
-	defer br.Close()
+	return batch
+}
 
-	for i := 0; i < len(dataStorageRows); i++ {
-		_, err := br.Exec()
-		if err != nil {
-			return err
-		}
+// RecordSplitClick атомарно увеличивает счётчик переходов варианта A/B теста,
+// хранящийся вместе с вариантами короткого URL.
+func (us *URLStorage) RecordSplitClick(ctx context.Context, shortURL string, variant int) error {
+	query := fmt.Sprintf(`UPDATE %s SET splits = jsonb_set(splits, ARRAY[$2::int::text, 'clicks'],
+		to_jsonb(COALESCE((splits->($2::int)->>'clicks')::int, 0) + 1))
+		WHERE short_url = $1 AND jsonb_array_length(splits) > $2::int`, tableName)
+	_, err := us.conn.Exec(ctx, query, shortURL, variant)
+	return wrapError(err)
+}
+
+// RedeemClick атомарно учитывает переход по короткому URL с ограничением количества переходов.
+// Счётчик увеличивается одним запросом UPDATE ... RETURNING, поэтому параллельные переходы
+// не могут превысить лимит. Возвращает количество оставшихся переходов и false,
+// если лимит переходов исчерпан.
+func (us *URLStorage) RedeemClick(ctx context.Context, shortURL string) (int, bool, error) {
+	query := fmt.Sprintf(`UPDATE %s SET clicks = clicks + 1 WHERE short_url = $1 AND clicks < max_clicks
+		RETURNING max_clicks - clicks`, tableName)
+	rows, err := us.conn.Query(ctx, query, shortURL)
+
+	if err != nil {
+		return 0, false, wrapError(err)
 	}
 
-	return nil
+	defer rows.Close()
+
+	if !rows.Next() {
+		return 0, false, wrapError(rows.Err())
+	}
+
+	var remaining int
+
+	if err = rows.Scan(&remaining); err != nil {
+		return 0, false, wrapError(err)
+	}
+
+	return remaining, true, nil
+}
+
+// SaveLinkMetadata сохраняет заголовок и Open Graph данные страницы перехода короткого URL.
+func (us *URLStorage) SaveLinkMetadata(ctx context.Context, shortURL string, metadata LinkMetadata) error {
+	_, err := us.conn.Exec(ctx, fmt.Sprintf("UPDATE %s SET metadata = $1 WHERE short_url = $2", tableName),
+		metadata, shortURL)
+
+	return wrapError(err)
 }
@@ -2,8 +2,11 @@ package storage
 
 import (
 	"context"
+	"errors"
 	"testing"
+	"time"
 
+	"github.com/jackc/pgconn"
 	"github.com/pashagolub/pgxmock"
 	"github.com/stretchr/testify/assert"
 )
@@ -15,7 +18,7 @@ func TestURLStorage_GetURL(t *testing.T) {
 	defer mock.Close()
 
 	ctx := context.Background()
-	storage := &URLStorage{conn: mock, ctx: ctx}
+	storage := &URLStorage{conn: mock}
 
 	// Подготовка тестовых данных
 	shortURL := "short.ly/xyz"
@@ -23,18 +26,32 @@ func TestURLStorage_GetURL(t *testing.T) {
 	expectedIsDeleted := false
 
 	// Задаем ожидание для SQL запроса
-	mock.ExpectQuery(`SELECT url, is_deleted FROM urls WHERE short_url = \$1`).
+	activeFrom := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(`SELECT url, COALESCE\(user_id, ''\), is_deleted, disabled_reason, domain, ios_url, android_url, splits,
+		sticky_split, active_from, max_clicks, clicks FROM urls WHERE short_url = \$1`).
 		WithArgs(shortURL).
-		WillReturnRows(pgxmock.NewRows([]string{"url", "is_deleted"}).
-			AddRow(expectedURL, expectedIsDeleted))
+		WillReturnRows(pgxmock.NewRows([]string{
+			"url", "user_id", "is_deleted", "disabled_reason", "domain", "ios_url", "android_url", "splits", "sticky_split",
+			"active_from", "max_clicks", "clicks",
+		}).
+			AddRow(expectedURL, "user1", expectedIsDeleted, "", "go.example.com", "https://apps.apple.com/app/id1", "",
+				[]SplitDestination{{URL: "http://a.example.com", Weight: 70}}, true, &activeFrom, 3, 1))
 
 	// Выполнение теста
-	urlRow, ok := storage.GetURL(shortURL)
+	urlRow, err := storage.GetURL(ctx, shortURL)
 
 	// Проверка результатов
-	assert.True(t, ok, "Expected URL to be found")
+	assert.NoError(t, err, "Expected URL to be found")
 	assert.Equal(t, expectedURL, urlRow.URL, "Returned URL should match expected")
+	assert.Equal(t, "user1", urlRow.UserID, "Expected owner should match")
 	assert.Equal(t, expectedIsDeleted, urlRow.IsDeleted, "Expected is_deleted flag should match")
+	assert.Equal(t, "go.example.com", urlRow.Domain, "Expected domain should match")
+	assert.Equal(t, "https://apps.apple.com/app/id1", urlRow.IOSURL, "Expected iOS URL should match")
+	assert.Equal(t, []SplitDestination{{URL: "http://a.example.com", Weight: 70}}, urlRow.Splits)
+	assert.True(t, urlRow.StickySplit, "Expected sticky split flag should match")
+	assert.Equal(t, &activeFrom, urlRow.ActiveFrom, "Expected activation time should match")
+	assert.Equal(t, 3, urlRow.MaxClicks, "Expected click limit should match")
+	assert.Equal(t, 1, urlRow.Clicks, "Expected click count should match")
 	assert.NoError(t, mock.ExpectationsWereMet(), "There should be no unfulfilled expectations")
 }
 
@@ -44,7 +61,7 @@ func TestURLStorage_GetShortURL(t *testing.T) {
 	defer mock.Close()
 
 	ctx := context.Background()
-	storage := &URLStorage{conn: mock, ctx: ctx}
+	storage := &URLStorage{conn: mock}
 
 	fullURL := "http://example.com"
 	expectedShortURL := "short.ly/xyz"
@@ -56,7 +73,7 @@ func TestURLStorage_GetShortURL(t *testing.T) {
 			AddRow(expectedShortURL))
 
 	// Выполнение теста
-	actualShortURL, err := storage.GetShortURL(fullURL)
+	actualShortURL, err := storage.GetShortURL(ctx, fullURL)
 
 	// Проверка результатов
 	assert.NoError(t, err, "Expected no error")
@@ -70,18 +87,19 @@ func TestURLStorage_Save(t *testing.T) {
 	defer mock.Close()
 
 	ctx := context.Background()
-	storage := &URLStorage{conn: mock, ctx: ctx}
+	storage := &URLStorage{conn: mock}
 
 	shortURL := "short.ly/xyz"
 	fullURL := "http://example.com"
 	userID := "user123"
 
-	mock.ExpectExec(`INSERT INTO urls \(short_url, url, user_id\) VALUES \(\$1, \$2, \$3\)`).
-		WithArgs(shortURL, fullURL, userID).
+	mock.ExpectExec(
+		`INSERT INTO urls\s+\(short_url, url, user_id, domain, ios_url, android_url, splits, sticky_split, active_from, max_clicks\)`).
+		WithArgs(shortURL, fullURL, userID, "", "", "", []SplitDestination(nil), false, (*time.Time)(nil), 0).
 		WillReturnResult(pgxmock.NewResult("1", 1)) // 1 строка успешно вставлена
 
 	// Выполнение теста
-	err = storage.Save(shortURL, fullURL, userID)
+	err = storage.Save(ctx, DataStorageRow{ShortURL: shortURL, URL: fullURL, UserID: userID})
 
 	// Проверка результатов
 	assert.NoError(t, err, "Expected no error during save")
@@ -89,16 +107,27 @@ func TestURLStorage_Save(t *testing.T) {
 }
 
 func TestURLStorage_GetURLCount(t *testing.T) {
-	// У этой функции нет реальной реализации, но мы можем протестировать, что она возвращает 0
 	mock, err := pgxmock.NewPool()
 	assert.NoError(t, err)
 	defer mock.Close()
 
 	ctx := context.Background()
-	storage := &URLStorage{conn: mock, ctx: ctx}
+	storage := &URLStorage{conn: mock}
 
-	count := storage.GetURLCount()
-	assert.Equal(t, 0, count, "Expected URL count to be 0")
+	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM urls`).
+		WillReturnRows(pgxmock.NewRows([]string{"count"}).AddRow(5))
+
+	count := storage.GetURLCount(ctx)
+	assert.Equal(t, 5, count, "Expected URL count to be 5")
+	assert.NoError(t, mock.ExpectationsWereMet(), "There should be no unfulfilled expectations")
+
+	// При ошибке запроса возвращается 0
+	mock.ExpectQuery(`SELECT COUNT\(\*\) FROM urls`).
+		WillReturnError(errors.New("query error"))
+
+	count = storage.GetURLCount(ctx)
+	assert.Equal(t, 0, count, "Expected URL count to be 0 on error")
+	assert.NoError(t, mock.ExpectationsWereMet(), "There should be no unfulfilled expectations")
 }
 
 func TestURLStorage_Ping(t *testing.T) {
@@ -107,13 +136,13 @@ func TestURLStorage_Ping(t *testing.T) {
 	defer mock.Close()
 
 	ctx := context.Background()
-	storage := &URLStorage{conn: mock, ctx: ctx}
+	storage := &URLStorage{conn: mock}
 
 	// Задаем ожидание для SQL запроса
 	mock.ExpectPing().WillReturnError(nil)
 
 	// Выполнение теста
-	assert.True(t, storage.Ping(), "Expected ping to return true")
+	assert.True(t, storage.Ping(ctx), "Expected ping to return true")
 	assert.NoError(t, mock.ExpectationsWereMet(), "There should be no unfulfilled expectations")
 }
 
@@ -121,8 +150,7 @@ func TestURLStorage_Close(t *testing.T) {
 	mock, err := pgxmock.NewPool()
 	assert.NoError(t, err)
 
-	ctx := context.Background()
-	storage := &URLStorage{conn: mock, ctx: ctx}
+	storage := &URLStorage{conn: mock}
 
 	// Ожидаем, что Close будет вызван на соединении
 	mock.ExpectClose()
@@ -130,3 +158,227 @@ func TestURLStorage_Close(t *testing.T) {
 	// Выполнение теста
 	storage.Close()
 }
+
+func TestURLStorage_RecordSplitClick(t *testing.T) {
+	ctx := context.Background()
+	mock, err := pgxmock.NewPool()
+	assert.NoError(t, err)
+	defer mock.Close()
+
+	storage := &URLStorage{conn: mock}
+
+	mock.ExpectExec(`UPDATE urls SET splits = jsonb_set\(splits, ARRAY\[\$2::int::text, 'clicks'\]`).
+		WithArgs("abc", 1).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+
+	assert.NoError(t, storage.RecordSplitClick(ctx, "abc", 1))
+	assert.NoError(t, mock.ExpectationsWereMet(), "There should be no unfulfilled expectations")
+}
+
+func TestURLStorage_RedeemClick(t *testing.T) {
+	ctx := context.Background()
+	mock, err := pgxmock.NewPool()
+	assert.NoError(t, err)
+	defer mock.Close()
+
+	storage := &URLStorage{conn: mock}
+
+	mock.ExpectQuery(`UPDATE urls SET clicks = clicks \+ 1 WHERE short_url = \$1 AND clicks < max_clicks\s+RETURNING max_clicks - clicks`).
+		WithArgs("abc").
+		WillReturnRows(pgxmock.NewRows([]string{"remaining"}).AddRow(2))
+
+	remaining, redeemed, err := storage.RedeemClick(ctx, "abc")
+	assert.NoError(t, err)
+	assert.True(t, redeemed, "Expected click to be redeemed")
+	assert.Equal(t, 2, remaining, "Expected remaining clicks to match")
+
+	// Лимит исчерпан: условие UPDATE не выполняется и строки не возвращаются
+	mock.ExpectQuery(`UPDATE urls SET clicks = clicks \+ 1 WHERE short_url = \$1 AND clicks < max_clicks\s+RETURNING max_clicks - clicks`).
+		WithArgs("abc").
+		WillReturnRows(pgxmock.NewRows([]string{"remaining"}))
+
+	_, redeemed, err = storage.RedeemClick(ctx, "abc")
+	assert.NoError(t, err)
+	assert.False(t, redeemed, "Expected click not to be redeemed after limit is reached")
+	assert.NoError(t, mock.ExpectationsWereMet(), "There should be no unfulfilled expectations")
+}
+
+func TestURLStorage_SaveLinkMetadata(t *testing.T) {
+	ctx := context.Background()
+	mock, err := pgxmock.NewPool()
+	assert.NoError(t, err)
+	defer mock.Close()
+
+	storage := &URLStorage{conn: mock}
+	metadata := LinkMetadata{Title: "Example Domain", FetchedAt: time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)}
+
+	mock.ExpectExec(`UPDATE urls SET metadata = \$1 WHERE short_url = \$2`).
+		WithArgs(metadata, "abc").
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+
+	assert.NoError(t, storage.SaveLinkMetadata(ctx, "abc", metadata))
+	assert.NoError(t, mock.ExpectationsWereMet(), "There should be no unfulfilled expectations")
+}
+
+func TestURLStorage_LoadData(t *testing.T) {
+	ctx := context.Background()
+	mock, err := pgxmock.NewPool()
+	assert.NoError(t, err)
+	defer mock.Close()
+
+	storage := &URLStorage{conn: mock}
+
+	mock.ExpectQuery(`SELECT id, short_url, url, COALESCE\(user_id, ''\), is_deleted, disabled_reason, domain, ios_url, android_url,
+		splits, sticky_split, active_from, max_clicks, clicks FROM urls ORDER BY id`).
+		WillReturnRows(pgxmock.NewRows([]string{
+			"id", "short_url", "url", "user_id", "is_deleted", "disabled_reason", "domain", "ios_url", "android_url",
+			"splits", "sticky_split", "active_from", "max_clicks", "clicks",
+		}).
+			AddRow(1, "abc", "http://example.com", "user1", false, "", "", "", "", []SplitDestination(nil), false,
+				(*time.Time)(nil), 0, 4).
+			AddRow(2, "def", "http://example2.com", "user2", true, "spam", "", "", "", []SplitDestination(nil), false,
+				(*time.Time)(nil), 0, 0))
+
+	rows, err := storage.LoadData(ctx)
+
+	assert.NoError(t, err)
+	assert.Len(t, rows, 2)
+	assert.Equal(t, "abc", rows[0].ShortURL)
+	assert.Equal(t, 4, rows[0].Clicks, "Expected click count to be loaded")
+	assert.Equal(t, "user2", rows[1].UserID, "Expected owner to be loaded")
+	assert.True(t, rows[1].DeletedFlag, "Expected deleted flag to be loaded")
+	assert.Equal(t, "spam", rows[1].DisabledReason)
+	assert.NoError(t, mock.ExpectationsWereMet(), "There should be no unfulfilled expectations")
+}
+
+func TestURLStorage_LoadLinkDetails(t *testing.T) {
+	ctx := context.Background()
+	mock, err := pgxmock.NewPool()
+	assert.NoError(t, err)
+	defer mock.Close()
+
+	storage := &URLStorage{conn: mock}
+	metadata := &LinkMetadata{Title: "Example Domain", FetchedAt: time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)}
+	health := &LinkHealth{Status: 404, Failures: 3, Dead: true}
+
+	mock.ExpectQuery(`SELECT short_url, metadata, health FROM urls
+		WHERE metadata IS NOT NULL OR health IS NOT NULL ORDER BY short_url`).
+		WillReturnRows(pgxmock.NewRows([]string{"short_url", "metadata", "health"}).
+			AddRow("abc", metadata, (*LinkHealth)(nil)).
+			AddRow("def", (*LinkMetadata)(nil), health))
+
+	details, err := storage.LoadLinkDetails(ctx)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []LinkDetails{{ShortURL: "abc", Metadata: metadata}, {ShortURL: "def", Health: health}}, details)
+	assert.NoError(t, mock.ExpectationsWereMet(), "There should be no unfulfilled expectations")
+}
+
+func TestURLStorage_GetShortURLCancelled(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	assert.NoError(t, err)
+	defer mock.Close()
+
+	storage := &URLStorage{conn: mock}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	mock.ExpectQuery("SELECT short_url FROM urls WHERE url = \\$1").
+		WithArgs("http://example.com").
+		WillDelayFor(time.Second).
+		WillReturnRows(pgxmock.NewRows([]string{"short_url"}).AddRow("abc"))
+
+	_, err = storage.GetShortURL(ctx, "http://example.com")
+
+	assert.ErrorIs(t, err, pgxmock.ErrCancelled, "Query should be cancelled together with the context")
+}
+
+func TestURLStorage_GetURLNotFound(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	assert.NoError(t, err)
+	defer mock.Close()
+
+	ctx := context.Background()
+	storage := &URLStorage{conn: mock}
+
+	mock.ExpectQuery("SELECT url").
+		WithArgs("missing").
+		WillReturnRows(pgxmock.NewRows([]string{
+			"url", "user_id", "is_deleted", "disabled_reason", "domain", "ios_url", "android_url", "splits", "sticky_split",
+			"active_from", "max_clicks", "clicks",
+		}))
+
+	_, err = storage.GetURL(ctx, "missing")
+
+	assert.ErrorIs(t, err, ErrNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet(), "There should be no unfulfilled expectations")
+}
+
+func TestURLStorage_GetURLUnavailable(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	assert.NoError(t, err)
+	defer mock.Close()
+
+	ctx := context.Background()
+	storage := &URLStorage{conn: mock}
+
+	mock.ExpectQuery("SELECT url").
+		WithArgs("abc").
+		WillReturnError(&pgconn.PgError{Code: "57P01", Message: "terminating connection due to administrator command"})
+
+	_, err = storage.GetURL(ctx, "abc")
+
+	assert.ErrorIs(t, err, ErrUnavailable, "Outage should not be reported as a missing link")
+	assert.NotErrorIs(t, err, ErrNotFound)
+}
+
+func TestURLStorage_SaveConflict(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	assert.NoError(t, err)
+	defer mock.Close()
+
+	ctx := context.Background()
+	storage := &URLStorage{conn: mock}
+
+	mock.ExpectExec("INSERT INTO urls").
+		WillReturnError(&pgconn.PgError{Code: "23505", ConstraintName: "urls_url_key"})
+
+	err = storage.Save(ctx, DataStorageRow{ShortURL: "abc", URL: "http://example.com", UserID: "user1"})
+
+	assert.ErrorIs(t, err, ErrConflict)
+
+	var pgErr *pgconn.PgError
+	assert.ErrorAs(t, err, &pgErr, "Original database error should be kept")
+}
+
+func TestURLStorage_InsertOrGet(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	assert.NoError(t, err)
+	defer mock.Close()
+
+	ctx := context.Background()
+	storage := &URLStorage{conn: mock}
+	row := DataStorageRow{ShortURL: "abc", URL: "http://example.com", UserID: "user1"}
+	columns := []string{"short_url", "user_id", "domain", "inserted"}
+
+	mock.ExpectQuery(`WITH saved AS \(\s+INSERT INTO urls.*ON CONFLICT \(url\) DO UPDATE SET url = EXCLUDED.url\s+`+
+		`RETURNING short_url, url, user_id, domain, \(xmax = 0\) AS inserted`).
+		WithArgs("abc", "http://example.com", "user1", "", "", "", []SplitDestination(nil), false, (*time.Time)(nil), 0).
+		WillReturnRows(pgxmock.NewRows(columns).AddRow("abc", "user1", "", true))
+	mock.ExpectQuery("WITH saved AS").
+		WillReturnRows(pgxmock.NewRows(columns).AddRow("xyz", "user2", "go.example.com", false))
+
+	stored, created, err := storage.InsertOrGet(ctx, row)
+
+	assert.NoError(t, err)
+	assert.True(t, created, "Inserted row should be reported as created")
+	assert.Equal(t, row, stored)
+
+	row.ShortURL = "def"
+	stored, created, err = storage.InsertOrGet(ctx, row)
+
+	assert.NoError(t, err)
+	assert.False(t, created, "Existing row should not be reported as created")
+	assert.Equal(t, DataStorageRow{ShortURL: "xyz", URL: "http://example.com", UserID: "user2", Domain: "go.example.com"}, stored)
+	assert.NoError(t, mock.ExpectationsWereMet(), "There should be no unfulfilled expectations")
+}
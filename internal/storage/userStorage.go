@@ -3,10 +3,9 @@ package storage
 import (
 	"context"
 	"fmt"
-	"log"
+	"time"
 
 	"github.com/jackc/pgx/v4"
-	"github.com/jackc/pgx/v4/pgxpool"
 )
 
 // UserStorageInterface определяет методы для работы с хранилищем пользователей.
@@ -15,20 +14,35 @@ import (
 type UserStorageInterface interface {
 	// IsUserExist проверяет, существует ли пользователь по указанному уникальному идентификатору.
 	// Возвращает true, если пользователь существует, и false в противном случае.
-	IsUserExist(uniqueID string) bool
+	IsUserExist(ctx context.Context, uniqueID string) bool
 
 	// SaveUser сохраняет нового пользователя с заданным уникальным идентификатором.
 	// Возвращает ошибку, если сохранение не удалось.
-	SaveUser(uniqueID string) error
+	SaveUser(ctx context.Context, uniqueID string) error
 
 	// GetUserUrls возвращает список коротких URL для указанного пользователя.
 	// В случае успешного получения возвращает массив UserUrlsResponseBodyItem и nil.
 	// В случае ошибки возвращает nil и ошибку.
-	GetUserUrls(uniqueID string) ([]UserUrlsResponseBodyItem, error)
+	GetUserUrls(ctx context.Context, uniqueID string) ([]UserUrlsResponseBodyItem, error)
 
 	// DeleteUserUrls удаляет указанные короткие URL для указанного пользователя.
 	// Возвращает ошибку, если возникла ошибка удаления.
-	DeleteUserUrls(uniqueID string, shortURLs []string) error
+	DeleteUserUrls(ctx context.Context, uniqueID string, shortURLs []string) error
+
+	// UpdateUserURLDevices задает адреса перехода для мобильных устройств короткому URL пользователя.
+	// Возвращает false, если короткий URL не найден среди URL пользователя.
+	UpdateUserURLDevices(ctx context.Context, uniqueID string, shortURL string, deviceURLs DeviceURLs) (bool, error)
+
+	// UpdateUserURLActivation задает время активации короткого URL пользователя.
+	// Значение nil делает ссылку активной сразу.
+	// Возвращает false, если короткий URL не найден среди URL пользователя.
+	UpdateUserURLActivation(ctx context.Context, uniqueID string, shortURL string, activeFrom *time.Time) (bool, error)
+
+	// GetUsersCount возвращает общее количество пользователей в хранилище.
+	GetUsersCount(ctx context.Context) int
+
+	// IsUserBanned проверяет, заблокирован ли пользователь администратором.
+	IsUserBanned(ctx context.Context, uniqueID string) bool
 
 	// Init инициализирует хранилище пользователей с помощью строки соединения.
 	// Возвращает ошибку, если произошла ошибка инициализации.
@@ -38,26 +52,46 @@ type UserStorageInterface interface {
 	Close()
 }
 
+// UserExportInterface определяет методы переноса пользователей между хранилищами.
+type UserExportInterface interface {
+	// LoadUsers возвращает всех пользователей хранилища с признаком блокировки.
+	LoadUsers(ctx context.Context) ([]User, error)
+
+	// SaveUsers сохраняет пользователей. Уже сохранённые пользователи не создаются повторно,
+	// но блокируются, если заблокированы в переданных данных.
+	SaveUsers(ctx context.Context, users []User) error
+}
+
+// User представляет пользователя хранилища.
+type User struct {
+	UserID string `json:"user_id"`   // Идентификатор пользователя из куки
+	Banned bool   `json:"is_banned"` // Признак блокировки пользователя администратором
+}
+
 // UsersStorage предоставляет реализацию для работы с хранилищем пользователей
 // и взаимодействия с базой данных через пул соединений pgx.
 type UsersStorage struct {
 	// conn представляет пул соединений с базой данных, позволяющий выполнять SQL-команды и запросы.
 	conn DBConnectionInterface
+}
 
-	// ctx представляет контекст, используемый для управления временем жизни запросов и операций.
-	ctx context.Context
+// SetConnection устанавливает объект подключения к бд
+func (us *UsersStorage) SetConnection(conn DBConnectionInterface) {
+	us.conn = conn
 }
 
 // IsUserExist проверяет, существует ли пользователь по его уникальному идентификатору.
 // Возвращает true, если пользователь существует, и false в противном случае.
-func (us *UsersStorage) IsUserExist(uniqueID string) bool {
+func (us *UsersStorage) IsUserExist(ctx context.Context, uniqueID string) bool {
 	query := "SELECT id FROM users_cookie WHERE user_id = $1"
-	rows, err := us.conn.Query(us.ctx, query, uniqueID)
+	rows, err := us.conn.Query(ctx, query, uniqueID)
 
 	if err != nil {
 		return false
 	}
 
+	defer rows.Close()
+
 	var id int
 	var rowsCount int
 
@@ -72,64 +106,178 @@ func (us *UsersStorage) IsUserExist(uniqueID string) bool {
 	return rowsCount > 0
 }
 
+// IsUserBanned проверяет, заблокирован ли пользователь администратором.
+// В случае ошибки выполнения запроса возвращает false.
+func (us *UsersStorage) IsUserBanned(ctx context.Context, uniqueID string) bool {
+	rows, err := us.conn.Query(ctx, "SELECT is_banned FROM users_cookie WHERE user_id = $1", uniqueID)
+
+	if err != nil {
+		return false
+	}
+
+	defer rows.Close()
+
+	isBanned := false
+
+	for rows.Next() {
+		if err := rows.Scan(&isBanned); err != nil {
+			return false
+		}
+	}
+
+	return isBanned
+}
+
 // SaveUser сохраняет нового пользователя с указанным уникальным идентификатором.
 // Возвращает ошибку, если сохранение не удалось.
-func (us *UsersStorage) SaveUser(uniqueID string) error {
+func (us *UsersStorage) SaveUser(ctx context.Context, uniqueID string) error {
 	query := "INSERT INTO users_cookie (user_id) VALUES ($1)"
-	_, err := us.conn.Exec(us.ctx, query, uniqueID)
-	return err
+	_, err := us.conn.Exec(ctx, query, uniqueID)
+	return wrapError(err)
+}
+
+// LoadUsers возвращает всех пользователей в порядке их создания.
+func (us *UsersStorage) LoadUsers(ctx context.Context) ([]User, error) {
+	rows, err := us.conn.Query(ctx, "SELECT user_id, is_banned FROM users_cookie ORDER BY id")
+
+	if err != nil {
+		return nil, wrapError(err)
+	}
+
+	defer rows.Close()
+
+	var users []User
+
+	for rows.Next() {
+		var user User
+
+		if err := rows.Scan(&user.UserID, &user.Banned); err != nil {
+			return nil, wrapError(err)
+		}
+
+		users = append(users, user)
+	}
+
+	return users, wrapError(rows.Err())
+}
+
+// SaveUsers сохраняет пользователей одним запросом.
+// Уже сохранённые пользователи блокируются, если заблокированы в переданных данных.
+func (us *UsersStorage) SaveUsers(ctx context.Context, users []User) error {
+	userIDs := make([]string, 0, len(users))
+	banned := make([]bool, 0, len(users))
+
+	for _, user := range users {
+		userIDs = append(userIDs, user.UserID)
+		banned = append(banned, user.Banned)
+	}
+
+	_, err := us.conn.Exec(ctx, `INSERT INTO users_cookie (user_id, is_banned)
+		SELECT * FROM unnest($1::varchar[], $2::boolean[])
+		ON CONFLICT (user_id) DO UPDATE SET is_banned = users_cookie.is_banned OR EXCLUDED.is_banned`,
+		userIDs, banned)
+
+	return wrapError(err)
 }
 
 // GetUserUrls возвращает список URL, сохраненных для указанного пользователя.
 // Возвращает массив UserUrlsResponseBodyItem и ошибку, если произошла ошибка чтения.
-func (us *UsersStorage) GetUserUrls(uniqueID string) ([]UserUrlsResponseBodyItem, error) {
-	query := fmt.Sprintf("SELECT url, short_url FROM %s WHERE user_id = $1 AND is_deleted = false", tableName)
-	rows, err := us.conn.Query(us.ctx, query, uniqueID)
+func (us *UsersStorage) GetUserUrls(ctx context.Context, uniqueID string) ([]UserUrlsResponseBodyItem, error) {
+	query := fmt.Sprintf(
+		`SELECT url, short_url, domain, ios_url, android_url, splits, active_from, max_clicks, clicks, health, metadata
+		FROM %s WHERE user_id = $1 AND is_deleted = false`, tableName)
+	rows, err := us.conn.Query(ctx, query, uniqueID)
 
 	if err != nil {
-		return nil, err
+		return nil, wrapError(err)
 	}
 
+	defer rows.Close()
+
 	var responseUrls []UserUrlsResponseBodyItem
 
 	for rows.Next() {
-		var url string
-		var shortURL string
 		var responseItem UserUrlsResponseBodyItem
 
-		if err := rows.Scan(&url, &shortURL); err != nil {
-			return nil, err
+		if err := rows.Scan(
+			&responseItem.OriginalURL, &responseItem.ShortURL, &responseItem.Domain,
+			&responseItem.IOSURL, &responseItem.AndroidURL, &responseItem.Splits, &responseItem.ActiveFrom,
+			&responseItem.MaxClicks, &responseItem.Clicks, &responseItem.Health,
+			&responseItem.Metadata,
+		); err != nil {
+			return nil, wrapError(err)
 		}
 
-		responseItem.OriginalURL = url
-		responseItem.ShortURL = shortURL
-
 		responseUrls = append(responseUrls, responseItem)
 	}
 
 	return responseUrls, nil
 }
 
+// GetUsersCount возвращает общее количество пользователей в хранилище.
+// В случае ошибки выполнения запроса возвращает 0.
+func (us *UsersStorage) GetUsersCount(ctx context.Context) int {
+	rows, err := us.conn.Query(ctx, "SELECT COUNT(*) FROM users_cookie")
+
+	if err != nil {
+		return 0
+	}
+
+	defer rows.Close()
+
+	count := 0
+
+	for rows.Next() {
+		if err := rows.Scan(&count); err != nil {
+			return 0
+		}
+	}
+
+	return count
+}
+
 // DeleteUserUrls удаляет указанные короткие URL для указанного пользователя.
 // Возвращает ошибку, если возникла ошибка удаления.
-func (us *UsersStorage) DeleteUserUrls(uniqueID string, shortURLS []string) error {
+func (us *UsersStorage) DeleteUserUrls(ctx context.Context, uniqueID string, shortURLS []string) error {
 	batch := &pgx.Batch{}
 	for _, shortURL := range shortURLS {
-		batch.Queue(
-			"UPDATE urls SET is_deleted = true WHERE short_url = $1 AND user_id = $2", shortURL, uniqueID)
+		batch.Queue(withOutbox(
+			"UPDATE urls SET is_deleted = true WHERE short_url = $1 AND user_id = $2 AND is_deleted = false",
+			OutboxLinkDeleted), shortURL, uniqueID)
 	}
 
-	br := us.conn.SendBatch(context.Background(), batch)
-	defer br.Close()
+	return sendBatchInTx(ctx, us.conn, batch)
+}
 
-	for i := 0; i < len(shortURLS); i++ {
-		_, err := br.Exec()
-		if err != nil {
-			return err
-		}
+// UpdateUserURLDevices задает адреса перехода для мобильных устройств короткому URL пользователя.
+// Возвращает false, если короткий URL не найден среди неудалённых URL пользователя.
+func (us *UsersStorage) UpdateUserURLDevices(
+	ctx context.Context, uniqueID string, shortURL string, deviceURLs DeviceURLs) (bool, error) {
+	query := fmt.Sprintf(
+		"UPDATE %s SET ios_url = $3, android_url = $4 WHERE short_url = $1 AND user_id = $2 AND is_deleted = false",
+		tableName)
+	tag, err := us.conn.Exec(ctx, query, shortURL, uniqueID, deviceURLs.IOSURL, deviceURLs.AndroidURL)
+
+	if err != nil {
+		return false, wrapError(err)
 	}
 
-	return nil
+	return tag.RowsAffected() > 0, nil
+}
+
+// UpdateUserURLActivation задает время активации короткого URL пользователя.
+// Возвращает false, если короткий URL не найден среди неудалённых URL пользователя.
+func (us *UsersStorage) UpdateUserURLActivation(
+	ctx context.Context, uniqueID string, shortURL string, activeFrom *time.Time) (bool, error) {
+	query := fmt.Sprintf(
+		"UPDATE %s SET active_from = $3 WHERE short_url = $1 AND user_id = $2 AND is_deleted = false", tableName)
+	tag, err := us.conn.Exec(ctx, query, shortURL, uniqueID, activeFrom)
+
+	if err != nil {
+		return false, wrapError(err)
+	}
+
+	return tag.RowsAffected() > 0, nil
 }
 
 // Init инициализирует соединение с базой данных по заданной строке подключения.
@@ -138,14 +286,14 @@ func (us *UsersStorage) DeleteUserUrls(uniqueID string, shortURLS []string) erro
 //
 // Возвращает ошибку, если инициализация соединения не удалась.
 func (us *UsersStorage) Init(connectionString string) error {
-	us.ctx = context.Background()
-	var err error
-	us.conn, err = pgxpool.Connect(us.ctx, connectionString)
+	pool, err := NewPool(context.Background(), connectionString, PoolConfig{})
 
 	if err != nil {
-		log.Fatalf("Error while initializing db connection: %v", err)
+		return err
 	}
 
+	us.SetConnection(pool)
+
 	return nil
 }
 
@@ -6,6 +6,7 @@ import (
 	"github.com/pashagolub/pgxmock"
 	"github.com/stretchr/testify/assert"
 	"testing"
+	"time"
 )
 
 func TestUsersStorage_IsUserExist(t *testing.T) {
@@ -14,7 +15,7 @@ func TestUsersStorage_IsUserExist(t *testing.T) {
 	defer mock.Close()
 
 	ctx := context.Background()
-	storage := &UsersStorage{conn: mock, ctx: ctx}
+	storage := &UsersStorage{conn: mock}
 
 	uniqueID := "user123"
 
@@ -23,7 +24,7 @@ func TestUsersStorage_IsUserExist(t *testing.T) {
 		WithArgs(uniqueID).
 		WillReturnRows(pgxmock.NewRows([]string{"id"}).AddRow(1)) // Успешный случай, пользователь существует
 
-	exists := storage.IsUserExist(uniqueID)
+	exists := storage.IsUserExist(ctx, uniqueID)
 	assert.True(t, exists, "Expected user to exist")
 	assert.NoError(t, mock.ExpectationsWereMet(), "There should be no unfulfilled expectations")
 
@@ -32,7 +33,7 @@ func TestUsersStorage_IsUserExist(t *testing.T) {
 		WithArgs(uniqueID).
 		WillReturnRows(pgxmock.NewRows([]string{"id"})) // Пользователь не найден
 
-	exists = storage.IsUserExist(uniqueID)
+	exists = storage.IsUserExist(ctx, uniqueID)
 	assert.False(t, exists, "Expected user to not exist")
 	assert.NoError(t, mock.ExpectationsWereMet(), "There should be no unfulfilled expectations")
 }
@@ -43,7 +44,7 @@ func TestUsersStorage_SaveUser(t *testing.T) {
 	defer mock.Close()
 
 	ctx := context.Background()
-	storage := &UsersStorage{conn: mock, ctx: ctx}
+	storage := &UsersStorage{conn: mock}
 
 	uniqueID := "user123"
 
@@ -52,7 +53,7 @@ func TestUsersStorage_SaveUser(t *testing.T) {
 		WithArgs(uniqueID).
 		WillReturnResult(pgxmock.NewResult("1", 1)) // Успешная вставка
 
-	err = storage.SaveUser(uniqueID)
+	err = storage.SaveUser(ctx, uniqueID)
 	assert.NoError(t, err, "Expected no error during SaveUser")
 	assert.NoError(t, mock.ExpectationsWereMet(), "There should be no unfulfilled expectations")
 }
@@ -63,31 +64,148 @@ func TestUsersStorage_GetUserUrls(t *testing.T) {
 	defer mock.Close()
 
 	ctx := context.Background()
-	storage := &UsersStorage{conn: mock, ctx: ctx}
+	storage := &UsersStorage{conn: mock}
 
 	uniqueID := "user123"
 
 	// Установка ожидания для SQL запроса
-	mock.ExpectQuery("SELECT url, short_url FROM urls WHERE user_id = \\$1 AND is_deleted = false").
+	mock.ExpectQuery(`SELECT url, short_url, domain, ios_url, android_url, splits, active_from, max_clicks, clicks, health, metadata
+		FROM urls WHERE user_id = \$1 AND is_deleted = false`).
 		WithArgs(uniqueID).
-		WillReturnRows(pgxmock.NewRows([]string{"url", "short_url"}).
-			AddRow("http://example.com", "short.ly/xyz").
-			AddRow("http://example2.com", "short.ly/abc")) // Данные для пользователя
-
-	urls, err := storage.GetUserUrls(uniqueID)
+		WillReturnRows(pgxmock.NewRows(
+			[]string{
+				"url", "short_url", "domain", "ios_url", "android_url", "splits", "active_from", "max_clicks", "clicks",
+				"health", "metadata",
+			}).
+			AddRow("http://example.com", "short.ly/xyz", "", "", "", []SplitDestination(nil), nil, 0, 0, nil,
+				&LinkMetadata{Title: "Example Domain"}).
+			AddRow("http://example2.com", "short.ly/abc", "go.example.com", "", "market://details?id=app",
+				[]SplitDestination{{URL: "http://a.example.com", Weight: 1, Clicks: 5}}, nil, 1, 1,
+				&LinkHealth{Status: 404, Failures: 3, Dead: true}, nil)) // Данные для пользователя
+
+	urls, err := storage.GetUserUrls(ctx, uniqueID)
 	assert.NoError(t, err, "Expected no error during GetUserUrls")
 	assert.Len(t, urls, 2, "Expected 2 URLs to be returned")
 	assert.Equal(t, "http://example.com", urls[0].OriginalURL, "Expected first URL to match")
 	assert.Equal(t, "short.ly/xyz", urls[0].ShortURL, "Expected first short URL to match")
+	assert.Equal(t, "go.example.com", urls[1].Domain, "Expected second domain to match")
+	assert.Equal(t, "market://details?id=app", urls[1].AndroidURL, "Expected second Android URL to match")
+	assert.Equal(t, 5, urls[1].Splits[0].Clicks, "Expected split clicks to match")
+	assert.Nil(t, urls[0].Health, "Expected unchecked link to have no health")
+	assert.Equal(t, "Example Domain", urls[0].Metadata.Title, "Expected page title to match")
+	assert.True(t, urls[1].Health.Dead, "Expected health check result to match")
 	assert.NoError(t, mock.ExpectationsWereMet(), "There should be no unfulfilled expectations")
 
 	// Проверяем случай, когда возникает ошибка
-	mock.ExpectQuery("SELECT url, short_url FROM urls WHERE user_id = \\$1 AND is_deleted = false").
+	mock.ExpectQuery(`SELECT url, short_url, domain, ios_url, android_url, splits, active_from, max_clicks, clicks, health, metadata
+		FROM urls WHERE user_id = \$1 AND is_deleted = false`).
 		WithArgs(uniqueID).
 		WillReturnError(errors.New("query error")) // Ошибка выполнения запроса
 
-	urls, err = storage.GetUserUrls(uniqueID)
+	urls, err = storage.GetUserUrls(ctx, uniqueID)
 	assert.Error(t, err, "Expected error during GetUserUrls")
 	assert.Nil(t, urls, "Expected nil URLs in case of error")
 	assert.NoError(t, mock.ExpectationsWereMet(), "There should be no unfulfilled expectations")
 }
+
+func TestUsersStorage_GetUsersCount(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	assert.NoError(t, err)
+	defer mock.Close()
+
+	ctx := context.Background()
+	storage := &UsersStorage{conn: mock}
+
+	mock.ExpectQuery("SELECT COUNT\\(\\*\\) FROM users_cookie").
+		WillReturnRows(pgxmock.NewRows([]string{"count"}).AddRow(3))
+
+	count := storage.GetUsersCount(ctx)
+	assert.Equal(t, 3, count, "Expected users count to be 3")
+	assert.NoError(t, mock.ExpectationsWereMet(), "There should be no unfulfilled expectations")
+}
+
+func TestUsersStorage_UpdateUserURLDevices(t *testing.T) {
+	ctx := context.Background()
+	mock, err := pgxmock.NewPool()
+	assert.NoError(t, err)
+	defer mock.Close()
+
+	storage := &UsersStorage{conn: mock}
+	deviceURLs := DeviceURLs{IOSURL: "https://apps.apple.com/app/id1", AndroidURL: "market://details?id=app"}
+
+	mock.ExpectExec(`UPDATE urls SET ios_url = \$3, android_url = \$4 WHERE short_url = \$1 AND user_id = \$2`).
+		WithArgs("abc", "user1", deviceURLs.IOSURL, deviceURLs.AndroidURL).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+
+	found, err := storage.UpdateUserURLDevices(ctx, "user1", "abc", deviceURLs)
+	assert.NoError(t, err)
+	assert.True(t, found)
+
+	mock.ExpectExec(`UPDATE urls SET ios_url = \$3, android_url = \$4 WHERE short_url = \$1 AND user_id = \$2`).
+		WithArgs("abc", "user2", "", "").
+		WillReturnResult(pgxmock.NewResult("UPDATE", 0))
+
+	found, err = storage.UpdateUserURLDevices(ctx, "user2", "abc", DeviceURLs{})
+	assert.NoError(t, err)
+	assert.False(t, found, "Expected link of another user not to be updated")
+	assert.NoError(t, mock.ExpectationsWereMet(), "There should be no unfulfilled expectations")
+}
+
+func TestUsersStorage_UpdateUserURLActivation(t *testing.T) {
+	ctx := context.Background()
+	mock, err := pgxmock.NewPool()
+	assert.NoError(t, err)
+	defer mock.Close()
+
+	storage := &UsersStorage{conn: mock}
+	activeFrom := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	mock.ExpectExec(`UPDATE urls SET active_from = \$3 WHERE short_url = \$1 AND user_id = \$2`).
+		WithArgs("abc", "user1", &activeFrom).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+
+	found, err := storage.UpdateUserURLActivation(ctx, "user1", "abc", &activeFrom)
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.NoError(t, mock.ExpectationsWereMet(), "There should be no unfulfilled expectations")
+}
+
+func TestUsersStorage_LoadUsers(t *testing.T) {
+	ctx := context.Background()
+	mock, err := pgxmock.NewPool()
+	assert.NoError(t, err)
+	defer mock.Close()
+
+	storage := &UsersStorage{conn: mock}
+
+	mock.ExpectQuery("SELECT user_id, is_banned FROM users_cookie ORDER BY id").
+		WillReturnRows(pgxmock.NewRows([]string{"user_id", "is_banned"}).
+			AddRow("user1", false).
+			AddRow("user2", true))
+
+	users, err := storage.LoadUsers(ctx)
+
+	assert.NoError(t, err)
+	assert.Equal(t, []User{{UserID: "user1"}, {UserID: "user2", Banned: true}}, users)
+	assert.NoError(t, mock.ExpectationsWereMet(), "There should be no unfulfilled expectations")
+}
+
+func TestUsersStorage_SaveUsers(t *testing.T) {
+	ctx := context.Background()
+	mock, err := pgxmock.NewPool()
+	assert.NoError(t, err)
+	defer mock.Close()
+
+	storage := &UsersStorage{conn: mock}
+
+	mock.ExpectExec(`INSERT INTO users_cookie \(user_id, is_banned\)
+		SELECT \* FROM unnest\(\$1::varchar\[\], \$2::boolean\[\]\)
+		ON CONFLICT \(user_id\) DO UPDATE SET is_banned = users_cookie.is_banned OR EXCLUDED.is_banned`).
+		WithArgs([]string{"user1", "user2"}, []bool{false, true}).
+		WillReturnResult(pgxmock.NewResult("INSERT", 2))
+
+	err = storage.SaveUsers(ctx, []User{{UserID: "user1"}, {UserID: "user2", Banned: true}})
+
+	assert.NoError(t, err)
+	assert.NoError(t, mock.ExpectationsWereMet(), "There should be no unfulfilled expectations")
+}
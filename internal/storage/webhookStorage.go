@@ -0,0 +1,382 @@
+package storage
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// Состояния доставки события вебхука.
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+)
+
+// deliveryLease задает время, на которое выбранные доставки закрепляются за выбравшим их экземпляром.
+// Пока аренда не истекла, доставки не выбираются повторно; если экземпляр не сохранил результат попытки,
+// доставки снова выбираются после её истечения. Аренда покрывает отправку пакета доставок
+// с таймаутом каждого запроса.
+const deliveryLease = 30 * time.Minute
+
+// WebhookStorageInterface определяет методы хранилища вебхуков и очереди доставки событий.
+type WebhookStorageInterface interface {
+	// SaveWebhook сохраняет вебхук и возвращает его с присвоенным идентификатором.
+	SaveWebhook(ctx context.Context, webhook Webhook) (Webhook, error)
+
+	// GetWebhooks возвращает вебхуки владельца. Пустой владелец соответствует вебхукам администратора.
+	GetWebhooks(ctx context.Context, userID string) ([]Webhook, error)
+
+	// DeleteWebhook удаляет вебхук владельца вместе с журналом его доставок.
+	// Возвращает false, если вебхук не найден.
+	DeleteWebhook(ctx context.Context, userID string, id int) (bool, error)
+
+	// GetEventWebhooks возвращает вебхуки, получающие события ссылок пользователя:
+	// вебхуки самого пользователя и вебхуки администратора.
+	GetEventWebhooks(ctx context.Context, userID string) ([]Webhook, error)
+
+	// EnqueueDeliveries добавляет доставки событий в очередь.
+	EnqueueDeliveries(ctx context.Context, deliveries []WebhookDelivery) error
+
+	// GetDueDeliveries выбирает ожидающие доставки, время попытки которых наступило,
+	// вместе с адресом и секретом вебхука, и закрепляет их за вызывающим на время аренды:
+	// параллельные вызовы не возвращают одни и те же доставки.
+	GetDueDeliveries(ctx context.Context, now time.Time, limit int) ([]WebhookDelivery, error)
+
+	// UpdateDelivery сохраняет результат попытки доставки.
+	UpdateDelivery(ctx context.Context, delivery WebhookDelivery) error
+
+	// GetDeliveries возвращает последние доставки вебхука владельца.
+	GetDeliveries(ctx context.Context, userID string, webhookID int, limit int) ([]WebhookDelivery, error)
+}
+
+// Webhook представляет адрес, на который отправляются события жизненного цикла ссылок.
+type Webhook struct {
+	ID        int       `json:"id"`               // Идентификатор вебхука
+	UserID    string    `json:"-"`                // Владелец вебхука, пустой для вебхуков администратора
+	URL       string    `json:"url"`              // Адрес, принимающий события
+	Secret    string    `json:"secret,omitempty"` // Ключ подписи HMAC-SHA256, возвращается только при создании
+	Events    []string  `json:"events,omitempty"` // Типы событий; пустой список означает все события, кроме переходов
+	CreatedAt time.Time `json:"created_at"`       // Время создания вебхука
+}
+
+// WebhookDelivery представляет доставку события на вебхук и результат последней попытки.
+type WebhookDelivery struct {
+	ID             int       `json:"id"`                   // Идентификатор доставки
+	WebhookID      int       `json:"webhook_id"`           // Идентификатор вебхука
+	Event          string    `json:"event"`                // Тип события
+	Payload        string    `json:"payload"`              // Тело события в формате JSON
+	Status         string    `json:"status"`               // Состояние доставки
+	Attempts       int       `json:"attempts"`             // Количество выполненных попыток
+	NextAttemptAt  time.Time `json:"next_attempt_at"`      // Время следующей попытки
+	ResponseStatus int       `json:"response_status"`      // HTTP статус последнего ответа, 0 при ошибке соединения
+	LastError      string    `json:"last_error,omitempty"` // Ошибка последней попытки
+	CreatedAt      time.Time `json:"created_at"`           // Время постановки в очередь
+	UpdatedAt      time.Time `json:"updated_at"`           // Время последнего изменения
+
+	WebhookURL    string `json:"-"` // Адрес вебхука, заполняется при выборке очереди
+	WebhookSecret string `json:"-"` // Секрет вебхука, заполняется при выборке очереди
+}
+
+// WebhookStorage предоставляет реализацию хранилища вебхуков в базе данных.
+type WebhookStorage struct {
+	// conn представляет соединение с базой данных, предоставляющее доступ к методам SQL.
+	conn DBConnectionInterface
+}
+
+// SetConnection устанавливает объект подключения к бд
+func (ws *WebhookStorage) SetConnection(conn DBConnectionInterface) {
+	ws.conn = conn
+}
+
+// Init инициализирует соединение с базой данных по заданной строке подключения.
+func (ws *WebhookStorage) Init(connectionString string) error {
+	pool, err := NewPool(context.Background(), connectionString, PoolConfig{})
+
+	if err != nil {
+		return err
+	}
+
+	ws.SetConnection(pool)
+
+	return nil
+}
+
+// Close закрывает соединение с базой данных.
+func (ws *WebhookStorage) Close() {
+	ws.conn.Close()
+}
+
+// SaveWebhook сохраняет вебхук и возвращает его с присвоенным идентификатором.
+func (ws *WebhookStorage) SaveWebhook(ctx context.Context, webhook Webhook) (Webhook, error) {
+	if webhook.Events == nil {
+		webhook.Events = []string{}
+	}
+
+	query := `INSERT INTO webhooks (user_id, url, secret, events, created_at) VALUES ($1, $2, $3, $4, $5)
+	RETURNING id`
+	rows, err := ws.conn.Query(ctx, query, webhook.UserID, webhook.URL, webhook.Secret, webhook.Events,
+		webhook.CreatedAt)
+
+	if err != nil {
+		return webhook, wrapError(err)
+	}
+
+	defer rows.Close()
+
+	if rows.Next() {
+		err = rows.Scan(&webhook.ID)
+	}
+
+	if err == nil {
+		err = rows.Err()
+	}
+
+	return webhook, wrapError(err)
+}
+
+// GetWebhooks возвращает вебхуки владельца.
+func (ws *WebhookStorage) GetWebhooks(ctx context.Context, userID string) ([]Webhook, error) {
+	return ws.queryWebhooks(ctx,
+		"SELECT id, user_id, url, secret, events, created_at FROM webhooks WHERE user_id = $1 ORDER BY id", userID)
+}
+
+// DeleteWebhook удаляет вебхук владельца. Журнал доставок удаляется каскадно.
+func (ws *WebhookStorage) DeleteWebhook(ctx context.Context, userID string, id int) (bool, error) {
+	tag, err := ws.conn.Exec(ctx, "DELETE FROM webhooks WHERE id = $1 AND user_id = $2", id, userID)
+
+	if err != nil {
+		return false, wrapError(err)
+	}
+
+	return tag.RowsAffected() > 0, nil
+}
+
+// GetEventWebhooks возвращает вебхуки пользователя и вебхуки администратора.
+func (ws *WebhookStorage) GetEventWebhooks(ctx context.Context, userID string) ([]Webhook, error) {
+	return ws.queryWebhooks(ctx, `SELECT id, user_id, url, secret, events, created_at FROM webhooks
+	WHERE user_id = $1 OR user_id = '' ORDER BY id`, userID)
+}
+
+// queryWebhooks выполняет запрос вебхуков с одним параметром.
+func (ws *WebhookStorage) queryWebhooks(ctx context.Context, query string, userID string) ([]Webhook, error) {
+	rows, err := ws.conn.Query(ctx, query, userID)
+
+	if err != nil {
+		return nil, wrapError(err)
+	}
+
+	defer rows.Close()
+
+	var webhooks []Webhook
+
+	for rows.Next() {
+		var webhook Webhook
+
+		if err := rows.Scan(
+			&webhook.ID, &webhook.UserID, &webhook.URL, &webhook.Secret, &webhook.Events, &webhook.CreatedAt,
+		); err != nil {
+			return nil, wrapError(err)
+		}
+
+		webhooks = append(webhooks, webhook)
+	}
+
+	return webhooks, wrapError(rows.Err())
+}
+
+// EnqueueDeliveries добавляет доставки событий в очередь одним пакетом.
+func (ws *WebhookStorage) EnqueueDeliveries(ctx context.Context, deliveries []WebhookDelivery) error {
+	batch := &pgx.Batch{}
+
+	for _, delivery := range deliveries {
+		batch.Queue(`INSERT INTO webhook_deliveries
+		(webhook_id, event, payload, status, next_attempt_at, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $6)`,
+			delivery.WebhookID, delivery.Event, delivery.Payload, delivery.Status, delivery.NextAttemptAt,
+			delivery.CreatedAt)
+	}
+
+	br := ws.conn.SendBatch(ctx, batch)
+	defer br.Close()
+
+	for i := 0; i < len(deliveries); i++ {
+		if _, err := br.Exec(); err != nil {
+			return wrapError(err)
+		}
+	}
+
+	return nil
+}
+
+// GetDueDeliveries выбирает ожидающие доставки, время попытки которых наступило, с блокировкой строк
+// и переносит время их следующей попытки на окончание аренды в той же транзакции.
+// Блокировка с SKIP LOCKED и аренда позволяют нескольким экземплярам сервиса отправлять доставки без повторов.
+func (ws *WebhookStorage) GetDueDeliveries(ctx context.Context, now time.Time, limit int) ([]WebhookDelivery, error) {
+	tx, err := ws.conn.Begin(ctx)
+
+	if err != nil {
+		return nil, wrapError(err)
+	}
+
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx, `SELECT d.id, d.webhook_id, d.event, d.payload, d.status, d.attempts,
+	d.next_attempt_at, d.response_status, d.last_error, d.created_at, d.updated_at, w.url, w.secret
+	FROM webhook_deliveries d JOIN webhooks w ON w.id = d.webhook_id
+	WHERE d.status = $1 AND d.next_attempt_at <= $2 ORDER BY d.next_attempt_at, d.id LIMIT $3
+	FOR UPDATE OF d SKIP LOCKED`, DeliveryPending, now, limit)
+
+	if err != nil {
+		return nil, wrapError(err)
+	}
+
+	deliveries, err := scanDeliveries(rows)
+
+	if err != nil || len(deliveries) == 0 {
+		return nil, err
+	}
+
+	ids := make([]int, 0, len(deliveries))
+	leaseUntil := now.Add(deliveryLease)
+
+	for i := range deliveries {
+		ids = append(ids, deliveries[i].ID)
+		deliveries[i].NextAttemptAt = leaseUntil
+	}
+
+	if _, err = tx.Exec(ctx, "UPDATE webhook_deliveries SET next_attempt_at = $2 WHERE id = ANY($1)",
+		ids, leaseUntil); err != nil {
+		return nil, wrapError(err)
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		return nil, wrapError(err)
+	}
+
+	return deliveries, nil
+}
+
+// UpdateDelivery сохраняет результат попытки доставки.
+func (ws *WebhookStorage) UpdateDelivery(ctx context.Context, delivery WebhookDelivery) error {
+	query := `UPDATE webhook_deliveries SET status = $2, attempts = $3, next_attempt_at = $4, response_status = $5,
+	last_error = $6, updated_at = $7 WHERE id = $1`
+	_, err := ws.conn.Exec(ctx, query, delivery.ID, delivery.Status, delivery.Attempts, delivery.NextAttemptAt,
+		delivery.ResponseStatus, delivery.LastError, delivery.UpdatedAt)
+	return wrapError(err)
+}
+
+// GetDeliveries возвращает последние доставки вебхука владельца.
+func (ws *WebhookStorage) GetDeliveries(
+	ctx context.Context, userID string, webhookID int, limit int) ([]WebhookDelivery, error) {
+	query := `SELECT d.id, d.webhook_id, d.event, d.payload, d.status, d.attempts, d.next_attempt_at,
+	d.response_status, d.last_error, d.created_at, d.updated_at, w.url, w.secret
+	FROM webhook_deliveries d JOIN webhooks w ON w.id = d.webhook_id
+	WHERE w.user_id = $1 AND d.webhook_id = $2 ORDER BY d.id DESC LIMIT $3`
+
+	return ws.queryDeliveries(ctx, query, userID, webhookID, limit)
+}
+
+// queryDeliveries выполняет запрос доставок вместе с адресом и секретом вебхука.
+func (ws *WebhookStorage) queryDeliveries(
+	ctx context.Context, query string, args ...interface{}) ([]WebhookDelivery, error) {
+	rows, err := ws.conn.Query(ctx, query, args...)
+
+	if err != nil {
+		return nil, wrapError(err)
+	}
+
+	return scanDeliveries(rows)
+}
+
+// scanDeliveries читает доставки вместе с адресом и секретом вебхука и закрывает строки результата.
+func scanDeliveries(rows pgx.Rows) ([]WebhookDelivery, error) {
+	defer rows.Close()
+
+	var deliveries []WebhookDelivery
+
+	for rows.Next() {
+		var delivery WebhookDelivery
+
+		if err := rows.Scan(
+			&delivery.ID, &delivery.WebhookID, &delivery.Event, &delivery.Payload, &delivery.Status,
+			&delivery.Attempts, &delivery.NextAttemptAt, &delivery.ResponseStatus, &delivery.LastError,
+			&delivery.CreatedAt, &delivery.UpdatedAt, &delivery.WebhookURL, &delivery.WebhookSecret,
+		); err != nil {
+			return nil, wrapError(err)
+		}
+
+		deliveries = append(deliveries, delivery)
+	}
+
+	return deliveries, wrapError(rows.Err())
+}
+
+// webhookDeliveries собирает журнал доставок вебхука в порядке от новых к старым.
+// Используется хранилищами, которые не поддерживают выборку средствами базы данных.
+func webhookDeliveries(deliveries []WebhookDelivery, webhookID int, limit int) []WebhookDelivery {
+	var result []WebhookDelivery
+
+	for i := len(deliveries) - 1; i >= 0; i-- {
+		if limit > 0 && len(result) >= limit {
+			break
+		}
+
+		if deliveries[i].WebhookID == webhookID {
+			result = append(result, deliveries[i])
+		}
+	}
+
+	return result
+}
+
+// dueDeliveries выбирает ожидающие доставки, время попытки которых наступило,
+// и заполняет адрес и секрет вебхука. Доставки удалённых вебхуков пропускаются.
+// Выбранные доставки не закрепляются, их аренду задает claimDeliveries.
+func dueDeliveries(deliveries []WebhookDelivery, webhooks map[int]Webhook, now time.Time, limit int) []WebhookDelivery {
+	var result []WebhookDelivery
+
+	for _, delivery := range deliveries {
+		if limit > 0 && len(result) >= limit {
+			break
+		}
+
+		webhook, ok := webhooks[delivery.WebhookID]
+
+		if !ok || delivery.Status != DeliveryPending || delivery.NextAttemptAt.After(now) {
+			continue
+		}
+
+		delivery.WebhookURL = webhook.URL
+		delivery.WebhookSecret = webhook.Secret
+		result = append(result, delivery)
+	}
+
+	return result
+}
+
+// claimDeliveries переносит время следующей попытки выбранных доставок на окончание аренды.
+func claimDeliveries(deliveries []WebhookDelivery, now time.Time) {
+	for i := range deliveries {
+		deliveries[i].NextAttemptAt = now.Add(deliveryLease)
+	}
+}
+
+// sortedWebhooks возвращает подходящие под условие вебхуки в порядке идентификаторов.
+func sortedWebhooks(webhooks map[int]Webhook, match func(webhook Webhook) bool) []Webhook {
+	var result []Webhook
+
+	for _, webhook := range webhooks {
+		if match(webhook) {
+			result = append(result, webhook)
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].ID < result[j].ID
+	})
+
+	return result
+}
@@ -0,0 +1,226 @@
+package storage
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pashagolub/pgxmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWebhookStorage_SaveWebhook(t *testing.T) {
+	ctx := context.Background()
+	mock, err := pgxmock.NewPool()
+	assert.NoError(t, err)
+	defer mock.Close()
+
+	storage := &WebhookStorage{conn: mock}
+	createdAt := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	mock.ExpectQuery(`INSERT INTO webhooks \(user_id, url, secret, events, created_at\) VALUES \(\$1, \$2, \$3, \$4, \$5\)\s+RETURNING id`).
+		WithArgs("user1", "https://example.com/hook", "secret", []string{}, createdAt).
+		WillReturnRows(pgxmock.NewRows([]string{"id"}).AddRow(7))
+
+	webhook, err := storage.SaveWebhook(ctx, Webhook{
+		UserID: "user1", URL: "https://example.com/hook", Secret: "secret", CreatedAt: createdAt,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 7, webhook.ID)
+	assert.NoError(t, mock.ExpectationsWereMet(), "There should be no unfulfilled expectations")
+}
+
+func TestWebhookStorage_GetDueDeliveries(t *testing.T) {
+	ctx := context.Background()
+	mock, err := pgxmock.NewPool()
+	assert.NoError(t, err)
+	defer mock.Close()
+
+	storage := &WebhookStorage{conn: mock}
+	now := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT d.id, d.webhook_id, .* FROM webhook_deliveries d JOIN webhooks w ON w.id = d.webhook_id\s+WHERE d.status = \$1 AND d.next_attempt_at <= \$2 .* FOR UPDATE OF d SKIP LOCKED`).
+		WithArgs(DeliveryPending, now, 10).
+		WillReturnRows(pgxmock.NewRows([]string{
+			"id", "webhook_id", "event", "payload", "status", "attempts", "next_attempt_at", "response_status",
+			"last_error", "created_at", "updated_at", "url", "secret",
+		}).AddRow(1, 7, "link.created", `{"type":"link.created"}`, DeliveryPending, 0, now, 0, "", now, now,
+			"https://example.com/hook", "secret"))
+	mock.ExpectExec(`UPDATE webhook_deliveries SET next_attempt_at = \$2 WHERE id = ANY\(\$1\)`).
+		WithArgs([]int{1}, now.Add(deliveryLease)).
+		WillReturnResult(pgxmock.NewResult("UPDATE", 1))
+	mock.ExpectCommit()
+
+	deliveries, err := storage.GetDueDeliveries(ctx, now, 10)
+	assert.NoError(t, err)
+	assert.Len(t, deliveries, 1)
+	assert.Equal(t, "https://example.com/hook", deliveries[0].WebhookURL)
+	assert.Equal(t, "secret", deliveries[0].WebhookSecret)
+	assert.Equal(t, now.Add(deliveryLease), deliveries[0].NextAttemptAt)
+	assert.NoError(t, mock.ExpectationsWereMet(), "There should be no unfulfilled expectations")
+}
+
+func TestWebhookStorage_GetDueDeliveries_NothingDue(t *testing.T) {
+	ctx := context.Background()
+	mock, err := pgxmock.NewPool()
+	assert.NoError(t, err)
+	defer mock.Close()
+
+	storage := &WebhookStorage{conn: mock}
+	now := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`FOR UPDATE OF d SKIP LOCKED`).
+		WithArgs(DeliveryPending, now, 10).
+		WillReturnRows(pgxmock.NewRows([]string{
+			"id", "webhook_id", "event", "payload", "status", "attempts", "next_attempt_at", "response_status",
+			"last_error", "created_at", "updated_at", "url", "secret",
+		}))
+	mock.ExpectRollback()
+
+	deliveries, err := storage.GetDueDeliveries(ctx, now, 10)
+	assert.NoError(t, err)
+	assert.Empty(t, deliveries)
+	assert.NoError(t, mock.ExpectationsWereMet(), "Nothing should be claimed")
+}
+
+func TestInMemoryStorage_GetDueDeliveries_Concurrent(t *testing.T) {
+	ctx := context.Background()
+	ims := &InMemoryStorage{}
+	now := time.Now().UTC()
+
+	webhook, err := ims.SaveWebhook(ctx, Webhook{URL: "https://example.com/hook", Secret: "secret"})
+	assert.NoError(t, err)
+
+	var deliveries []WebhookDelivery
+
+	for i := 0; i < 50; i++ {
+		deliveries = append(deliveries, WebhookDelivery{
+			WebhookID: webhook.ID, Event: "link.created", Status: DeliveryPending, NextAttemptAt: now, CreatedAt: now,
+		})
+	}
+
+	assert.NoError(t, ims.EnqueueDeliveries(ctx, deliveries))
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	claimed := make(map[int]int)
+
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for {
+				due, err := ims.GetDueDeliveries(ctx, now, 7)
+
+				if err != nil || len(due) == 0 {
+					return
+				}
+
+				mu.Lock()
+
+				for _, delivery := range due {
+					claimed[delivery.ID]++
+				}
+
+				mu.Unlock()
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	assert.Len(t, claimed, 50, "Every due delivery should be claimed")
+
+	for id, count := range claimed {
+		assert.Equal(t, 1, count, "Delivery %d should be claimed once", id)
+	}
+
+	due, err := ims.GetDueDeliveries(ctx, now.Add(deliveryLease), 100)
+	assert.NoError(t, err)
+	assert.Len(t, due, 50, "Deliveries without a saved result should be due again after the lease")
+}
+
+func TestWebhookStorage_DeleteWebhook(t *testing.T) {
+	ctx := context.Background()
+	mock, err := pgxmock.NewPool()
+	assert.NoError(t, err)
+	defer mock.Close()
+
+	storage := &WebhookStorage{conn: mock}
+
+	mock.ExpectExec(`DELETE FROM webhooks WHERE id = \$1 AND user_id = \$2`).
+		WithArgs(7, "user2").
+		WillReturnResult(pgxmock.NewResult("DELETE", 0))
+
+	found, err := storage.DeleteWebhook(ctx, "user2", 7)
+	assert.NoError(t, err)
+	assert.False(t, found)
+	assert.NoError(t, mock.ExpectationsWereMet(), "There should be no unfulfilled expectations")
+}
+
+func TestFileStorage_Webhooks(t *testing.T) {
+	ctx := context.Background()
+	clearTestFile()
+	defer clearTestFile()
+
+	fs := &FileStorage{FileStoragePath: testFilePath}
+	_ = fs.Save(ctx, DataStorageRow{ShortURL: "abc", URL: "http://example.com", UserID: "user1"})
+
+	userWebhook, err := fs.SaveWebhook(ctx, Webhook{UserID: "user1", URL: "https://example.com/user", Secret: "s1"})
+	assert.NoError(t, err)
+	adminWebhook, err := fs.SaveWebhook(ctx, Webhook{URL: "https://example.com/admin", Secret: "s2"})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, adminWebhook.ID)
+
+	webhooks, err := fs.GetEventWebhooks(ctx, "user1")
+	assert.NoError(t, err)
+	assert.Len(t, webhooks, 2)
+	assert.Equal(t, "user1", webhooks[0].UserID, "owner should be restored from the file")
+
+	now := time.Now().UTC()
+	assert.NoError(t, fs.EnqueueDeliveries(ctx, []WebhookDelivery{
+		{WebhookID: userWebhook.ID, Event: "link.created", Status: DeliveryPending, NextAttemptAt: now, CreatedAt: now},
+		{WebhookID: adminWebhook.ID, Event: "link.created", Status: DeliveryPending, NextAttemptAt: now, CreatedAt: now},
+	}))
+
+	due, err := fs.GetDueDeliveries(ctx, now, 10)
+	assert.NoError(t, err)
+	assert.Len(t, due, 2)
+	assert.Equal(t, "s1", due[0].WebhookSecret)
+
+	claimed, err := fs.GetDueDeliveries(ctx, now, 10)
+	assert.NoError(t, err)
+	assert.Empty(t, claimed, "claimed deliveries should not be returned again")
+
+	due[0].Status = DeliveryDelivered
+	due[0].Attempts = 1
+	assert.NoError(t, fs.UpdateDelivery(ctx, due[0]))
+
+	deliveries, err := fs.GetDeliveries(ctx, "user1", userWebhook.ID, 10)
+	assert.NoError(t, err)
+	assert.Len(t, deliveries, 1)
+	assert.Equal(t, DeliveryDelivered, deliveries[0].Status)
+	assert.Empty(t, deliveries[0].WebhookSecret, "secret should not be stored with deliveries")
+
+	deliveries, _ = fs.GetDeliveries(ctx, "user2", userWebhook.ID, 10)
+	assert.Empty(t, deliveries, "deliveries of another user's webhook should not be returned")
+
+	found, err := fs.DeleteWebhook(ctx, "user1", adminWebhook.ID)
+	assert.NoError(t, err)
+	assert.False(t, found, "admin webhook should not be deleted by a user")
+
+	found, err = fs.DeleteWebhook(ctx, "", adminWebhook.ID)
+	assert.NoError(t, err)
+	assert.True(t, found)
+
+	due, _ = fs.GetDueDeliveries(ctx, now.Add(deliveryLease), 10)
+	assert.Empty(t, due, "deliveries of deleted webhooks should not be sent")
+
+	// Служебные записи не учитываются как URL
+	assert.Equal(t, 1, fs.GetURLCount(ctx))
+}
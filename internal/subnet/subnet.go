@@ -0,0 +1,72 @@
+package subnet
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// TrustedSubnetChecker ограничивает доступ к обработчикам клиентами из доверенной подсети.
+type TrustedSubnetChecker struct {
+	// TrustedSubnet содержит доверенную подсеть. Если подсеть не задана, доступ запрещён всем.
+	TrustedSubnet *net.IPNet
+}
+
+// NewTrustedSubnetChecker создает TrustedSubnetChecker по подсети в нотации CIDR.
+// Пустая строка допустима и означает, что доступ запрещён всем клиентам.
+// Возвращает ошибку, если подсеть задана некорректно.
+func NewTrustedSubnetChecker(cidr string) (*TrustedSubnetChecker, error) {
+	if cidr == "" {
+		return &TrustedSubnetChecker{}, nil
+	}
+
+	_, ipNet, err := net.ParseCIDR(cidr)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &TrustedSubnetChecker{TrustedSubnet: ipNet}, nil
+}
+
+// Middleware оборачивает HTTP-обработчик проверкой IP-адреса клиента.
+// Если адрес не входит в доверенную подсеть, возвращает статус 403 Forbidden.
+func (tc *TrustedSubnetChecker) Middleware(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !tc.IsTrusted(tc.ClientIP(r)) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+
+		h.ServeHTTP(w, r)
+	})
+}
+
+// IsTrusted проверяет, входит ли IP-адрес в доверенную подсеть.
+func (tc *TrustedSubnetChecker) IsTrusted(ip net.IP) bool {
+	if tc.TrustedSubnet == nil || ip == nil {
+		return false
+	}
+
+	return tc.TrustedSubnet.Contains(ip)
+}
+
+// ClientIP определяет IP-адрес клиента по адресу соединения. Заголовок X-Real-IP учитывается,
+// только если соединение установлено из доверенной подсети, то есть через прокси, перезаписывающий
+// заголовок. Иначе любой клиент мог бы подставить в заголовок адрес доверенной подсети.
+// Возвращает nil, если адрес соединения не является IP-адресом.
+func (tc *TrustedSubnetChecker) ClientIP(r *http.Request) net.IP {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	peerIP := net.ParseIP(host)
+
+	if realIP := strings.TrimSpace(r.Header.Get("X-Real-IP")); realIP != "" && tc.IsTrusted(peerIP) {
+		return net.ParseIP(realIP)
+	}
+
+	return peerIP
+}
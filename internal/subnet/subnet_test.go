@@ -0,0 +1,90 @@
+package subnet
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func okHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+}
+
+func TestNewTrustedSubnetChecker_InvalidCIDR(t *testing.T) {
+	checker, err := NewTrustedSubnetChecker("not-a-cidr")
+
+	assert.Error(t, err)
+	assert.Nil(t, checker)
+}
+
+func TestMiddleware_RealIPInSubnet(t *testing.T) {
+	checker, err := NewTrustedSubnetChecker("192.168.1.0/24")
+	assert.NoError(t, err)
+
+	req := httptest.NewRequest("GET", "/api/internal/stats", nil)
+	req.RemoteAddr = "192.168.1.1:54321"
+	req.Header.Set("X-Real-IP", "192.168.1.15")
+	w := httptest.NewRecorder()
+
+	checker.Middleware(okHandler()).ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestMiddleware_RealIPOutsideSubnet(t *testing.T) {
+	checker, err := NewTrustedSubnetChecker("192.168.1.0/24")
+	assert.NoError(t, err)
+
+	req := httptest.NewRequest("GET", "/api/internal/stats", nil)
+	req.RemoteAddr = "192.168.1.1:54321"
+	req.Header.Set("X-Real-IP", "10.0.0.1")
+	w := httptest.NewRecorder()
+
+	checker.Middleware(okHandler()).ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
+
+func TestMiddleware_RealIPFromUntrustedPeerIgnored(t *testing.T) {
+	checker, err := NewTrustedSubnetChecker("192.168.1.0/24")
+	assert.NoError(t, err)
+
+	req := httptest.NewRequest("GET", "/api/internal/stats", nil)
+	req.RemoteAddr = "203.0.113.7:54321"
+	req.Header.Set("X-Real-IP", "192.168.1.15")
+	w := httptest.NewRecorder()
+
+	checker.Middleware(okHandler()).ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusForbidden, w.Code, "Spoofed X-Real-IP from an untrusted peer should be ignored")
+}
+
+func TestMiddleware_RemoteAddrFallback(t *testing.T) {
+	checker, err := NewTrustedSubnetChecker("10.0.0.0/8")
+	assert.NoError(t, err)
+
+	req := httptest.NewRequest("GET", "/api/internal/stats", nil)
+	req.RemoteAddr = "10.1.2.3:54321"
+	w := httptest.NewRecorder()
+
+	checker.Middleware(okHandler()).ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestMiddleware_EmptySubnetForbidsAll(t *testing.T) {
+	checker, err := NewTrustedSubnetChecker("")
+	assert.NoError(t, err)
+
+	req := httptest.NewRequest("GET", "/api/internal/stats", nil)
+	req.Header.Set("X-Real-IP", "127.0.0.1")
+	w := httptest.NewRecorder()
+
+	checker.Middleware(okHandler()).ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
@@ -0,0 +1,233 @@
+package webhook
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sub3er0/urlShorteningService/internal/metadata"
+	"github.com/sub3er0/urlShorteningService/internal/repository"
+	"github.com/sub3er0/urlShorteningService/internal/storage"
+)
+
+const (
+	defaultLimit = 100
+	maxLimit     = 1000
+	secretSize   = 32
+)
+
+// Действия с вебхуками, сохраняемые в журнале действий администратора.
+const (
+	ActionCreate = "create_webhook"
+	ActionDelete = "delete_webhook"
+)
+
+// ErrInvalidWebhookURL указывает, что адрес вебхука не является абсолютным адресом http или https.
+var ErrInvalidWebhookURL = errors.New("webhook url must be an absolute http or https URL")
+
+// ErrUnknownEvent указывает, что в подписке вебхука указан неизвестный тип события.
+var ErrUnknownEvent = errors.New("unknown webhook event")
+
+// Handler обрабатывает запросы API управления вебхуками.
+// Один и тот же обработчик используется для вебхуков пользователей и администратора,
+// владелец вебхуков определяется функцией Owner.
+type Handler struct {
+	// Repository предоставляет доступ к вебхукам и журналу доставки.
+	Repository repository.WebhookRepositoryInterface
+
+	// Owner возвращает владельца вебхуков запроса.
+	// Пустое значение соответствует вебхукам администратора, получающим события всех пользователей.
+	Owner func(r *http.Request) string
+
+	// Audit сохраняет запись об изменении вебхуков. Если не задан, изменения не записываются.
+	Audit func(r *http.Request, action string, target string, details string)
+}
+
+// CreateRequestBody представляет тело запроса на создание вебхука.
+type CreateRequestBody struct {
+	URL    string   `json:"url"`              // Адрес, принимающий события.
+	Secret string   `json:"secret,omitempty"` // Ключ подписи, по умолчанию генерируется.
+	Events []string `json:"events,omitempty"` // Типы событий, по умолчанию все события, кроме переходов.
+}
+
+// ListWebhooks возвращает вебхуки владельца без секретов.
+func (h *Handler) ListWebhooks(w http.ResponseWriter, r *http.Request) {
+	webhooks, err := h.Repository.GetWebhooks(r.Context(), h.Owner(r))
+
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	if webhooks == nil {
+		webhooks = []storage.Webhook{}
+	}
+
+	for i := range webhooks {
+		webhooks[i].Secret = ""
+	}
+
+	writeJSON(w, http.StatusOK, webhooks)
+}
+
+// CreateWebhook создает вебхук и возвращает его вместе с секретом подписи.
+// Секрет возвращается только в ответе на создание.
+func (h *Handler) CreateWebhook(w http.ResponseWriter, r *http.Request) {
+	var requestBody CreateRequestBody
+
+	if err := json.NewDecoder(r.Body).Decode(&requestBody); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := validateWebhook(requestBody); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if requestBody.Secret == "" {
+		requestBody.Secret = randomHex(secretSize)
+	}
+
+	webhook, err := h.Repository.SaveWebhook(r.Context(), storage.Webhook{
+		UserID:    h.Owner(r),
+		URL:       requestBody.URL,
+		Secret:    requestBody.Secret,
+		Events:    requestBody.Events,
+		CreatedAt: time.Now().UTC(),
+	})
+
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	h.audit(r, ActionCreate, strconv.Itoa(webhook.ID), webhook.URL)
+	writeJSON(w, http.StatusCreated, webhook)
+}
+
+// DeleteWebhook удаляет вебхук владельца.
+func (h *Handler) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+
+	if err != nil {
+		http.Error(w, "Invalid webhook id", http.StatusBadRequest)
+		return
+	}
+
+	found, err := h.Repository.DeleteWebhook(r.Context(), h.Owner(r), id)
+
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	if !found {
+		http.Error(w, "NotFound", http.StatusNotFound)
+		return
+	}
+
+	h.audit(r, ActionDelete, strconv.Itoa(id), "")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetDeliveries возвращает последние доставки вебхука владельца.
+// Поддерживает параметр запроса limit.
+func (h *Handler) GetDeliveries(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+
+	if err != nil {
+		http.Error(w, "Invalid webhook id", http.StatusBadRequest)
+		return
+	}
+
+	limit := defaultLimit
+
+	if value := r.URL.Query().Get("limit"); value != "" {
+		limit, err = strconv.Atoi(value)
+
+		if err != nil || limit <= 0 || limit > maxLimit {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+	}
+
+	deliveries, err := h.Repository.GetDeliveries(r.Context(), h.Owner(r), id, limit)
+
+	if err != nil {
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	if deliveries == nil {
+		deliveries = []storage.WebhookDelivery{}
+	}
+
+	writeJSON(w, http.StatusOK, deliveries)
+}
+
+// audit сохраняет запись об изменении вебхуков, если задана функция Audit.
+func (h *Handler) audit(r *http.Request, action string, target string, details string) {
+	if h.Audit != nil {
+		h.Audit(r, action, target, details)
+	}
+}
+
+// validateWebhook проверяет адрес вебхука и типы событий подписки.
+// Адреса внутренних сетей отклоняются сразу, имена хостов проверяются при каждой доставке.
+func validateWebhook(requestBody CreateRequestBody) error {
+	webhookURL, err := url.ParseRequestURI(requestBody.URL)
+
+	if err != nil || (webhookURL.Scheme != "http" && webhookURL.Scheme != "https") || webhookURL.Host == "" {
+		return ErrInvalidWebhookURL
+	}
+
+	host := webhookURL.Hostname()
+
+	if ip, err := netip.ParseAddr(host); (err == nil && metadata.IsPrivate(ip)) || strings.EqualFold(host, "localhost") {
+		return metadata.ErrPrivateAddress
+	}
+
+	for _, event := range requestBody.Events {
+		if !knownEvent(event) {
+			return ErrUnknownEvent
+		}
+	}
+
+	return nil
+}
+
+// knownEvent проверяет, поддерживается ли тип события.
+func knownEvent(eventType string) bool {
+	for _, event := range events {
+		if event == eventType {
+			return true
+		}
+	}
+
+	return false
+}
+
+// writeJSON сериализует данные и записывает их в ответ с указанным статусом.
+func writeJSON(w http.ResponseWriter, status int, data interface{}) {
+	jsonData, err := json.Marshal(data)
+
+	if err != nil {
+		log.Printf("Serialization fail: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	if _, err = w.Write(jsonData); err != nil {
+		log.Printf("Write data error: %v", err)
+	}
+}
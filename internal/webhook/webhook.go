@@ -0,0 +1,316 @@
+package webhook
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/sub3er0/urlShorteningService/internal/metadata"
+	"github.com/sub3er0/urlShorteningService/internal/repository"
+	"github.com/sub3er0/urlShorteningService/internal/storage"
+)
+
+// Типы событий жизненного цикла ссылок.
+const (
+	EventLinkCreated = "link.created"
+	EventLinkUpdated = "link.updated"
+	EventLinkDeleted = "link.deleted"
+	EventLinkExpired = "link.expired"
+	EventLinkClicked = "link.clicked"
+)
+
+// Заголовки запроса доставки события.
+const (
+	EventHeader     = "X-Webhook-Event"
+	DeliveryHeader  = "X-Webhook-Delivery"
+	SignatureHeader = "X-Webhook-Signature"
+)
+
+const (
+	defaultMaxAttempts  = 8
+	defaultRetryDelay   = 30 * time.Second
+	defaultPollInterval = 5 * time.Second
+	maxRetryDelay       = 6 * time.Hour
+	deliveryBatchSize   = 100
+	requestTimeout      = 10 * time.Second
+	maxResponseSize     = 64 << 10
+)
+
+// events перечисляет поддерживаемые типы событий.
+var events = []string{EventLinkCreated, EventLinkUpdated, EventLinkDeleted, EventLinkExpired, EventLinkClicked}
+
+// EmitterInterface определяет метод публикации событий жизненного цикла ссылок.
+type EmitterInterface interface {
+	// Emit ставит событие ссылки пользователя в очередь доставки на подписанные вебхуки.
+	Emit(ctx context.Context, userID string, eventType string, data interface{})
+}
+
+// Event представляет тело события, отправляемого на вебхук.
+type Event struct {
+	ID        string      `json:"id"`         // Уникальный идентификатор события
+	Type      string      `json:"type"`       // Тип события
+	CreatedAt time.Time   `json:"created_at"` // Время возникновения события
+	Data      interface{} `json:"data"`       // Данные события
+}
+
+// LinkData представляет данные события ссылки.
+type LinkData struct {
+	ShortKey    string `json:"short_key"`              // Ключ короткой ссылки
+	ShortURL    string `json:"short_url,omitempty"`    // Полный короткий URL
+	OriginalURL string `json:"original_url,omitempty"` // Оригинальный URL
+	UserID      string `json:"user_id,omitempty"`      // Владелец ссылки
+}
+
+// Dispatcher ставит события в очередь доставки и отправляет их на вебхуки.
+// Неудачные доставки повторяются с экспоненциально растущей задержкой,
+// после MaxAttempts попыток доставка помечается неуспешной.
+type Dispatcher struct {
+	// Repository предоставляет доступ к вебхукам и очереди доставки.
+	Repository repository.WebhookRepositoryInterface
+
+	// Client отправляет запросы на вебхуки. Если не задан, используется клиент NewClient,
+	// запрещающий подключения к внутренним адресам.
+	Client *http.Client
+
+	// MaxAttempts задает максимальное количество попыток доставки события.
+	MaxAttempts int
+
+	// RetryDelay задает задержку перед второй попыткой, каждая следующая задержка удваивается.
+	RetryDelay time.Duration
+
+	// PollInterval задает период проверки очереди доставки.
+	PollInterval time.Duration
+}
+
+// Emit ставит событие в очередь доставки на вебхуки пользователя и администратора,
+// подписанные на этот тип события. Ошибки записываются в лог и не прерывают обработку запроса.
+func (d *Dispatcher) Emit(ctx context.Context, userID string, eventType string, data interface{}) {
+	webhooks, err := d.Repository.GetEventWebhooks(ctx, userID)
+
+	if err != nil {
+		log.Printf("Error while loading webhooks: %v", err)
+		return
+	}
+
+	now := time.Now().UTC()
+	var payload []byte
+	var deliveries []storage.WebhookDelivery
+
+	for _, webhook := range webhooks {
+		if !Subscribed(webhook, eventType) {
+			continue
+		}
+
+		if payload == nil {
+			payload, err = json.Marshal(Event{ID: randomHex(16), Type: eventType, CreatedAt: now, Data: data})
+
+			if err != nil {
+				log.Printf("Serialization fail: %v", err)
+				return
+			}
+		}
+
+		deliveries = append(deliveries, storage.WebhookDelivery{
+			WebhookID:     webhook.ID,
+			Event:         eventType,
+			Payload:       string(payload),
+			Status:        storage.DeliveryPending,
+			NextAttemptAt: now,
+			CreatedAt:     now,
+		})
+	}
+
+	if len(deliveries) == 0 {
+		return
+	}
+
+	if err = d.Repository.EnqueueDeliveries(ctx, deliveries); err != nil {
+		log.Printf("Error while enqueuing webhook deliveries: %v", err)
+	}
+}
+
+// Run периодически отправляет доставки из очереди до отмены контекста.
+func (d *Dispatcher) Run(ctx context.Context) {
+	pollInterval := d.PollInterval
+
+	if pollInterval <= 0 {
+		pollInterval = defaultPollInterval
+	}
+
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		d.DeliverDue(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// DeliverDue отправляет доставки, время попытки которых наступило.
+// Возвращает количество обработанных доставок.
+func (d *Dispatcher) DeliverDue(ctx context.Context) int {
+	deliveries, err := d.Repository.GetDueDeliveries(ctx, time.Now().UTC(), deliveryBatchSize)
+
+	if err != nil {
+		log.Printf("Error while loading webhook deliveries: %v", err)
+		return 0
+	}
+
+	for _, delivery := range deliveries {
+		d.deliver(ctx, delivery)
+	}
+
+	return len(deliveries)
+}
+
+// deliver выполняет попытку доставки и сохраняет её результат.
+func (d *Dispatcher) deliver(ctx context.Context, delivery storage.WebhookDelivery) {
+	var err error
+	delivery.Attempts++
+	delivery.ResponseStatus, err = d.send(ctx, delivery)
+
+	now := time.Now().UTC()
+	delivery.UpdatedAt = now
+
+	if err == nil {
+		delivery.Status = storage.DeliveryDelivered
+		delivery.LastError = ""
+	} else {
+		delivery.LastError = err.Error()
+
+		if delivery.Attempts >= d.maxAttempts() {
+			delivery.Status = storage.DeliveryFailed
+		} else {
+			delivery.NextAttemptAt = now.Add(d.retryDelay(delivery.Attempts))
+		}
+	}
+
+	if err = d.Repository.UpdateDelivery(ctx, delivery); err != nil {
+		log.Printf("Error while saving webhook delivery: %v", err)
+	}
+}
+
+// send отправляет подписанное событие на вебхук.
+// Возвращает HTTP статус ответа и ошибку, если статус не 2xx или запрос не выполнен.
+func (d *Dispatcher) send(ctx context.Context, delivery storage.WebhookDelivery) (int, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.WebhookURL, strings.NewReader(delivery.Payload))
+
+	if err != nil {
+		return 0, err
+	}
+
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set(EventHeader, delivery.Event)
+	request.Header.Set(DeliveryHeader, fmt.Sprint(delivery.ID))
+	request.Header.Set(SignatureHeader, Sign(delivery.WebhookSecret, []byte(delivery.Payload)))
+
+	client := d.Client
+
+	if client == nil {
+		client = NewClient()
+	}
+
+	response, err := client.Do(request)
+
+	if err != nil {
+		return 0, err
+	}
+
+	defer response.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(response.Body, maxResponseSize))
+
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return response.StatusCode, fmt.Errorf("unexpected response status %d", response.StatusCode)
+	}
+
+	return response.StatusCode, nil
+}
+
+// NewClient создает HTTP клиент доставки, который не подключается к внутренним адресам
+// и не следует перенаправлениям: ответ с перенаправлением считается неуспешной доставкой.
+func NewClient() *http.Client {
+	client := metadata.NewClient(requestTimeout)
+	client.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+
+	return client
+}
+
+// maxAttempts возвращает максимальное количество попыток доставки.
+func (d *Dispatcher) maxAttempts() int {
+	if d.MaxAttempts <= 0 {
+		return defaultMaxAttempts
+	}
+
+	return d.MaxAttempts
+}
+
+// retryDelay возвращает задержку перед следующей попыткой после заданного количества попыток.
+func (d *Dispatcher) retryDelay(attempts int) time.Duration {
+	delay := d.RetryDelay
+
+	if delay <= 0 {
+		delay = defaultRetryDelay
+	}
+
+	for i := 1; i < attempts && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+
+	if delay > maxRetryDelay {
+		delay = maxRetryDelay
+	}
+
+	return delay
+}
+
+// Subscribed проверяет, подписан ли вебхук на тип события.
+// Вебхук без списка событий получает все события, кроме переходов по ссылкам.
+func Subscribed(webhook storage.Webhook, eventType string) bool {
+	if len(webhook.Events) == 0 {
+		return eventType != EventLinkClicked
+	}
+
+	for _, event := range webhook.Events {
+		if event == eventType {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Sign возвращает подпись тела события в формате "sha256=<hex>",
+// вычисленную по алгоритму HMAC-SHA256 с секретом вебхука.
+func Sign(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// randomHex возвращает случайную строку из n байт в шестнадцатеричной записи.
+func randomHex(n int) string {
+	data := make([]byte, n)
+
+	if _, err := rand.Read(data); err != nil {
+		log.Printf("Error while generating random data: %v", err)
+	}
+
+	return hex.EncodeToString(data)
+}
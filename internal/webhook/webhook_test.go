@@ -0,0 +1,218 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/sub3er0/urlShorteningService/internal/metadata"
+	"github.com/sub3er0/urlShorteningService/internal/repository"
+	"github.com/sub3er0/urlShorteningService/internal/storage"
+)
+
+func newRepository() *repository.WebhookRepository {
+	return &repository.WebhookRepository{Storage: &storage.InMemoryStorage{}}
+}
+
+func TestSign(t *testing.T) {
+	assert.Equal(t,
+		"sha256=f7bc83f430538424b13298e6aa6fb143ef4d59a14946175997479dbc2d1a3cd8",
+		Sign("key", []byte("The quick brown fox jumps over the lazy dog")))
+}
+
+func TestSubscribed(t *testing.T) {
+	all := storage.Webhook{}
+	clicks := storage.Webhook{Events: []string{EventLinkClicked}}
+
+	assert.True(t, Subscribed(all, EventLinkCreated))
+	assert.False(t, Subscribed(all, EventLinkClicked), "clicks should be delivered only on explicit subscription")
+	assert.True(t, Subscribed(clicks, EventLinkClicked))
+	assert.False(t, Subscribed(clicks, EventLinkDeleted))
+}
+
+func TestDispatcher_DeliversSignedEvent(t *testing.T) {
+	ctx := context.Background()
+	var body []byte
+	var header http.Header
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = io.ReadAll(r.Body)
+		header = r.Header
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	repo := newRepository()
+	dispatcher := &Dispatcher{Repository: repo, Client: server.Client()}
+
+	owned, _ := repo.SaveWebhook(ctx, storage.Webhook{UserID: "user1", URL: server.URL, Secret: "secret"})
+	_, _ = repo.SaveWebhook(ctx, storage.Webhook{UserID: "user2", URL: server.URL, Secret: "other"})
+
+	dispatcher.Emit(ctx, "user1", EventLinkCreated, LinkData{ShortKey: "abc", UserID: "user1"})
+
+	assert.Equal(t, 1, dispatcher.DeliverDue(ctx), "only the owner's webhook should receive the event")
+	assert.Equal(t, Sign("secret", body), header.Get(SignatureHeader))
+	assert.Equal(t, EventLinkCreated, header.Get(EventHeader))
+
+	var event Event
+	require.NoError(t, json.Unmarshal(body, &event))
+	assert.Equal(t, EventLinkCreated, event.Type)
+	assert.NotEmpty(t, event.ID)
+
+	deliveries, _ := repo.GetDeliveries(ctx, "user1", owned.ID, 10)
+	require.Len(t, deliveries, 1)
+	assert.Equal(t, storage.DeliveryDelivered, deliveries[0].Status)
+	assert.Equal(t, http.StatusNoContent, deliveries[0].ResponseStatus)
+	assert.Equal(t, 0, dispatcher.DeliverDue(ctx), "delivered events should not be sent again")
+}
+
+func TestDispatcher_AdminWebhookReceivesAllUsers(t *testing.T) {
+	ctx := context.Background()
+	repo := newRepository()
+	dispatcher := &Dispatcher{Repository: repo}
+
+	admin, _ := repo.SaveWebhook(ctx, storage.Webhook{URL: "http://example.com/hook", Secret: "secret"})
+	dispatcher.Emit(ctx, "user1", EventLinkDeleted, LinkData{ShortKey: "abc"})
+
+	deliveries, _ := repo.GetDeliveries(ctx, "", admin.ID, 10)
+	assert.Len(t, deliveries, 1)
+}
+
+func TestDispatcher_RetriesWithBackoff(t *testing.T) {
+	ctx := context.Background()
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	repo := newRepository()
+	webhook, _ := repo.SaveWebhook(ctx, storage.Webhook{UserID: "user1", URL: server.URL, Secret: "secret"})
+	dispatcher := &Dispatcher{Repository: repo, Client: server.Client(), MaxAttempts: 2, RetryDelay: time.Hour}
+
+	dispatcher.Emit(ctx, "user1", EventLinkUpdated, LinkData{ShortKey: "abc"})
+	dispatcher.DeliverDue(ctx)
+
+	deliveries, _ := repo.GetDeliveries(ctx, "user1", webhook.ID, 10)
+	require.Len(t, deliveries, 1)
+	assert.Equal(t, storage.DeliveryPending, deliveries[0].Status)
+	assert.Equal(t, 1, deliveries[0].Attempts)
+	assert.Equal(t, http.StatusInternalServerError, deliveries[0].ResponseStatus)
+	assert.True(t, deliveries[0].NextAttemptAt.After(time.Now().Add(59*time.Minute)))
+	assert.Equal(t, 0, dispatcher.DeliverDue(ctx), "retry should wait for the backoff delay")
+
+	dispatcher.RetryDelay = time.Nanosecond
+	deliveries[0].NextAttemptAt = time.Now().UTC()
+	_ = repo.UpdateDelivery(ctx, deliveries[0])
+	dispatcher.DeliverDue(ctx)
+
+	deliveries, _ = repo.GetDeliveries(ctx, "user1", webhook.ID, 10)
+	assert.Equal(t, storage.DeliveryFailed, deliveries[0].Status, "delivery should fail after max attempts")
+	assert.Equal(t, 2, calls)
+}
+
+func TestDispatcher_RefusesPrivateAddresses(t *testing.T) {
+	ctx := context.Background()
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	repo := newRepository()
+	webhook, _ := repo.SaveWebhook(ctx, storage.Webhook{UserID: "user1", URL: server.URL, Secret: "secret"})
+	dispatcher := &Dispatcher{Repository: repo}
+
+	dispatcher.Emit(ctx, "user1", EventLinkCreated, LinkData{ShortKey: "abc"})
+	dispatcher.DeliverDue(ctx)
+
+	deliveries, _ := repo.GetDeliveries(ctx, "user1", webhook.ID, 10)
+	require.Len(t, deliveries, 1)
+	assert.Equal(t, storage.DeliveryPending, deliveries[0].Status)
+	assert.Contains(t, deliveries[0].LastError, metadata.ErrPrivateAddress.Error())
+	assert.Equal(t, 0, calls, "default client should not connect to loopback addresses")
+}
+
+func TestNewClient_DoesNotFollowRedirects(t *testing.T) {
+	client := NewClient()
+
+	request := httptest.NewRequest("POST", "http://example.com/hook", nil)
+	err := client.CheckRedirect(request, []*http.Request{request})
+	assert.ErrorIs(t, err, http.ErrUseLastResponse)
+}
+
+func TestDispatcher_RetryDelay(t *testing.T) {
+	dispatcher := &Dispatcher{RetryDelay: time.Second}
+
+	assert.Equal(t, time.Second, dispatcher.retryDelay(1))
+	assert.Equal(t, 4*time.Second, dispatcher.retryDelay(3))
+	assert.Equal(t, maxRetryDelay, dispatcher.retryDelay(100))
+}
+
+func TestHandler(t *testing.T) {
+	repo := newRepository()
+	owner := "user1"
+	var audited []string
+	handler := &Handler{
+		Repository: repo,
+		Owner:      func(*http.Request) string { return owner },
+		Audit: func(_ *http.Request, action string, target string, _ string) {
+			audited = append(audited, action+" "+target)
+		},
+	}
+
+	tests := []struct {
+		name string
+		body string
+	}{
+		{name: "invalid url", body: `{"url":"ftp://example.com"}`},
+		{name: "unknown event", body: `{"url":"https://example.com","events":["link.renamed"]}`},
+		{name: "loopback", body: `{"url":"http://127.0.0.1:8080/hook"}`},
+		{name: "cloud metadata", body: `{"url":"http://169.254.169.254/latest/meta-data"}`},
+		{name: "localhost", body: `{"url":"http://localhost/hook"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			handler.CreateWebhook(w, httptest.NewRequest("POST", "/api/user/webhooks", bytes.NewBufferString(tt.body)))
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+		})
+	}
+
+	w := httptest.NewRecorder()
+	handler.CreateWebhook(w, httptest.NewRequest("POST", "/api/user/webhooks",
+		bytes.NewBufferString(`{"url":"https://example.com/hook","events":["link.clicked"]}`)))
+	require.Equal(t, http.StatusCreated, w.Code)
+
+	var created storage.Webhook
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	assert.NotEmpty(t, created.Secret, "secret should be generated and returned on creation")
+
+	w = httptest.NewRecorder()
+	handler.ListWebhooks(w, httptest.NewRequest("GET", "/api/user/webhooks", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), created.Secret, "list should not expose secrets")
+
+	owner = "user2"
+	req := httptest.NewRequest("DELETE", "/api/user/webhooks/1", nil)
+	req.SetPathValue("id", "1")
+	w = httptest.NewRecorder()
+	handler.DeleteWebhook(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code, "webhooks of another user should not be deleted")
+
+	owner = "user1"
+	w = httptest.NewRecorder()
+	handler.DeleteWebhook(w, req)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, []string{"create_webhook 1", "delete_webhook 1"}, audited)
+}